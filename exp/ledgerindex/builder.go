@@ -0,0 +1,218 @@
+package ledgerindex
+
+import (
+	"io"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// Builder adds ledgers to an index. Ledgers are kept in memory until Flush is
+// called. Builder is not thread-safe.
+type Builder struct {
+	backend historyarchive.ArchiveBackend
+	meta    Meta
+	pending map[string][]uint32
+}
+
+// NewBuilder returns a Builder writing the index to the given backend. If the
+// backend already contains an index, granularity and checkpointFrequency must
+// match it and new ledgers are appended after the last indexed ledger.
+func NewBuilder(
+	backend historyarchive.ArchiveBackend,
+	granularity Granularity,
+	checkpointFrequency uint32,
+) (*Builder, error) {
+	exists, meta, err := readMeta(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		meta = Meta{
+			Version:             indexVersion,
+			Granularity:         granularity,
+			CheckpointFrequency: checkpointFrequency,
+		}
+		if err = meta.validate(); err != nil {
+			return nil, err
+		}
+	} else if meta.Granularity != granularity || meta.CheckpointFrequency != checkpointFrequency {
+		return nil, errors.Errorf(
+			"existing index has different granularity or checkpoint frequency (granularity=%s checkpoint frequency=%d)",
+			meta.Granularity,
+			meta.CheckpointFrequency,
+		)
+	}
+
+	return &Builder{
+		backend: backend,
+		meta:    meta,
+		pending: map[string][]uint32{},
+	}, nil
+}
+
+// Meta returns the meta of the index including ledgers added but not flushed.
+func (b *Builder) Meta() Meta {
+	return b.meta
+}
+
+// AddLedger adds the accounts and assets participating in transactions of
+// the given ledger to the index. Ledgers must be added in order and, once
+// the index is not empty, without gaps.
+func (b *Builder) AddLedger(networkPassphrase string, ledger xdr.LedgerCloseMeta) error {
+	sequence := ledger.LedgerSequence()
+	if b.meta.To != 0 && sequence != b.meta.To+1 {
+		return errors.Errorf(
+			"ledger %d does not follow the last indexed ledger %d",
+			sequence,
+			b.meta.To,
+		)
+	}
+
+	reader, err := ingest.NewLedgerTransactionReaderFromLedgerCloseMeta(networkPassphrase, ledger)
+	if err != nil {
+		return errors.Wrapf(err, "error creating transaction reader for ledger %d", sequence)
+	}
+	defer reader.Close()
+
+	unit := b.meta.unit(sequence)
+	for {
+		tx, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Wrapf(err, "error reading transaction in ledger %d", sequence)
+		}
+
+		keys, err := TransactionKeys(tx)
+		if err != nil {
+			return errors.Wrapf(err, "error indexing transaction %d in ledger %d", tx.Index, sequence)
+		}
+		for _, key := range keys {
+			units := b.pending[key]
+			if len(units) == 0 || units[len(units)-1] != unit {
+				b.pending[key] = append(units, unit)
+			}
+		}
+	}
+
+	if b.meta.From == 0 {
+		b.meta.From = sequence
+	}
+	b.meta.To = sequence
+	return nil
+}
+
+// Flush merges the ledgers added since the last Flush into the index stored
+// in the backend. The index meta is updated last so an interrupted Flush can
+// be retried by adding the ledgers again.
+func (b *Builder) Flush() error {
+	shards := map[int][]string{}
+	for key := range b.pending {
+		number := shardOf(key)
+		shards[number] = append(shards[number], key)
+	}
+
+	for number, keys := range shards {
+		s, err := readShard(b.backend, number)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			s[key] = mergeUnits(s[key], b.pending[key])
+		}
+		if err = writeShard(b.backend, number, s); err != nil {
+			return err
+		}
+	}
+
+	if err := writeMeta(b.backend, b.meta); err != nil {
+		return err
+	}
+	b.pending = map[string][]uint32{}
+	return nil
+}
+
+// TransactionKeys returns the index keys of all accounts and assets
+// participating in the transaction (see AccountKey and AssetKey).
+func TransactionKeys(tx ingest.LedgerTransaction) ([]string, error) {
+	participants, err := tx.Participants()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting participants")
+	}
+
+	keys := map[string]struct{}{}
+	for _, participant := range participants {
+		keys[AccountKey(participant.Address())] = struct{}{}
+	}
+
+	addAsset := func(asset xdr.Asset) {
+		if asset.Type != xdr.AssetTypeAssetTypeNative {
+			keys[AssetKey(asset)] = struct{}{}
+		}
+	}
+
+	for _, op := range tx.Envelope.Operations() {
+		for _, asset := range operationAssets(op) {
+			addAsset(asset)
+		}
+	}
+
+	// Legacy meta does not contain changes
+	if tx.Meta.V != 0 {
+		changes, err := tx.GetChanges()
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting changes")
+		}
+		for _, change := range changes {
+			entry := change.Post
+			if entry == nil {
+				entry = change.Pre
+			}
+			for _, asset := range entryAssets(entry) {
+				addAsset(asset)
+			}
+		}
+	}
+
+	result := make([]string, 0, len(keys))
+	for key := range keys {
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+func operationAssets(op xdr.Operation) []xdr.Asset {
+	switch op.Body.Type {
+	case xdr.OperationTypePayment:
+		return []xdr.Asset{op.Body.MustPaymentOp().Asset}
+	case xdr.OperationTypePathPaymentStrictReceive:
+		body := op.Body.MustPathPaymentStrictReceiveOp()
+		return append([]xdr.Asset{body.SendAsset, body.DestAsset}, body.Path...)
+	case xdr.OperationTypePathPaymentStrictSend:
+		body := op.Body.MustPathPaymentStrictSendOp()
+		return append([]xdr.Asset{body.SendAsset, body.DestAsset}, body.Path...)
+	case xdr.OperationTypeClawback:
+		return []xdr.Asset{op.Body.MustClawbackOp().Asset}
+	}
+	return nil
+}
+
+func entryAssets(entry *xdr.LedgerEntry) []xdr.Asset {
+	if entry == nil {
+		return nil
+	}
+	switch entry.Data.Type {
+	case xdr.LedgerEntryTypeTrustline:
+		return []xdr.Asset{entry.Data.MustTrustLine().Asset}
+	case xdr.LedgerEntryTypeOffer:
+		offer := entry.Data.MustOffer()
+		return []xdr.Asset{offer.Selling, offer.Buying}
+	case xdr.LedgerEntryTypeClaimableBalance:
+		return []xdr.Asset{entry.Data.MustClaimableBalance().Asset}
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+// Package ledgerindex builds and reads a compact index of the ledgers in which
+// accounts and assets participated. The index lets a light client fetch only
+// the ledgers relevant to an account from a meta archive or Captive
+// Stellar-Core instead of processing the entire history.
+//
+// The index is stored in an ArchiveBackend (a directory, S3 bucket, etc.) in
+// the following layout:
+//
+//   ledger-index/index.json        - Meta describing the index
+//   ledger-index/shards/xx.idx.gz  - 256 shards of the index
+//
+// Keys are assigned to shards using the first byte of the SHA-256 hash of the
+// key so a lookup reads a single shard. A shard contains a sorted list of
+// keys, each followed by a sorted list of ledgers (or checkpoints) encoded as
+// varint deltas.
+package ledgerindex
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+const (
+	indexDirectory = "ledger-index"
+	indexMetaPath  = indexDirectory + "/index.json"
+	indexVersion   = 1
+	shardCount     = 256
+)
+
+// Granularity defines what is stored in the index for every key: all ledgers
+// in which a key participated or only checkpoints containing such ledgers.
+// Checkpoint granularity makes the index much smaller at the cost of fetching
+// up to a checkpoint of ledgers for every entry.
+type Granularity string
+
+const (
+	// LedgerGranularity indexes ledgers.
+	LedgerGranularity Granularity = "ledger"
+	// CheckpointGranularity indexes checkpoints.
+	CheckpointGranularity Granularity = "checkpoint"
+)
+
+// Meta describes an index.
+type Meta struct {
+	Version             int         `json:"version"`
+	Granularity         Granularity `json:"granularity"`
+	CheckpointFrequency uint32      `json:"checkpoint_frequency"`
+	// From and To is the range of indexed ledgers. Both are 0 in an empty
+	// index.
+	From uint32 `json:"from"`
+	To   uint32 `json:"to"`
+}
+
+// AccountKey returns the index key of the account with the given address.
+func AccountKey(address string) string {
+	return "account:" + address
+}
+
+// AssetKey returns the index key of the given asset. The native asset is not
+// indexed.
+func AssetKey(asset xdr.Asset) string {
+	return "asset:" + asset.StringCanonical()
+}
+
+// unit converts ledger sequence to the value stored in the index.
+func (m Meta) unit(sequence uint32) uint32 {
+	if m.Granularity == CheckpointGranularity {
+		return sequence / m.CheckpointFrequency
+	}
+	return sequence
+}
+
+// unitRange returns the range of ledgers represented by the value stored in
+// the index.
+func (m Meta) unitRange(unit uint32) (uint32, uint32) {
+	if m.Granularity == CheckpointGranularity {
+		low := unit * m.CheckpointFrequency
+		if low == 0 {
+			low = 1
+		}
+		return low, unit*m.CheckpointFrequency + m.CheckpointFrequency - 1
+	}
+	return unit, unit
+}
+
+func (m Meta) validate() error {
+	if m.Version != indexVersion {
+		return errors.Errorf("unsupported index version %d", m.Version)
+	}
+	switch m.Granularity {
+	case LedgerGranularity:
+	case CheckpointGranularity:
+		if m.CheckpointFrequency == 0 {
+			return errors.New("checkpoint frequency is not set")
+		}
+	default:
+		return errors.Errorf("unknown granularity %q", m.Granularity)
+	}
+	return nil
+}
+
+func readMeta(backend historyarchive.ArchiveBackend) (bool, Meta, error) {
+	exists, err := backend.Exists(indexMetaPath)
+	if err != nil {
+		return false, Meta{}, errors.Wrapf(err, "error checking if %s exists", indexMetaPath)
+	}
+	if !exists {
+		return false, Meta{}, nil
+	}
+
+	reader, err := backend.GetFile(indexMetaPath)
+	if err != nil {
+		return false, Meta{}, errors.Wrapf(err, "error reading %s", indexMetaPath)
+	}
+	defer reader.Close()
+
+	var meta Meta
+	if err = json.NewDecoder(reader).Decode(&meta); err != nil {
+		return false, Meta{}, errors.Wrapf(err, "error decoding %s", indexMetaPath)
+	}
+	if err = meta.validate(); err != nil {
+		return false, Meta{}, errors.Wrapf(err, "invalid %s", indexMetaPath)
+	}
+	return true, meta, nil
+}
+
+func writeMeta(backend historyarchive.ArchiveBackend, meta Meta) error {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling index meta")
+	}
+	if err = backend.PutFile(indexMetaPath, ioutil.NopCloser(bytes.NewReader(content))); err != nil {
+		return errors.Wrapf(err, "error writing %s", indexMetaPath)
+	}
+	return nil
+}
+
+func shardOf(key string) int {
+	hash := sha256.Sum256([]byte(key))
+	return int(hash[0])
+}
+
+func shardPath(shard int) string {
+	return path.Join(indexDirectory, "shards", fmt.Sprintf("%02x.idx.gz", shard))
+}
+
+// shard maps keys to sorted lists of units.
+type shard map[string][]uint32
+
+func readShard(backend historyarchive.ArchiveBackend, number int) (shard, error) {
+	filePath := shardPath(number)
+	exists, err := backend.Exists(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error checking if %s exists", filePath)
+	}
+	if !exists {
+		return shard{}, nil
+	}
+
+	reader, err := backend.GetFile(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filePath)
+	}
+	defer reader.Close()
+
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filePath)
+	}
+	defer gzipReader.Close()
+
+	result, err := decodeShard(bufio.NewReader(gzipReader))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decoding %s", filePath)
+	}
+	return result, nil
+}
+
+func writeShard(backend historyarchive.ArchiveBackend, number int, s shard) error {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	if err := s.encode(gzipWriter); err != nil {
+		return errors.Wrap(err, "error encoding shard")
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return errors.Wrap(err, "error compressing shard")
+	}
+
+	filePath := shardPath(number)
+	if err := backend.PutFile(filePath, ioutil.NopCloser(&buf)); err != nil {
+		return errors.Wrapf(err, "error writing %s", filePath)
+	}
+	return nil
+}
+
+func (s shard) encode(w io.Writer) error {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writer := bufio.NewWriter(w)
+	varint := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(v uint64) error {
+		n := binary.PutUvarint(varint, v)
+		_, err := writer.Write(varint[:n])
+		return err
+	}
+
+	for _, key := range keys {
+		units := s[key]
+		if err := writeUvarint(uint64(len(key))); err != nil {
+			return err
+		}
+		if _, err := writer.WriteString(key); err != nil {
+			return err
+		}
+		if err := writeUvarint(uint64(len(units))); err != nil {
+			return err
+		}
+		previous := uint32(0)
+		for _, unit := range units {
+			if err := writeUvarint(uint64(unit - previous)); err != nil {
+				return err
+			}
+			previous = unit
+		}
+	}
+	return writer.Flush()
+}
+
+func decodeShard(r *bufio.Reader) (shard, error) {
+	result := shard{}
+	for {
+		keyLength, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		key := make([]byte, keyLength)
+		if _, err = io.ReadFull(r, key); err != nil {
+			return nil, err
+		}
+
+		count, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		units := make([]uint32, 0, count)
+		previous := uint32(0)
+		for i := uint64(0); i < count; i++ {
+			delta, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			previous += uint32(delta)
+			units = append(units, previous)
+		}
+		result[string(key)] = units
+	}
+}
+
+// mergeUnits merges two sorted lists of units removing duplicates.
+func mergeUnits(a, b []uint32) []uint32 {
+	result := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var next uint32
+		switch {
+		case j == len(b) || (i < len(a) && a[i] < b[j]):
+			next = a[i]
+			i++
+		case i == len(a) || b[j] < a[i]:
+			next = b[j]
+			j++
+		default:
+			next = a[i]
+			i++
+			j++
+		}
+		if len(result) == 0 || result[len(result)-1] != next {
+			result = append(result, next)
+		}
+	}
+	return result
+}
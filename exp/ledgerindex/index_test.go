@@ -0,0 +1,238 @@
+package ledgerindex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+)
+
+var (
+	alice  = keypair.MustRandom().Address()
+	bob    = keypair.MustRandom().Address()
+	carol  = keypair.MustRandom().Address()
+	usd    = xdr.MustNewCreditAsset("USD", carol)
+	native = xdr.MustNewNativeAsset()
+)
+
+type payment struct {
+	from, to string
+	asset    xdr.Asset
+}
+
+func testLedger(t *testing.T, sequence uint32, payments ...payment) xdr.LedgerCloseMeta {
+	ledger := xdr.LedgerCloseMeta{
+		V0: &xdr.LedgerCloseMetaV0{
+			LedgerHeader: xdr.LedgerHeaderHistoryEntry{
+				Header: xdr.LedgerHeader{
+					LedgerSeq:     xdr.Uint32(sequence),
+					LedgerVersion: 14,
+				},
+			},
+		},
+	}
+
+	for i, p := range payments {
+		envelope := xdr.TransactionEnvelope{
+			Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+			V1: &xdr.TransactionV1Envelope{
+				Tx: xdr.Transaction{
+					Fee:           100,
+					SourceAccount: xdr.MustMuxedAddress(p.from),
+					SeqNum:        xdr.SequenceNumber(i + 1),
+					Operations: []xdr.Operation{
+						{
+							Body: xdr.OperationBody{
+								Type: xdr.OperationTypePayment,
+								PaymentOp: &xdr.PaymentOp{
+									Destination: xdr.MustMuxedAddress(p.to),
+									Asset:       p.asset,
+									Amount:      10,
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		hash, err := network.HashTransactionInEnvelope(envelope, network.TestNetworkPassphrase)
+		require.NoError(t, err)
+
+		ledger.V0.TxSet.Txs = append(ledger.V0.TxSet.Txs, envelope)
+		ledger.V0.TxProcessing = append(ledger.V0.TxProcessing, xdr.TransactionResultMeta{
+			Result: xdr.TransactionResultPair{TransactionHash: hash},
+			TxApplyProcessing: xdr.TransactionMeta{
+				V:  1,
+				V1: &xdr.TransactionMetaV1{},
+			},
+		})
+	}
+	return ledger
+}
+
+func testLedgers(t *testing.T) []xdr.LedgerCloseMeta {
+	return []xdr.LedgerCloseMeta{
+		testLedger(t, 62, payment{alice, bob, native}),
+		testLedger(t, 63),
+		testLedger(t, 64, payment{bob, carol, usd}),
+		testLedger(t, 65, payment{alice, carol, native}),
+		testLedger(t, 200, payment{carol, alice, usd}),
+	}
+}
+
+func buildIndex(t *testing.T, granularity Granularity, ledgers []xdr.LedgerCloseMeta) historyarchive.ArchiveBackend {
+	backend, err := historyarchive.ConnectBackend("mock://test", historyarchive.ConnectOptions{})
+	require.NoError(t, err)
+
+	builder, err := NewBuilder(backend, granularity, 64)
+	require.NoError(t, err)
+	for _, ledger := range ledgers {
+		require.NoError(t, builder.AddLedger(network.TestNetworkPassphrase, ledger))
+	}
+	require.NoError(t, builder.Flush())
+	return backend
+}
+
+func TestLookupLedgerGranularity(t *testing.T) {
+	ledgers := testLedgers(t)
+	// Index ledgers without gaps
+	ledgers = ledgers[:4]
+	backend := buildIndex(t, LedgerGranularity, ledgers)
+
+	reader, err := NewReader(backend)
+	require.NoError(t, err)
+	assert.Equal(t, Meta{
+		Version:             indexVersion,
+		Granularity:         LedgerGranularity,
+		CheckpointFrequency: 64,
+		From:                62,
+		To:                  65,
+	}, reader.Meta())
+
+	for _, testCase := range []struct {
+		key      string
+		expected []ledgerbackend.Range
+	}{
+		{AccountKey(alice), []ledgerbackend.Range{ledgerbackend.BoundedRange(62, 62), ledgerbackend.BoundedRange(65, 65)}},
+		{AccountKey(bob), []ledgerbackend.Range{ledgerbackend.BoundedRange(62, 62), ledgerbackend.BoundedRange(64, 64)}},
+		{AccountKey(carol), []ledgerbackend.Range{ledgerbackend.BoundedRange(64, 65)}},
+		{AssetKey(usd), []ledgerbackend.Range{ledgerbackend.BoundedRange(64, 64)}},
+		{AssetKey(native), nil},
+		{AccountKey(keypair.MustRandom().Address()), nil},
+	} {
+		ranges, err := reader.Lookup(testCase.key)
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected, ranges, testCase.key)
+	}
+}
+
+func TestLookupCheckpointGranularity(t *testing.T) {
+	ledgers := testLedgers(t)
+	backend, err := historyarchive.ConnectBackend("mock://test", historyarchive.ConnectOptions{})
+	require.NoError(t, err)
+
+	// Add ledgers in two batches to check that flushes are merged
+	builder, err := NewBuilder(backend, CheckpointGranularity, 64)
+	require.NoError(t, err)
+	for _, ledger := range ledgers[:3] {
+		require.NoError(t, builder.AddLedger(network.TestNetworkPassphrase, ledger))
+	}
+	require.NoError(t, builder.Flush())
+
+	builder, err = NewBuilder(backend, CheckpointGranularity, 64)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(64), builder.Meta().To)
+	require.NoError(t, builder.AddLedger(network.TestNetworkPassphrase, ledgers[3]))
+	// Gaps are not allowed
+	assert.EqualError(
+		t,
+		builder.AddLedger(network.TestNetworkPassphrase, ledgers[4]),
+		"ledger 200 does not follow the last indexed ledger 65",
+	)
+	for seq := uint32(66); seq <= 200; seq++ {
+		ledger := testLedger(t, seq)
+		if seq == 200 {
+			ledger = ledgers[4]
+		}
+		require.NoError(t, builder.AddLedger(network.TestNetworkPassphrase, ledger))
+	}
+	require.NoError(t, builder.Flush())
+
+	reader, err := NewReader(backend)
+	require.NoError(t, err)
+
+	for _, testCase := range []struct {
+		key      string
+		expected []ledgerbackend.Range
+	}{
+		// Ranges are clamped to the indexed ledgers and adjacent checkpoints
+		// are merged
+		{AccountKey(alice), []ledgerbackend.Range{ledgerbackend.BoundedRange(62, 127), ledgerbackend.BoundedRange(192, 200)}},
+		{AccountKey(bob), []ledgerbackend.Range{ledgerbackend.BoundedRange(62, 127)}},
+		{AssetKey(usd), []ledgerbackend.Range{ledgerbackend.BoundedRange(64, 127), ledgerbackend.BoundedRange(192, 200)}},
+	} {
+		ranges, err := reader.Lookup(testCase.key)
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected, ranges, testCase.key)
+	}
+}
+
+func TestNewBuilderMismatch(t *testing.T) {
+	backend := buildIndex(t, LedgerGranularity, testLedgers(t)[:1])
+
+	_, err := NewBuilder(backend, CheckpointGranularity, 64)
+	assert.EqualError(t, err, "existing index has different granularity or checkpoint frequency (granularity=ledger checkpoint frequency=64)")
+
+	_, err = NewBuilder(backend, Granularity("day"), 64)
+	assert.Error(t, err)
+
+	empty, err := historyarchive.ConnectBackend("mock://test", historyarchive.ConnectOptions{})
+	require.NoError(t, err)
+	_, err = NewBuilder(empty, Granularity("day"), 64)
+	assert.EqualError(t, err, `unknown granularity "day"`)
+	_, err = NewReader(empty)
+	assert.EqualError(t, err, "index not found (ledger-index/index.json does not exist)")
+}
+
+func TestAccountTransactions(t *testing.T) {
+	ledgers := testLedgers(t)[:4]
+	indexBackend := buildIndex(t, LedgerGranularity, ledgers)
+	reader, err := NewReader(indexBackend)
+	require.NoError(t, err)
+
+	backend := &ledgerbackend.MockDatabaseBackend{}
+	for _, sequence := range []uint32{62, 65} {
+		ledgerRange := ledgerbackend.SingleLedgerRange(sequence)
+		backend.On("IsPrepared", ledgerRange).Return(true, nil).Once()
+		backend.On("GetLedger", sequence).Return(true, ledgers[sequence-62], nil).Once()
+	}
+
+	var found []uint32
+	err = reader.AccountTransactions(
+		context.Background(),
+		backend,
+		network.TestNetworkPassphrase,
+		alice,
+		func(header xdr.LedgerHeaderHistoryEntry, tx ingest.LedgerTransaction) error {
+			found = append(found, uint32(header.Header.LedgerSeq))
+			return nil
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{62, 65}, found)
+	backend.AssertExpectations(t)
+}
+
+func TestMergeUnits(t *testing.T) {
+	assert.Equal(t, []uint32{1, 2, 3, 5, 8}, mergeUnits([]uint32{1, 3, 5}, []uint32{2, 3, 8}))
+	assert.Equal(t, []uint32{4}, mergeUnits(nil, []uint32{4}))
+	assert.Equal(t, []uint32{}, mergeUnits(nil, nil))
+}
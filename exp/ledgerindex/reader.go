@@ -0,0 +1,134 @@
+package ledgerindex
+
+import (
+	"context"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// Reader looks up keys in an index. Reader is thread-safe.
+type Reader struct {
+	backend historyarchive.ArchiveBackend
+	meta    Meta
+}
+
+// NewReader returns a Reader of the index stored in the given backend.
+func NewReader(backend historyarchive.ArchiveBackend) (*Reader, error) {
+	exists, meta, err := readMeta(backend)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.Errorf("index not found (%s does not exist)", indexMetaPath)
+	}
+	return &Reader{backend: backend, meta: meta}, nil
+}
+
+// Meta returns the meta of the index.
+func (r *Reader) Meta() Meta {
+	return r.meta
+}
+
+// Lookup returns the ranges of ledgers in which the key participated. For
+// CheckpointGranularity indexes every range covers whole checkpoints so it
+// also contains ledgers in which the key did not participate. Adjacent ranges
+// are merged and ranges are clamped to the indexed range.
+func (r *Reader) Lookup(key string) ([]ledgerbackend.Range, error) {
+	s, err := readShard(r.backend, shardOf(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var ranges []ledgerbackend.Range
+	for _, unit := range s[key] {
+		from, to := r.meta.unitRange(unit)
+		if from < r.meta.From {
+			from = r.meta.From
+		}
+		if to > r.meta.To {
+			to = r.meta.To
+		}
+		if from > to {
+			continue
+		}
+
+		if last := len(ranges) - 1; last >= 0 && ranges[last].To()+1 == from {
+			ranges[last] = ledgerbackend.BoundedRange(ranges[last].From(), to)
+			continue
+		}
+		ranges = append(ranges, ledgerbackend.BoundedRange(from, to))
+	}
+	return ranges, nil
+}
+
+// AccountTransactions streams all transactions in which the account
+// participated from the given backend (ex. a meta archive or Captive
+// Stellar-Core) fetching only the ledgers found in the index.
+func (r *Reader) AccountTransactions(
+	ctx context.Context,
+	backend ledgerbackend.LedgerBackend,
+	networkPassphrase string,
+	address string,
+	handler ingest.TransactionHandler,
+) error {
+	key := AccountKey(address)
+	return r.transactions(ctx, backend, networkPassphrase, key, handler)
+}
+
+// AssetTransactions streams all transactions in which the asset participated
+// from the given backend fetching only the ledgers found in the index.
+func (r *Reader) AssetTransactions(
+	ctx context.Context,
+	backend ledgerbackend.LedgerBackend,
+	networkPassphrase string,
+	asset xdr.Asset,
+	handler ingest.TransactionHandler,
+) error {
+	key := AssetKey(asset)
+	return r.transactions(ctx, backend, networkPassphrase, key, handler)
+}
+
+func (r *Reader) transactions(
+	ctx context.Context,
+	backend ledgerbackend.LedgerBackend,
+	networkPassphrase string,
+	key string,
+	handler ingest.TransactionHandler,
+) error {
+	ranges, err := r.Lookup(key)
+	if err != nil {
+		return err
+	}
+
+	for _, ledgerRange := range ranges {
+		stream, err := ingest.NewLedgerStream(ingest.LedgerStreamConfig{
+			Backend:           backend,
+			NetworkPassphrase: networkPassphrase,
+			Range:             ledgerRange,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = stream.StreamTransactions(ctx, func(header xdr.LedgerHeaderHistoryEntry, tx ingest.LedgerTransaction) error {
+			keys, err := TransactionKeys(tx)
+			if err != nil {
+				return errors.Wrapf(err, "error indexing transaction %d in ledger %d", tx.Index, header.Header.LedgerSeq)
+			}
+			for _, txKey := range keys {
+				if txKey == key {
+					return handler(header, tx)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error streaming ledgers %s", ledgerRange.String())
+		}
+	}
+	return nil
+}
@@ -17,8 +17,15 @@ var (
 	// ErrMissingPrepareRange is returned when attempting an operation before PrepareRange has finished
 	// running
 	ErrPrepareRangeNotReady = errors.New("PrepareRange operation is not yet complete")
+	// ErrStatusNotSupported is returned by Status when the ledger backend does
+	// not report its status
+	ErrStatusNotSupported = errors.New("ledger backend does not report status")
 )
 
+type statusReporter interface {
+	Status(ctx context.Context) ledgerbackend.CaptiveCoreStatus
+}
+
 type rangeRequest struct {
 	ledgerRange   ledgerbackend.Range
 	startTime     time.Time
@@ -179,3 +186,13 @@ func (c *CaptiveCoreAPI) GetLedger(sequence uint32) (ledgerbackend.LedgerRespons
 		Ledger:  ledgerbackend.Base64Ledger(ledger),
 	}, err
 }
+
+// Status returns the status of the captive core instance. Unlike other
+// operations it does not wait for PrepareRange or GetLedger calls in progress.
+func (c *CaptiveCoreAPI) Status(ctx context.Context) (ledgerbackend.CaptiveCoreStatus, error) {
+	reporter, ok := c.core.(statusReporter)
+	if !ok {
+		return ledgerbackend.CaptiveCoreStatus{}, ErrStatusNotSupported
+	}
+	return reporter.Status(ctx), nil
+}
@@ -43,6 +43,11 @@ func Handler(api CaptiveCoreAPI) http.Handler {
 		serializeResponse(api.log, w, r, response, err)
 	})
 
+	mux.Get("/status", func(w http.ResponseWriter, r *http.Request) {
+		response, err := api.Status(r.Context())
+		serializeResponse(api.log, w, r, response, err)
+	})
+
 	mux.Get("/ledger/{sequence}", func(w http.ResponseWriter, r *http.Request) {
 		req := GetLedgerRequest{}
 		if err := httpdecode.Decode(r, &req); err != nil {
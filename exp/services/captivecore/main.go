@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"go/types"
+	"net/http"
 	"strings"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -24,6 +27,7 @@ func main() {
 	var historyArchiveURLs []string
 	var stellarCoreHTTPPort uint
 	var checkpointFrequency uint32
+	var maxRestarts int
 	var logLevel logrus.Level
 	logger := supportlog.New()
 
@@ -112,6 +116,14 @@ func main() {
 			Required:    false,
 			Usage:       "establishes how many ledgers exist between checkpoints, do NOT change this unless you really know what you are doing",
 		},
+		&config.ConfigOption{
+			Name:        "max-restarts",
+			ConfigKey:   &maxRestarts,
+			OptType:     types.Int,
+			FlagDefault: 3,
+			Required:    false,
+			Usage:       "maximum number of consecutive restarts of Stellar Core after it exits unexpectedly (0 disables restarts)",
+		},
 	}
 	cmd := &cobra.Command{
 		Use:   "captivecore",
@@ -128,6 +140,7 @@ func main() {
 				HistoryArchiveURLs:  historyArchiveURLs,
 				CheckpointFrequency: checkpointFrequency,
 				HTTPPort:            stellarCoreHTTPPort,
+				MaxRestarts:         maxRestarts,
 				Log:                 logger.WithField("subservice", "stellar-core"),
 			}
 
@@ -147,9 +160,19 @@ func main() {
 			}
 			api := internal.NewCaptiveCoreAPI(core, logger.WithField("subservice", "api"))
 
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(
+				prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+				prometheus.NewGoCollector(),
+				ledgerbackend.NewCaptiveCoreCollector(core, "captivecore", ""),
+			)
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+			mux.Handle("/", internal.Handler(api))
+
 			supporthttp.Run(supporthttp.Config{
 				ListenAddr: fmt.Sprintf(":%d", port),
-				Handler:    internal.Handler(api),
+				Handler:    mux,
 				OnStarting: func() {
 					logger.Infof("Starting Captive Core server on %v", port)
 				},
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/stellar/go/exp/ledgerindex"
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/support/log"
+	"github.com/stellar/go/xdr"
+)
+
+type buildOptions struct {
+	indexURL            string
+	metaArchiveURL      string
+	binaryPath          string
+	configAppendPath    string
+	historyArchiveURLs  string
+	networkPassphrase   string
+	granularity         string
+	checkpointFrequency uint32
+	start               uint32
+	end                 uint32
+	flushEvery          uint32
+}
+
+func main() {
+	rootCmd := &cobra.Command{
+		Use:   "ledger-indexer",
+		Short: "Builds and queries an index of ledgers in which accounts and assets participated",
+	}
+
+	opts := buildOptions{}
+	buildCmd := &cobra.Command{
+		Use:   "build",
+		Short: "Adds ledgers to the index, resuming after the last indexed ledger",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := build(opts); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	buildCmd.Flags().StringVar(&opts.indexURL, "index-url", "", "URL of the index (file, s3)")
+	buildCmd.Flags().StringVar(&opts.metaArchiveURL, "meta-archive-url", "", "URL of the meta archive to read ledgers from (if not set Captive Stellar-Core is used)")
+	buildCmd.Flags().StringVar(&opts.binaryPath, "stellar-core-binary-path", "", "path to stellar core binary")
+	buildCmd.Flags().StringVar(&opts.configAppendPath, "captive-core-config-append-path", "", "path to additional configuration for the Stellar Core configuration file used by captive core")
+	buildCmd.Flags().StringVar(&opts.historyArchiveURLs, "history-archive-urls", "", "comma-separated list of stellar history archives to connect with")
+	buildCmd.Flags().StringVar(&opts.networkPassphrase, "network-passphrase", network.PublicNetworkPassphrase, "network passphrase")
+	buildCmd.Flags().StringVar(&opts.granularity, "granularity", string(ledgerindex.CheckpointGranularity), "what is indexed for every account and asset: ledger or checkpoint")
+	buildCmd.Flags().Uint32Var(&opts.checkpointFrequency, "checkpoint-frequency", historyarchive.DefaultCheckpointFrequency, "establishes how many ledgers exist between checkpoints, do NOT change this unless you really know what you are doing")
+	buildCmd.Flags().Uint32Var(&opts.start, "start", 2, "first ledger to index, ignored when resuming an existing index")
+	buildCmd.Flags().Uint32Var(&opts.end, "end", 0, "last ledger to index (required)")
+	buildCmd.Flags().Uint32Var(&opts.flushEvery, "flush-every", 10000, "number of ledgers kept in memory before the index is written")
+
+	var indexURL, account, asset string
+	lookupCmd := &cobra.Command{
+		Use:   "lookup",
+		Short: "Prints ranges of ledgers in which the account or asset participated",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := lookup(indexURL, account, asset); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	lookupCmd.Flags().StringVar(&indexURL, "index-url", "", "URL of the index (file, s3, http(s))")
+	lookupCmd.Flags().StringVar(&account, "account", "", "account address (G...)")
+	lookupCmd.Flags().StringVar(&asset, "asset", "", "asset in the CODE:ISSUER format")
+
+	rootCmd.AddCommand(buildCmd, lookupCmd)
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func build(opts buildOptions) error {
+	if opts.indexURL == "" {
+		return errors.New("--index-url is required")
+	}
+	if opts.end == 0 {
+		return errors.New("--end is required")
+	}
+
+	indexBackend, err := historyarchive.ConnectBackend(opts.indexURL, historyarchive.ConnectOptions{})
+	if err != nil {
+		return errors.Wrap(err, "error connecting to index")
+	}
+	builder, err := ledgerindex.NewBuilder(
+		indexBackend,
+		ledgerindex.Granularity(opts.granularity),
+		opts.checkpointFrequency,
+	)
+	if err != nil {
+		return errors.Wrap(err, "error opening index")
+	}
+
+	start := opts.start
+	if to := builder.Meta().To; to != 0 {
+		start = to + 1
+		log.Infof("Resuming index after ledger %d", to)
+	}
+	if start > opts.end {
+		log.Infof("Ledgers up to %d are already indexed", opts.end)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	var backend ledgerbackend.LedgerBackend
+	if opts.metaArchiveURL != "" {
+		backend, err = ledgerbackend.NewMetaArchiveBackend(opts.metaArchiveURL, historyarchive.ConnectOptions{
+			Context: ctx,
+		})
+	} else {
+		backend, err = ledgerbackend.NewCaptive(ledgerbackend.CaptiveCoreConfig{
+			BinaryPath:          opts.binaryPath,
+			ConfigAppendPath:    opts.configAppendPath,
+			NetworkPassphrase:   opts.networkPassphrase,
+			HistoryArchiveURLs:  strings.Split(opts.historyArchiveURLs, ","),
+			CheckpointFrequency: opts.checkpointFrequency,
+			Context:             ctx,
+		})
+	}
+	if err != nil {
+		return errors.Wrap(err, "error creating ledger backend")
+	}
+	defer backend.Close()
+
+	stream, err := ingest.NewLedgerStream(ingest.LedgerStreamConfig{
+		Backend:           backend,
+		NetworkPassphrase: opts.networkPassphrase,
+		Range:             ledgerbackend.BoundedRange(start, opts.end),
+		BufferSize:        100,
+	})
+	if err != nil {
+		return err
+	}
+
+	unflushed := uint32(0)
+	err = stream.StreamLedgers(ctx, func(ledger xdr.LedgerCloseMeta) error {
+		if err := builder.AddLedger(opts.networkPassphrase, ledger); err != nil {
+			return err
+		}
+		unflushed++
+		if unflushed < opts.flushEvery {
+			return nil
+		}
+		unflushed = 0
+		log.Infof("Indexed ledgers up to %d", ledger.LedgerSequence())
+		return builder.Flush()
+	})
+	// Ledgers indexed so far are written even when streaming is interrupted
+	// so the next run resumes after them.
+	if flushErr := builder.Flush(); flushErr != nil {
+		return errors.Wrap(flushErr, "error writing index")
+	}
+	if err != nil {
+		return errors.Wrap(err, "error indexing ledgers")
+	}
+
+	log.Infof("Indexed ledgers %d-%d", builder.Meta().From, builder.Meta().To)
+	return nil
+}
+
+func lookup(indexURL, account, asset string) error {
+	if indexURL == "" {
+		return errors.New("--index-url is required")
+	}
+
+	var key string
+	switch {
+	case account != "" && asset == "":
+		key = ledgerindex.AccountKey(account)
+	case asset != "" && account == "":
+		assets, err := xdr.BuildAssets(asset)
+		if err != nil {
+			return errors.Wrap(err, "invalid --asset")
+		}
+		key = ledgerindex.AssetKey(assets[0])
+	default:
+		return errors.New("exactly one of --account and --asset is required")
+	}
+
+	indexBackend, err := historyarchive.ConnectBackend(indexURL, historyarchive.ConnectOptions{})
+	if err != nil {
+		return errors.Wrap(err, "error connecting to index")
+	}
+	reader, err := ledgerindex.NewReader(indexBackend)
+	if err != nil {
+		return err
+	}
+
+	ranges, err := reader.Lookup(key)
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		fmt.Printf("%d-%d\n", r.From(), r.To())
+	}
+	return nil
+}
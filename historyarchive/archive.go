@@ -26,6 +26,10 @@ import (
 const hexPrefixPat = "/[0-9a-f]{2}/[0-9a-f]{2}/[0-9a-f]{2}/"
 const rootHASPath = ".well-known/stellar-history.json"
 
+// DefaultCacheMaxSize is the default maximum size of the local cache of
+// archive files (10 GiB).
+const DefaultCacheMaxSize = 10 << 30
+
 type CommandOptions struct {
 	Concurrency int
 	Range       Range
@@ -33,6 +37,13 @@ type CommandOptions struct {
 	Force       bool
 	Verify      bool
 	Thorough    bool
+	// Manifest, if set, makes Mirror skip files copied by previous runs and
+	// record newly copied files.
+	Manifest *MirrorManifest
+	// NotPublished confirms to Prune that no Stellar-Core instance publishes
+	// to the archive. Core uploads buckets before the HAS referencing them,
+	// so pruning removes buckets of a checkpoint being published.
+	NotPublished bool
 }
 
 type ConnectOptions struct {
@@ -44,6 +55,22 @@ type ConnectOptions struct {
 	S3Region          string
 	S3Endpoint        string
 	UnsignedRequests  bool
+	// GCSEndpoint overrides the Google Cloud Storage endpoint used by gs://
+	// URLs, ex. to connect to an emulator.
+	GCSEndpoint string
+	// AzureEndpoint overrides the Blob service endpoint used by azure:// URLs,
+	// ex. http://127.0.0.1:10000/devstoreaccount1 to connect to Azurite.
+	AzureEndpoint string
+	// AzureAccountKey and AzureSASToken authorize requests to azure:// URLs.
+	// If both are empty AZURE_STORAGE_KEY and AZURE_STORAGE_SAS_TOKEN
+	// environment variables are used.
+	AzureAccountKey string
+	AzureSASToken   string
+	// CachePath enables caching of files read from the archive in the given
+	// local directory (see CachingArchiveBackend). CacheMaxSize is the
+	// maximum size of the cache in bytes, DefaultCacheMaxSize if unset.
+	CachePath    string
+	CacheMaxSize int64
 	// CheckpointFrequency is the number of ledgers between checkpoints
 	// if unset, DefaultCheckpointFrequency will be used
 	CheckpointFrequency uint32
@@ -64,6 +91,12 @@ type ArchiveBackend interface {
 	CanListFiles() bool
 }
 
+// FileRemover is implemented by ArchiveBackends which can remove files, it's
+// required by Prune.
+type FileRemover interface {
+	RemoveFile(path string) error
+}
+
 type ArchiveInterface interface {
 	GetPathHAS(path string) (HistoryArchiveState, error)
 	PutPathHAS(path string, has HistoryArchiveState, opts *CommandOptions) error
@@ -387,37 +420,64 @@ func Connect(u string, opts ConnectOptions) (*Archive, error) {
 		arch.checkpointFiles[cat] = make(map[uint32]bool)
 	}
 
+	var err error
+	arch.backend, err = ConnectBackend(u, opts)
+	return &arch, err
+}
+
+// ConnectBackend returns the ArchiveBackend for the given URL. Supported
+// schemes are s3, gs, azure, file, http(s) and mock.
+func ConnectBackend(u string, opts ConnectOptions) (ArchiveBackend, error) {
 	if u == "" {
-		return &arch, errors.New("URL is empty")
+		return nil, errors.New("URL is empty")
 	}
 
 	parsed, err := url.Parse(u)
 	if err != nil {
-		return &arch, err
+		return nil, err
 	}
 
 	if opts.Context == nil {
 		opts.Context = context.Background()
 	}
 
+	var backend ArchiveBackend
 	pth := parsed.Path
 	if parsed.Scheme == "s3" {
 		// Inside s3, all paths start _without_ the leading /
 		if len(pth) > 0 && pth[0] == '/' {
 			pth = pth[1:]
 		}
-		arch.backend, err = makeS3Backend(parsed.Host, pth, opts)
+		backend, err = makeS3Backend(parsed.Host, pth, opts)
+	} else if parsed.Scheme == "gs" {
+		pth = strings.TrimPrefix(pth, "/")
+		backend, err = makeGCSBackend(parsed.Host, pth, opts)
+	} else if parsed.Scheme == "azure" {
+		backend, err = makeAzureBackend(parsed.Host, pth, opts)
 	} else if parsed.Scheme == "file" {
 		pth = path.Join(parsed.Host, pth)
-		arch.backend = makeFsBackend(pth, opts)
+		backend = makeFsBackend(pth, opts)
 	} else if parsed.Scheme == "http" || parsed.Scheme == "https" {
-		arch.backend = makeHttpBackend(parsed, opts)
+		backend = makeHttpBackend(parsed, opts)
 	} else if parsed.Scheme == "mock" {
-		arch.backend = makeMockBackend(opts)
+		backend = makeMockBackend(opts)
 	} else {
 		err = errors.New("unknown URL scheme: '" + parsed.Scheme + "'")
 	}
-	return &arch, err
+
+	if err == nil && opts.CachePath != "" {
+		maxSize := opts.CacheMaxSize
+		if maxSize == 0 {
+			maxSize = DefaultCacheMaxSize
+		}
+		var cachingBackend *CachingArchiveBackend
+		cachingBackend, err = NewCachingArchiveBackend(backend, opts.CachePath, maxSize)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating archive cache")
+		}
+		backend = cachingBackend
+	}
+	return backend, err
 }
 
 func MustConnect(u string, opts ConnectOptions) *Archive {
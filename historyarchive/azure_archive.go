@@ -0,0 +1,337 @@
+package historyarchive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stellar/go/support/errors"
+)
+
+const azureAPIVersion = "2019-12-12"
+
+// AzureArchiveBackend is an ArchiveBackend storing files in an Azure Blob
+// Storage container. Requests are authorized with a Shared Key (account key)
+// or a SAS token. When neither is set in ConnectOptions, AZURE_STORAGE_KEY
+// and AZURE_STORAGE_SAS_TOKEN environment variables are used. Requests are
+// anonymous if ConnectOptions.UnsignedRequests is set.
+type AzureArchiveBackend struct {
+	ctx        context.Context
+	client     http.Client
+	account    string
+	endpoint   *url.URL
+	container  string
+	prefix     string
+	accountKey []byte
+	sasToken   url.Values
+}
+
+func (b *AzureArchiveBackend) url(blob string, query url.Values) *url.URL {
+	u := *b.endpoint
+	u.Path = path.Join("/", u.Path, b.container, blob)
+	for key, values := range b.sasToken {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+func (b *AzureArchiveBackend) do(method string, u *url.URL, body io.Reader, contentLength int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.ContentLength = contentLength
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if len(b.accountKey) > 0 {
+		req.Header.Set("Authorization", "SharedKey "+b.account+":"+b.sign(req))
+	}
+	return b.client.Do(req.WithContext(b.ctx))
+}
+
+// sign returns the Shared Key signature of the request, see:
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (b *AzureArchiveBackend) sign(req *http.Request) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	var msHeaders []string
+	for key := range req.Header {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "x-ms-") {
+			msHeaders = append(msHeaders, key)
+		}
+	}
+	sort.Strings(msHeaders)
+	var canonicalizedHeaders strings.Builder
+	for _, key := range msHeaders {
+		canonicalizedHeaders.WriteString(key + ":" + strings.TrimSpace(req.Header.Get(key)) + "\n")
+	}
+
+	canonicalizedResource := "/" + b.account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	var queryKeys []string
+	for key := range query {
+		queryKeys = append(queryKeys, key)
+	}
+	sort.Strings(queryKeys)
+	for _, key := range queryKeys {
+		values := query[key]
+		sort.Strings(values)
+		canonicalizedResource += "\n" + strings.ToLower(key) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalizedHeaders.String() + canonicalizedResource,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, b.accountKey)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// azureError returns an error including the status and error code returned
+// by Azure.
+func azureError(resp *http.Response) error {
+	return errors.Errorf(
+		"Bad Azure response '%s' for %s '%s': %s",
+		resp.Status,
+		resp.Request.Method,
+		resp.Request.URL.Path,
+		resp.Header.Get("x-ms-error-code"),
+	)
+}
+
+func (b *AzureArchiveBackend) GetFile(pth string) (io.ReadCloser, error) {
+	resp, err := b.do("GET", b.url(path.Join(b.prefix, pth), url.Values{}), nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, azureError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (b *AzureArchiveBackend) Head(pth string) (*http.Response, error) {
+	resp, err := b.do("HEAD", b.url(path.Join(b.prefix, pth), url.Values{}), nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+func (b *AzureArchiveBackend) Exists(pth string) (bool, error) {
+	resp, err := b.Head(pth)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+		return true, nil
+	} else if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	} else {
+		return false, azureError(resp)
+	}
+}
+
+func (b *AzureArchiveBackend) Size(pth string) (int64, error) {
+	resp, err := b.Head(pth)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+		return resp.ContentLength, nil
+	} else if resp.StatusCode == http.StatusNotFound {
+		return 0, nil
+	} else {
+		return 0, azureError(resp)
+	}
+}
+
+func (b *AzureArchiveBackend) PutFile(pth string, in io.ReadCloser) error {
+	// Put Blob requires Content-Length so the file is read into memory,
+	// like in S3ArchiveBackend.
+	content, err := ioutil.ReadAll(in)
+	in.Close()
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("x-ms-blob-type", "BlockBlob")
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err := b.do(
+		"PUT",
+		b.url(path.Join(b.prefix, pth), url.Values{}),
+		bytes.NewReader(content),
+		int64(len(content)),
+		header,
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return azureError(resp)
+	}
+	return nil
+}
+
+func (b *AzureArchiveBackend) RemoveFile(pth string) error {
+	resp, err := b.do("DELETE", b.url(path.Join(b.prefix, pth), url.Values{}), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNotFound {
+		return azureError(resp)
+	}
+	return nil
+}
+
+func (b *AzureArchiveBackend) ListFiles(pth string) (chan string, chan error) {
+	prefix := path.Join(b.prefix, pth)
+	ch := make(chan string)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(ch)
+		defer close(errs)
+
+		marker := ""
+		for {
+			query := url.Values{}
+			query.Set("restype", "container")
+			query.Set("comp", "list")
+			query.Set("prefix", prefix)
+			if marker != "" {
+				query.Set("marker", marker)
+			}
+
+			resp, err := b.do("GET", b.url("", query), nil, 0, nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			var page struct {
+				Blobs []struct {
+					Name string `xml:"Name"`
+				} `xml:"Blobs>Blob"`
+				NextMarker string `xml:"NextMarker"`
+			}
+			if resp.StatusCode != http.StatusOK {
+				err = azureError(resp)
+			} else {
+				err = xml.NewDecoder(resp.Body).Decode(&page)
+			}
+			resp.Body.Close()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			for _, blob := range page.Blobs {
+				ch <- blob.Name
+			}
+			if page.NextMarker == "" {
+				return
+			}
+			marker = page.NextMarker
+		}
+	}()
+	return ch, errs
+}
+
+func (b *AzureArchiveBackend) CanListFiles() bool {
+	return true
+}
+
+// makeAzureBackend creates a backend for azure://account/container/prefix
+// URLs.
+func makeAzureBackend(account string, pth string, opts ConnectOptions) (ArchiveBackend, error) {
+	parts := strings.SplitN(strings.TrimPrefix(pth, "/"), "/", 2)
+	if parts[0] == "" {
+		return nil, errors.New("Azure URL must include container name: azure://account/container/prefix")
+	}
+	container := parts[0]
+	prefix := ""
+	if len(parts) == 2 {
+		prefix = parts[1]
+	}
+
+	endpoint := opts.AzureEndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid Azure endpoint")
+	}
+
+	backend := &AzureArchiveBackend{
+		ctx:       opts.Context,
+		account:   account,
+		endpoint:  endpointURL,
+		container: container,
+		prefix:    prefix,
+	}
+
+	if opts.UnsignedRequests {
+		return backend, nil
+	}
+
+	accountKey, sasToken := opts.AzureAccountKey, opts.AzureSASToken
+	if accountKey == "" && sasToken == "" {
+		accountKey, sasToken = os.Getenv("AZURE_STORAGE_KEY"), os.Getenv("AZURE_STORAGE_SAS_TOKEN")
+	}
+	if accountKey != "" {
+		backend.accountKey, err = base64.StdEncoding.DecodeString(accountKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid Azure account key")
+		}
+	} else if sasToken != "" {
+		backend.sasToken, err = url.ParseQuery(strings.TrimPrefix(sasToken, "?"))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid Azure SAS token")
+		}
+	}
+	return backend, nil
+}
@@ -0,0 +1,152 @@
+package historyarchive
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAzureAccountKey = "dGVzdC1rZXk="
+
+// fakeAzure implements the subset of the Blob service REST API used by
+// AzureArchiveBackend. Blobs are listed one per page to test pagination.
+type fakeAzure struct {
+	sync.Mutex
+	blobs map[string][]byte
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.Header.Get("x-ms-version") == "" ||
+		!strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey devstoreaccount1:") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	const containerPath = "/devstoreaccount1/test-container"
+	query := r.URL.Query()
+	switch {
+	case r.Method == "GET" && r.URL.Path == containerPath && query.Get("comp") == "list":
+		var names []string
+		for name := range f.blobs {
+			if strings.HasPrefix(name, query.Get("prefix")) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		type blob struct {
+			Name string
+		}
+		page := struct {
+			XMLName    xml.Name `xml:"EnumerationResults"`
+			Blobs      []blob   `xml:"Blobs>Blob"`
+			NextMarker string
+		}{}
+		if len(names) > 0 {
+			marker, _ := strconv.Atoi(query.Get("marker"))
+			page.Blobs = []blob{{names[marker]}}
+			if marker+1 < len(names) {
+				page.NextMarker = strconv.Itoa(marker + 1)
+			}
+		}
+		xml.NewEncoder(w).Encode(page)
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, containerPath+"/"):
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		content, _ := ioutil.ReadAll(r.Body)
+		f.blobs[strings.TrimPrefix(r.URL.Path, containerPath+"/")] = content
+		w.WriteHeader(http.StatusCreated)
+	case (r.Method == "GET" || r.Method == "HEAD") && strings.HasPrefix(r.URL.Path, containerPath+"/"):
+		content, ok := f.blobs[strings.TrimPrefix(r.URL.Path, containerPath+"/")]
+		if !ok {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if r.Method == "GET" {
+			w.Write(content)
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestAzureArchiveBackend(t *testing.T) {
+	server := httptest.NewServer(&fakeAzure{blobs: map[string][]byte{}})
+	defer server.Close()
+
+	backend, err := ConnectBackend("azure://devstoreaccount1/test-container/prefix", ConnectOptions{
+		AzureEndpoint:   server.URL + "/devstoreaccount1",
+		AzureAccountKey: testAzureAccountKey,
+	})
+	require.NoError(t, err)
+	testCloudArchiveBackend(t, backend)
+}
+
+func TestAzureSharedKeySignature(t *testing.T) {
+	backend, err := ConnectBackend("azure://myaccount/mycontainer/prefix", ConnectOptions{
+		AzureAccountKey: testAzureAccountKey,
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("GET", "https://myaccount.blob.core.windows.net/mycontainer?restype=container&comp=list&prefix=prefix%2Fbucket", nil)
+	require.NoError(t, err)
+	req.Header.Set("x-ms-date", "Fri, 26 Jun 2015 23:39:12 GMT")
+	req.Header.Set("x-ms-version", azureAPIVersion)
+
+	stringToSign := "GET\n\n\n\n\n\n\n\n\n\n\n\n" +
+		"x-ms-date:Fri, 26 Jun 2015 23:39:12 GMT\n" +
+		"x-ms-version:" + azureAPIVersion + "\n" +
+		"/myaccount/mycontainer\ncomp:list\nprefix:prefix/bucket\nrestype:container"
+	key, err := base64.StdEncoding.DecodeString(testAzureAccountKey)
+	require.NoError(t, err)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+
+	assert.Equal(
+		t,
+		base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		backend.(*AzureArchiveBackend).sign(req),
+	)
+}
+
+func TestAzureSASToken(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		query = r.URL.RawQuery
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	backend, err := ConnectBackend("azure://devstoreaccount1/test-container", ConnectOptions{
+		AzureEndpoint: server.URL,
+		AzureSASToken: "?sv=2019-12-12&sig=abc",
+	})
+	require.NoError(t, err)
+
+	exists, err := backend.Exists("file")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Equal(t, "sig=abc&sv=2019-12-12", query)
+
+	_, err = ConnectBackend("azure://devstoreaccount1", ConnectOptions{})
+	assert.EqualError(t, err, "Azure URL must include container name: azure://account/container/prefix")
+}
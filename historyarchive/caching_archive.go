@@ -0,0 +1,350 @@
+package historyarchive
+
+import (
+	"compress/gzip"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/support/errors"
+)
+
+var bucketPathRegexp = regexp.MustCompile("(^|/)bucket" + hexPrefixPat + "bucket-([0-9a-f]{64})\\.xdr\\.gz$")
+
+// CachingArchiveBackend is an ArchiveBackend decorator which stores files
+// read from the wrapped backend in a local directory. Files are cached on the
+// first GetFile call and served from the directory afterwards. The least
+// recently used files are removed when the size of the directory exceeds the
+// limit.
+//
+// Only files which never change once published are cached: the root HAS
+// (.well-known/stellar-history.json) is always read from the wrapped backend.
+// Bucket files are content-addressed so their hash is validated before they
+// are added to the cache.
+type CachingArchiveBackend struct {
+	backend ArchiveBackend
+	path    string
+	maxSize int64
+
+	mutex sync.Mutex
+	size  int64
+	// lru contains *cachedFile values, the most recently used at the front.
+	lru   *list.List
+	files map[string]*list.Element
+}
+
+type cachedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// NewCachingArchiveBackend returns a CachingArchiveBackend storing files in
+// the given directory. The directory is created if it does not exist. Files
+// cached by previous runs are used. The directory must not be shared by
+// multiple CachingArchiveBackend instances running at the same time.
+func NewCachingArchiveBackend(backend ArchiveBackend, cachePath string, maxSize int64) (*CachingArchiveBackend, error) {
+	if cachePath == "" {
+		return nil, errors.New("cache path is empty")
+	}
+	if maxSize <= 0 {
+		return nil, errors.New("cache max size must be positive")
+	}
+	if err := os.MkdirAll(cachePath, 0755); err != nil {
+		return nil, errors.Wrapf(err, "error creating %s", cachePath)
+	}
+
+	c := &CachingArchiveBackend{
+		backend: backend,
+		path:    cachePath,
+		maxSize: maxSize,
+		lru:     list.New(),
+		files:   map[string]*list.Element{},
+	}
+
+	var found []*cachedFile
+	err := filepath.Walk(cachePath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		// Remove leftovers of interrupted downloads
+		if strings.HasSuffix(filePath, ".tmp") {
+			return os.Remove(filePath)
+		}
+
+		rel, err := filepath.Rel(cachePath, filePath)
+		if err != nil {
+			return err
+		}
+		found = append(found, &cachedFile{
+			path:    filepath.ToSlash(rel),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", cachePath)
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].modTime.Before(found[j].modTime)
+	})
+	for _, file := range found {
+		c.files[file.path] = c.lru.PushFront(file)
+		c.size += file.size
+	}
+
+	return c, c.evict()
+}
+
+func cacheable(pth string) bool {
+	return path.Clean(pth) != rootHASPath
+}
+
+func (c *CachingArchiveBackend) filePath(pth string) string {
+	return filepath.Join(c.path, filepath.FromSlash(path.Clean(pth)))
+}
+
+// cached returns the cached file or nil if the file is not cached.
+func (c *CachingArchiveBackend) cached(pth string) *cachedFile {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.files[path.Clean(pth)]; ok {
+		return element.Value.(*cachedFile)
+	}
+	return nil
+}
+
+func (c *CachingArchiveBackend) Exists(pth string) (bool, error) {
+	if c.cached(pth) != nil {
+		return true, nil
+	}
+	return c.backend.Exists(pth)
+}
+
+func (c *CachingArchiveBackend) Size(pth string) (int64, error) {
+	if file := c.cached(pth); file != nil {
+		return file.size, nil
+	}
+	return c.backend.Size(pth)
+}
+
+// GetFile returns the cached file if it exists. Otherwise the file is
+// downloaded from the wrapped backend to the cache first.
+func (c *CachingArchiveBackend) GetFile(pth string) (io.ReadCloser, error) {
+	if !cacheable(pth) {
+		return c.backend.GetFile(pth)
+	}
+
+	file, err := c.open(pth)
+	if err != nil || file != nil {
+		return file, err
+	}
+
+	if err = c.download(pth); err != nil {
+		return nil, err
+	}
+
+	file, err = c.open(pth)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		// The file was evicted right after the download because another
+		// file was used more recently.
+		return c.backend.GetFile(pth)
+	}
+	return file, nil
+}
+
+// open opens the cached file and marks it as the most recently used. It
+// returns nil if the file is not cached.
+func (c *CachingArchiveBackend) open(pth string) (*os.File, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.files[path.Clean(pth)]
+	if !ok {
+		return nil, nil
+	}
+
+	filePath := c.filePath(pth)
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		// The file was removed outside of the cache
+		c.remove(element)
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error opening %s", filePath)
+	}
+
+	// Modification times are used to restore the order of use on restart
+	now := time.Now()
+	if err = os.Chtimes(filePath, now, now); err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "error updating modification time of %s", filePath)
+	}
+	element.Value.(*cachedFile).modTime = now
+	c.lru.MoveToFront(element)
+	return file, nil
+}
+
+// download copies the file from the wrapped backend to the cache validating
+// its hash if it's a bucket file.
+func (c *CachingArchiveBackend) download(pth string) error {
+	filePath := c.filePath(pth)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return errors.Wrapf(err, "error creating directory for %s", filePath)
+	}
+
+	// Download to a temporary file first so a crash never leaves a partially
+	// written file in the cache. The name is unique so concurrent downloads
+	// of the same file do not interfere.
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "error creating temporary file")
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	reader, err := c.backend.GetFile(pth)
+	if err != nil {
+		tmpFile.Close()
+		return err
+	}
+	size, err := io.Copy(tmpFile, reader)
+	reader.Close()
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error downloading %s", pth)
+	}
+
+	if m := bucketPathRegexp.FindStringSubmatch(pth); m != nil {
+		if err = validateBucketFile(tmpPath, m[2]); err != nil {
+			return errors.Wrapf(err, "error validating %s", pth)
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		return errors.Wrapf(err, "error renaming %s", tmpPath)
+	}
+	// Set the modification time explicitly because the time set by the
+	// filesystem can be behind the time set by open.
+	now := time.Now()
+	if err = os.Chtimes(filePath, now, now); err != nil {
+		return errors.Wrapf(err, "error updating modification time of %s", filePath)
+	}
+
+	key := path.Clean(pth)
+	if element, ok := c.files[key]; ok {
+		c.remove(element)
+	}
+	c.files[key] = c.lru.PushFront(&cachedFile{
+		path:    key,
+		size:    size,
+		modTime: now,
+	})
+	c.size += size
+	return c.evict()
+}
+
+// validateBucketFile checks if the SHA-256 hash of the uncompressed content
+// of the file matches the hash from the bucket file name.
+func validateBucketFile(filePath, expectedHash string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, gzipReader); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expectedHash {
+		return errors.Errorf("bucket hash does not match (expected=%s actual=%s)", expectedHash, actual)
+	}
+	return nil
+}
+
+// PutFile writes the file to the wrapped backend and removes it from the
+// cache.
+func (c *CachingArchiveBackend) PutFile(pth string, in io.ReadCloser) error {
+	c.mutex.Lock()
+	if element, ok := c.files[path.Clean(pth)]; ok {
+		os.Remove(c.filePath(pth))
+		c.remove(element)
+	}
+	c.mutex.Unlock()
+
+	return c.backend.PutFile(pth, in)
+}
+
+// RemoveFile removes the file from the cache and from the wrapped backend. It
+// returns an error if the wrapped backend does not implement FileRemover.
+func (c *CachingArchiveBackend) RemoveFile(pth string) error {
+	remover, ok := c.backend.(FileRemover)
+	if !ok {
+		return errors.New("RemoveFile not available for the wrapped backend")
+	}
+
+	c.mutex.Lock()
+	if element, ok := c.files[path.Clean(pth)]; ok {
+		os.Remove(c.filePath(pth))
+		c.remove(element)
+	}
+	c.mutex.Unlock()
+
+	return remover.RemoveFile(pth)
+}
+
+func (c *CachingArchiveBackend) ListFiles(pth string) (chan string, chan error) {
+	return c.backend.ListFiles(pth)
+}
+
+func (c *CachingArchiveBackend) CanListFiles() bool {
+	return c.backend.CanListFiles()
+}
+
+// evict removes the least recently used files until the size of the cache is
+// within the limit. The most recently used file is never removed.
+func (c *CachingArchiveBackend) evict() error {
+	for c.size > c.maxSize && c.lru.Len() > 1 {
+		element := c.lru.Back()
+		filePath := c.filePath(element.Value.(*cachedFile).path)
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "error removing %s", filePath)
+		}
+		c.remove(element)
+	}
+	return nil
+}
+
+func (c *CachingArchiveBackend) remove(element *list.Element) {
+	file := c.lru.Remove(element).(*cachedFile)
+	delete(c.files, file.path)
+	c.size -= file.size
+}
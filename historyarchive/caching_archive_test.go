@@ -0,0 +1,190 @@
+package historyarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingBackend counts GetFile calls of the wrapped backend.
+type countingBackend struct {
+	ArchiveBackend
+	gets map[string]int
+}
+
+func (b *countingBackend) GetFile(pth string) (io.ReadCloser, error) {
+	b.gets[pth]++
+	return b.ArchiveBackend.GetFile(pth)
+}
+
+func newCountingBackend() *countingBackend {
+	return &countingBackend{
+		ArchiveBackend: makeMockBackend(ConnectOptions{}),
+		gets:           map[string]int{},
+	}
+}
+
+func putTestFile(t *testing.T, backend ArchiveBackend, pth string, content []byte) {
+	require.NoError(t, backend.PutFile(pth, ioutil.NopCloser(bytes.NewReader(content))))
+}
+
+func readTestFile(t *testing.T, backend ArchiveBackend, pth string) string {
+	reader, err := backend.GetFile(pth)
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
+
+// testBucket returns the path and the gzipped content of a bucket file.
+func testBucket(t *testing.T, content string) (string, []byte) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	hash := sha256.Sum256([]byte(content))
+	hexHash := hex.EncodeToString(hash[:])
+	return fmt.Sprintf("bucket/%s/%s/%s/bucket-%s.xdr.gz", hexHash[0:2], hexHash[2:4], hexHash[4:6], hexHash), buf.Bytes()
+}
+
+func TestCachingArchiveBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	backend := newCountingBackend()
+	cache, err := NewCachingArchiveBackend(backend, dir, 1024)
+	require.NoError(t, err)
+
+	historyPath := "history/00/00/00/history-0000003f.json"
+	putTestFile(t, backend, historyPath, []byte("history"))
+	putTestFile(t, backend, rootHASPath, []byte("root"))
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, "history", readTestFile(t, cache, historyPath))
+		assert.Equal(t, "root", readTestFile(t, cache, rootHASPath))
+	}
+	assert.Equal(t, 1, backend.gets[historyPath])
+	// Root HAS is never cached
+	assert.Equal(t, 2, backend.gets[rootHASPath])
+
+	exists, err := cache.Exists(historyPath)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	size, err := cache.Size(historyPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("history")), size)
+
+	// PutFile removes the file from the cache
+	require.NoError(t, cache.PutFile(historyPath, ioutil.NopCloser(strings.NewReader("new history"))))
+	assert.Equal(t, "new history", readTestFile(t, cache, historyPath))
+	assert.Equal(t, 2, backend.gets[historyPath])
+
+	// Missing files are not cached
+	_, err = cache.GetFile("history/00/00/00/history-0000007f.json")
+	assert.EqualError(t, err, "no such file: history/00/00/00/history-0000007f.json")
+}
+
+func TestCachingArchiveBackendValidatesBuckets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	backend := newCountingBackend()
+	cache, err := NewCachingArchiveBackend(backend, dir, 1024)
+	require.NoError(t, err)
+
+	bucketPath, content := testBucket(t, "bucket entries")
+	putTestFile(t, backend, bucketPath, content)
+	assert.Equal(t, string(content), readTestFile(t, cache, bucketPath))
+	assert.Equal(t, string(content), readTestFile(t, cache, bucketPath))
+	assert.Equal(t, 1, backend.gets[bucketPath])
+
+	corruptedPath, _ := testBucket(t, "other entries")
+	putTestFile(t, backend, corruptedPath, content)
+	_, err = cache.GetFile(corruptedPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bucket hash does not match")
+	assert.Nil(t, cache.cached(corruptedPath))
+
+	// Temporary files are removed
+	var files []string
+	filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if !info.IsDir() {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+	assert.Equal(t, []string{filepath.Join(dir, filepath.FromSlash(bucketPath))}, files)
+}
+
+func TestCachingArchiveBackendEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	backend := newCountingBackend()
+	cache, err := NewCachingArchiveBackend(backend, dir, 20)
+	require.NoError(t, err)
+
+	paths := []string{
+		"ledger/00/00/00/ledger-0000003f.xdr.gz",
+		"ledger/00/00/00/ledger-0000007f.xdr.gz",
+		"ledger/00/00/00/ledger-000000bf.xdr.gz",
+	}
+	for _, pth := range paths {
+		putTestFile(t, backend, pth, []byte("0123456789"))
+	}
+
+	readTestFile(t, cache, paths[0])
+	readTestFile(t, cache, paths[1])
+	// Use the first file so the second one is the least recently used
+	readTestFile(t, cache, paths[0])
+	readTestFile(t, cache, paths[2])
+
+	assert.NotNil(t, cache.cached(paths[0]))
+	assert.Nil(t, cache.cached(paths[1]))
+	assert.NotNil(t, cache.cached(paths[2]))
+	_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(paths[1])))
+	assert.True(t, os.IsNotExist(err))
+
+	// Cached files are used after restart
+	cache, err = NewCachingArchiveBackend(backend, dir, 20)
+	require.NoError(t, err)
+	readTestFile(t, cache, paths[0])
+	readTestFile(t, cache, paths[2])
+	assert.Equal(t, 1, backend.gets[paths[0]])
+	assert.Equal(t, 1, backend.gets[paths[2]])
+
+	// Restarting with a smaller limit evicts the least recently used file
+	cache, err = NewCachingArchiveBackend(backend, dir, 10)
+	require.NoError(t, err)
+	assert.Nil(t, cache.cached(paths[0]))
+	assert.NotNil(t, cache.cached(paths[2]))
+}
+
+func TestConnectWithCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	backend, err := ConnectBackend("mock://test", ConnectOptions{CachePath: dir})
+	require.NoError(t, err)
+	cache, ok := backend.(*CachingArchiveBackend)
+	require.True(t, ok)
+	assert.Equal(t, int64(DefaultCacheMaxSize), cache.maxSize)
+}
@@ -0,0 +1,432 @@
+// Copyright 2021 Stellar Development Foundation and contributors. Licensed
+// under the Apache License, Version 2.0. See the COPYING file at the root
+// of this distribution or at http://www.apache.org/licenses/LICENSE-2.0
+
+package historyarchive
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// DefaultFailoverArchivePoolCooldown is the default time an archive which
+// returned an error is skipped for.
+const DefaultFailoverArchivePoolCooldown = 30 * time.Second
+
+// FailoverArchivePoolOptions configures a FailoverArchivePool.
+type FailoverArchivePoolOptions struct {
+	// Cooldown is the time an archive which returned an error is tried only
+	// after all healthy archives failed. DefaultFailoverArchivePoolCooldown
+	// if unset.
+	Cooldown time.Duration
+	// HedgeDelay enables hedged bucket downloads: if an archive does not
+	// respond to GetXdrStreamForHash within HedgeDelay, the same request is
+	// sent to another archive and the first response is used. Disabled if
+	// unset.
+	HedgeDelay time.Duration
+}
+
+// FailoverArchivePoolStats contains statistics of requests sent to a single
+// archive of a FailoverArchivePool.
+type FailoverArchivePoolStats struct {
+	// Archive is the URL of the archive.
+	Archive  string `json:"archive"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"`
+	// LastError is the last error returned by the archive.
+	LastError string `json:"last_error,omitempty"`
+	// AverageLatency is the average time of requests to the archive.
+	AverageLatency time.Duration `json:"average_latency_ns"`
+	// UnhealthyUntil is the end of the cooldown after the last error, zero if
+	// the archive is healthy.
+	UnhealthyUntil time.Time `json:"unhealthy_until"`
+}
+
+// A FailoverArchivePool is a collection of `ArchiveInterface`s like
+// ArchivePool which, unlike ArchivePool, handles archive failures. Requests
+// are sent to a random healthy archive. When an archive returns an error, the
+// same request is retried on other archives and the archive is marked
+// unhealthy for a cooldown period, during which it's tried only after all
+// healthy archives.
+type FailoverArchivePool struct {
+	options  FailoverArchivePoolOptions
+	archives []*pooledArchive
+}
+
+type pooledArchive struct {
+	ArchiveInterface
+	url string
+
+	mutex          sync.Mutex
+	requests       int64
+	errors         int64
+	lastError      string
+	totalLatency   time.Duration
+	unhealthyUntil time.Time
+}
+
+// NewFailoverArchivePool tries connecting to each of the provided history
+// archive URLs, returning a pool of valid archives.
+//
+// If none of the archives work, this returns the error message of the last
+// failed archive.
+func NewFailoverArchivePool(archiveURLs []string, config ConnectOptions, options FailoverArchivePoolOptions) (*FailoverArchivePool, error) {
+	if len(archiveURLs) <= 0 {
+		return nil, errors.New("No history archives provided")
+	}
+
+	var lastErr error = nil
+
+	// Try connecting to all of the listed archives, but only store valid ones.
+	var validArchives []ArchiveInterface
+	var validURLs []string
+	for _, url := range archiveURLs {
+		archive, err := Connect(
+			url,
+			ConnectOptions{
+				NetworkPassphrase:   config.NetworkPassphrase,
+				CheckpointFrequency: config.CheckpointFrequency,
+				Context:             config.Context,
+			},
+		)
+
+		if err != nil {
+			lastErr = errors.Wrapf(err, "Error connecting to history archive (%s)", url)
+			continue
+		}
+
+		validArchives = append(validArchives, archive)
+		validURLs = append(validURLs, url)
+	}
+
+	if len(validArchives) == 0 {
+		return nil, lastErr
+	}
+
+	return newFailoverArchivePool(validArchives, validURLs, options), nil
+}
+
+func newFailoverArchivePool(archives []ArchiveInterface, urls []string, options FailoverArchivePoolOptions) *FailoverArchivePool {
+	if options.Cooldown == 0 {
+		options.Cooldown = DefaultFailoverArchivePoolCooldown
+	}
+	pool := &FailoverArchivePool{options: options}
+	for i, archive := range archives {
+		pool.archives = append(pool.archives, &pooledArchive{
+			ArchiveInterface: archive,
+			url:              urls[i],
+		})
+	}
+	return pool
+}
+
+// Ensure the pool conforms to the ArchiveInterface
+var _ ArchiveInterface = &FailoverArchivePool{}
+
+// Stats returns request statistics of every archive in the pool.
+func (pa *FailoverArchivePool) Stats() []FailoverArchivePoolStats {
+	now := time.Now()
+	stats := make([]FailoverArchivePoolStats, 0, len(pa.archives))
+	for _, archive := range pa.archives {
+		archive.mutex.Lock()
+		stat := FailoverArchivePoolStats{
+			Archive:   archive.url,
+			Requests:  archive.requests,
+			Errors:    archive.errors,
+			LastError: archive.lastError,
+		}
+		if archive.requests > 0 {
+			stat.AverageLatency = archive.totalLatency / time.Duration(archive.requests)
+		}
+		if archive.unhealthyUntil.After(now) {
+			stat.UnhealthyUntil = archive.unhealthyUntil
+		}
+		archive.mutex.Unlock()
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+func (a *pooledArchive) healthy(now time.Time) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return !a.unhealthyUntil.After(now)
+}
+
+// record updates statistics of the archive after a request which started at
+// the given time.
+func (a *pooledArchive) record(start time.Time, err error, cooldown time.Duration) {
+	now := time.Now()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.requests++
+	a.totalLatency += now.Sub(start)
+	// Missing files are a valid response, the archive can be behind others
+	if err != nil && err != errNotInArchive {
+		a.errors++
+		a.lastError = err.Error()
+		a.unhealthyUntil = now.Add(cooldown)
+	} else {
+		a.unhealthyUntil = time.Time{}
+	}
+}
+
+// ordered returns archives in the order they should be tried: healthy
+// archives in random order followed by unhealthy archives in random order.
+func (pa *FailoverArchivePool) ordered() []*pooledArchive {
+	now := time.Now()
+	var healthy, unhealthy []*pooledArchive
+	for _, i := range rand.Perm(len(pa.archives)) {
+		archive := pa.archives[i]
+		if archive.healthy(now) {
+			healthy = append(healthy, archive)
+		} else {
+			unhealthy = append(unhealthy, archive)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// try calls fn with archives of the pool until it succeeds. It returns the
+// error of the last archive if all archives fail.
+func (pa *FailoverArchivePool) try(fn func(archive ArchiveInterface) error) error {
+	var err error
+	for _, archive := range pa.ordered() {
+		start := time.Now()
+		err = fn(archive.ArchiveInterface)
+		archive.record(start, err, pa.options.Cooldown)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// exists calls fn with archives of the pool until one of them returns true.
+// Archives which are behind may not have the file yet so false from a single
+// archive is not final.
+func (pa *FailoverArchivePool) exists(fn func(archive ArchiveInterface) (bool, error)) (bool, error) {
+	var exists bool
+	err := pa.try(func(archive ArchiveInterface) error {
+		var err error
+		exists, err = fn(archive)
+		if err == nil && !exists {
+			return errNotInArchive
+		}
+		return err
+	})
+	if err == errNotInArchive {
+		return false, nil
+	}
+	return exists, err
+}
+
+// errNotInArchive is used internally to try other archives when a file does
+// not exist in an archive.
+var errNotInArchive = errors.New("not found in archive")
+
+// Below are the ArchiveInterface method implementations.
+
+// GetAnyArchive returns a random healthy archive or a random archive if all
+// archives are unhealthy.
+func (pa *FailoverArchivePool) GetAnyArchive() ArchiveInterface {
+	return pa.ordered()[0].ArchiveInterface
+}
+
+func (pa *FailoverArchivePool) GetPathHAS(path string) (HistoryArchiveState, error) {
+	var has HistoryArchiveState
+	err := pa.try(func(archive ArchiveInterface) error {
+		var err error
+		has, err = archive.GetPathHAS(path)
+		return err
+	})
+	return has, err
+}
+
+func (pa *FailoverArchivePool) PutPathHAS(path string, has HistoryArchiveState, opts *CommandOptions) error {
+	return pa.try(func(archive ArchiveInterface) error {
+		return archive.PutPathHAS(path, has, opts)
+	})
+}
+
+func (pa *FailoverArchivePool) BucketExists(bucket Hash) (bool, error) {
+	return pa.exists(func(archive ArchiveInterface) (bool, error) {
+		return archive.BucketExists(bucket)
+	})
+}
+
+func (pa *FailoverArchivePool) CategoryCheckpointExists(cat string, chk uint32) (bool, error) {
+	return pa.exists(func(archive ArchiveInterface) (bool, error) {
+		return archive.CategoryCheckpointExists(cat, chk)
+	})
+}
+
+func (pa *FailoverArchivePool) GetLedgerHeader(chk uint32) (xdr.LedgerHeaderHistoryEntry, error) {
+	var header xdr.LedgerHeaderHistoryEntry
+	err := pa.try(func(archive ArchiveInterface) error {
+		var err error
+		header, err = archive.GetLedgerHeader(chk)
+		return err
+	})
+	return header, err
+}
+
+func (pa *FailoverArchivePool) GetRootHAS() (HistoryArchiveState, error) {
+	var has HistoryArchiveState
+	err := pa.try(func(archive ArchiveInterface) error {
+		var err error
+		has, err = archive.GetRootHAS()
+		return err
+	})
+	return has, err
+}
+
+func (pa *FailoverArchivePool) GetLedgers(start, end uint32) (map[uint32]*Ledger, error) {
+	var ledgers map[uint32]*Ledger
+	err := pa.try(func(archive ArchiveInterface) error {
+		var err error
+		ledgers, err = archive.GetLedgers(start, end)
+		return err
+	})
+	return ledgers, err
+}
+
+func (pa *FailoverArchivePool) GetCheckpointHAS(chk uint32) (HistoryArchiveState, error) {
+	var has HistoryArchiveState
+	err := pa.try(func(archive ArchiveInterface) error {
+		var err error
+		has, err = archive.GetCheckpointHAS(chk)
+		return err
+	})
+	return has, err
+}
+
+func (pa *FailoverArchivePool) PutCheckpointHAS(chk uint32, has HistoryArchiveState, opts *CommandOptions) error {
+	return pa.try(func(archive ArchiveInterface) error {
+		return archive.PutCheckpointHAS(chk, has, opts)
+	})
+}
+
+func (pa *FailoverArchivePool) PutRootHAS(has HistoryArchiveState, opts *CommandOptions) error {
+	return pa.try(func(archive ArchiveInterface) error {
+		return archive.PutRootHAS(has, opts)
+	})
+}
+
+// ListBucket and other List methods stream results so they are not retried,
+// they use a single healthy archive.
+func (pa *FailoverArchivePool) ListBucket(dp DirPrefix) (chan string, chan error) {
+	return pa.GetAnyArchive().ListBucket(dp)
+}
+
+func (pa *FailoverArchivePool) ListAllBuckets() (chan string, chan error) {
+	return pa.GetAnyArchive().ListAllBuckets()
+}
+
+func (pa *FailoverArchivePool) ListAllBucketHashes() (chan Hash, chan error) {
+	return pa.GetAnyArchive().ListAllBucketHashes()
+}
+
+func (pa *FailoverArchivePool) ListCategoryCheckpoints(cat string, pth string) (chan uint32, chan error) {
+	return pa.GetAnyArchive().ListCategoryCheckpoints(cat, pth)
+}
+
+// GetXdrStreamForHash returns a stream of the bucket. When
+// FailoverArchivePoolOptions.HedgeDelay is set and the first archive does not respond
+// in time, the request is also sent to the next archive and the first
+// successful response is used.
+func (pa *FailoverArchivePool) GetXdrStreamForHash(hash Hash) (*XdrStream, error) {
+	if pa.options.HedgeDelay <= 0 || len(pa.archives) < 2 {
+		var stream *XdrStream
+		err := pa.try(func(archive ArchiveInterface) error {
+			var err error
+			stream, err = archive.GetXdrStreamForHash(hash)
+			return err
+		})
+		return stream, err
+	}
+	return pa.hedgedXdrStreamForHash(hash)
+}
+
+type hedgedResult struct {
+	stream *XdrStream
+	err    error
+}
+
+func (pa *FailoverArchivePool) hedgedXdrStreamForHash(hash Hash) (*XdrStream, error) {
+	archives := pa.ordered()
+	results := make(chan hedgedResult, len(archives))
+	send := func(archive *pooledArchive) {
+		start := time.Now()
+		stream, err := archive.GetXdrStreamForHash(hash)
+		archive.record(start, err, pa.options.Cooldown)
+		results <- hedgedResult{stream, err}
+	}
+
+	next, pending := 0, 0
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var lastErr error
+	for {
+		select {
+		case <-timer.C:
+			// Send the request to the next archive when the hedge delay
+			// passes without a response.
+			if next < len(archives) {
+				go send(archives[next])
+				next++
+				pending++
+				timer.Reset(pa.options.HedgeDelay)
+			}
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				// Close streams returned by slower archives
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if late := <-results; late.err == nil {
+							late.stream.closeReaders()
+						}
+					}
+				}(pending)
+				return result.stream, nil
+			}
+			lastErr = result.err
+			if next == len(archives) && pending == 0 {
+				return nil, lastErr
+			}
+			// Do not wait for the hedge delay after an error
+			if next < len(archives) {
+				go send(archives[next])
+				next++
+				pending++
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(pa.options.HedgeDelay)
+			}
+		}
+	}
+}
+
+func (pa *FailoverArchivePool) GetXdrStream(pth string) (*XdrStream, error) {
+	var stream *XdrStream
+	err := pa.try(func(archive ArchiveInterface) error {
+		var err error
+		stream, err = archive.GetXdrStream(pth)
+		return err
+	})
+	return stream, err
+}
+
+func (pa *FailoverArchivePool) GetCheckpointManager() CheckpointManager {
+	return pa.GetAnyArchive().GetCheckpointManager()
+}
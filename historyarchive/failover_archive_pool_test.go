@@ -0,0 +1,123 @@
+package historyarchive
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailoverArchivePoolFailover(t *testing.T) {
+	failing, working := &MockArchive{}, &MockArchive{}
+	pool := newFailoverArchivePool(
+		[]ArchiveInterface{failing, working},
+		[]string{"failing", "working"},
+		FailoverArchivePoolOptions{Cooldown: time.Hour},
+	)
+
+	has := HistoryArchiveState{CurrentLedger: 63}
+	failing.On("GetRootHAS").Return(HistoryArchiveState{}, errors.New("timeout"))
+	working.On("GetRootHAS").Return(has, nil)
+
+	for i := 0; i < 10; i++ {
+		actual, err := pool.GetRootHAS()
+		require.NoError(t, err)
+		assert.Equal(t, has, actual)
+	}
+
+	// The failing archive is skipped during the cooldown after the first error
+	stats := pool.Stats()
+	assert.Equal(t, "failing", stats[0].Archive)
+	assert.LessOrEqual(t, stats[0].Requests, int64(1))
+	assert.Equal(t, stats[0].Requests, stats[0].Errors)
+	if stats[0].Errors > 0 {
+		assert.Equal(t, "timeout", stats[0].LastError)
+		assert.True(t, stats[0].UnhealthyUntil.After(time.Now()))
+	}
+	assert.Equal(t, "working", stats[1].Archive)
+	assert.Equal(t, int64(10), stats[1].Requests)
+	assert.Equal(t, int64(0), stats[1].Errors)
+	assert.True(t, stats[1].UnhealthyUntil.IsZero())
+
+	// Unhealthy archives are still used when all archives fail
+	working.ExpectedCalls = nil
+	working.On("GetRootHAS").Return(HistoryArchiveState{}, errors.New("not found"))
+	_, err := pool.GetRootHAS()
+	assert.Error(t, err)
+	stats = pool.Stats()
+	assert.GreaterOrEqual(t, stats[0].Errors, int64(1))
+	assert.Equal(t, int64(1), stats[1].Errors)
+}
+
+func TestFailoverArchivePoolExists(t *testing.T) {
+	behind, current := &MockArchive{}, &MockArchive{}
+	pool := newFailoverArchivePool(
+		[]ArchiveInterface{behind, current},
+		[]string{"behind", "current"},
+		FailoverArchivePoolOptions{},
+	)
+
+	behind.On("CategoryCheckpointExists", "ledger", uint32(127)).Return(false, nil)
+	current.On("CategoryCheckpointExists", "ledger", uint32(127)).Return(true, nil)
+	behind.On("CategoryCheckpointExists", "ledger", uint32(191)).Return(false, nil)
+	current.On("CategoryCheckpointExists", "ledger", uint32(191)).Return(false, nil)
+
+	exists, err := pool.CategoryCheckpointExists("ledger", 127)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = pool.CategoryCheckpointExists("ledger", 191)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// Missing files do not make archives unhealthy
+	for _, stat := range pool.Stats() {
+		assert.True(t, stat.UnhealthyUntil.IsZero())
+	}
+}
+
+func TestFailoverArchivePoolHedgedBucketReads(t *testing.T) {
+	slow, fast := &MockArchive{}, &MockArchive{}
+	pool := newFailoverArchivePool(
+		[]ArchiveInterface{slow, fast},
+		[]string{"slow", "fast"},
+		FailoverArchivePoolOptions{HedgeDelay: 10 * time.Millisecond},
+	)
+
+	hash := Hash{1}
+	slowStream := NewXdrStream(ioutil.NopCloser(strings.NewReader("slow")))
+	fastStream := NewXdrStream(ioutil.NopCloser(strings.NewReader("fast")))
+	slow.On("GetXdrStreamForHash", hash).Return(slowStream, nil).After(time.Second)
+	fast.On("GetXdrStreamForHash", hash).Return(fastStream, nil)
+
+	start := time.Now()
+	stream, err := pool.GetXdrStreamForHash(hash)
+	require.NoError(t, err)
+	assert.Equal(t, fastStream, stream)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestFailoverArchivePoolHedgedBucketReadsError(t *testing.T) {
+	first, second := &MockArchive{}, &MockArchive{}
+	pool := newFailoverArchivePool(
+		[]ArchiveInterface{first, second},
+		[]string{"first", "second"},
+		FailoverArchivePoolOptions{HedgeDelay: time.Hour},
+	)
+
+	hash := Hash{1}
+	first.On("GetXdrStreamForHash", hash).Return((*XdrStream)(nil), errors.New("first failed"))
+	second.On("GetXdrStreamForHash", hash).Return((*XdrStream)(nil), errors.New("second failed"))
+
+	// Errors send the request to the next archive without waiting for the
+	// hedge delay
+	_, err := pool.GetXdrStreamForHash(hash)
+	assert.Error(t, err)
+	for _, stat := range pool.Stats() {
+		assert.Equal(t, int64(1), stat.Errors)
+	}
+}
@@ -69,6 +69,14 @@ func (b *FsArchiveBackend) PutFile(pth string, in io.ReadCloser) error {
 	return e
 }
 
+func (b *FsArchiveBackend) RemoveFile(pth string) error {
+	err := os.Remove(path.Join(b.prefix, pth))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (b *FsArchiveBackend) ListFiles(pth string) (chan string, chan error) {
 	ch := make(chan string)
 	errs := make(chan error)
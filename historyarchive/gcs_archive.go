@@ -0,0 +1,243 @@
+package historyarchive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+
+	"github.com/stellar/go/support/errors"
+)
+
+const (
+	gcsDefaultEndpoint = "https://storage.googleapis.com"
+	gcsReadWriteScope  = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+// GCSArchiveBackend is an ArchiveBackend storing files in a Google Cloud
+// Storage bucket. It uses the Cloud Storage JSON API. Requests are
+// authenticated with Application Default Credentials (ex. a service account
+// file pointed by GOOGLE_APPLICATION_CREDENTIALS) unless
+// ConnectOptions.UnsignedRequests is set.
+type GCSArchiveBackend struct {
+	ctx      context.Context
+	client   *http.Client
+	endpoint string
+	bucket   string
+	prefix   string
+}
+
+func (b *GCSArchiveBackend) objectURL(pth string) string {
+	return fmt.Sprintf(
+		"%s/storage/v1/b/%s/o/%s",
+		b.endpoint,
+		url.PathEscape(b.bucket),
+		url.PathEscape(path.Join(b.prefix, pth)),
+	)
+}
+
+func (b *GCSArchiveBackend) do(method, u string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(b.ctx)
+	return b.client.Do(req)
+}
+
+// gcsError returns an error including the status and message returned by
+// GCS.
+func gcsError(resp *http.Response) error {
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return errors.Errorf(
+		"Bad GCS response '%s' for %s '%s': %s",
+		resp.Status,
+		resp.Request.Method,
+		resp.Request.URL.String(),
+		body.Error.Message,
+	)
+}
+
+func (b *GCSArchiveBackend) GetFile(pth string) (io.ReadCloser, error) {
+	resp, err := b.do("GET", b.objectURL(pth)+"?alt=media", nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, gcsError(resp)
+	}
+	return resp.Body, nil
+}
+
+// head returns the size of the object. The first returned value is false if
+// the object does not exist.
+func (b *GCSArchiveBackend) head(pth string) (bool, int64, error) {
+	resp, err := b.do("GET", b.objectURL(pth)+"?fields=size", nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, 0, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return false, 0, gcsError(resp)
+	}
+
+	var object struct {
+		// Size is encoded as a string in the JSON API
+		Size string `json:"size"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&object); err != nil {
+		return false, 0, errors.Wrap(err, "error decoding object metadata")
+	}
+	size, err := strconv.ParseInt(object.Size, 10, 64)
+	if err != nil {
+		return false, 0, errors.Wrap(err, "error parsing object size")
+	}
+	return true, size, nil
+}
+
+func (b *GCSArchiveBackend) Exists(pth string) (bool, error) {
+	exists, _, err := b.head(pth)
+	return exists, err
+}
+
+func (b *GCSArchiveBackend) Size(pth string) (int64, error) {
+	_, size, err := b.head(pth)
+	return size, err
+}
+
+func (b *GCSArchiveBackend) PutFile(pth string, in io.ReadCloser) error {
+	defer in.Close()
+
+	u := fmt.Sprintf(
+		"%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		b.endpoint,
+		url.PathEscape(b.bucket),
+		url.QueryEscape(path.Join(b.prefix, pth)),
+	)
+	req, err := http.NewRequest("POST", u, in)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := b.client.Do(req.WithContext(b.ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return gcsError(resp)
+	}
+	return nil
+}
+
+func (b *GCSArchiveBackend) RemoveFile(pth string) error {
+	resp, err := b.do("DELETE", b.objectURL(pth), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return gcsError(resp)
+	}
+	return nil
+}
+
+func (b *GCSArchiveBackend) ListFiles(pth string) (chan string, chan error) {
+	prefix := path.Join(b.prefix, pth)
+	ch := make(chan string)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(ch)
+		defer close(errs)
+
+		pageToken := ""
+		for {
+			query := url.Values{}
+			query.Set("prefix", prefix)
+			query.Set("fields", "items(name),nextPageToken")
+			if pageToken != "" {
+				query.Set("pageToken", pageToken)
+			}
+			u := fmt.Sprintf("%s/storage/v1/b/%s/o?%s", b.endpoint, url.PathEscape(b.bucket), query.Encode())
+
+			resp, err := b.do("GET", u, nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			var page struct {
+				Items []struct {
+					Name string `json:"name"`
+				} `json:"items"`
+				NextPageToken string `json:"nextPageToken"`
+			}
+			if resp.StatusCode != http.StatusOK {
+				err = gcsError(resp)
+			} else {
+				err = json.NewDecoder(resp.Body).Decode(&page)
+			}
+			resp.Body.Close()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			for _, item := range page.Items {
+				ch <- item.Name
+			}
+			if page.NextPageToken == "" {
+				return
+			}
+			pageToken = page.NextPageToken
+		}
+	}()
+	return ch, errs
+}
+
+func (b *GCSArchiveBackend) CanListFiles() bool {
+	return true
+}
+
+func makeGCSBackend(bucket string, prefix string, opts ConnectOptions) (ArchiveBackend, error) {
+	endpoint := gcsDefaultEndpoint
+	if opts.GCSEndpoint != "" {
+		endpoint = strings.TrimSuffix(opts.GCSEndpoint, "/")
+	}
+
+	client := &http.Client{}
+	if !opts.UnsignedRequests {
+		var err error
+		client, err = google.DefaultClient(opts.Context, gcsReadWriteScope)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating GCS client")
+		}
+	}
+
+	return &GCSArchiveBackend{
+		ctx:      opts.Context,
+		client:   client,
+		endpoint: endpoint,
+		bucket:   bucket,
+		prefix:   prefix,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package historyarchive
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGCS implements the subset of the Cloud Storage JSON API used by
+// GCSArchiveBackend. Objects are listed one per page to test pagination.
+type fakeGCS struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	const objectsPath = "/storage/v1/b/test-bucket/o"
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/upload"+objectsPath:
+		content, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Query().Get("name")] = content
+		json.NewEncoder(w).Encode(map[string]string{"name": r.URL.Query().Get("name")})
+	case r.Method == "GET" && r.URL.Path == objectsPath:
+		var names []string
+		for name := range f.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		page := map[string]interface{}{}
+		if len(names) > 0 {
+			token, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+			page["items"] = []map[string]string{{"name": names[token]}}
+			if token+1 < len(names) {
+				page["nextPageToken"] = strconv.Itoa(token + 1)
+			}
+		}
+		json.NewEncoder(w).Encode(page)
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, objectsPath+"/"):
+		content, ok := f.objects[strings.TrimPrefix(r.URL.Path, objectsPath+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"No such object"}}`))
+			return
+		}
+		if r.URL.Query().Get("alt") == "media" {
+			w.Write(content)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"size": strconv.Itoa(len(content))})
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestGCSArchiveBackend(t *testing.T) {
+	server := httptest.NewServer(&fakeGCS{objects: map[string][]byte{}})
+	defer server.Close()
+
+	backend, err := ConnectBackend("gs://test-bucket/prefix", ConnectOptions{
+		GCSEndpoint:      server.URL,
+		UnsignedRequests: true,
+	})
+	require.NoError(t, err)
+	testCloudArchiveBackend(t, backend)
+}
+
+// testCloudArchiveBackend checks ArchiveBackend implementation connected to
+// an empty bucket or container with "prefix" prefix.
+func testCloudArchiveBackend(t *testing.T, backend ArchiveBackend) {
+	exists, err := backend.Exists("history/00/00/00/history-0000003f.json")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = backend.GetFile("history/00/00/00/history-0000003f.json")
+	assert.Error(t, err)
+
+	files := map[string]string{
+		"history/00/00/00/history-0000003f.json": "{}",
+		"history/00/00/00/history-0000007f.json": "{\"version\": 1}",
+		"ledger/00/00/00/ledger-0000003f.xdr.gz": "ledgers",
+	}
+	for name, content := range files {
+		require.NoError(t, backend.PutFile(name, ioutil.NopCloser(strings.NewReader(content))))
+	}
+
+	for name, content := range files {
+		exists, err = backend.Exists(name)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		size, err := backend.Size(name)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), size)
+
+		reader, err := backend.GetFile(name)
+		require.NoError(t, err)
+		actual, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		reader.Close()
+		assert.Equal(t, content, string(actual))
+	}
+
+	assert.True(t, backend.CanListFiles())
+	ch, errs := backend.ListFiles("history")
+	var listed []string
+	for name := range ch {
+		listed = append(listed, name)
+	}
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{
+		"prefix/history/00/00/00/history-0000003f.json",
+		"prefix/history/00/00/00/history-0000007f.json",
+	}, listed)
+}
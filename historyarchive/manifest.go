@@ -0,0 +1,101 @@
+// Copyright 2021 Stellar Development Foundation and contributors. Licensed
+// under the Apache License, Version 2.0. See the COPYING file at the root
+// of this distribution or at http://www.apache.org/licenses/LICENSE-2.0
+
+package historyarchive
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/stellar/go/support/errors"
+)
+
+// MirrorManifest is a local file recording paths of files copied to a
+// mirror, one path per line. Mirror skips files in the manifest without
+// checking if they exist in the destination archive, so interrupted mirrors
+// resume where they stopped and repeated mirrors copy only new checkpoints.
+//
+// A checkpoint is complete once its HAS path is in the manifest: Mirror adds
+// it after all other files of the checkpoint were copied. The manifest must
+// only be used with a single destination archive and it becomes stale if
+// files are removed from the destination (ex. by Prune).
+type MirrorManifest struct {
+	mutex sync.Mutex
+	file  *os.File
+	paths map[string]bool
+}
+
+// OpenMirrorManifest loads the manifest at the given path, creating it if it
+// does not exist.
+func OpenMirrorManifest(pth string) (*MirrorManifest, error) {
+	file, err := os.OpenFile(pth, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening manifest %s", pth)
+	}
+
+	m := &MirrorManifest{file: file, paths: map[string]bool{}}
+	reader := bufio.NewReader(file)
+	var size int64
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// A line without newline was not completely written when the
+			// previous mirror was interrupted.
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, errors.Wrapf(err, "error reading manifest %s", pth)
+		}
+		size += int64(len(line))
+		m.paths[strings.TrimSuffix(line, "\n")] = true
+	}
+
+	// Drop the partial line so new paths are appended after a newline
+	if err = file.Truncate(size); err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "error truncating manifest %s", pth)
+	}
+	if _, err = file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "error seeking manifest %s", pth)
+	}
+	return m, nil
+}
+
+// Contains returns true if the file was copied.
+func (m *MirrorManifest) Contains(pth string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.paths[pth]
+}
+
+// Len returns the number of copied files.
+func (m *MirrorManifest) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.paths)
+}
+
+// Add records the copied file.
+func (m *MirrorManifest) Add(pth string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.paths[pth] {
+		return nil
+	}
+	if _, err := m.file.WriteString(pth + "\n"); err != nil {
+		return errors.Wrap(err, "error writing manifest")
+	}
+	m.paths[pth] = true
+	return nil
+}
+
+// Close closes the manifest file.
+func (m *MirrorManifest) Close() error {
+	return m.file.Close()
+}
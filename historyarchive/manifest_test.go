@@ -0,0 +1,108 @@
+package historyarchive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorManifest(t *testing.T) {
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pth := filepath.Join(dir, "manifest")
+
+	src := GetRandomPopulatedArchive()
+	dst := GetTestArchive()
+
+	manifest, err := OpenMirrorManifest(pth)
+	require.NoError(t, err)
+	opts := testOptions()
+	opts.Manifest = manifest
+	require.NoError(t, Mirror(src, dst, opts))
+	assert.Equal(t, 0, countMissing(dst, opts))
+	copied := manifest.Len()
+	// 5 category files and 33 buckets per checkpoint
+	assert.Equal(t, 15*(5+33), copied)
+	require.NoError(t, manifest.Close())
+
+	// Files in the manifest are not copied again
+	missing := checkpointBuckets(t, src, 0x17f)[0]
+	require.NoError(t, dst.backend.(FileRemover).RemoveFile(BucketPath(missing)))
+
+	manifest, err = OpenMirrorManifest(pth)
+	require.NoError(t, err)
+	assert.Equal(t, copied, manifest.Len())
+	opts = testOptions()
+	opts.Manifest = manifest
+	opts.Range.High += 64
+	require.NoError(t, src.AddRandomCheckpoint(opts.Range.High))
+	require.NoError(t, Mirror(src, dst, opts))
+	require.NoError(t, manifest.Close())
+
+	exists, err := dst.BucketExists(missing)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Equal(t, copied+5+33, manifest.Len())
+	assert.Equal(t, opts.Range.High, dst.MustGetRootHAS().CurrentLedger)
+	for _, cat := range Categories() {
+		exists, err = dst.CategoryCheckpointExists(cat, opts.Range.High)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	}
+}
+
+func TestMirrorManifestSharedBucketFailure(t *testing.T) {
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := GetRandomPopulatedArchive()
+	dst := GetTestArchive()
+
+	// Checkpoints 0x17f and 0x1bf share a bucket which can't be copied
+	shared := checkpointBuckets(t, src, 0x17f)[0]
+	has, err := src.GetCheckpointHAS(0x1bf)
+	require.NoError(t, err)
+	has.CurrentBuckets[0].Curr = shared.String()
+	require.NoError(t, src.PutCheckpointHAS(0x1bf, has, &CommandOptions{Force: true}))
+	require.NoError(t, src.backend.(FileRemover).RemoveFile(BucketPath(shared)))
+
+	manifest, err := OpenMirrorManifest(filepath.Join(dir, "manifest"))
+	require.NoError(t, err)
+	defer manifest.Close()
+	opts := testOptions()
+	opts.Manifest = manifest
+	assert.Error(t, Mirror(src, dst, opts))
+
+	for chk := range testRange().GenerateCheckpoints(src.checkpointManager) {
+		failed := chk == 0x17f || chk == 0x1bf
+		assert.Equal(t, !failed, manifest.Contains(CategoryCheckpointPath("history", chk)), "%d", chk)
+	}
+}
+
+func TestMirrorManifestPartialLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pth := filepath.Join(dir, "manifest")
+	require.NoError(t, ioutil.WriteFile(pth, []byte("ledger/00/00/00/ledger-0000003f.xdr.gz\nbucket/00/a"), 0644))
+
+	manifest, err := OpenMirrorManifest(pth)
+	require.NoError(t, err)
+	assert.True(t, manifest.Contains("ledger/00/00/00/ledger-0000003f.xdr.gz"))
+	assert.False(t, manifest.Contains("bucket/00/a"))
+	assert.Equal(t, 1, manifest.Len())
+	require.NoError(t, manifest.Add("scp/00/00/00/scp-0000003f.xdr.gz"))
+	require.NoError(t, manifest.Close())
+
+	content, err := ioutil.ReadFile(pth)
+	require.NoError(t, err)
+	assert.Equal(t, "ledger/00/00/00/ledger-0000003f.xdr.gz\nscp/00/00/00/scp-0000003f.xdr.gz\n", string(content))
+}
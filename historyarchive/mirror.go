@@ -9,10 +9,18 @@ import (
 	"log"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/stellar/go/support/errors"
 )
 
+// bucketCopy is a bucket copied by one of the Mirror workers, done is closed
+// once the copy is finished.
+type bucketCopy struct {
+	done chan struct{}
+	err  error
+}
+
 // Mirror mirrors an archive, it assumes that the source and destination have the same checkpoint ledger frequency
 func Mirror(src *Archive, dst *Archive, opts *CommandOptions) error {
 	rootHAS, e := src.GetRootHAS()
@@ -24,24 +32,52 @@ func Mirror(src *Archive, dst *Archive, opts *CommandOptions) error {
 
 	log.Printf("copying range %s\n", opts.Range)
 
+	// Checkpoints whose HAS is in the manifest were completely copied by a
+	// previous run.
+	var pending []uint32
+	for chk := range opts.Range.GenerateCheckpoints(src.checkpointManager) {
+		if opts.Manifest == nil || !opts.Manifest.Contains(CategoryCheckpointPath("history", chk)) {
+			pending = append(pending, chk)
+		}
+	}
+	if opts.Manifest != nil {
+		log.Printf("skipping %d checkpoints in manifest",
+			opts.Range.SizeInCheckPoints(src.checkpointManager)-len(pending))
+	}
+
 	// Make a bucket-fetch map that shows which buckets are
 	// already-being-fetched
-	bucketFetch := make(map[Hash]bool)
+	bucketFetch := make(map[Hash]*bucketCopy)
 	var bucketFetchMutex sync.Mutex
 
 	var errs uint32
+	start := time.Now()
 	tick := makeTicker(func(ticks uint) {
 		bucketFetchMutex.Lock()
-		sz := opts.Range.SizeInCheckPoints(src.checkpointManager)
-		log.Printf("Copied %d/%d checkpoints (%f%%), %d buckets",
-			ticks, sz,
-			100.0*float64(ticks)/float64(sz),
-			len(bucketFetch))
+		sz := len(pending)
+		elapsed := time.Since(start)
+		if ticks == 0 || elapsed <= 0 {
+			log.Printf("Copied %d/%d checkpoints, %d buckets", ticks, sz, len(bucketFetch))
+		} else {
+			rate := float64(ticks) / elapsed.Seconds()
+			eta := time.Duration(float64(sz-int(ticks))/rate) * time.Second
+			log.Printf("Copied %d/%d checkpoints (%f%%), %d buckets, %.1f checkpoints/s, ETA %s",
+				ticks, sz,
+				100.0*float64(ticks)/float64(sz),
+				len(bucketFetch), rate, eta)
+		}
 		bucketFetchMutex.Unlock()
 	})
 
+	checkpoints := make(chan uint32)
+	go func() {
+		for _, chk := range pending {
+			checkpoints <- chk
+		}
+		close(checkpoints)
+	}()
+
 	var wg sync.WaitGroup
-	checkpoints := opts.Range.GenerateCheckpoints(src.checkpointManager)
 	wg.Add(opts.Concurrency)
 	for i := 0; i < opts.Concurrency; i++ {
 		go func() {
@@ -61,29 +97,56 @@ func Mirror(src *Archive, dst *Archive, opts *CommandOptions) error {
 					panic(errors.Wrap(err, "error getting buckets"))
 				}
 
+				var checkpointErrs uint32
+				// Buckets being copied by other workers are waited for after
+				// copying the buckets of this worker, so workers never wait
+				// for each other in a cycle.
+				var fetchedByOthers []*bucketCopy
 				for _, bucket := range buckets {
-					alreadyFetching := false
 					bucketFetchMutex.Lock()
-					_, alreadyFetching = bucketFetch[bucket]
+					fetch, alreadyFetching := bucketFetch[bucket]
 					if !alreadyFetching {
-						bucketFetch[bucket] = true
+						fetch = &bucketCopy{done: make(chan struct{})}
+						bucketFetch[bucket] = fetch
 					}
 					bucketFetchMutex.Unlock()
-					if !alreadyFetching {
-						pth := BucketPath(bucket)
-						err = copyPath(src, dst, pth, opts)
-						atomic.AddUint32(&errs, noteError(err))
+					if alreadyFetching {
+						fetchedByOthers = append(fetchedByOthers, fetch)
+						continue
+					}
+					pth := BucketPath(bucket)
+					fetch.err = mirrorPath(src, dst, pth, opts, func() error {
+						return dst.VerifyBucketHash(bucket)
+					})
+					close(fetch.done)
+					checkpointErrs += noteError(fetch.err)
+				}
+				for _, fetch := range fetchedByOthers {
+					<-fetch.done
+					// The error was already reported by the worker which
+					// copied the bucket.
+					if fetch.err != nil {
+						checkpointErrs++
 					}
 				}
 
 				for _, cat := range Categories() {
-					pth := CategoryCheckpointPath(cat, ix)
-					err = copyPath(src, dst, pth, opts)
+					if cat == "history" {
+						continue
+					}
+					err = mirrorCategoryCheckpoint(src, dst, cat, ix, opts)
 					if err != nil && !categoryRequired(cat) {
 						continue
 					}
-					atomic.AddUint32(&errs, noteError(err))
+					checkpointErrs += noteError(err)
 				}
+				// The HAS is copied last so the checkpoint is only in the
+				// manifest when all its files are, including buckets copied
+				// by other workers.
+				if checkpointErrs == 0 {
+					checkpointErrs += noteError(mirrorCategoryCheckpoint(src, dst, "history", ix, opts))
+				}
+				atomic.AddUint32(&errs, checkpointErrs)
 				tick <- true
 			}
 			wg.Done()
@@ -91,8 +154,10 @@ func Mirror(src *Archive, dst *Archive, opts *CommandOptions) error {
 	}
 
 	wg.Wait()
-	log.Printf("copied %d checkpoints, %d buckets, range %s",
-		opts.Range.SizeInCheckPoints(src.checkpointManager), len(bucketFetch), opts.Range)
+	elapsed := time.Since(start)
+	log.Printf("copied %d checkpoints, %d buckets, range %s in %s (%.1f checkpoints/s)",
+		len(pending), len(bucketFetch), opts.Range, elapsed.Round(time.Second),
+		float64(len(pending))/elapsed.Seconds())
 	close(tick)
 	if rootHAS.CurrentLedger == opts.Range.High {
 		log.Printf("updating destination archive current-ledger pointer to 0x%8.8x",
@@ -113,3 +178,32 @@ func Mirror(src *Archive, dst *Archive, opts *CommandOptions) error {
 	}
 	return nil
 }
+
+func mirrorCategoryCheckpoint(src *Archive, dst *Archive, cat string, chk uint32, opts *CommandOptions) error {
+	return mirrorPath(src, dst, CategoryCheckpointPath(cat, chk), opts, func() error {
+		return dst.VerifyCategoryCheckpoint(cat, chk)
+	})
+}
+
+// mirrorPath copies the file unless it's in the manifest. Copied files are
+// verified with verify if opts.Verify is set and added to the manifest.
+func mirrorPath(src *Archive, dst *Archive, pth string, opts *CommandOptions, verify func() error) error {
+	if opts.Manifest != nil && opts.Manifest.Contains(pth) {
+		return nil
+	}
+	if err := copyPath(src, dst, pth, opts); err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return nil
+	}
+	if opts.Verify {
+		if err := verify(); err != nil {
+			return errors.Wrapf(err, "error verifying %s", pth)
+		}
+	}
+	if opts.Manifest != nil {
+		return opts.Manifest.Add(pth)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2021 Stellar Development Foundation and contributors. Licensed
+// under the Apache License, Version 2.0. See the COPYING file at the root
+// of this distribution or at http://www.apache.org/licenses/LICENSE-2.0
+
+package historyarchive
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/stellar/go/support/errors"
+)
+
+// Prune removes checkpoint files of all checkpoints before the checkpoint
+// containing the retain ledger and buckets which are not referenced by any
+// of the remaining HAS files.
+//
+// Pruning refuses to run if the retain ledger is after the current ledger
+// of the root HAS, if any remaining HAS can't be read or if the newest
+// checkpoint references missing buckets, so the archive always contains a
+// valid newest HAS. Checkpoint files are removed before buckets so buckets
+// are never referenced by a HAS once they are removed, even if pruning is
+// interrupted. With DryRun, files are only logged.
+//
+// The archive must not be published to while it is pruned, which callers
+// confirm with opts.NotPublished: buckets uploaded for a checkpoint whose HAS
+// is not written yet are not referenced by any HAS and are removed. Pruning
+// only aborts if the root HAS changes while it runs, which doesn't detect
+// such a checkpoint.
+//
+// The backend must implement FileRemover.
+func Prune(arch *Archive, retain uint32, opts *CommandOptions) error {
+	if opts.Concurrency == 0 {
+		return errors.New("Zero concurrency")
+	}
+	if !opts.NotPublished {
+		return errors.New("pruning requires confirming that the archive is not published to")
+	}
+	if !arch.backend.CanListFiles() {
+		return errors.New("pruning requires an archive backend which can list files")
+	}
+	remover, ok := arch.backend.(FileRemover)
+	if !ok {
+		return errors.New("pruning requires an archive backend which can remove files")
+	}
+
+	root, err := arch.GetRootHAS()
+	if err != nil {
+		return errors.Wrap(err, "error getting root HAS")
+	}
+	if retain > root.CurrentLedger {
+		return errors.Errorf(
+			"retain ledger %d is after the current ledger %d, refusing to prune the newest checkpoint",
+			retain, root.CurrentLedger,
+		)
+	}
+	retainChk := arch.checkpointManager.GetCheckpoint(retain)
+
+	// Scan the whole archive: all checkpoint files and all existing buckets
+	scanOpts := *opts
+	scanOpts.Range = arch.checkpointManager.MakeRange(0, root.CurrentLedger)
+	scanOpts.Verify = false
+	arch.ClearCachedInfo()
+	if err = arch.ScanCheckpoints(&scanOpts); err != nil {
+		return err
+	}
+	if err = arch.ScanAllBuckets(); err != nil {
+		return err
+	}
+	if err = arch.checkRootHASUnchanged(root.CurrentLedger); err != nil {
+		return err
+	}
+
+	arch.mutex.Lock()
+	var retained []uint32
+	for chk, present := range arch.checkpointFiles["history"] {
+		if present && chk >= retainChk {
+			retained = append(retained, chk)
+		}
+	}
+	newestPresent := arch.checkpointFiles["history"][root.CurrentLedger]
+	arch.mutex.Unlock()
+
+	if !newestPresent {
+		return errors.Errorf("HAS of the newest checkpoint %d is missing, refusing to prune", root.CurrentLedger)
+	}
+
+	// Buckets of the root HAS and of all retained HAS files are kept
+	buckets, err := root.Buckets()
+	if err != nil {
+		return errors.Wrap(err, "error getting buckets of root HAS")
+	}
+	for _, bucket := range buckets {
+		arch.NoteReferencedBucket(bucket)
+		arch.mutex.Lock()
+		exists := arch.allBuckets[bucket]
+		arch.mutex.Unlock()
+		if !exists {
+			return errors.Errorf("newest checkpoint references missing bucket %s, refusing to prune", bucket)
+		}
+	}
+	log.Printf("Reading buckets referenced by %d retained checkpoints", len(retained))
+	if errs := arch.noteRetainedBuckets(retained, opts.Concurrency); errs != 0 {
+		return fmt.Errorf("%d errors reading retained checkpoints, refusing to prune", errs)
+	}
+
+	var checkpointPaths, bucketPaths []string
+	arch.mutex.Lock()
+	for _, cat := range Categories() {
+		for chk, present := range arch.checkpointFiles[cat] {
+			if present && chk < retainChk {
+				checkpointPaths = append(checkpointPaths, CategoryCheckpointPath(cat, chk))
+			}
+		}
+	}
+	for bucket := range arch.allBuckets {
+		if !arch.referencedBuckets[bucket] {
+			bucketPaths = append(bucketPaths, BucketPath(bucket))
+		}
+	}
+	arch.mutex.Unlock()
+	sort.Strings(checkpointPaths)
+	sort.Strings(bucketPaths)
+
+	log.Printf("Pruning %d checkpoint files before checkpoint %d and %d unreferenced buckets",
+		len(checkpointPaths), retainChk, len(bucketPaths))
+	errs := removeFiles(remover, checkpointPaths, opts)
+	if errs != 0 {
+		// Buckets may still be referenced by checkpoints which were not
+		// removed.
+		return fmt.Errorf("%d errors while pruning checkpoint files, buckets not pruned", errs)
+	}
+	if err = arch.checkRootHASUnchanged(root.CurrentLedger); err != nil {
+		return errors.Wrap(err, "buckets not pruned")
+	}
+	errs = removeFiles(remover, bucketPaths, opts)
+	if errs != 0 {
+		return fmt.Errorf("%d errors while pruning buckets", errs)
+	}
+	return nil
+}
+
+// noteRetainedBuckets marks buckets of the HAS files of the given
+// checkpoints as referenced and returns the number of errors.
+func (arch *Archive) noteRetainedBuckets(checkpoints []uint32, concurrency int) uint32 {
+	var errs uint32
+	var wg sync.WaitGroup
+	req := make(chan uint32)
+	go func() {
+		for _, chk := range checkpoints {
+			req <- chk
+		}
+		close(req)
+	}()
+
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for chk := range req {
+				has, err := arch.GetCheckpointHAS(chk)
+				if err != nil {
+					atomic.AddUint32(&errs, noteError(err))
+					continue
+				}
+				buckets, err := has.Buckets()
+				if err != nil {
+					atomic.AddUint32(&errs, noteError(err))
+					continue
+				}
+				for _, bucket := range buckets {
+					arch.NoteReferencedBucket(bucket)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// checkRootHASUnchanged returns an error if the current ledger of the root
+// HAS is not currentLedger anymore.
+func (arch *Archive) checkRootHASUnchanged(currentLedger uint32) error {
+	root, err := arch.GetRootHAS()
+	if err != nil {
+		return errors.Wrap(err, "error getting root HAS")
+	}
+	if root.CurrentLedger != currentLedger {
+		return errors.Errorf(
+			"root HAS changed from ledger %d to %d while pruning, refusing to prune an archive being published to",
+			currentLedger, root.CurrentLedger,
+		)
+	}
+	return nil
+}
+
+// removeFiles removes the files and returns the number of errors.
+func removeFiles(remover FileRemover, paths []string, opts *CommandOptions) uint32 {
+	if opts.DryRun {
+		for _, pth := range paths {
+			log.Printf("dryrun skipping remove %s", pth)
+		}
+		return 0
+	}
+
+	var errs uint32
+	var wg sync.WaitGroup
+	req := make(chan string)
+	go func() {
+		for _, pth := range paths {
+			req <- pth
+		}
+		close(req)
+	}()
+
+	wg.Add(opts.Concurrency)
+	for i := 0; i < opts.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for pth := range req {
+				atomic.AddUint32(&errs, noteError(remover.RemoveFile(pth)))
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,141 @@
+package historyarchive
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checkpointBuckets(t *testing.T, arch *Archive, chk uint32) []Hash {
+	has, err := arch.GetCheckpointHAS(chk)
+	require.NoError(t, err)
+	buckets, err := has.Buckets()
+	require.NoError(t, err)
+	return buckets
+}
+
+// publishingBackend calls publish the first time buckets are listed, to
+// simulate a checkpoint published while the archive is scanned.
+type publishingBackend struct {
+	*MockArchiveBackend
+	once    sync.Once
+	publish func()
+}
+
+func (b *publishingBackend) ListFiles(pth string) (chan string, chan error) {
+	if strings.HasPrefix(pth, "bucket") {
+		b.once.Do(b.publish)
+	}
+	return b.MockArchiveBackend.ListFiles(pth)
+}
+
+func pruneOptions() *CommandOptions {
+	opts := testOptions()
+	opts.NotPublished = true
+	return opts
+}
+
+func TestPrune(t *testing.T) {
+	defer cleanup()
+	arch := GetRandomPopulatedArchive()
+
+	// Checkpoint 511 shares a bucket with the pruned checkpoint 447
+	has, err := arch.GetCheckpointHAS(511)
+	require.NoError(t, err)
+	shared := checkpointBuckets(t, arch, 447)[0]
+	has.CurrentBuckets[0].Curr = shared.String()
+	require.NoError(t, arch.PutCheckpointHAS(511, has, &CommandOptions{Force: true}))
+	pruned := checkpointBuckets(t, arch, 447)[1]
+
+	require.NoError(t, Prune(arch, 500, pruneOptions()))
+
+	for chk := range testRange().GenerateCheckpoints(arch.checkpointManager) {
+		for _, cat := range Categories() {
+			exists, err := arch.CategoryCheckpointExists(cat, chk)
+			require.NoError(t, err)
+			assert.Equal(t, chk >= 511, exists, "%s %d", cat, chk)
+		}
+		if chk >= 511 {
+			for _, bucket := range checkpointBuckets(t, arch, chk) {
+				exists, err := arch.BucketExists(bucket)
+				require.NoError(t, err)
+				assert.True(t, exists)
+			}
+		}
+	}
+	exists, err := arch.BucketExists(shared)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = arch.BucketExists(pruned)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	root, err := arch.GetRootHAS()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0x3bf), root.CurrentLedger)
+}
+
+func TestPruneDryRun(t *testing.T) {
+	defer cleanup()
+	arch := GetRandomPopulatedArchive()
+	bucket := checkpointBuckets(t, arch, 63)[0]
+
+	opts := pruneOptions()
+	opts.DryRun = true
+	require.NoError(t, Prune(arch, 500, opts))
+
+	exists, err := arch.CategoryCheckpointExists("ledger", 63)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = arch.BucketExists(bucket)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestPruneSafetyChecks(t *testing.T) {
+	defer cleanup()
+	arch := GetRandomPopulatedArchive()
+
+	err := Prune(arch, 500, testOptions())
+	assert.EqualError(t, err, "pruning requires confirming that the archive is not published to")
+
+	err = Prune(arch, 0x3c0, pruneOptions())
+	assert.EqualError(t, err,
+		"retain ledger 960 is after the current ledger 959, refusing to prune the newest checkpoint")
+
+	missing := checkpointBuckets(t, arch, 0x3bf)[0]
+	require.NoError(t, arch.backend.(FileRemover).RemoveFile(BucketPath(missing)))
+	err = Prune(arch, 500, pruneOptions())
+	assert.EqualError(t, err,
+		"newest checkpoint references missing bucket "+missing.String()+", refusing to prune")
+	exists, err := arch.CategoryCheckpointExists("ledger", 63)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestPruneConcurrentPublish(t *testing.T) {
+	defer cleanup()
+	arch := GetRandomPopulatedArchive()
+	arch.backend = &publishingBackend{
+		MockArchiveBackend: arch.backend.(*MockArchiveBackend),
+		publish: func() {
+			require.NoError(t, arch.AddRandomCheckpoint(0x3ff))
+		},
+	}
+
+	err := Prune(arch, 500, pruneOptions())
+	assert.EqualError(t, err,
+		"root HAS changed from ledger 959 to 1023 while pruning, refusing to prune an archive being published to")
+
+	for _, bucket := range checkpointBuckets(t, arch, 0x3ff) {
+		exists, err := arch.BucketExists(bucket)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	}
+	exists, err := arch.CategoryCheckpointExists("ledger", 63)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
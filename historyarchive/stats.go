@@ -0,0 +1,161 @@
+// Copyright 2021 Stellar Development Foundation and contributors. Licensed
+// under the Apache License, Version 2.0. See the COPYING file at the root
+// of this distribution or at http://www.apache.org/licenses/LICENSE-2.0
+
+package historyarchive
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/stellar/go/support/errors"
+)
+
+// CheckpointStats are statistics of ledgers of a checkpoint, computed from
+// the ledger, transactions and results categories and the checkpoint HAS.
+type CheckpointStats struct {
+	Checkpoint uint32 `json:"checkpoint"`
+	Ledgers    int    `json:"ledgers"`
+	// Transactions includes failed transactions, fee bump transactions are
+	// counted once.
+	Transactions       int `json:"transactions"`
+	FailedTransactions int `json:"failed_transactions"`
+	// Operations and OperationTypes include operations of failed
+	// transactions.
+	Operations     int            `json:"operations"`
+	OperationTypes map[string]int `json:"operation_types"`
+	// FeeCharged is the total fee charged in stroops.
+	FeeCharged int64 `json:"fee_charged"`
+	// FirstCloseTime and LastCloseTime are close times of the first and the
+	// last ledger of the checkpoint (unix timestamps).
+	FirstCloseTime int64 `json:"first_close_time"`
+	LastCloseTime  int64 `json:"last_close_time"`
+	// AverageCloseTime is the average time between ledgers of the
+	// checkpoint in seconds.
+	AverageCloseTime float64 `json:"average_close_time"`
+	// Buckets and BucketsSize are the number and the total (compressed)
+	// size of buckets referenced by the checkpoint HAS.
+	Buckets     int   `json:"buckets"`
+	BucketsSize int64 `json:"buckets_size"`
+}
+
+// GetCheckpointStats returns statistics of the checkpoint.
+func (arch *Archive) GetCheckpointStats(chk uint32) (CheckpointStats, error) {
+	stats := CheckpointStats{
+		Checkpoint:     chk,
+		OperationTypes: map[string]int{},
+	}
+
+	ledgers, err := arch.GetLedgers(arch.checkpointManager.GetCheckpointRange(chk).Low, chk)
+	if err != nil {
+		return stats, errors.Wrapf(err, "error getting ledgers of checkpoint %d", chk)
+	}
+	stats.Ledgers = len(ledgers)
+	first := true
+	for _, ledger := range ledgers {
+		closeTime := int64(ledger.Header.Header.ScpValue.CloseTime)
+		if first || closeTime < stats.FirstCloseTime {
+			stats.FirstCloseTime = closeTime
+		}
+		if first || closeTime > stats.LastCloseTime {
+			stats.LastCloseTime = closeTime
+		}
+		first = false
+
+		for _, tx := range ledger.Transaction.TxSet.Txs {
+			stats.Transactions++
+			for _, op := range tx.Operations() {
+				stats.Operations++
+				stats.OperationTypes[op.Body.Type.String()]++
+			}
+		}
+		for _, result := range ledger.TransactionResult.TxResultSet.Results {
+			stats.FeeCharged += int64(result.Result.FeeCharged)
+			if !result.Successful() {
+				stats.FailedTransactions++
+			}
+		}
+	}
+	if stats.Ledgers > 1 {
+		stats.AverageCloseTime = float64(stats.LastCloseTime-stats.FirstCloseTime) / float64(stats.Ledgers-1)
+	}
+
+	has, err := arch.GetCheckpointHAS(chk)
+	if err != nil {
+		return stats, errors.Wrapf(err, "error getting HAS of checkpoint %d", chk)
+	}
+	buckets, err := has.Buckets()
+	if err != nil {
+		return stats, errors.Wrapf(err, "error getting buckets of checkpoint %d", chk)
+	}
+	seen := map[Hash]bool{}
+	for _, bucket := range buckets {
+		if seen[bucket] {
+			continue
+		}
+		seen[bucket] = true
+		size, err := arch.backend.Size(BucketPath(bucket))
+		if err != nil {
+			return stats, errors.Wrapf(err, "error getting size of bucket %s", bucket)
+		}
+		stats.Buckets++
+		stats.BucketsSize += size
+	}
+	return stats, nil
+}
+
+// CollectCheckpointStats returns statistics of all checkpoints in
+// opts.Range, ordered by checkpoint.
+func CollectCheckpointStats(arch *Archive, opts *CommandOptions) ([]CheckpointStats, error) {
+	if opts.Concurrency == 0 {
+		return nil, errors.New("Zero concurrency")
+	}
+	state, err := arch.GetRootHAS()
+	if err != nil {
+		return nil, err
+	}
+	opts.Range = opts.Range.clamp(state.Range(), arch.checkpointManager)
+
+	log.Printf("Collecting stats of checkpoints in range: %s", opts.Range)
+
+	var mutex sync.Mutex
+	var result []CheckpointStats
+	var errs uint32
+	tick := makeTicker(func(ticks uint) {
+		log.Printf("Collected stats of %d/%d checkpoints",
+			ticks, opts.Range.SizeInCheckPoints(arch.checkpointManager))
+	})
+
+	var wg sync.WaitGroup
+	checkpoints := opts.Range.GenerateCheckpoints(arch.checkpointManager)
+	wg.Add(opts.Concurrency)
+	for i := 0; i < opts.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for chk := range checkpoints {
+				stats, err := arch.GetCheckpointStats(chk)
+				tick <- true
+				if err != nil {
+					atomic.AddUint32(&errs, noteError(err))
+					continue
+				}
+				mutex.Lock()
+				result = append(result, stats)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(tick)
+
+	if errs != 0 {
+		return nil, fmt.Errorf("%d errors while collecting stats", errs)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Checkpoint < result[j].Checkpoint
+	})
+	return result, nil
+}
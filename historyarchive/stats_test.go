@@ -0,0 +1,76 @@
+package historyarchive
+
+import (
+	"testing"
+
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectCheckpointStats(t *testing.T) {
+	archive := GetTestMockArchive()
+	metas := makeTestLedgerCloseMetas(t, 127)
+	for i := range metas {
+		v0 := metas[i].V0
+		v0.LedgerHeader.Header.ScpValue.CloseTime = xdr.TimePoint(1000 + 5*i)
+		if len(v0.TxSet.Txs) > 0 {
+			v0.TxSet.Txs[0].V1.Tx.Operations = []xdr.Operation{{
+				Body: xdr.OperationBody{
+					Type:           xdr.OperationTypeBumpSequence,
+					BumpSequenceOp: &xdr.BumpSequenceOp{BumpTo: 1},
+				},
+			}}
+		}
+	}
+	// Transaction of ledger 100 failed
+	metas[99].V0.TxProcessing[0].Result.Result.Result.Code = xdr.TransactionResultCodeTxFailed
+
+	writer, err := NewCheckpointWriter(archive, CheckpointWriterOptions{})
+	require.NoError(t, err)
+	for _, meta := range metas {
+		require.NoError(t, writer.AddLedger(meta))
+	}
+
+	bucket, err := archive.AddRandomBucket()
+	require.NoError(t, err)
+	has, err := archive.GetCheckpointHAS(127)
+	require.NoError(t, err)
+	has.CurrentBuckets[0].Curr = bucket.String()
+	has.CurrentBuckets[0].Snap = bucket.String()
+	require.NoError(t, archive.PutCheckpointHAS(127, has, &CommandOptions{Force: true}))
+
+	stats, err := CollectCheckpointStats(archive, &CommandOptions{
+		Range:       Range{Low: 0, High: 0xffffffff},
+		Concurrency: 4,
+	})
+	require.NoError(t, err)
+	require.Len(t, stats, 2)
+
+	assert.Equal(t, CheckpointStats{
+		Checkpoint:       63,
+		Ledgers:          63,
+		Transactions:     6,
+		Operations:       6,
+		OperationTypes:   map[string]int{"OperationTypeBumpSequence": 6},
+		FeeCharged:       10 + 20 + 30 + 40 + 50 + 60,
+		FirstCloseTime:   1000,
+		LastCloseTime:    1310,
+		AverageCloseTime: 5,
+	}, stats[0])
+
+	assert.Equal(t, CheckpointStats{
+		Checkpoint:         127,
+		Ledgers:            64,
+		Transactions:       6,
+		FailedTransactions: 1,
+		Operations:         6,
+		OperationTypes:     map[string]int{"OperationTypeBumpSequence": 6},
+		FeeCharged:         70 + 80 + 90 + 100 + 110 + 120,
+		FirstCloseTime:     1315,
+		LastCloseTime:      1630,
+		AverageCloseTime:   5,
+		Buckets:            1,
+		BucketsSize:        1024,
+	}, stats[1])
+}
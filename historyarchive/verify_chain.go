@@ -0,0 +1,199 @@
+// Copyright 2021 Stellar Development Foundation and contributors. Licensed
+// under the Apache License, Version 2.0. See the COPYING file at the root
+// of this distribution or at http://www.apache.org/licenses/LICENSE-2.0
+
+package historyarchive
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// TrustedLedger is a ledger with a hash obtained from a trusted source, ex.
+// a local stellar-core instance or a block explorer.
+type TrustedLedger struct {
+	Sequence uint32
+	Hash     Hash
+}
+
+// ParseTrustedLedger parses a trusted ledger in the SEQUENCE:HASH format.
+func ParseTrustedLedger(s string) (TrustedLedger, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return TrustedLedger{}, errors.Errorf("invalid trusted ledger %s, expected SEQUENCE:HASH", s)
+	}
+	sequence, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil || sequence == 0 {
+		return TrustedLedger{}, errors.Errorf("invalid trusted ledger sequence %s", parts[0])
+	}
+	hash, err := DecodeHash(parts[1])
+	if err != nil {
+		return TrustedLedger{}, errors.Wrapf(err, "invalid trusted ledger hash %s", parts[1])
+	}
+	return TrustedLedger{Sequence: uint32(sequence), Hash: hash}, nil
+}
+
+// VerifyLedgerChain proves that all checkpoints covering the given range are
+// on the same chain as the trusted ledger. Starting from the trusted ledger
+// it walks ledger headers backward, checking that the hash of every header
+// matches the previous ledger hash of the following one, and forward,
+// checking that the previous ledger hash of every header matches the hash of
+// the preceding one. Hashes are computed from the headers so hashes stored
+// in the archive are not trusted. Additionally the bucket list hash of every
+// checkpoint HAS is compared with the bucket list hash in the header of the
+// checkpoint ledger.
+//
+// The range is extended to include the trusted ledger and limited to the
+// current ledger of the archive. The range of verified ledgers is returned.
+// Transaction sets and results can be then verified against verified headers
+// using `Scan` with the `Verify` option.
+func VerifyLedgerChain(archive ArchiveInterface, trusted TrustedLedger, rng Range) (Range, error) {
+	root, err := archive.GetRootHAS()
+	if err != nil {
+		return Range{}, errors.Wrap(err, "error getting root HAS")
+	}
+	if trusted.Sequence > root.CurrentLedger {
+		return Range{}, errors.Errorf(
+			"trusted ledger %d has not been published yet (latest=%d)",
+			trusted.Sequence, root.CurrentLedger,
+		)
+	}
+
+	manager := archive.GetCheckpointManager()
+	low, high := rng.Low, rng.High
+	if trusted.Sequence < low {
+		low = trusted.Sequence
+	}
+	if trusted.Sequence > high {
+		high = trusted.Sequence
+	}
+	if high > root.CurrentLedger {
+		high = root.CurrentLedger
+	}
+	verified := Range{
+		Low:  manager.GetCheckpointRange(low).Low,
+		High: manager.GetCheckpoint(high),
+	}
+
+	// Backward: every header must hash to the previous ledger hash of the
+	// following header, starting from the trusted hash.
+	trustedCheckpoint := manager.GetCheckpoint(trusted.Sequence)
+	expected := trusted.Hash
+	for chk := trustedCheckpoint; ; chk -= manager.GetCheckpointFrequency() {
+		headers, err := getCheckpointLedgerHeaders(archive, chk)
+		if err != nil {
+			return Range{}, err
+		}
+		checkpointRange := manager.GetCheckpointRange(chk)
+		first := chk
+		if chk == trustedCheckpoint {
+			first = trusted.Sequence
+		}
+		for seq := first; seq >= checkpointRange.Low; seq-- {
+			header, ok := headers[seq]
+			if !ok {
+				return Range{}, errors.Errorf("ledger %d is missing from checkpoint %d", seq, chk)
+			}
+			hash, err := HashXdr(&header.Header)
+			if err != nil {
+				return Range{}, errors.Wrapf(err, "error hashing ledger %d", seq)
+			}
+			if hash != expected {
+				return Range{}, errors.Errorf(
+					"ledger %d is not on the trusted chain: expected hash %s, got %s",
+					seq, expected, hash,
+				)
+			}
+			expected = Hash(header.Header.PreviousLedgerHash)
+		}
+		// The header of the trusted checkpoint ledger is verified below
+		if chk != trustedCheckpoint {
+			if err = verifyCheckpointBucketList(archive, chk, headers[chk]); err != nil {
+				return Range{}, err
+			}
+		}
+		if checkpointRange.Low <= verified.Low {
+			break
+		}
+	}
+
+	// Forward: the previous ledger hash of every header must be the hash of
+	// the preceding header, starting from the trusted hash.
+	previous := trusted.Hash
+	for chk := trustedCheckpoint; chk <= verified.High; chk += manager.GetCheckpointFrequency() {
+		headers, err := getCheckpointLedgerHeaders(archive, chk)
+		if err != nil {
+			return Range{}, err
+		}
+		first := manager.GetCheckpointRange(chk).Low
+		if chk == trustedCheckpoint {
+			first = trusted.Sequence + 1
+		}
+		for seq := first; seq <= chk; seq++ {
+			header, ok := headers[seq]
+			if !ok {
+				return Range{}, errors.Errorf("ledger %d is missing from checkpoint %d", seq, chk)
+			}
+			if Hash(header.Header.PreviousLedgerHash) != previous {
+				return Range{}, errors.Errorf(
+					"ledger %d is not on the trusted chain: expected previous ledger hash %s, got %s",
+					seq, previous, Hash(header.Header.PreviousLedgerHash),
+				)
+			}
+			if previous, err = HashXdr(&header.Header); err != nil {
+				return Range{}, errors.Wrapf(err, "error hashing ledger %d", seq)
+			}
+		}
+		if err = verifyCheckpointBucketList(archive, chk, headers[chk]); err != nil {
+			return Range{}, err
+		}
+	}
+
+	return verified, nil
+}
+
+// getCheckpointLedgerHeaders returns all ledger headers of the checkpoint by
+// ledger sequence.
+func getCheckpointLedgerHeaders(archive ArchiveInterface, chk uint32) (map[uint32]xdr.LedgerHeaderHistoryEntry, error) {
+	xdrStream, err := archive.GetXdrStream(CategoryCheckpointPath("ledger", chk))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening ledger stream of checkpoint %d", chk)
+	}
+	defer xdrStream.Close()
+
+	headers := map[uint32]xdr.LedgerHeaderHistoryEntry{}
+	for {
+		var header xdr.LedgerHeaderHistoryEntry
+		if err = xdrStream.ReadOne(&header); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "error reading ledger stream of checkpoint %d", chk)
+		}
+		headers[uint32(header.Header.LedgerSeq)] = header
+	}
+	return headers, nil
+}
+
+// verifyCheckpointBucketList checks if the bucket list of the checkpoint HAS
+// matches the bucket list hash of the (verified) checkpoint ledger header.
+func verifyCheckpointBucketList(archive ArchiveInterface, chk uint32, header xdr.LedgerHeaderHistoryEntry) error {
+	has, err := archive.GetCheckpointHAS(chk)
+	if err != nil {
+		return errors.Wrapf(err, "error getting HAS of checkpoint %d", chk)
+	}
+	bucketListHash, err := has.BucketListHash()
+	if err != nil {
+		return errors.Wrapf(err, "error hashing bucket list of checkpoint %d", chk)
+	}
+	if bucketListHash != header.Header.BucketListHash {
+		return errors.Errorf(
+			"bucket list of checkpoint %d does not match ledger header: expected %s, got %s",
+			chk, Hash(header.Header.BucketListHash), Hash(bucketListHash),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package historyarchive
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeTestChain publishes checkpoints with ledgers 1 to 191 forming a valid
+// hash chain. modify is called with every header before it's hashed.
+func makeTestChain(t *testing.T, modify func(header *xdr.LedgerHeader)) (*Archive, []Hash) {
+	archive := GetTestMockArchive()
+	hashes := make([]Hash, 192)
+
+	var has HistoryArchiveState
+	for i := range has.CurrentBuckets {
+		has.CurrentBuckets[i].Curr = strings.Repeat("0", 64)
+		has.CurrentBuckets[i].Snap = strings.Repeat("0", 64)
+	}
+	bucketListHash, err := has.BucketListHash()
+	require.NoError(t, err)
+
+	var entries []xdrEntry
+	for seq := uint32(1); seq <= 191; seq++ {
+		header := xdr.LedgerHeader{
+			LedgerSeq:          xdr.Uint32(seq),
+			PreviousLedgerHash: xdr.Hash(hashes[seq-1]),
+			BucketListHash:     bucketListHash,
+		}
+		modify(&header)
+		hash, err := HashXdr(&header)
+		require.NoError(t, err)
+		hashes[seq] = hash
+		entries = append(entries, &xdr.LedgerHeaderHistoryEntry{Hash: xdr.Hash(hash), Header: header})
+
+		if archive.GetCheckpointManager().IsCheckpoint(seq) {
+			writeCategoryFile(t, archive.backend, CategoryCheckpointPath("ledger", seq), entries)
+			entries = nil
+			has.CurrentLedger = seq
+			require.NoError(t, archive.PutCheckpointHAS(seq, has, &CommandOptions{}))
+			require.NoError(t, archive.PutRootHAS(has, &CommandOptions{Force: true}))
+		}
+	}
+	return archive, hashes
+}
+
+func TestVerifyLedgerChain(t *testing.T) {
+	archive, hashes := makeTestChain(t, func(header *xdr.LedgerHeader) {})
+
+	verified, err := VerifyLedgerChain(archive, TrustedLedger{100, hashes[100]}, Range{Low: 0, High: 0xffffffff})
+	require.NoError(t, err)
+	assert.Equal(t, Range{Low: 1, High: 191}, verified)
+
+	// The range is extended to the trusted ledger
+	verified, err = VerifyLedgerChain(archive, TrustedLedger{100, hashes[100]}, Range{Low: 150, High: 160})
+	require.NoError(t, err)
+	assert.Equal(t, Range{Low: 64, High: 191}, verified)
+
+	verified, err = VerifyLedgerChain(archive, TrustedLedger{63, hashes[63]}, Range{Low: 1, High: 63})
+	require.NoError(t, err)
+	assert.Equal(t, Range{Low: 1, High: 63}, verified)
+
+	_, err = VerifyLedgerChain(archive, TrustedLedger{100, hashes[101]}, Range{Low: 0, High: 0xffffffff})
+	assert.EqualError(t, err, "ledger 100 is not on the trusted chain: expected hash "+
+		hashes[101].String()+", got "+hashes[100].String())
+
+	_, err = VerifyLedgerChain(archive, TrustedLedger{200, hashes[100]}, Range{Low: 0, High: 0xffffffff})
+	assert.EqualError(t, err, "trusted ledger 200 has not been published yet (latest=191)")
+}
+
+func TestVerifyLedgerChainForkedHeaders(t *testing.T) {
+	archive, hashes := makeTestChain(t, func(header *xdr.LedgerHeader) {})
+
+	// Replace ledgers 10 and 150 with headers not linked to the chain
+	for _, seq := range []uint32{10, 150} {
+		chk := archive.GetCheckpointManager().GetCheckpoint(seq)
+		headers, err := getCheckpointLedgerHeaders(archive, chk)
+		require.NoError(t, err)
+		var entries []xdrEntry
+		for i := archive.GetCheckpointManager().GetCheckpointRange(chk).Low; i <= chk; i++ {
+			entry := headers[i]
+			if i == seq {
+				entry.Header.ScpValue.CloseTime = 1
+			}
+			entries = append(entries, &entry)
+		}
+		writeCategoryFile(t, archive.backend, CategoryCheckpointPath("ledger", chk), entries)
+	}
+
+	_, err := VerifyLedgerChain(archive, TrustedLedger{100, hashes[100]}, Range{Low: 64, High: 127})
+	require.NoError(t, err)
+
+	_, err = VerifyLedgerChain(archive, TrustedLedger{100, hashes[100]}, Range{Low: 1, High: 127})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ledger 10 is not on the trusted chain: expected hash "+hashes[10].String())
+
+	_, err = VerifyLedgerChain(archive, TrustedLedger{100, hashes[100]}, Range{Low: 64, High: 191})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ledger 151 is not on the trusted chain: expected previous ledger hash")
+}
+
+func TestVerifyLedgerChainBucketList(t *testing.T) {
+	archive, hashes := makeTestChain(t, func(header *xdr.LedgerHeader) {
+		if header.LedgerSeq == 127 {
+			header.BucketListHash = xdr.Hash{1}
+		}
+	})
+
+	_, err := VerifyLedgerChain(archive, TrustedLedger{50, hashes[50]}, Range{Low: 1, High: 63})
+	require.NoError(t, err)
+
+	_, err = VerifyLedgerChain(archive, TrustedLedger{50, hashes[50]}, Range{Low: 1, High: 127})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bucket list of checkpoint 127 does not match ledger header")
+}
+
+func TestParseTrustedLedger(t *testing.T) {
+	hash := "df3f619804a92fdb4057192dc43dd748ea778adc52bc498ce80524c014b81119"
+	trusted, err := ParseTrustedLedger("100:" + hash)
+	require.NoError(t, err)
+	assert.Equal(t, TrustedLedger{100, MustDecodeHash(hash)}, trusted)
+
+	_, err = ParseTrustedLedger(hash)
+	assert.EqualError(t, err, "invalid trusted ledger "+hash+", expected SEQUENCE:HASH")
+	_, err = ParseTrustedLedger("0:" + hash)
+	assert.EqualError(t, err, "invalid trusted ledger sequence 0")
+	_, err = ParseTrustedLedger("100:abc")
+	assert.Error(t, err)
+}
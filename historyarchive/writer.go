@@ -0,0 +1,249 @@
+// Copyright 2021 Stellar Development Foundation and contributors. Licensed
+// under the Apache License, Version 2.0. See the COPYING file at the root
+// of this distribution or at http://www.apache.org/licenses/LICENSE-2.0
+
+package historyarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// CheckpointWriterOptions configures a CheckpointWriter.
+type CheckpointWriterOptions struct {
+	// NetworkPassphrase is written to every HAS.
+	NetworkPassphrase string
+	// Server is the name of the software written to every HAS,
+	// "stellar-go" if unset.
+	Server string
+	// StartLedger is the first ledger written to an empty archive, it must be
+	// the first ledger of a checkpoint. 1 if unset. Ignored if the archive is
+	// not empty.
+	StartLedger uint32
+	// CommandOptions are used when writing files, ex. to overwrite existing
+	// checkpoint files (Force) or to only log the writes (DryRun).
+	CommandOptions CommandOptions
+}
+
+// CheckpointWriter publishes checkpoints to a history archive from a
+// stream of xdr.LedgerCloseMeta: ledger headers, transactions, results and
+// scp category files and the checkpoint HAS in the standard layout. The root
+// HAS is updated after every checkpoint so the archive can be used right
+// away.
+//
+// The bucket list cannot be built from ledger meta so HAS files written by
+// CheckpointWriter contain empty buckets and no bucket files are published.
+// Archives written by CheckpointWriter can be used to replay ledgers (ex. by
+// HistoryArchiveBackend) but not to catch up state.
+type CheckpointWriter struct {
+	archive *Archive
+	options CheckpointWriterOptions
+
+	nextLedger   uint32
+	previousHash xdr.Hash
+
+	headers      []xdr.LedgerHeaderHistoryEntry
+	transactions []xdr.TransactionHistoryEntry
+	results      []xdr.TransactionHistoryResultEntry
+	scp          []xdr.ScpHistoryEntry
+}
+
+// NewCheckpointWriter creates a CheckpointWriter publishing to the given
+// archive. If the archive is not empty, writing continues after the current
+// ledger in the root HAS. Otherwise it starts with StartLedger.
+func NewCheckpointWriter(archive *Archive, options CheckpointWriterOptions) (*CheckpointWriter, error) {
+	if options.Server == "" {
+		options.Server = "stellar-go"
+	}
+	w := &CheckpointWriter{
+		archive: archive,
+		options: options,
+	}
+
+	exists, err := archive.backend.Exists(rootHASPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "error checking if root HAS exists")
+	}
+	if !exists {
+		w.nextLedger = options.StartLedger
+		if w.nextLedger == 0 {
+			w.nextLedger = 1
+		}
+		manager := archive.GetCheckpointManager()
+		if manager.GetCheckpointRange(w.nextLedger).Low != w.nextLedger {
+			return nil, errors.Errorf("start ledger %d is not the first ledger of a checkpoint", w.nextLedger)
+		}
+		return w, nil
+	}
+
+	root, err := archive.GetRootHAS()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting root HAS")
+	}
+	header, err := archive.GetLedgerHeader(root.CurrentLedger)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting header of ledger %d", root.CurrentLedger)
+	}
+	w.nextLedger = root.CurrentLedger + 1
+	w.previousHash = header.Hash
+	return w, nil
+}
+
+// NextLedger returns the sequence of the ledger expected by AddLedger.
+func (w *CheckpointWriter) NextLedger() uint32 {
+	return w.nextLedger
+}
+
+// AddLedger adds the ledger to the current checkpoint. Files of the
+// checkpoint are written when the last ledger of the checkpoint is added.
+// Ledgers must be added in order, starting from NextLedger.
+func (w *CheckpointWriter) AddLedger(meta xdr.LedgerCloseMeta) error {
+	v0, ok := meta.GetV0()
+	if !ok {
+		return errors.Errorf("unsupported LedgerCloseMeta version %d", meta.V)
+	}
+
+	seq := meta.LedgerSequence()
+	if seq != w.nextLedger {
+		return errors.Errorf("unexpected ledger %d (expected=%d)", seq, w.nextLedger)
+	}
+	// The previous ledger hash is unknown when writing to an empty archive
+	if !Hash(w.previousHash).IsZero() && meta.PreviousLedgerHash() != w.previousHash {
+		return errors.Errorf(
+			"previous ledger hash of ledger %d does not match (expected=%s actual=%s)",
+			seq, Hash(w.previousHash), Hash(meta.PreviousLedgerHash()),
+		)
+	}
+
+	w.headers = append(w.headers, v0.LedgerHeader)
+	// Like stellar-core, only ledgers with transactions are written to
+	// transactions and results files.
+	if len(v0.TxSet.Txs) > 0 {
+		results := make([]xdr.TransactionResultPair, len(v0.TxProcessing))
+		for i, processing := range v0.TxProcessing {
+			results[i] = processing.Result
+		}
+		w.transactions = append(w.transactions, xdr.TransactionHistoryEntry{
+			LedgerSeq: xdr.Uint32(seq),
+			TxSet:     v0.TxSet,
+		})
+		w.results = append(w.results, xdr.TransactionHistoryResultEntry{
+			LedgerSeq:   xdr.Uint32(seq),
+			TxResultSet: xdr.TransactionResultSet{Results: results},
+		})
+	}
+	w.scp = append(w.scp, v0.ScpInfo...)
+
+	w.nextLedger++
+	w.previousHash = meta.LedgerHash()
+
+	if w.archive.GetCheckpointManager().IsCheckpoint(seq) {
+		return w.writeCheckpoint(seq)
+	}
+	return nil
+}
+
+func (w *CheckpointWriter) writeCheckpoint(chk uint32) error {
+	opts := w.options.CommandOptions
+
+	headers := make([]interface{}, len(w.headers))
+	for i := range w.headers {
+		headers[i] = &w.headers[i]
+	}
+	transactions := make([]interface{}, len(w.transactions))
+	for i := range w.transactions {
+		transactions[i] = &w.transactions[i]
+	}
+	results := make([]interface{}, len(w.results))
+	for i := range w.results {
+		results[i] = &w.results[i]
+	}
+	scp := make([]interface{}, len(w.scp))
+	for i := range w.scp {
+		scp[i] = &w.scp[i]
+	}
+
+	for _, category := range []struct {
+		name    string
+		entries []interface{}
+	}{
+		{"ledger", headers},
+		{"transactions", transactions},
+		{"results", results},
+		{"scp", scp},
+	} {
+		if err := w.putCategoryFile(category.name, chk, category.entries); err != nil {
+			return err
+		}
+	}
+
+	has := HistoryArchiveState{
+		Version:           1,
+		Server:            w.options.Server,
+		CurrentLedger:     chk,
+		NetworkPassphrase: w.options.NetworkPassphrase,
+	}
+	emptyBucket := strings.Repeat("0", 64)
+	for i := range has.CurrentBuckets {
+		has.CurrentBuckets[i].Curr = emptyBucket
+		has.CurrentBuckets[i].Snap = emptyBucket
+	}
+
+	if opts.DryRun {
+		log.Printf("dryrun skipping HAS of checkpoint %d", chk)
+	} else {
+		if err := w.archive.PutCheckpointHAS(chk, has, &opts); err != nil {
+			return errors.Wrapf(err, "error writing HAS of checkpoint %d", chk)
+		}
+		if err := w.archive.PutRootHAS(has, &opts); err != nil {
+			return errors.Wrap(err, "error writing root HAS")
+		}
+	}
+
+	w.headers = nil
+	w.transactions = nil
+	w.results = nil
+	w.scp = nil
+	return nil
+}
+
+// putCategoryFile writes XDR entries to a gzipped category file.
+func (w *CheckpointWriter) putCategoryFile(category string, chk uint32, entries []interface{}) error {
+	pth := CategoryCheckpointPath(category, chk)
+	opts := w.options.CommandOptions
+	if opts.DryRun {
+		log.Printf("dryrun skipping %s", pth)
+		return nil
+	}
+	if !opts.Force {
+		exists, err := w.archive.backend.Exists(pth)
+		if err != nil {
+			return errors.Wrapf(err, "error checking if %s exists", pth)
+		}
+		if exists {
+			log.Printf("skipping existing %s", pth)
+			return nil
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	for _, entry := range entries {
+		if err := xdr.MarshalFramed(writer, entry); err != nil {
+			return errors.Wrapf(err, "error encoding %s", pth)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return errors.Wrapf(err, "error compressing %s", pth)
+	}
+	if err := w.archive.backend.PutFile(pth, ioutil.NopCloser(&buf)); err != nil {
+		return errors.Wrapf(err, "error writing %s", pth)
+	}
+	return nil
+}
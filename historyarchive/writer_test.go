@@ -0,0 +1,145 @@
+package historyarchive
+
+import (
+	"testing"
+
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeTestLedgerCloseMetas returns meta of ledgers 1 to end forming a valid
+// hash chain. Every 10th ledger contains a transaction.
+func makeTestLedgerCloseMetas(t *testing.T, end uint32) []xdr.LedgerCloseMeta {
+	var metas []xdr.LedgerCloseMeta
+	var previousHash xdr.Hash
+	for seq := uint32(1); seq <= end; seq++ {
+		v0 := &xdr.LedgerCloseMetaV0{
+			LedgerHeader: xdr.LedgerHeaderHistoryEntry{
+				Header: xdr.LedgerHeader{
+					LedgerSeq:          xdr.Uint32(seq),
+					PreviousLedgerHash: previousHash,
+				},
+			},
+			TxSet: xdr.TransactionSet{PreviousLedgerHash: previousHash},
+		}
+		if seq%10 == 0 {
+			v0.TxSet.Txs = []xdr.TransactionEnvelope{{
+				Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+				V1: &xdr.TransactionV1Envelope{
+					Tx: xdr.Transaction{
+						SourceAccount: xdr.MuxedAccount{
+							Type:    xdr.CryptoKeyTypeKeyTypeEd25519,
+							Ed25519: &xdr.Uint256{},
+						},
+						Fee:  xdr.Uint32(seq),
+						Memo: xdr.Memo{Type: xdr.MemoTypeMemoNone},
+					},
+				},
+			}}
+			v0.TxProcessing = []xdr.TransactionResultMeta{{
+				Result: xdr.TransactionResultPair{
+					TransactionHash: xdr.Hash{byte(seq)},
+					Result: xdr.TransactionResult{
+						FeeCharged: xdr.Int64(seq),
+						Result: xdr.TransactionResultResult{
+							Code:    xdr.TransactionResultCodeTxSuccess,
+							Results: &[]xdr.OperationResult{},
+						},
+					},
+				},
+			}}
+		}
+		hash, err := HashXdr(&v0.LedgerHeader.Header)
+		require.NoError(t, err)
+		v0.LedgerHeader.Hash = xdr.Hash(hash)
+		previousHash = xdr.Hash(hash)
+		metas = append(metas, xdr.LedgerCloseMeta{V0: v0})
+	}
+	return metas
+}
+
+func TestCheckpointWriter(t *testing.T) {
+	archive := GetTestMockArchive()
+	metas := makeTestLedgerCloseMetas(t, 150)
+
+	writer, err := NewCheckpointWriter(archive, CheckpointWriterOptions{NetworkPassphrase: "test"})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), writer.NextLedger())
+	for _, meta := range metas[:140] {
+		require.NoError(t, writer.AddLedger(meta))
+	}
+
+	root, err := archive.GetRootHAS()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(127), root.CurrentLedger)
+	assert.Equal(t, "test", root.NetworkPassphrase)
+	assert.Equal(t, "stellar-go", root.Server)
+	buckets, err := root.Buckets()
+	require.NoError(t, err)
+	assert.Empty(t, buckets)
+
+	for _, chk := range []uint32{63, 127} {
+		for _, category := range []string{"history", "ledger", "transactions", "results", "scp"} {
+			exists, err := archive.CategoryCheckpointExists(category, chk)
+			require.NoError(t, err)
+			assert.True(t, exists, category)
+		}
+	}
+	exists, err := archive.CategoryCheckpointExists("ledger", 191)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	ledgers, err := archive.GetLedgers(1, 127)
+	require.NoError(t, err)
+	assert.Len(t, ledgers, 127)
+	for seq := uint32(1); seq <= 127; seq++ {
+		ledger := ledgers[seq]
+		assertXdrEquals(t, metas[seq-1].V0.LedgerHeader, ledger.Header)
+		if seq%10 == 0 {
+			assertXdrEquals(t, metas[seq-1].V0.TxSet, ledger.Transaction.TxSet)
+			assert.Equal(t, xdr.Int64(seq), ledger.TransactionResult.TxResultSet.Results[0].Result.FeeCharged)
+		} else {
+			assert.Empty(t, ledger.Transaction.TxSet.Txs)
+		}
+	}
+
+	// Writing resumes after the last published checkpoint
+	writer, err = NewCheckpointWriter(archive, CheckpointWriterOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(128), writer.NextLedger())
+	assert.EqualError(t, writer.AddLedger(metas[128]), "unexpected ledger 129 (expected=128)")
+
+	forked := makeTestLedgerCloseMetas(t, 150)
+	forked[126].V0.LedgerHeader.Hash = xdr.Hash{1}
+	forked[127].V0.LedgerHeader.Header.PreviousLedgerHash = xdr.Hash{1}
+	err = writer.AddLedger(forked[127])
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "previous ledger hash of ledger 128 does not match")
+
+	for _, meta := range metas[127:] {
+		require.NoError(t, writer.AddLedger(meta))
+	}
+	assert.Equal(t, uint32(151), writer.NextLedger())
+}
+
+func TestCheckpointWriterStartLedger(t *testing.T) {
+	metas := makeTestLedgerCloseMetas(t, 127)
+
+	_, err := NewCheckpointWriter(GetTestMockArchive(), CheckpointWriterOptions{StartLedger: 65})
+	assert.EqualError(t, err, "start ledger 65 is not the first ledger of a checkpoint")
+
+	archive := GetTestMockArchive()
+	writer, err := NewCheckpointWriter(archive, CheckpointWriterOptions{StartLedger: 64})
+	require.NoError(t, err)
+	for _, meta := range metas[63:] {
+		require.NoError(t, writer.AddLedger(meta))
+	}
+
+	root, err := archive.GetRootHAS()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(127), root.CurrentLedger)
+	exists, err := archive.CategoryCheckpointExists("ledger", 63)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,314 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// BucketListDiffEntry is a ledger entry which changed between two
+// checkpoints.
+type BucketListDiffEntry struct {
+	// Type is LedgerEntryCreated, LedgerEntryUpdated or LedgerEntryRemoved.
+	Type xdr.LedgerEntryChangeType
+	Key  xdr.LedgerKey
+	// Pre is the entry at the first checkpoint. It's nil for created entries
+	// and for entries whose previous state is in buckets shared by both
+	// checkpoints (which are not read).
+	Pre *xdr.LedgerEntry
+	// Post is the entry at the second checkpoint, nil for removed entries.
+	Post *xdr.LedgerEntry
+}
+
+// LedgerEntryChanges returns the diff entry as ledger entry changes, like in
+// transaction meta: the state of the entry (if known) followed by the
+// created, updated or removed change.
+func (e BucketListDiffEntry) LedgerEntryChanges() []xdr.LedgerEntryChange {
+	var changes []xdr.LedgerEntryChange
+	if e.Pre != nil {
+		changes = append(changes, xdr.LedgerEntryChange{
+			Type:  xdr.LedgerEntryChangeTypeLedgerEntryState,
+			State: e.Pre,
+		})
+	}
+	switch e.Type {
+	case xdr.LedgerEntryChangeTypeLedgerEntryCreated:
+		changes = append(changes, xdr.LedgerEntryChange{Type: e.Type, Created: e.Post})
+	case xdr.LedgerEntryChangeTypeLedgerEntryUpdated:
+		changes = append(changes, xdr.LedgerEntryChange{Type: e.Type, Updated: e.Post})
+	case xdr.LedgerEntryChangeTypeLedgerEntryRemoved:
+		key := e.Key
+		changes = append(changes, xdr.LedgerEntryChange{Type: e.Type, Removed: &key})
+	}
+	return changes
+}
+
+// bucketListSide is the state of a ledger key in buckets of one checkpoint.
+type bucketListSide struct {
+	found bool
+	// newest is the position and the value of the newest bucket entry
+	newestPosition int
+	newest         xdr.BucketEntry
+	// oldestType is the type of the oldest bucket entry
+	oldestPosition int
+	oldestType     xdr.BucketEntryType
+}
+
+func (s *bucketListSide) add(position int, entry xdr.BucketEntry) {
+	if !s.found || position < s.newestPosition {
+		s.newestPosition = position
+		s.newest = entry
+	}
+	if !s.found || position > s.oldestPosition {
+		s.oldestPosition = position
+		s.oldestType = entry.Type
+	}
+	s.found = true
+}
+
+type bucketListDiffKey struct {
+	key   xdr.LedgerKey
+	sides [2]bucketListSide
+}
+
+// DiffCheckpoints calls fn with every ledger entry which was created,
+// updated or removed between the `from` and `to` checkpoint ledgers.
+//
+// Only buckets at the levels which differ between the two HAS files are
+// read, deep levels which did not change are skipped. Entries are classified
+// using bucket entry types: an INITENTRY means the entry did not exist in
+// older buckets, LIVEENTRY and DEADENTRY mean it did. Buckets created
+// before protocol 11 do not contain INITENTRY so entries created in them are
+// reported as updated.
+//
+// Keys of all entries in the differing buckets are kept in memory, so diffing
+// checkpoints far apart can require a lot of memory.
+func DiffCheckpoints(
+	ctx context.Context,
+	archive historyarchive.ArchiveInterface,
+	from, to uint32,
+	fn func(BucketListDiffEntry) error,
+) error {
+	manager := archive.GetCheckpointManager()
+	for _, sequence := range []uint32{from, to} {
+		if !manager.IsCheckpoint(sequence) {
+			return errors.Errorf("%d is not a checkpoint ledger", sequence)
+		}
+	}
+	if from >= to {
+		return errors.Errorf("from ledger %d must be lower than to ledger %d", from, to)
+	}
+
+	var lists [2][]historyarchive.Hash
+	for i, sequence := range []uint32{from, to} {
+		has, err := archive.GetCheckpointHAS(sequence)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get checkpoint HAS at ledger sequence %d", sequence)
+		}
+		lists[i], err = bucketListHashes(has)
+		if err != nil {
+			return errors.Wrapf(err, "invalid bucket list of checkpoint %d", sequence)
+		}
+	}
+
+	// Buckets are ordered from the newest to the oldest. Buckets after the
+	// last position at which the bucket lists differ are the same in both
+	// lists so they do not affect the diff.
+	last := -1
+	for i := range lists[0] {
+		if lists[0][i] != lists[1][i] {
+			last = i
+		}
+	}
+
+	// A bucket can be in both lists at different positions (ex. curr
+	// becoming snap) so every bucket is read once and its entries are added
+	// at all its positions.
+	type occurrence struct {
+		side     int
+		position int
+	}
+	var hashes []historyarchive.Hash
+	occurrences := map[historyarchive.Hash][]occurrence{}
+	for position := 0; position <= last; position++ {
+		for side := range lists {
+			hash := lists[side][position]
+			if hash.IsZero() {
+				continue
+			}
+			if _, ok := occurrences[hash]; !ok {
+				hashes = append(hashes, hash)
+			}
+			occurrences[hash] = append(occurrences[hash], occurrence{side, position})
+		}
+	}
+
+	var keys []*bucketListDiffKey
+	byKey := map[string]*bucketListDiffKey{}
+	for _, hash := range hashes {
+		err := readBucket(ctx, archive, hash, func(entry xdr.BucketEntry) error {
+			key, ok := bucketEntryKey(entry)
+			if !ok {
+				return nil
+			}
+			keyBytes, err := key.MarshalBinary()
+			if err != nil {
+				return errors.Wrap(err, "error marshaling ledger key")
+			}
+			diffKey, ok := byKey[string(keyBytes)]
+			if !ok {
+				diffKey = &bucketListDiffKey{key: key}
+				byKey[string(keyBytes)] = diffKey
+				keys = append(keys, diffKey)
+			}
+			for _, o := range occurrences[hash] {
+				diffKey.sides[o.side].add(o.position, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, diffKey := range keys {
+		entry, changed, err := diffKey.diff()
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diff compares the state of the key at both checkpoints.
+func (k *bucketListDiffKey) diff() (BucketListDiffEntry, bool, error) {
+	// The state in the skipped buckets is the same for both checkpoints. It
+	// can be inferred from the oldest entry seen: there is a live entry in
+	// older buckets unless the oldest entry is an INITENTRY.
+	oldest := k.sides[0]
+	if !oldest.found || (k.sides[1].found && k.sides[1].oldestPosition > oldest.oldestPosition) {
+		oldest = k.sides[1]
+	}
+	existsInSkipped := oldest.oldestType != xdr.BucketEntryTypeInitentry
+
+	var live [2]bool
+	var entries [2]*xdr.LedgerEntry
+	for i, side := range k.sides {
+		if !side.found {
+			live[i] = existsInSkipped
+			continue
+		}
+		if side.newest.Type != xdr.BucketEntryTypeDeadentry {
+			live[i] = true
+			entries[i] = side.newest.LiveEntry
+		}
+	}
+
+	diff := BucketListDiffEntry{Key: k.key, Pre: entries[0], Post: entries[1]}
+	switch {
+	case !live[0] && live[1]:
+		if entries[1] == nil {
+			return diff, false, errors.Errorf("unknown state of created entry %s", keyString(k.key))
+		}
+		diff.Type = xdr.LedgerEntryChangeTypeLedgerEntryCreated
+	case live[0] && !live[1]:
+		diff.Type = xdr.LedgerEntryChangeTypeLedgerEntryRemoved
+	case live[0] && live[1]:
+		if entries[1] == nil {
+			// Both states come from skipped buckets
+			return diff, false, nil
+		}
+		if entries[0] != nil {
+			equal, err := xdrEqual(entries[0], entries[1])
+			if err != nil || equal {
+				return diff, false, err
+			}
+		}
+		diff.Type = xdr.LedgerEntryChangeTypeLedgerEntryUpdated
+	default:
+		return diff, false, nil
+	}
+	return diff, true, nil
+}
+
+func keyString(key xdr.LedgerKey) string {
+	s, err := key.MarshalBinaryBase64()
+	if err != nil {
+		return key.Type.String()
+	}
+	return s
+}
+
+func xdrEqual(a, b *xdr.LedgerEntry) (bool, error) {
+	aBytes, err := a.MarshalBinary()
+	if err != nil {
+		return false, errors.Wrap(err, "error marshaling ledger entry")
+	}
+	bBytes, err := b.MarshalBinary()
+	if err != nil {
+		return false, errors.Wrap(err, "error marshaling ledger entry")
+	}
+	return bytes.Equal(aBytes, bBytes), nil
+}
+
+// bucketListHashes returns curr and snap bucket hashes of all levels from the
+// newest to the oldest.
+func bucketListHashes(has historyarchive.HistoryArchiveState) ([]historyarchive.Hash, error) {
+	var hashes []historyarchive.Hash
+	for _, level := range has.CurrentBuckets {
+		for _, s := range []string{level.Curr, level.Snap} {
+			hash, err := historyarchive.DecodeHash(s)
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
+
+// readBucket calls fn with every entry of the bucket and validates the hash
+// of the bucket.
+func readBucket(
+	ctx context.Context,
+	archive historyarchive.ArchiveInterface,
+	hash historyarchive.Hash,
+	fn func(xdr.BucketEntry) error,
+) error {
+	stream, err := archive.GetXdrStreamForHash(hash)
+	if err != nil {
+		return errors.Wrapf(err, "error opening bucket %s", hash)
+	}
+	stream.SetExpectedHash(hash)
+
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var entry xdr.BucketEntry
+		if err = stream.ReadOne(&entry); err != nil {
+			break
+		}
+		if err = fn(entry); err != nil {
+			break
+		}
+	}
+	if err != io.EOF {
+		stream.Close()
+		return errors.Wrapf(err, "error reading bucket %s", hash)
+	}
+	if err = stream.Close(); err != nil {
+		return errors.Wrapf(err, "error closing bucket %s", hash)
+	}
+	return nil
+}
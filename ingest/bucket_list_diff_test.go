@@ -0,0 +1,136 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockBucket makes the archive return the bucket with the given entries once
+// and returns its hash.
+func mockBucket(archive *historyarchive.MockArchive, entries ...xdr.BucketEntry) historyarchive.Hash {
+	b := &bytes.Buffer{}
+	for _, e := range entries {
+		if err := xdr.MarshalFramed(b, e); err != nil {
+			panic(err)
+		}
+	}
+	hash := historyarchive.Hash(sha256.Sum256(b.Bytes()))
+	archive.On("GetXdrStreamForHash", hash).
+		Return(historyarchive.NewXdrStream(ioutil.NopCloser(b)), nil).Once()
+	return hash
+}
+
+func testHAS(buckets map[int]historyarchive.Hash) historyarchive.HistoryArchiveState {
+	var has historyarchive.HistoryArchiveState
+	for i := range has.CurrentBuckets {
+		for j, s := range []*string{&has.CurrentBuckets[i].Curr, &has.CurrentBuckets[i].Snap} {
+			*s = buckets[2*i+j].String()
+		}
+	}
+	return has
+}
+
+func TestDiffCheckpoints(t *testing.T) {
+	var accounts []string
+	for i := 0; i < 8; i++ {
+		accounts = append(accounts, keypair.MustRandom().Address())
+	}
+
+	archive := &historyarchive.MockArchive{}
+	archive.On("GetCheckpointManager").Return(historyarchive.NewCheckpointManager(64))
+
+	// The deep bucket is shared by both checkpoints so it's never read
+	deep := historyarchive.Hash{1}
+	x := mockBucket(archive,
+		metaEntry(15),
+		entryAccount(xdr.BucketEntryTypeInitentry, accounts[6], 6),
+		entryAccount(xdr.BucketEntryTypeLiveentry, accounts[1], 10),
+	)
+	y := mockBucket(archive,
+		metaEntry(15),
+		entryAccount(xdr.BucketEntryTypeInitentry, accounts[5], 5),
+	)
+	z := mockBucket(archive,
+		metaEntry(15),
+		entryAccount(xdr.BucketEntryTypeInitentry, accounts[4], 4),
+	)
+	// Merge of y and z
+	w := mockBucket(archive,
+		metaEntry(15),
+		entryAccount(xdr.BucketEntryTypeInitentry, accounts[4], 4),
+		entryAccount(xdr.BucketEntryTypeInitentry, accounts[5], 5),
+	)
+	n := mockBucket(archive,
+		metaEntry(15),
+		entryAccount(xdr.BucketEntryTypeLiveentry, accounts[2], 20),
+		entryAccount(xdr.BucketEntryTypeDeadentry, accounts[3], 0),
+		entryAccount(xdr.BucketEntryTypeLiveentry, accounts[4], 40),
+		entryAccount(xdr.BucketEntryTypeDeadentry, accounts[5], 0),
+		entryAccount(xdr.BucketEntryTypeLiveentry, accounts[6], 6),
+		entryAccount(xdr.BucketEntryTypeInitentry, accounts[7], 7),
+	)
+
+	archive.On("GetCheckpointHAS", uint32(63)).
+		Return(testHAS(map[int]historyarchive.Hash{0: x, 1: y, 2: z, 10: deep}), nil)
+	// x moved from curr to snap, y and z were merged into w
+	archive.On("GetCheckpointHAS", uint32(127)).
+		Return(testHAS(map[int]historyarchive.Hash{0: n, 1: x, 2: w, 10: deep}), nil)
+
+	diffs := map[string]BucketListDiffEntry{}
+	err := DiffCheckpoints(context.Background(), archive, 63, 127, func(entry BucketListDiffEntry) error {
+		diffs[entry.Key.Account.AccountId.Address()] = entry
+		return nil
+	})
+	require.NoError(t, err)
+	archive.AssertExpectations(t)
+
+	assert.Len(t, diffs, 5)
+
+	// Previous state is in the skipped bucket
+	assert.Equal(t, xdr.LedgerEntryChangeTypeLedgerEntryUpdated, diffs[accounts[2]].Type)
+	assert.Nil(t, diffs[accounts[2]].Pre)
+	assert.Equal(t, xdr.Int64(20), diffs[accounts[2]].Post.Data.Account.Balance)
+
+	assert.Equal(t, xdr.LedgerEntryChangeTypeLedgerEntryRemoved, diffs[accounts[3]].Type)
+	assert.Nil(t, diffs[accounts[3]].Pre)
+	assert.Nil(t, diffs[accounts[3]].Post)
+
+	assert.Equal(t, xdr.LedgerEntryChangeTypeLedgerEntryUpdated, diffs[accounts[4]].Type)
+	assert.Equal(t, xdr.Int64(4), diffs[accounts[4]].Pre.Data.Account.Balance)
+	assert.Equal(t, xdr.Int64(40), diffs[accounts[4]].Post.Data.Account.Balance)
+
+	assert.Equal(t, xdr.LedgerEntryChangeTypeLedgerEntryRemoved, diffs[accounts[5]].Type)
+	assert.Equal(t, xdr.Int64(5), diffs[accounts[5]].Pre.Data.Account.Balance)
+
+	assert.Equal(t, xdr.LedgerEntryChangeTypeLedgerEntryCreated, diffs[accounts[7]].Type)
+	assert.Nil(t, diffs[accounts[7]].Pre)
+	assert.Equal(t, xdr.Int64(7), diffs[accounts[7]].Post.Data.Account.Balance)
+
+	changes := diffs[accounts[4]].LedgerEntryChanges()
+	require.Len(t, changes, 2)
+	assert.Equal(t, xdr.LedgerEntryChangeTypeLedgerEntryState, changes[0].Type)
+	assert.Equal(t, xdr.LedgerEntryChangeTypeLedgerEntryUpdated, changes[1].Type)
+	changes = diffs[accounts[3]].LedgerEntryChanges()
+	require.Len(t, changes, 1)
+	assert.Equal(t, xdr.LedgerEntryChangeTypeLedgerEntryRemoved, changes[0].Type)
+}
+
+func TestDiffCheckpointsInvalidRange(t *testing.T) {
+	archive := &historyarchive.MockArchive{}
+	archive.On("GetCheckpointManager").Return(historyarchive.NewCheckpointManager(64))
+	noop := func(BucketListDiffEntry) error { return nil }
+
+	err := DiffCheckpoints(context.Background(), archive, 63, 100, noop)
+	assert.EqualError(t, err, "100 is not a checkpoint ledger")
+	err = DiffCheckpoints(context.Background(), archive, 127, 63, noop)
+	assert.EqualError(t, err, "from ledger 127 must be lower than to ledger 63")
+}
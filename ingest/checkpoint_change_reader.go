@@ -1,9 +1,12 @@
 package ingest
 
 import (
+	"bufio"
 	"context"
 	"encoding/base64"
 	"io"
+	"io/ioutil"
+	"os"
 	"sync"
 	"time"
 
@@ -22,11 +25,16 @@ type readResult struct {
 // snapshot. The Changes produced by a CheckpointChangeReader reflect the state of the Stellar
 // network at a particular checkpoint ledger sequence.
 type CheckpointChangeReader struct {
-	ctx        context.Context
-	has        *historyarchive.HistoryArchiveState
-	archive    historyarchive.ArchiveInterface
-	tempStore  tempSet
-	sequence   uint32
+	ctx       context.Context
+	has       *historyarchive.HistoryArchiveState
+	archive   historyarchive.ArchiveInterface
+	tempStore tempSet
+	sequence  uint32
+	// bucketConcurrency is the number of buckets read at the same time.
+	bucketConcurrency int
+	// spillPath is the directory of the temp files holding entries of
+	// prefetched buckets which don't fit in memory, os.TempDir() when empty.
+	spillPath  string
 	readChan   chan readResult
 	streamOnce sync.Once
 	closeOnce  sync.Once
@@ -70,6 +78,25 @@ const (
 	sleepDuration = time.Second
 )
 
+// CheckpointChangeReaderOptions configures a CheckpointChangeReader.
+type CheckpointChangeReaderOptions struct {
+	// TempSetPath is a directory in which the reader keeps the set of ledger
+	// keys seen while streaming buckets. When empty the set is kept in memory
+	// which requires several GB of RAM for pubnet. The files are removed when
+	// streaming ends.
+	TempSetPath string
+	// TempSetMemoryLimit is the maximum number of keys kept in memory when
+	// TempSetPath is set. Defaults to 1000000 keys.
+	TempSetMemoryLimit int
+	// BucketConcurrency is the number of buckets downloaded and decoded at
+	// the same time. Entries of the prefetched buckets are buffered until the
+	// reader gets to them so ledger entries are still returned in the same
+	// order as when buckets are read one by one (the default). Entries which
+	// don't fit in memory are spilled to temp files in TempSetPath (or the
+	// default temp directory).
+	BucketConcurrency int
+}
+
 // NewCheckpointChangeReader constructs a new CheckpointChangeReader instance.
 //
 // The ledger sequence must be a checkpoint ledger. By default (see
@@ -80,6 +107,17 @@ func NewCheckpointChangeReader(
 	ctx context.Context,
 	archive historyarchive.ArchiveInterface,
 	sequence uint32,
+) (*CheckpointChangeReader, error) {
+	return NewCheckpointChangeReaderWithOptions(ctx, archive, sequence, CheckpointChangeReaderOptions{})
+}
+
+// NewCheckpointChangeReaderWithOptions constructs a new CheckpointChangeReader
+// instance configured with the given options. See NewCheckpointChangeReader.
+func NewCheckpointChangeReaderWithOptions(
+	ctx context.Context,
+	archive historyarchive.ArchiveInterface,
+	sequence uint32,
+	options CheckpointChangeReaderOptions,
 ) (*CheckpointChangeReader, error) {
 	manager := archive.GetCheckpointManager()
 
@@ -99,23 +137,33 @@ func NewCheckpointChangeReader(
 		return nil, errors.Wrapf(err, "unable to get checkpoint HAS at ledger sequence %d", sequence)
 	}
 
-	tempStore := &memoryTempSet{}
+	var tempStore tempSet = &memoryTempSet{}
+	if options.TempSetPath != "" {
+		tempStore = newDiskTempSet(options.TempSetPath, options.TempSetMemoryLimit)
+	}
 	err = tempStore.Open()
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to get open temp store")
 	}
 
+	bucketConcurrency := options.BucketConcurrency
+	if bucketConcurrency < 1 {
+		bucketConcurrency = 1
+	}
+
 	return &CheckpointChangeReader{
-		ctx:        ctx,
-		has:        &has,
-		archive:    archive,
-		tempStore:  tempStore,
-		sequence:   sequence,
-		readChan:   make(chan readResult, msrBufferSize),
-		streamOnce: sync.Once{},
-		closeOnce:  sync.Once{},
-		done:       make(chan bool),
-		sleep:      time.Sleep,
+		ctx:               ctx,
+		has:               &has,
+		archive:           archive,
+		tempStore:         tempStore,
+		sequence:          sequence,
+		bucketConcurrency: bucketConcurrency,
+		spillPath:         options.TempSetPath,
+		readChan:          make(chan readResult, msrBufferSize),
+		streamOnce:        sync.Once{},
+		closeOnce:         sync.Once{},
+		done:              make(chan bool),
+		sleep:             time.Sleep,
 	}, nil
 }
 
@@ -189,6 +237,25 @@ func (r *CheckpointChangeReader) streamBuckets() {
 		}
 	}
 
+	// When bucketConcurrency > 1 the next buckets are read in the background
+	// while the current one is processed.
+	prefetched := make([]*prefetchedBucket, len(buckets))
+	prefetch := func(i int) {
+		if r.bucketConcurrency > 1 && i < len(buckets) {
+			prefetched[i] = r.prefetchBucket(buckets[i])
+		}
+	}
+	defer func() {
+		for _, bucket := range prefetched {
+			if bucket != nil {
+				bucket.close()
+			}
+		}
+	}()
+	for i := 0; i < r.bucketConcurrency; i++ {
+		prefetch(i)
+	}
+
 	for i, hash := range buckets {
 		exists, err := r.bucketExists(hash)
 		if err != nil {
@@ -205,8 +272,22 @@ func (r *CheckpointChangeReader) streamBuckets() {
 			return
 		}
 
+		var reader bucketReader
+		if prefetched[i] != nil {
+			reader = prefetched[i]
+			// The bucket is closed by streamBucketContents
+			prefetched[i] = nil
+			prefetch(i + r.bucketConcurrency)
+		} else {
+			reader, err = r.openBucket(hash)
+			if err != nil {
+				r.readChan <- r.error(err)
+				return
+			}
+		}
+
 		oldestBucket := i == len(buckets)-1
-		if shouldContinue := r.streamBucketContents(hash, oldestBucket); !shouldContinue {
+		if shouldContinue := r.streamBucketContents(hash, reader, oldestBucket); !shouldContinue {
 			break
 		}
 	}
@@ -274,18 +355,238 @@ func (r *CheckpointChangeReader) newXDRStream(hash historyarchive.Hash) (
 	return rdr, e
 }
 
-// streamBucketContents pushes value onto the read channel, returning false when the channel needs to be closed otherwise true
-func (r *CheckpointChangeReader) streamBucketContents(hash historyarchive.Hash, oldestBucket bool) bool {
-	rdr, e := r.newXDRStream(hash)
-	if e != nil {
-		r.readChan <- r.error(
-			errors.Wrapf(e, "cannot get xdr stream for hash '%s'", hash.String()),
-		)
-		return false
+// bucketReader reads entries of a single bucket.
+type bucketReader interface {
+	// read returns the next entry of the bucket or io.EOF at the end.
+	read() (xdr.BucketEntry, error)
+	close() error
+}
+
+// xdrBucketReader reads a bucket from a history archive stream.
+type xdrBucketReader struct {
+	r      *CheckpointChangeReader
+	stream *historyarchive.XdrStream
+	hash   historyarchive.Hash
+}
+
+func (r *CheckpointChangeReader) openBucket(hash historyarchive.Hash) (*xdrBucketReader, error) {
+	stream, err := r.newXDRStream(hash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get xdr stream for hash '%s'", hash.String())
+	}
+	return &xdrBucketReader{r: r, stream: stream, hash: hash}, nil
+}
+
+func (b *xdrBucketReader) read() (xdr.BucketEntry, error) {
+	return b.r.readBucketEntry(b.stream, b.hash)
+}
+
+func (b *xdrBucketReader) close() error {
+	return b.stream.Close()
+}
+
+// prefetchedBucket reads a bucket in a separate go routine. The first
+// preloadedEntries entries are buffered in memory, the following ones are
+// spilled to a temp file so the whole bucket is downloaded and decoded without
+// waiting for the reader to get to it.
+type prefetchedBucket struct {
+	// entries is closed when the bucket was read or when the following entries
+	// are spilled.
+	entries  chan xdr.BucketEntry
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	closeErr error
+
+	mutex     sync.Mutex
+	cond      *sync.Cond
+	spillFile string
+	// spilled is the number of entries flushed to spillFile.
+	spilled  int
+	finished bool
+	err      error
+
+	spillStream *historyarchive.XdrStream
+	spillRead   int
+}
+
+// spillFlushEntries is the number of entries spilled to a temp file before
+// they are made available to the reader.
+const spillFlushEntries = 1000
+
+func (r *CheckpointChangeReader) prefetchBucket(hash historyarchive.Hash) *prefetchedBucket {
+	bucket := &prefetchedBucket{
+		entries: make(chan xdr.BucketEntry, preloadedEntries),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	bucket.cond = sync.NewCond(&bucket.mutex)
+
+	go func() {
+		defer close(bucket.done)
+		err := bucket.fill(r, hash)
+
+		bucket.mutex.Lock()
+		bucket.finished = true
+		bucket.err = err
+		bucket.cond.Broadcast()
+		bucket.mutex.Unlock()
+	}()
+
+	return bucket
+}
+
+// fill reads all entries of the bucket into the memory buffer and the spill
+// file. It closes entries before returning.
+func (b *prefetchedBucket) fill(r *CheckpointChangeReader, hash historyarchive.Hash) error {
+	spilling := false
+	defer func() {
+		if !spilling {
+			close(b.entries)
+		}
+	}()
+
+	reader, err := r.openBucket(hash)
+	if err != nil {
+		return err
+	}
+
+	var (
+		file    *os.File
+		writer  *bufio.Writer
+		pending int
+	)
+	flush := func() error {
+		if err := writer.Flush(); err != nil {
+			return errors.Wrap(err, "error flushing spilled bucket entries")
+		}
+		b.mutex.Lock()
+		b.spilled += pending
+		b.cond.Broadcast()
+		b.mutex.Unlock()
+		pending = 0
+		return nil
+	}
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-b.stop:
+			reader.close()
+			return nil
+		default:
+		}
+
+		entry, err := reader.read()
+		if err == io.EOF {
+			b.closeErr = reader.close()
+			break
+		}
+		if err != nil {
+			reader.close()
+			return err
+		}
+
+		if !spilling {
+			select {
+			case b.entries <- entry:
+				continue
+			default:
+			}
+
+			// The memory buffer is full, the following entries are spilled.
+			file, err = ioutil.TempFile(r.spillPath, "bucket-*.xdr")
+			if err != nil {
+				reader.close()
+				return errors.Wrap(err, "error creating spill file")
+			}
+			b.mutex.Lock()
+			b.spillFile = file.Name()
+			b.mutex.Unlock()
+			writer = bufio.NewWriter(file)
+			spilling = true
+			close(b.entries)
+		}
+
+		if err = xdr.MarshalFramed(writer, entry); err != nil {
+			reader.close()
+			return errors.Wrap(err, "error spilling bucket entry")
+		}
+		pending++
+		if pending == spillFlushEntries {
+			if err = flush(); err != nil {
+				reader.close()
+				return err
+			}
+		}
 	}
 
+	if spilling {
+		return flush()
+	}
+	return nil
+}
+
+func (b *prefetchedBucket) read() (xdr.BucketEntry, error) {
+	if entry, ok := <-b.entries; ok {
+		return entry, nil
+	}
+
+	b.mutex.Lock()
+	for b.spillRead >= b.spilled && !b.finished {
+		b.cond.Wait()
+	}
+	spillFile, available, err := b.spillFile, b.spillRead < b.spilled, b.err
+	b.mutex.Unlock()
+
+	if !available {
+		if err != nil {
+			return xdr.BucketEntry{}, err
+		}
+		return xdr.BucketEntry{}, io.EOF
+	}
+
+	if b.spillStream == nil {
+		file, openErr := os.Open(spillFile)
+		if openErr != nil {
+			return xdr.BucketEntry{}, errors.Wrap(openErr, "error opening spill file")
+		}
+		b.spillStream = historyarchive.NewXdrStream(file)
+	}
+
+	var entry xdr.BucketEntry
+	if err = b.spillStream.ReadOne(&entry); err != nil {
+		return xdr.BucketEntry{}, errors.Wrap(err, "error reading spilled bucket entry")
+	}
+	b.spillRead++
+	return entry, nil
+}
+
+// close stops reading the bucket, removes the spill file and returns the error
+// of closing the stream if the bucket was read to the end.
+func (b *prefetchedBucket) close() error {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+	})
+	<-b.done
+
+	if b.spillStream != nil {
+		b.spillStream.Close()
+	}
+	if b.spillFile != "" {
+		os.Remove(b.spillFile)
+	}
+	return b.closeErr
+}
+
+// streamBucketContents pushes value onto the read channel, returning false when the channel needs to be closed otherwise true
+func (r *CheckpointChangeReader) streamBucketContents(hash historyarchive.Hash, rdr bucketReader, oldestBucket bool) bool {
 	defer func() {
-		err := rdr.Close()
+		err := rdr.close()
 		if err != nil {
 			r.readChan <- r.error(errors.Wrap(err, "Error closing xdr stream"))
 			// Stop streaming from the rest of the files.
@@ -312,8 +613,7 @@ LoopBucketEntry:
 			preloadKeys := []string{}
 
 			for i := 0; i < preloadedEntries; i++ {
-				var entry xdr.BucketEntry
-				entry, e = r.readBucketEntry(rdr, hash)
+				entry, e := rdr.read()
 				if e != nil {
 					if e == io.EOF {
 						if len(batch) == 0 {
@@ -133,6 +133,87 @@ func (s *SingleLedgerStateReaderTestSuite) TestRemoved() {
 	s.Require().Equal(err, io.EOF)
 }
 
+// TestBucketConcurrency tests that entries shadowed by newer buckets are
+// skipped when buckets are read at the same time.
+func (s *SingleLedgerStateReaderTestSuite) TestBucketConcurrency() {
+	s.reader.bucketConcurrency = 4
+
+	curr1 := createXdrStream(
+		entryAccount(xdr.BucketEntryTypeDeadentry, "GC3C4AKRBQLHOJ45U4XG35ESVWRDECWO5XLDGYADO6DPR3L7KIDVUMML", 1),
+	)
+
+	snap1 := createXdrStream(
+		entryAccount(xdr.BucketEntryTypeLiveentry, "GC3C4AKRBQLHOJ45U4XG35ESVWRDECWO5XLDGYADO6DPR3L7KIDVUMML", 1),
+		entryAccount(xdr.BucketEntryTypeLiveentry, "GALPCCZN4YXA3YMJHKL6CVIECKPLJJCTVMSNYWBTKJW4K5HQLYLDMZTB", 2),
+	)
+
+	curr2 := createXdrStream(
+		entryAccount(xdr.BucketEntryTypeLiveentry, "GALPCCZN4YXA3YMJHKL6CVIECKPLJJCTVMSNYWBTKJW4K5HQLYLDMZTB", 1),
+	)
+
+	nextBucket := s.getNextBucketChannel()
+
+	for _, stream := range []*historyarchive.XdrStream{curr1, snap1, curr2} {
+		s.mockArchive.
+			On("GetXdrStreamForHash", <-nextBucket).
+			Return(stream, nil).Once()
+	}
+
+	for hash := range nextBucket {
+		s.mockArchive.
+			On("GetXdrStreamForHash", hash).
+			Return(createXdrStream(), nil).Once()
+	}
+
+	change, err := s.reader.Read()
+	s.Require().NoError(err)
+	account := change.Post.Data.MustAccount()
+	s.Assert().Equal("GALPCCZN4YXA3YMJHKL6CVIECKPLJJCTVMSNYWBTKJW4K5HQLYLDMZTB", account.AccountId.Address())
+	s.Assert().Equal(xdr.Int64(2), account.Balance)
+
+	_, err = s.reader.Read()
+	s.Require().Equal(err, io.EOF)
+}
+
+// TestPrefetchedBucketSpill tests that a prefetched bucket larger than the
+// memory buffer is read to the end without a reader, and that its entries are
+// returned in order.
+func (s *SingleLedgerStateReaderTestSuite) TestPrefetchedBucketSpill() {
+	s.reader.spillPath = s.T().TempDir()
+	// the bucket list is not streamed
+	s.mockBucketExistsCall.Times(0).Maybe()
+
+	count := preloadedEntries + spillFlushEntries + 10
+	var entries []xdr.BucketEntry
+	for i := 0; i < count; i++ {
+		entries = append(entries, entryAccount(
+			xdr.BucketEntryTypeLiveentry,
+			"GALPCCZN4YXA3YMJHKL6CVIECKPLJJCTVMSNYWBTKJW4K5HQLYLDMZTB",
+			uint32(i),
+		))
+	}
+	hash := historyarchive.Hash{1}
+	s.mockArchive.
+		On("GetXdrStreamForHash", hash).
+		Return(createXdrStream(entries...), nil).Once()
+
+	bucket := s.reader.prefetchBucket(hash)
+	<-bucket.done
+	s.Require().NotEmpty(bucket.spillFile)
+	s.Require().FileExists(bucket.spillFile)
+
+	for i := 0; i < count; i++ {
+		entry, err := bucket.read()
+		s.Require().NoError(err)
+		s.Require().Equal(xdr.Int64(i), entry.LiveEntry.Data.MustAccount().Balance)
+	}
+	_, err := bucket.read()
+	s.Require().Equal(io.EOF, err)
+
+	s.Require().NoError(bucket.close())
+	s.Require().NoFileExists(bucket.spillFile)
+}
+
 // TestConcurrentRead test concurrent reads for race conditions
 func (s *SingleLedgerStateReaderTestSuite) TestConcurrentRead() {
 	curr1 := createXdrStream(
@@ -0,0 +1,334 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/stellar/go/support/errors"
+)
+
+const (
+	// defaultDiskTempSetMemoryLimit is the default number of keys kept in
+	// memory by diskTempSet before they are written to a file.
+	defaultDiskTempSetMemoryLimit = 1000000
+	// diskTempSetBlockKeys is the number of keys in a single block of a
+	// diskTempSet file. The first key of every block is kept in memory.
+	diskTempSetBlockKeys = 128
+	// diskTempSetMaxFiles is the maximum number of files a diskTempSet keeps.
+	// Files are merged into one when there are more.
+	diskTempSetMaxFiles = 8
+)
+
+// tempSetKey is a SHA-256 hash of a key added to diskTempSet. Using fixed
+// size keys allows searching the files without reading them in full.
+type tempSetKey [sha256.Size]byte
+
+// diskTempSet is an implementation of TempSet interface keeping at most
+// memoryLimit keys in memory. When the limit is reached the keys are sorted
+// and written to a file in a temporary directory created in dir. Files are
+// searched using an in-memory index of the first key of every block so
+// memory usage stays bounded for sets of any size.
+type diskTempSet struct {
+	dir         string
+	memoryLimit int
+
+	tmpDir    string
+	memory    map[tempSetKey]struct{}
+	preloaded map[tempSetKey]bool
+	files     []*tempSetFile
+}
+
+// newDiskTempSet returns a diskTempSet storing files in dir. The default limit
+// is used when memoryLimit is not positive.
+func newDiskTempSet(dir string, memoryLimit int) *diskTempSet {
+	if memoryLimit <= 0 {
+		memoryLimit = defaultDiskTempSetMemoryLimit
+	}
+	return &diskTempSet{
+		dir:         dir,
+		memoryLimit: memoryLimit,
+	}
+}
+
+// Open creates a temporary directory for files.
+func (s *diskTempSet) Open() error {
+	tmpDir, err := ioutil.TempDir(s.dir, "temp-set")
+	if err != nil {
+		return errors.Wrap(err, "error creating temp set directory")
+	}
+	s.tmpDir = tmpDir
+	s.memory = map[tempSetKey]struct{}{}
+	s.preloaded = map[tempSetKey]bool{}
+	s.files = nil
+	return nil
+}
+
+// Add adds a key to TempSet.
+func (s *diskTempSet) Add(key string) error {
+	hash := tempSetKey(sha256.Sum256([]byte(key)))
+	s.memory[hash] = struct{}{}
+	if _, ok := s.preloaded[hash]; ok {
+		s.preloaded[hash] = true
+	}
+
+	if len(s.memory) >= s.memoryLimit {
+		return s.spill()
+	}
+	return nil
+}
+
+// Preload looks up keys in files in a single pass so following Exist calls
+// for these keys do not read files.
+func (s *diskTempSet) Preload(keys []string) error {
+	s.preloaded = make(map[tempSetKey]bool, len(keys))
+
+	hashes := make([]tempSetKey, 0, len(keys))
+	for _, key := range keys {
+		hashes = append(hashes, sha256.Sum256([]byte(key)))
+	}
+	// Sorting the keys makes lookups in the same block of a file consecutive
+	// so the block is read only once.
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+
+	for _, hash := range hashes {
+		exists, err := s.existInFiles(hash)
+		if err != nil {
+			return err
+		}
+		s.preloaded[hash] = exists
+	}
+	return nil
+}
+
+// Exist check if the key exists in a TempSet.
+func (s *diskTempSet) Exist(key string) (bool, error) {
+	hash := tempSetKey(sha256.Sum256([]byte(key)))
+	if _, ok := s.memory[hash]; ok {
+		return true, nil
+	}
+	if exists, ok := s.preloaded[hash]; ok {
+		return exists, nil
+	}
+	return s.existInFiles(hash)
+}
+
+// Close closes and removes all files.
+func (s *diskTempSet) Close() error {
+	for _, file := range s.files {
+		file.file.Close()
+	}
+	s.files = nil
+	s.memory = nil
+	s.preloaded = nil
+
+	if s.tmpDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(s.tmpDir)
+	s.tmpDir = ""
+	if err != nil {
+		return errors.Wrap(err, "error removing temp set directory")
+	}
+	return nil
+}
+
+func (s *diskTempSet) existInFiles(hash tempSetKey) (bool, error) {
+	for _, file := range s.files {
+		exists, err := file.contains(hash)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// spill writes keys kept in memory to a new file.
+func (s *diskTempSet) spill() error {
+	hashes := make([]tempSetKey, 0, len(s.memory))
+	for hash := range s.memory {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+
+	i := 0
+	file, err := s.writeFile(func() (tempSetKey, bool, error) {
+		if i == len(hashes) {
+			return tempSetKey{}, false, nil
+		}
+		i++
+		return hashes[i-1], true, nil
+	})
+	if err != nil {
+		return err
+	}
+	s.files = append(s.files, file)
+	s.memory = map[tempSetKey]struct{}{}
+
+	if len(s.files) > diskTempSetMaxFiles {
+		return s.merge()
+	}
+	return nil
+}
+
+// merge merges all files into a single one.
+func (s *diskTempSet) merge() error {
+	readers := make([]*bufio.Reader, len(s.files))
+	heads := make([]*tempSetKey, len(s.files))
+	for i, file := range s.files {
+		readers[i] = bufio.NewReader(io.NewSectionReader(file.file, 0, file.size()))
+	}
+
+	// next reads the next key of the i-th file into heads.
+	next := func(i int) error {
+		var hash tempSetKey
+		if _, err := io.ReadFull(readers[i], hash[:]); err == io.EOF {
+			heads[i] = nil
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "error reading temp set file")
+		}
+		heads[i] = &hash
+		return nil
+	}
+	for i := range readers {
+		if err := next(i); err != nil {
+			return err
+		}
+	}
+
+	var last *tempSetKey
+	merged, err := s.writeFile(func() (tempSetKey, bool, error) {
+		for {
+			min := -1
+			for i, head := range heads {
+				if head != nil && (min == -1 || bytes.Compare(head[:], heads[min][:]) < 0) {
+					min = i
+				}
+			}
+			if min == -1 {
+				return tempSetKey{}, false, nil
+			}
+
+			hash := *heads[min]
+			if err := next(min); err != nil {
+				return tempSetKey{}, false, err
+			}
+			// The same key can be in many files
+			if last != nil && *last == hash {
+				continue
+			}
+			last = &hash
+			return hash, true, nil
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, file := range s.files {
+		file.file.Close()
+		if err := os.Remove(file.file.Name()); err != nil {
+			return errors.Wrap(err, "error removing temp set file")
+		}
+	}
+	s.files = []*tempSetFile{merged}
+	return nil
+}
+
+// writeFile writes sorted keys returned by next to a new file.
+func (s *diskTempSet) writeFile(next func() (tempSetKey, bool, error)) (*tempSetFile, error) {
+	file, err := ioutil.TempFile(s.tmpDir, "keys")
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating temp set file")
+	}
+
+	result := &tempSetFile{file: file, cachedBlock: -1}
+	writer := bufio.NewWriter(file)
+	for {
+		hash, ok, err := next()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		if result.keys%diskTempSetBlockKeys == 0 {
+			result.index = append(result.index, hash)
+		}
+		if _, err = writer.Write(hash[:]); err != nil {
+			file.Close()
+			return nil, errors.Wrap(err, "error writing temp set file")
+		}
+		result.keys++
+	}
+
+	if err = writer.Flush(); err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "error writing temp set file")
+	}
+	return result, nil
+}
+
+// tempSetFile is a file with sorted keys.
+type tempSetFile struct {
+	file *os.File
+	keys int64
+	// index contains the first key of every block
+	index []tempSetKey
+
+	cachedBlock int
+	cache       []byte
+}
+
+func (f *tempSetFile) size() int64 {
+	return f.keys * sha256.Size
+}
+
+func (f *tempSetFile) contains(hash tempSetKey) (bool, error) {
+	// Find the last block starting with a key lower or equal to hash
+	block := sort.Search(len(f.index), func(i int) bool {
+		return bytes.Compare(f.index[i][:], hash[:]) > 0
+	}) - 1
+	if block < 0 {
+		return false, nil
+	}
+
+	if block != f.cachedBlock {
+		offset := int64(block) * diskTempSetBlockKeys * sha256.Size
+		length := int64(diskTempSetBlockKeys * sha256.Size)
+		if offset+length > f.size() {
+			length = f.size() - offset
+		}
+
+		f.cache = f.cache[:0]
+		if int64(cap(f.cache)) < length {
+			f.cache = make([]byte, 0, diskTempSetBlockKeys*sha256.Size)
+		}
+		f.cache = f.cache[:length]
+		f.cachedBlock = -1
+		if _, err := f.file.ReadAt(f.cache, offset); err != nil {
+			return false, errors.Wrap(err, "error reading temp set file")
+		}
+		f.cachedBlock = block
+	}
+
+	keys := len(f.cache) / sha256.Size
+	i := sort.Search(keys, func(i int) bool {
+		return bytes.Compare(f.cache[i*sha256.Size:(i+1)*sha256.Size], hash[:]) >= 0
+	})
+	return i < keys && bytes.Equal(f.cache[i*sha256.Size:(i+1)*sha256.Size], hash[:]), nil
+}
@@ -0,0 +1,109 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stellar/go/historyarchive"
+)
+
+func TestDiskTempSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-temp-set")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := newDiskTempSet(dir, 7)
+	require.NoError(t, s.Open())
+
+	// Enough keys to create more files than diskTempSetMaxFiles
+	for i := 0; i < 1000; i += 2 {
+		require.NoError(t, s.Add(fmt.Sprintf("key-%d", i)))
+	}
+	assert.True(t, len(s.files) <= diskTempSetMaxFiles+1)
+	assert.NotEmpty(t, s.memory)
+
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+	require.NoError(t, s.Preload(keys[:500]))
+
+	for i, key := range keys {
+		exists, err := s.Exist(key)
+		require.NoError(t, err)
+		assert.Equal(t, i%2 == 0, exists, key)
+	}
+
+	// Adding a preloaded key is visible after the key is written to a file
+	require.NoError(t, s.Add("key-1"))
+	for len(s.memory) > 0 {
+		require.NoError(t, s.Add(fmt.Sprintf("other-%d", len(s.memory))))
+	}
+	exists, err := s.Exist("key-1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	tmpDir := s.tmpDir
+	require.NoError(t, s.Close())
+	_, err = os.Stat(tmpDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDiskTempSetMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-temp-set")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := newDiskTempSet(dir, 200)
+	require.NoError(t, s.Open())
+	defer s.Close()
+
+	// The same keys in every file
+	for i := 0; i <= diskTempSetMaxFiles; i++ {
+		for j := 0; j < 200; j++ {
+			require.NoError(t, s.Add(fmt.Sprintf("key-%d", j)))
+		}
+	}
+	require.Len(t, s.files, 1)
+	assert.Equal(t, int64(200), s.files[0].keys)
+	assert.Len(t, s.files[0].index, 2)
+
+	for j := 0; j < 200; j++ {
+		exists, err := s.Exist(fmt.Sprintf("key-%d", j))
+		require.NoError(t, err)
+		assert.True(t, exists)
+	}
+	exists, err := s.Exist("key-200")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestCheckpointChangeReaderDiskTempSet(t *testing.T) {
+	archive := &historyarchive.MockArchive{}
+	archive.
+		On("GetCheckpointManager").
+		Return(historyarchive.NewCheckpointManager(historyarchive.DefaultCheckpointFrequency))
+	archive.
+		On("GetCheckpointHAS", uint32(63)).
+		Return(historyarchive.HistoryArchiveState{}, nil)
+
+	dir, err := ioutil.TempDir("", "disk-temp-set")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	reader, err := NewCheckpointChangeReaderWithOptions(
+		context.Background(),
+		archive,
+		63,
+		CheckpointChangeReaderOptions{TempSetPath: dir},
+	)
+	require.NoError(t, err)
+	assert.IsType(t, &diskTempSet{}, reader.tempStore)
+	assert.NoError(t, reader.tempStore.Close())
+}
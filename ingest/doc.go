@@ -33,5 +33,16 @@ Currently there are three types of readers:
 
 Warning: Readers stream BOTH successful and failed transactions; check
          transactions status in your application if required.
+
+LedgerTransaction.Effects and LedgerTransaction.Participants return the
+effects and participants of a transaction exactly as Horizon ingests them.
+
+Streaming Ledger Ranges
+
+LedgerStream reads a range of ledgers from a ledger backend and passes
+ledgers, transactions or changes to a handler function. Ledgers are fetched
+ahead of the handler up to LedgerStreamConfig.BufferSize ledgers. An optional
+Cursor (like FileCursor) stores the last processed ledger so a restarted
+application continues where it stopped.
 */
 package ingest
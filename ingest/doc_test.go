@@ -131,3 +131,45 @@ func Example_changes() {
 		}
 	}
 }
+
+// Example_stream demonstrates how to count successful transactions in all
+// ledgers since ledger 1000 and resume counting after a restart.
+func Example_stream() {
+	archiveURL := "http://history.stellar.org/prd/core-live/core_live_001"
+	networkPassphrase := network.PublicNetworkPassphrase
+
+	// Requires Stellar-Core 13.2.0+
+	backend, err := ledgerbackend.NewCaptive(
+		ledgerbackend.CaptiveCoreConfig{
+			BinaryPath:         "/bin/stellar-core",
+			ConfigAppendPath:   "/opt/stellar-core.cfg",
+			NetworkPassphrase:  networkPassphrase,
+			HistoryArchiveURLs: []string{archiveURL},
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	stream, err := NewLedgerStream(LedgerStreamConfig{
+		Backend:           backend,
+		NetworkPassphrase: networkPassphrase,
+		Range:             ledgerbackend.UnboundedRange(1000),
+		Cursor:            &FileCursor{Path: "/var/lib/indexer/cursor"},
+		BufferSize:        10,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	successful := 0
+	err = stream.StreamTransactions(context.TODO(), func(header xdr.LedgerHeaderHistoryEntry, tx LedgerTransaction) error {
+		if tx.Result.Successful() {
+			successful++
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
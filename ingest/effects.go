@@ -0,0 +1,1177 @@
+package ingest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// EffectType is the numeric type for an effect. Horizon stores it in the
+// `type` field of the `history_effects` table.
+type EffectType int
+
+const (
+	// account effects
+
+	// EffectAccountCreated effects occur when a new account is created
+	EffectAccountCreated EffectType = 0 // from create_account
+
+	// EffectAccountRemoved effects occur when one account is merged into another
+	EffectAccountRemoved EffectType = 1 // from merge_account
+
+	// EffectAccountCredited effects occur when an account receives some currency
+	EffectAccountCredited EffectType = 2 // from create_account, payment, path_payment, merge_account
+
+	// EffectAccountDebited effects occur when an account sends some currency
+	EffectAccountDebited EffectType = 3 // from create_account, payment, path_payment, create_account
+
+	// EffectAccountThresholdsUpdated effects occur when an account changes its
+	// multisig thresholds.
+	EffectAccountThresholdsUpdated EffectType = 4 // from set_options
+
+	// EffectAccountHomeDomainUpdated effects occur when an account changes its
+	// home domain.
+	EffectAccountHomeDomainUpdated EffectType = 5 // from set_options
+
+	// EffectAccountFlagsUpdated effects occur when an account changes its
+	// account flags, either clearing or setting.
+	EffectAccountFlagsUpdated EffectType = 6 // from set_options
+
+	// EffectAccountInflationDestinationUpdated effects occur when an account changes its
+	// inflation destination.
+	EffectAccountInflationDestinationUpdated EffectType = 7 // from set_options
+
+	// signer effects
+
+	// EffectSignerCreated occurs when an account gains a signer
+	EffectSignerCreated EffectType = 10 // from set_options
+
+	// EffectSignerRemoved occurs when an account loses a signer
+	EffectSignerRemoved EffectType = 11 // from set_options
+
+	// EffectSignerUpdated occurs when an account changes the weight of one of its
+	// signers.
+	EffectSignerUpdated EffectType = 12 // from set_options
+
+	// trustline effects
+
+	// EffectTrustlineCreated occurs when an account trusts an anchor
+	EffectTrustlineCreated EffectType = 20 // from change_trust
+
+	// EffectTrustlineRemoved occurs when an account removes struct by setting the
+	// limit of a trustline to 0
+	EffectTrustlineRemoved EffectType = 21 // from change_trust
+
+	// EffectTrustlineUpdated occurs when an account changes a trustline's limit
+	EffectTrustlineUpdated EffectType = 22 // from change_trust, allow_trust
+
+	// Deprecated: use EffectTrustlineFlagsUpdated instead.
+	// EffectTrustlineAuthorized occurs when an anchor has AUTH_REQUIRED flag set
+	// to true and it authorizes another account's trustline
+	EffectTrustlineAuthorized EffectType = 23 // from allow_trust
+
+	// Deprecated: use EffectTrustlineFlagsUpdated instead.
+	// EffectTrustlineDeauthorized occurs when an anchor revokes access to a asset
+	// it issues.
+	EffectTrustlineDeauthorized EffectType = 24 // from allow_trust
+
+	// Deprecated: use EffectTrustlineFlagsUpdated instead.
+	// EffectTrustlineAuthorizedToMaintainLiabilities occurs when an anchor has AUTH_REQUIRED flag set
+	// to true and it authorizes another account's trustline to maintain liabilities
+	EffectTrustlineAuthorizedToMaintainLiabilities EffectType = 25 // from allow_trust
+
+	// EffectTrustlineFlagsUpdated effects occur when a TrustLine changes its
+	// flags, either clearing or setting.
+	EffectTrustlineFlagsUpdated EffectType = 26 // from set_trust_line flags
+
+	// trading effects
+
+	// EffectOfferCreated occurs when an account offers to trade an asset
+	EffectOfferCreated EffectType = 30 // from manage_offer, creat_passive_offer
+
+	// EffectOfferRemoved occurs when an account removes an offer
+	EffectOfferRemoved EffectType = 31 // from manage_offer, create_passive_offer, path_payment
+
+	// EffectOfferUpdated occurs when an offer is updated by the offering account.
+	EffectOfferUpdated EffectType = 32 // from manage_offer, creat_passive_offer, path_payment
+
+	// EffectTrade occurs when a trade is initiated because of a path payment or
+	// offer operation.
+	EffectTrade EffectType = 33 // from manage_offer, creat_passive_offer, path_payment
+
+	// data effects
+
+	// EffectDataCreated occurs when an account gets a new data field
+	EffectDataCreated EffectType = 40 // from manage_data
+
+	// EffectDataRemoved occurs when an account removes a data field
+	EffectDataRemoved EffectType = 41 // from manage_data
+
+	// EffectDataUpdated occurs when an account changes a data field's value
+	EffectDataUpdated EffectType = 42 // from manage_data
+
+	// EffectSequenceBumped occurs when an account bumps their sequence number
+	EffectSequenceBumped EffectType = 43 // from bump_sequence
+
+	// claimable balance effects
+
+	// EffectClaimableBalanceCreated occurs when a claimable balance is created
+	EffectClaimableBalanceCreated EffectType = 50 // from create_claimable_balance
+
+	// EffectClaimableBalanceClaimantCreated occurs when a claimable balance claimant is created
+	EffectClaimableBalanceClaimantCreated EffectType = 51 // from create_claimable_balance
+
+	// EffectClaimableBalanceClaimed occurs when a claimable balance is claimed
+	EffectClaimableBalanceClaimed EffectType = 52 // from claim_claimable_balance
+
+	// sponsorship effects
+
+	// EffectAccountSponsorshipCreated occurs when an account ledger entry is sponsored
+	EffectAccountSponsorshipCreated EffectType = 60 // from create_account
+
+	// EffectAccountSponsorshipUpdated occurs when the sponsoring of an account ledger entry is updated
+	EffectAccountSponsorshipUpdated EffectType = 61 // from revoke_sponsorship
+
+	// EffectAccountSponsorshipRemoved occurs when the sponsorship of an account ledger entry is removed
+	EffectAccountSponsorshipRemoved EffectType = 62 // from revoke_sponsorship
+
+	// EffectTrustlineSponsorshipCreated occurs when a trustline ledger entry is sponsored
+	EffectTrustlineSponsorshipCreated EffectType = 63 // from change_trust
+
+	// EffectTrustlineSponsorshipUpdated occurs when the sponsoring of a trustline ledger entry is updated
+	EffectTrustlineSponsorshipUpdated EffectType = 64 // from revoke_sponsorship
+
+	// EffectTrustlineSponsorshipRemoved occurs when the sponsorship of a trustline ledger entry is removed
+	EffectTrustlineSponsorshipRemoved EffectType = 65 // from revoke_sponsorship
+
+	// EffectDataSponsorshipCreated occurs when a trustline ledger entry is sponsored
+	EffectDataSponsorshipCreated EffectType = 66 // from manage_data
+
+	// EffectDataSponsorshipUpdated occurs when the sponsoring of a trustline ledger entry is updated
+	EffectDataSponsorshipUpdated EffectType = 67 // from revoke_sponsorship
+
+	// EffectDataSponsorshipRemoved occurs when the sponsorship of a trustline ledger entry is removed
+	EffectDataSponsorshipRemoved EffectType = 68 // from revoke_sponsorship
+
+	// EffectClaimableBalanceSponsorshipCreated occurs when a claimable balance ledger entry is sponsored
+	EffectClaimableBalanceSponsorshipCreated EffectType = 69 // from create_claimable_balance
+
+	// EffectClaimableBalanceSponsorshipUpdated occurs when the sponsoring of a claimable balance ledger entry
+	// is updated
+	EffectClaimableBalanceSponsorshipUpdated EffectType = 70 // from revoke_sponsorship
+
+	// EffectClaimableBalanceSponsorshipRemoved occurs when the sponsorship of a claimable balance ledger entry
+	// is removed
+	EffectClaimableBalanceSponsorshipRemoved EffectType = 71 // from claim_claimable_balance
+
+	// EffectSignerSponsorshipCreated occurs when the sponsorship of a signer is created
+	EffectSignerSponsorshipCreated EffectType = 72 // from set_options
+
+	// EffectSignerSponsorshipUpdated occurs when the sponsorship of a signer is updated
+	EffectSignerSponsorshipUpdated EffectType = 73 // from revoke_sponsorship
+
+	// EffectSignerSponsorshipRemoved occurs when the sponsorship of a signer is removed
+	EffectSignerSponsorshipRemoved EffectType = 74 // from revoke_sponsorship
+
+	// EffectClaimableBalanceClawedBack occurs when a claimable balance is clawed back
+	EffectClaimableBalanceClawedBack EffectType = 80 // from clawback_claimable_balance
+)
+
+// Effect represents a single change caused by an operation to an account,
+// exactly like effects served by Horizon.
+type Effect struct {
+	// Address is the account affected by the effect.
+	Address string
+	// OperationIndex is the index of the operation in the transaction.
+	OperationIndex uint32
+	Type           EffectType
+	// Order is the position of the effect among the effects of the
+	// operation, starting at 1.
+	Order   uint32
+	Details map[string]interface{}
+}
+
+// Effects returns the effects of all operations in the transaction. Failed
+// transactions have no effects. It returns ErrMetaUnavailable if the
+// transaction has no meta (see HasMeta).
+func (t *LedgerTransaction) Effects() ([]Effect, error) {
+	effects := []Effect{}
+	for _, operation := range t.Operations() {
+		operationEffects, err := operation.Effects()
+		if err == ErrMetaUnavailable {
+			return nil, err
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "reading operation %d effects", operation.Index)
+		}
+		effects = append(effects, operationEffects...)
+	}
+	return effects, nil
+}
+
+// Effects returns the effects of the operation in the same order Horizon
+// ingests them. Operations of failed transactions have no effects.
+func (operation *LedgerOperation) Effects() ([]Effect, error) {
+	if !operation.Transaction.Result.Successful() {
+		return []Effect{}, nil
+	}
+	var (
+		op  = operation.Operation
+		err error
+	)
+
+	changes, err := operation.Transaction.GetOperationChanges(operation.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapper := &effectsWrapper{
+		effects:   []Effect{},
+		operation: operation,
+	}
+
+	switch operation.OperationType() {
+	case xdr.OperationTypeCreateAccount:
+		wrapper.addAccountCreatedEffects()
+	case xdr.OperationTypePayment:
+		wrapper.addPaymentEffects()
+	case xdr.OperationTypePathPaymentStrictReceive:
+		wrapper.pathPaymentStrictReceiveEffects()
+	case xdr.OperationTypePathPaymentStrictSend:
+		wrapper.addPathPaymentStrictSendEffects()
+	case xdr.OperationTypeManageSellOffer:
+		wrapper.addManageSellOfferEffects()
+	case xdr.OperationTypeManageBuyOffer:
+		wrapper.addManageBuyOfferEffects()
+	case xdr.OperationTypeCreatePassiveSellOffer:
+		wrapper.addCreatePassiveSellOfferEffect()
+	case xdr.OperationTypeSetOptions:
+		wrapper.addSetOptionsEffects()
+	case xdr.OperationTypeChangeTrust:
+		err = wrapper.addChangeTrustEffects()
+	case xdr.OperationTypeAllowTrust:
+		wrapper.addAllowTrustEffects()
+	case xdr.OperationTypeAccountMerge:
+		wrapper.addAccountMergeEffects()
+	case xdr.OperationTypeInflation:
+		wrapper.addInflationEffects()
+	case xdr.OperationTypeManageData:
+		err = wrapper.addManageDataEffects()
+	case xdr.OperationTypeBumpSequence:
+		err = wrapper.addBumpSequenceEffects()
+	case xdr.OperationTypeCreateClaimableBalance:
+		err = wrapper.addCreateClaimableBalanceEffects(changes)
+	case xdr.OperationTypeClaimClaimableBalance:
+		err = wrapper.addClaimClaimableBalanceEffects(changes)
+	case xdr.OperationTypeBeginSponsoringFutureReserves, xdr.OperationTypeEndSponsoringFutureReserves, xdr.OperationTypeRevokeSponsorship:
+	// The effects of these operations are obtained  indirectly from the ledger entries
+	case xdr.OperationTypeClawback:
+		err = wrapper.addClawbackEffects()
+	case xdr.OperationTypeClawbackClaimableBalance:
+		err = wrapper.addClawbackClaimableBalanceEffects(changes)
+	case xdr.OperationTypeSetTrustLineFlags:
+		err = wrapper.addSetTrustLineFlagsEffects()
+	default:
+		return nil, fmt.Errorf("Unknown operation type: %s", op.Body.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if err = wrapper.addLedgerEntrySponsorshipEffects(change); err != nil {
+			return nil, err
+		}
+		wrapper.addSignerSponsorshipEffects(change)
+	}
+
+	return wrapper.effects, nil
+}
+
+type effectsWrapper struct {
+	effects   []Effect
+	operation *LedgerOperation
+}
+
+func (e *effectsWrapper) add(address string, effectType EffectType, details map[string]interface{}) {
+	e.effects = append(e.effects, Effect{
+		Address:        address,
+		OperationIndex: e.operation.Index,
+		Type:           effectType,
+		Order:          uint32(len(e.effects) + 1),
+		Details:        details,
+	})
+}
+
+var sponsoringEffectsTable = map[xdr.LedgerEntryType]struct {
+	created, updated, removed EffectType
+}{
+	xdr.LedgerEntryTypeAccount: {
+		created: EffectAccountSponsorshipCreated,
+		updated: EffectAccountSponsorshipUpdated,
+		removed: EffectAccountSponsorshipRemoved,
+	},
+	xdr.LedgerEntryTypeTrustline: {
+		created: EffectTrustlineSponsorshipCreated,
+		updated: EffectTrustlineSponsorshipUpdated,
+		removed: EffectTrustlineSponsorshipRemoved,
+	},
+	xdr.LedgerEntryTypeData: {
+		created: EffectDataSponsorshipCreated,
+		updated: EffectDataSponsorshipUpdated,
+		removed: EffectDataSponsorshipRemoved,
+	},
+	xdr.LedgerEntryTypeClaimableBalance: {
+		created: EffectClaimableBalanceSponsorshipCreated,
+		updated: EffectClaimableBalanceSponsorshipUpdated,
+		removed: EffectClaimableBalanceSponsorshipRemoved,
+	},
+
+	// We intentionally don't have Sponsoring effects for Offer
+	// entries because we don't generate creation effects for them.
+}
+
+func (e *effectsWrapper) addSignerSponsorshipEffects(change Change) {
+	if change.Type != xdr.LedgerEntryTypeAccount {
+		return
+	}
+
+	preSigners := map[string]xdr.AccountId{}
+	postSigners := map[string]xdr.AccountId{}
+	if change.Pre != nil {
+		account := change.Pre.Data.MustAccount()
+		preSigners = account.SponsorPerSigner()
+	}
+	if change.Post != nil {
+		account := change.Post.Data.MustAccount()
+		postSigners = account.SponsorPerSigner()
+	}
+
+	var all []string
+	for signer := range preSigners {
+		all = append(all, signer)
+	}
+	for signer := range postSigners {
+		if _, ok := preSigners[signer]; ok {
+			continue
+		}
+		all = append(all, signer)
+	}
+	sort.Strings(all)
+
+	for _, signer := range all {
+		pre, foundPre := preSigners[signer]
+		post, foundPost := postSigners[signer]
+		details := map[string]interface{}{}
+
+		switch {
+		case !foundPre && !foundPost:
+			continue
+		case !foundPre && foundPost:
+			details["sponsor"] = post.Address()
+			details["signer"] = signer
+			srcAccount := change.Post.Data.MustAccount().AccountId
+			e.add(srcAccount.Address(), EffectSignerSponsorshipCreated, details)
+		case !foundPost && foundPre:
+			details["former_sponsor"] = pre.Address()
+			details["signer"] = signer
+			srcAccount := change.Pre.Data.MustAccount().AccountId
+			e.add(srcAccount.Address(), EffectSignerSponsorshipRemoved, details)
+		case foundPre && foundPost:
+			formerSponsor := pre.Address()
+			newSponsor := post.Address()
+			if formerSponsor == newSponsor {
+				continue
+			}
+
+			details["former_sponsor"] = formerSponsor
+			details["new_sponsor"] = newSponsor
+			details["signer"] = signer
+			srcAccount := change.Post.Data.MustAccount().AccountId
+			e.add(srcAccount.Address(), EffectSignerSponsorshipUpdated, details)
+		}
+	}
+}
+
+func (e *effectsWrapper) addLedgerEntrySponsorshipEffects(change Change) error {
+	effectsForEntryType, found := sponsoringEffectsTable[change.Type]
+	if !found {
+		return nil
+	}
+
+	details := map[string]interface{}{}
+	var effectType EffectType
+
+	switch {
+	case (change.Pre == nil || change.Pre.SponsoringID() == nil) &&
+		(change.Post != nil && change.Post.SponsoringID() != nil):
+		effectType = effectsForEntryType.created
+		details["sponsor"] = (*change.Post.SponsoringID()).Address()
+	case (change.Pre != nil && change.Pre.SponsoringID() != nil) &&
+		(change.Post == nil || change.Post.SponsoringID() == nil):
+		effectType = effectsForEntryType.removed
+		details["former_sponsor"] = (*change.Pre.SponsoringID()).Address()
+	case (change.Pre != nil && change.Pre.SponsoringID() != nil) &&
+		(change.Post != nil && change.Post.SponsoringID() != nil):
+		preSponsor := (*change.Pre.SponsoringID()).Address()
+		postSponsor := (*change.Post.SponsoringID()).Address()
+		if preSponsor == postSponsor {
+			return nil
+		}
+		effectType = effectsForEntryType.updated
+		details["new_sponsor"] = postSponsor
+		details["former_sponsor"] = preSponsor
+	default:
+		return nil
+	}
+
+	var accountAddress string
+	var data xdr.LedgerEntryData
+	if change.Post != nil {
+		data = change.Post.Data
+	} else {
+		data = change.Pre.Data
+	}
+
+	switch change.Type {
+	case xdr.LedgerEntryTypeAccount:
+		aid := data.MustAccount().AccountId
+		accountAddress = aid.Address()
+	case xdr.LedgerEntryTypeTrustline:
+		aid := data.MustTrustLine().AccountId
+		accountAddress = aid.Address()
+		details["asset"] = data.MustTrustLine().Asset.StringCanonical()
+	case xdr.LedgerEntryTypeData:
+		accountAddress = e.operation.SourceAccount().Address()
+		details["data_name"] = data.MustData().DataName
+	case xdr.LedgerEntryTypeClaimableBalance:
+		accountAddress = e.operation.SourceAccount().Address()
+		var err error
+		details["balance_id"], err = xdr.MarshalHex(data.MustClaimableBalance().BalanceId)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid balanceId in change from op %d", e.operation.Index)
+		}
+	default:
+		return errors.Errorf("invalid sponsorship ledger entry type %v", change.Type.String())
+	}
+
+	e.add(accountAddress, effectType, details)
+	return nil
+}
+
+func (e *effectsWrapper) addAccountCreatedEffects() {
+	op := e.operation.Operation.Body.MustCreateAccountOp()
+
+	e.add(
+		op.Destination.Address(),
+		EffectAccountCreated,
+		map[string]interface{}{
+			"starting_balance": amount.String(op.StartingBalance),
+		},
+	)
+	e.add(
+		e.operation.SourceAccount().Address(),
+		EffectAccountDebited,
+		map[string]interface{}{
+			"asset_type": "native",
+			"amount":     amount.String(op.StartingBalance),
+		},
+	)
+	e.add(
+		op.Destination.Address(),
+		EffectSignerCreated,
+		map[string]interface{}{
+			"public_key": op.Destination.Address(),
+			"weight":     keypair.DefaultSignerWeight,
+		},
+	)
+}
+
+func (e *effectsWrapper) addPaymentEffects() {
+	op := e.operation.Operation.Body.MustPaymentOp()
+
+	details := map[string]interface{}{"amount": amount.String(op.Amount)}
+	addAssetDetails(details, op.Asset, "")
+
+	aid := op.Destination.ToAccountId()
+	e.add(
+		aid.Address(),
+		EffectAccountCredited,
+		details,
+	)
+	e.add(
+		e.operation.SourceAccount().Address(),
+		EffectAccountDebited,
+		details,
+	)
+}
+
+func (e *effectsWrapper) pathPaymentStrictReceiveEffects() {
+	op := e.operation.Operation.Body.MustPathPaymentStrictReceiveOp()
+	resultSuccess := e.operation.OperationResult().MustPathPaymentStrictReceiveResult().MustSuccess()
+	source := e.operation.SourceAccount()
+
+	details := map[string]interface{}{"amount": amount.String(op.DestAmount)}
+	addAssetDetails(details, op.DestAsset, "")
+
+	aid := op.Destination.ToAccountId()
+	e.add(
+		aid.Address(),
+		EffectAccountCredited,
+		details,
+	)
+
+	result := e.operation.OperationResult().MustPathPaymentStrictReceiveResult()
+	details = map[string]interface{}{"amount": amount.String(result.SendAmount())}
+	addAssetDetails(details, op.SendAsset, "")
+
+	e.add(
+		source.Address(),
+		EffectAccountDebited,
+		details,
+	)
+
+	e.addIngestTradeEffects(*source, resultSuccess.Offers)
+}
+
+func (e *effectsWrapper) addPathPaymentStrictSendEffects() {
+	source := e.operation.SourceAccount()
+	op := e.operation.Operation.Body.MustPathPaymentStrictSendOp()
+	resultSuccess := e.operation.OperationResult().MustPathPaymentStrictSendResult().MustSuccess()
+	result := e.operation.OperationResult().MustPathPaymentStrictSendResult()
+
+	details := map[string]interface{}{"amount": amount.String(result.DestAmount())}
+	addAssetDetails(details, op.DestAsset, "")
+	aid := op.Destination.ToAccountId()
+	e.add(aid.Address(), EffectAccountCredited, details)
+
+	details = map[string]interface{}{"amount": amount.String(op.SendAmount)}
+	addAssetDetails(details, op.SendAsset, "")
+	e.add(source.Address(), EffectAccountDebited, details)
+
+	e.addIngestTradeEffects(*source, resultSuccess.Offers)
+}
+
+func (e *effectsWrapper) addManageSellOfferEffects() {
+	source := e.operation.SourceAccount()
+	result := e.operation.OperationResult().MustManageSellOfferResult().MustSuccess()
+	e.addIngestTradeEffects(*source, result.OffersClaimed)
+}
+
+func (e *effectsWrapper) addManageBuyOfferEffects() {
+	source := e.operation.SourceAccount()
+	result := e.operation.OperationResult().MustManageBuyOfferResult().MustSuccess()
+	e.addIngestTradeEffects(*source, result.OffersClaimed)
+}
+
+func (e *effectsWrapper) addCreatePassiveSellOfferEffect() {
+	result := e.operation.OperationResult()
+	source := e.operation.SourceAccount()
+
+	var claims []xdr.ClaimOfferAtom
+
+	// KNOWN ISSUE:  stellar-core creates results for CreatePassiveOffer operations
+	// with the wrong result arm set.
+	if result.Type == xdr.OperationTypeManageSellOffer {
+		claims = result.MustManageSellOfferResult().MustSuccess().OffersClaimed
+	} else {
+		claims = result.MustCreatePassiveSellOfferResult().MustSuccess().OffersClaimed
+	}
+
+	e.addIngestTradeEffects(*source, claims)
+}
+
+func (e *effectsWrapper) addSetOptionsEffects() error {
+	source := e.operation.SourceAccount()
+	op := e.operation.Operation.Body.MustSetOptionsOp()
+
+	if op.HomeDomain != nil {
+		e.add(source.Address(), EffectAccountHomeDomainUpdated,
+			map[string]interface{}{
+				"home_domain": string(*op.HomeDomain),
+			},
+		)
+	}
+
+	thresholdDetails := map[string]interface{}{}
+
+	if op.LowThreshold != nil {
+		thresholdDetails["low_threshold"] = *op.LowThreshold
+	}
+
+	if op.MedThreshold != nil {
+		thresholdDetails["med_threshold"] = *op.MedThreshold
+	}
+
+	if op.HighThreshold != nil {
+		thresholdDetails["high_threshold"] = *op.HighThreshold
+	}
+
+	if len(thresholdDetails) > 0 {
+		e.add(source.Address(), EffectAccountThresholdsUpdated, thresholdDetails)
+	}
+
+	flagDetails := map[string]interface{}{}
+	if op.SetFlags != nil {
+		setAuthFlagDetails(flagDetails, xdr.AccountFlags(*op.SetFlags), true)
+	}
+	if op.ClearFlags != nil {
+		setAuthFlagDetails(flagDetails, xdr.AccountFlags(*op.ClearFlags), false)
+	}
+
+	if len(flagDetails) > 0 {
+		e.add(source.Address(), EffectAccountFlagsUpdated, flagDetails)
+	}
+
+	if op.InflationDest != nil {
+		e.add(source.Address(), EffectAccountInflationDestinationUpdated,
+			map[string]interface{}{
+				"inflation_destination": op.InflationDest.Address(),
+			},
+		)
+	}
+	changes, err := e.operation.Transaction.GetOperationChanges(e.operation.Index)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if change.Type != xdr.LedgerEntryTypeAccount {
+			continue
+		}
+
+		beforeAccount := change.Pre.Data.MustAccount()
+		afterAccount := change.Post.Data.MustAccount()
+
+		before := beforeAccount.SignerSummary()
+		after := afterAccount.SignerSummary()
+
+		// if before and after are the same, the signers have not changed
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+
+		beforeSortedSigners := []string{}
+		for signer := range before {
+			beforeSortedSigners = append(beforeSortedSigners, signer)
+		}
+		sort.Strings(beforeSortedSigners)
+
+		for _, addy := range beforeSortedSigners {
+			weight, ok := after[addy]
+			if !ok {
+				e.add(source.Address(), EffectSignerRemoved, map[string]interface{}{
+					"public_key": addy,
+				})
+				continue
+			}
+
+			if weight != before[addy] {
+				e.add(source.Address(), EffectSignerUpdated, map[string]interface{}{
+					"public_key": addy,
+					"weight":     weight,
+				})
+			}
+		}
+
+		afterSortedSigners := []string{}
+		for signer := range after {
+			afterSortedSigners = append(afterSortedSigners, signer)
+		}
+		sort.Strings(afterSortedSigners)
+
+		// Add the "created" effects
+		for _, addy := range afterSortedSigners {
+			weight := after[addy]
+			// if `addy` is in before, the previous for loop should have recorded
+			// the update, so skip this key
+			if _, ok := before[addy]; ok {
+				continue
+			}
+
+			e.add(source.Address(), EffectSignerCreated, map[string]interface{}{
+				"public_key": addy,
+				"weight":     weight,
+			})
+		}
+	}
+	return nil
+}
+
+func (e *effectsWrapper) addChangeTrustEffects() error {
+	source := e.operation.SourceAccount()
+
+	op := e.operation.Operation.Body.MustChangeTrustOp()
+	changes, err := e.operation.Transaction.GetOperationChanges(e.operation.Index)
+	if err != nil {
+		return err
+	}
+
+	// NOTE:  when an account trusts itself, the transaction is successful but
+	// no ledger entries are actually modified.
+	if len(changes) > 0 {
+		details := map[string]interface{}{"limit": amount.String(op.Limit)}
+		effect := EffectType(0)
+		addAssetDetails(details, op.Line, "")
+
+		for _, change := range changes {
+			if change.Type != xdr.LedgerEntryTypeTrustline {
+				continue
+			}
+
+			switch {
+			case change.Pre == nil && change.Post != nil:
+				effect = EffectTrustlineCreated
+			case change.Pre != nil && change.Post == nil:
+				effect = EffectTrustlineRemoved
+			case change.Pre != nil && change.Post != nil:
+				effect = EffectTrustlineUpdated
+			default:
+				panic("Invalid change")
+			}
+
+			break
+		}
+
+		e.add(source.Address(), effect, details)
+	}
+	return nil
+}
+
+func (e *effectsWrapper) addAllowTrustEffects() {
+	source := e.operation.SourceAccount()
+	op := e.operation.Operation.Body.MustAllowTrustOp()
+	asset := op.Asset.ToAsset(*source)
+	details := map[string]interface{}{
+		"trustor": op.Trustor.Address(),
+	}
+	addAssetDetails(details, asset, "")
+
+	switch {
+	case xdr.TrustLineFlags(op.Authorize).IsAuthorized():
+		e.add(source.Address(), EffectTrustlineAuthorized, details)
+		// Forward compatibility
+		setFlags := xdr.Uint32(xdr.TrustLineFlagsAuthorizedFlag)
+		e.addTrustLineFlagsEffect(source, &op.Trustor, asset, &setFlags, nil)
+	case xdr.TrustLineFlags(op.Authorize).IsAuthorizedToMaintainLiabilitiesFlag():
+		e.add(
+			source.Address(),
+			EffectTrustlineAuthorizedToMaintainLiabilities,
+			details,
+		)
+		// Forward compatibility
+		setFlags := xdr.Uint32(xdr.TrustLineFlagsAuthorizedToMaintainLiabilitiesFlag)
+		e.addTrustLineFlagsEffect(source, &op.Trustor, asset, &setFlags, nil)
+	default:
+		e.add(source.Address(), EffectTrustlineDeauthorized, details)
+		// Forward compatibility, show both as cleared
+		clearFlags := xdr.Uint32(xdr.TrustLineFlagsAuthorizedFlag | xdr.TrustLineFlagsAuthorizedToMaintainLiabilitiesFlag)
+		e.addTrustLineFlagsEffect(source, &op.Trustor, asset, nil, &clearFlags)
+	}
+}
+
+func (e *effectsWrapper) addAccountMergeEffects() {
+	source := e.operation.SourceAccount()
+
+	dest := e.operation.Operation.Body.MustDestination()
+	result := e.operation.OperationResult().MustAccountMergeResult()
+	details := map[string]interface{}{
+		"amount":     amount.String(result.MustSourceAccountBalance()),
+		"asset_type": "native",
+	}
+
+	e.add(source.Address(), EffectAccountDebited, details)
+	aid := dest.ToAccountId()
+	e.add(aid.Address(), EffectAccountCredited, details)
+	e.add(source.Address(), EffectAccountRemoved, map[string]interface{}{})
+}
+
+func (e *effectsWrapper) addInflationEffects() {
+	payouts := e.operation.OperationResult().MustInflationResult().MustPayouts()
+	for _, payout := range payouts {
+		e.add(payout.Destination.Address(), EffectAccountCredited,
+			map[string]interface{}{
+				"amount":     amount.String(payout.Amount),
+				"asset_type": "native",
+			},
+		)
+	}
+}
+
+func (e *effectsWrapper) addManageDataEffects() error {
+	source := e.operation.SourceAccount()
+	op := e.operation.Operation.Body.MustManageDataOp()
+	details := map[string]interface{}{"name": op.DataName}
+	effect := EffectType(0)
+	changes, err := e.operation.Transaction.GetOperationChanges(e.operation.Index)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if change.Type != xdr.LedgerEntryTypeData {
+			continue
+		}
+
+		before := change.Pre
+		after := change.Post
+
+		if after != nil {
+			raw := after.Data.MustData().DataValue
+			details["value"] = base64.StdEncoding.EncodeToString(raw)
+		}
+
+		switch {
+		case before == nil && after != nil:
+			effect = EffectDataCreated
+		case before != nil && after == nil:
+			effect = EffectDataRemoved
+		case before != nil && after != nil:
+			effect = EffectDataUpdated
+		default:
+			panic("Invalid before-and-after state")
+		}
+
+		break
+	}
+
+	e.add(source.Address(), effect, details)
+	return nil
+}
+
+func (e *effectsWrapper) addBumpSequenceEffects() error {
+	source := e.operation.SourceAccount()
+	changes, err := e.operation.Transaction.GetOperationChanges(e.operation.Index)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if change.Type != xdr.LedgerEntryTypeAccount {
+			continue
+		}
+
+		before := change.Pre
+		after := change.Post
+
+		beforeAccount := before.Data.MustAccount()
+		afterAccount := after.Data.MustAccount()
+
+		if beforeAccount.SeqNum != afterAccount.SeqNum {
+			details := map[string]interface{}{"new_seq": afterAccount.SeqNum}
+			e.add(source.Address(), EffectSequenceBumped, details)
+		}
+		break
+	}
+
+	return nil
+}
+
+func setClaimableBalanceFlagDetails(details map[string]interface{}, flags xdr.ClaimableBalanceFlags) {
+	if flags.IsClawbackEnabled() {
+		details["claimable_balance_clawback_enabled_flag"] = true
+		return
+	}
+}
+
+func (e *effectsWrapper) addCreateClaimableBalanceEffects(changes []Change) error {
+	op := e.operation.Operation.Body.MustCreateClaimableBalanceOp()
+
+	result := e.operation.OperationResult().MustCreateClaimableBalanceResult()
+	balanceID, err := xdr.MarshalHex(result.BalanceId)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid balanceId in op: %d", e.operation.Index)
+	}
+
+	details := map[string]interface{}{
+		"balance_id": balanceID,
+		"amount":     amount.String(op.Amount),
+		"asset":      op.Asset.StringCanonical(),
+	}
+	for _, change := range changes {
+		if change.Type != xdr.LedgerEntryTypeClaimableBalance || change.Post == nil {
+			continue
+		}
+		setClaimableBalanceFlagDetails(details, change.Post.Data.ClaimableBalance.Flags())
+		break
+	}
+	e.add(
+		e.operation.SourceAccount().Address(),
+		EffectClaimableBalanceCreated,
+		details,
+	)
+
+	for _, c := range op.Claimants {
+		cv0 := c.MustV0()
+		e.add(
+			cv0.Destination.Address(),
+			EffectClaimableBalanceClaimantCreated,
+			map[string]interface{}{
+				"balance_id": balanceID,
+				"amount":     amount.String(op.Amount),
+				"predicate":  cv0.Predicate,
+				"asset":      op.Asset.StringCanonical(),
+			},
+		)
+	}
+
+	details = map[string]interface{}{
+		"amount": amount.String(op.Amount),
+	}
+	addAssetDetails(details, op.Asset, "")
+	e.add(
+		e.operation.SourceAccount().Address(),
+		EffectAccountDebited,
+		details,
+	)
+
+	return nil
+}
+
+func (e *effectsWrapper) addClaimClaimableBalanceEffects(changes []Change) error {
+	op := e.operation.Operation.Body.MustClaimClaimableBalanceOp()
+
+	balanceID, err := xdr.MarshalHex(op.BalanceId)
+	if err != nil {
+		return fmt.Errorf("Invalid balanceId in op: %d", e.operation.Index)
+	}
+
+	var cBalance xdr.ClaimableBalanceEntry
+	found := false
+	for _, change := range changes {
+		if change.Type != xdr.LedgerEntryTypeClaimableBalance {
+			continue
+		}
+
+		if change.Pre != nil && change.Post == nil {
+			cBalance = change.Pre.Data.MustClaimableBalance()
+			preBalanceID, err := xdr.MarshalHex(cBalance.BalanceId)
+			if err != nil {
+				return fmt.Errorf("Invalid balanceId in meta changes for op: %d", e.operation.Index)
+			}
+
+			if preBalanceID == balanceID {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("Change not found for balanceId : %s", balanceID)
+	}
+
+	details := map[string]interface{}{
+		"amount":     amount.String(cBalance.Amount),
+		"balance_id": balanceID,
+		"asset":      cBalance.Asset.StringCanonical(),
+	}
+	setClaimableBalanceFlagDetails(details, cBalance.Flags())
+	e.add(
+		e.operation.SourceAccount().Address(),
+		EffectClaimableBalanceClaimed,
+		details,
+	)
+
+	details = map[string]interface{}{
+		"amount": amount.String(cBalance.Amount),
+	}
+	addAssetDetails(details, cBalance.Asset, "")
+	e.add(
+		e.operation.SourceAccount().Address(),
+		EffectAccountCredited,
+		details,
+	)
+
+	return nil
+}
+
+func (e *effectsWrapper) addIngestTradeEffects(buyer xdr.AccountId, claims []xdr.ClaimOfferAtom) {
+	for _, claim := range claims {
+		if claim.AmountSold == 0 && claim.AmountBought == 0 {
+			continue
+		}
+
+		seller := claim.SellerId
+		bd, sd := tradeDetails(buyer, seller, claim)
+
+		e.add(
+			buyer.Address(),
+			EffectTrade,
+			bd,
+		)
+
+		e.add(
+			seller.Address(),
+			EffectTrade,
+			sd,
+		)
+	}
+}
+
+func (e *effectsWrapper) addClawbackEffects() error {
+	op := e.operation.Operation.Body.MustClawbackOp()
+	details := map[string]interface{}{
+		"amount": amount.String(op.Amount),
+	}
+	source := e.operation.SourceAccount()
+	addAssetDetails(details, op.Asset, "")
+
+	// The funds will be burned, but even with that, we generated an account credited effect
+	e.add(
+		source.Address(),
+		EffectAccountCredited,
+		details,
+	)
+
+	from := op.From.ToAccountId()
+	e.add(
+		from.Address(),
+		EffectAccountDebited,
+		details,
+	)
+
+	return nil
+}
+
+func (e *effectsWrapper) addClawbackClaimableBalanceEffects(changes []Change) error {
+	op := e.operation.Operation.Body.MustClawbackClaimableBalanceOp()
+	balanceId, err := xdr.MarshalHex(op.BalanceId)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid balanceId in op %d", e.operation.Index)
+	}
+	details := map[string]interface{}{
+		"balance_id": balanceId,
+	}
+	e.add(
+		e.operation.SourceAccount().Address(),
+		EffectClaimableBalanceClawedBack,
+		details,
+	)
+
+	// Generate the account credited effect (although the funds will be burned) for the asset issuer
+	for _, c := range changes {
+		if c.Type == xdr.LedgerEntryTypeClaimableBalance && c.Post == nil && c.Pre != nil {
+			cb := c.Pre.Data.ClaimableBalance
+			details = map[string]interface{}{"amount": amount.String(cb.Amount)}
+			addAssetDetails(details, cb.Asset, "")
+			e.add(
+				e.operation.SourceAccount().Address(),
+				EffectAccountCredited,
+				details,
+			)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (e *effectsWrapper) addSetTrustLineFlagsEffects() error {
+	source := e.operation.SourceAccount()
+	op := e.operation.Operation.Body.MustSetTrustLineFlagsOp()
+	e.addTrustLineFlagsEffect(source, &op.Trustor, op.Asset, &op.SetFlags, &op.ClearFlags)
+	return nil
+}
+
+func (e *effectsWrapper) addTrustLineFlagsEffect(
+	account *xdr.AccountId,
+	trustor *xdr.AccountId,
+	asset xdr.Asset,
+	setFlags *xdr.Uint32,
+	clearFlags *xdr.Uint32) {
+	details := map[string]interface{}{
+		"trustor": trustor.Address(),
+	}
+	addAssetDetails(details, asset, "")
+
+	var flagDetailsAdded bool
+	if setFlags != nil {
+		setTrustLineFlagDetails(details, xdr.TrustLineFlags(*setFlags), true)
+		flagDetailsAdded = true
+	}
+	if clearFlags != nil {
+		setTrustLineFlagDetails(details, xdr.TrustLineFlags(*clearFlags), false)
+		flagDetailsAdded = true
+	}
+
+	if flagDetailsAdded {
+		e.add(account.Address(), EffectTrustlineFlagsUpdated, details)
+	}
+}
+
+func setTrustLineFlagDetails(flagDetails map[string]interface{}, flags xdr.TrustLineFlags, setValue bool) {
+	if flags.IsAuthorized() {
+		flagDetails["authorized_flag"] = setValue
+	}
+	if flags.IsAuthorizedToMaintainLiabilitiesFlag() {
+		flagDetails["authorized_to_maintain_liabilites"] = setValue
+	}
+	if flags.IsClawbackEnabledFlag() {
+		flagDetails["clawback_enabled_flag"] = setValue
+	}
+}
+
+func setAuthFlagDetails(flagDetails map[string]interface{}, flags xdr.AccountFlags, setValue bool) {
+	if flags.IsAuthRequired() {
+		flagDetails["auth_required_flag"] = setValue
+	}
+	if flags.IsAuthRevocable() {
+		flagDetails["auth_revocable_flag"] = setValue
+	}
+	if flags.IsAuthImmutable() {
+		flagDetails["auth_immutable_flag"] = setValue
+	}
+	if flags.IsAuthClawbackEnabled() {
+		flagDetails["auth_clawback_enabled_flag"] = setValue
+	}
+}
+
+func tradeDetails(buyer, seller xdr.AccountId, claim xdr.ClaimOfferAtom) (bd map[string]interface{}, sd map[string]interface{}) {
+	bd = map[string]interface{}{
+		"offer_id":      claim.OfferId,
+		"seller":        seller.Address(),
+		"bought_amount": amount.String(claim.AmountSold),
+		"sold_amount":   amount.String(claim.AmountBought),
+	}
+	addAssetDetails(bd, claim.AssetSold, "bought_")
+	addAssetDetails(bd, claim.AssetBought, "sold_")
+
+	sd = map[string]interface{}{
+		"offer_id":      claim.OfferId,
+		"seller":        buyer.Address(),
+		"bought_amount": amount.String(claim.AmountBought),
+		"sold_amount":   amount.String(claim.AmountSold),
+	}
+	addAssetDetails(sd, claim.AssetBought, "bought_")
+	addAssetDetails(sd, claim.AssetSold, "sold_")
+
+	return
+}
+
+// addAssetDetails sets the details for `a` on `result` using keys with `prefix`
+func addAssetDetails(result map[string]interface{}, a xdr.Asset, prefix string) error {
+	var (
+		assetType string
+		code      string
+		issuer    string
+	)
+	err := a.Extract(&assetType, &code, &issuer)
+	if err != nil {
+		err = errors.Wrap(err, "xdr.Asset.Extract error")
+		return err
+	}
+	result[prefix+"asset_type"] = assetType
+
+	if a.Type == xdr.AssetTypeAssetTypeNative {
+		return nil
+	}
+
+	result[prefix+"asset_code"] = code
+	result[prefix+"asset_issuer"] = issuer
+	return nil
+}
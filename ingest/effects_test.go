@@ -0,0 +1,103 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stellar/go/xdr"
+)
+
+func paymentTransaction(code xdr.TransactionResultCode) LedgerTransaction {
+	source := xdr.MustMuxedAddress("GBRPYHIL2CI3FNQ4BXLFMNDLFJUNPU2HY3ZMFSHONUCEOASW7QC7OX2H")
+	destination := xdr.MustMuxedAddress("GAXI33UCLQTCKM2NMRBS7XYBR535LLEVAHL5YBN4FTCB4HZHT7ZA5CVK")
+
+	results := []xdr.OperationResult{
+		{
+			Code: xdr.OperationResultCodeOpInner,
+			Tr: &xdr.OperationResultTr{
+				Type: xdr.OperationTypePayment,
+				PaymentResult: &xdr.PaymentResult{
+					Code: xdr.PaymentResultCodePaymentSuccess,
+				},
+			},
+		},
+	}
+
+	return LedgerTransaction{
+		Index: 1,
+		Envelope: xdr.TransactionEnvelope{
+			Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+			V1: &xdr.TransactionV1Envelope{
+				Tx: xdr.Transaction{
+					SourceAccount: source,
+					Operations: []xdr.Operation{
+						{
+							Body: xdr.OperationBody{
+								Type: xdr.OperationTypePayment,
+								PaymentOp: &xdr.PaymentOp{
+									Destination: destination,
+									Asset:       xdr.MustNewNativeAsset(),
+									Amount:      100000000,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Result: xdr.TransactionResultPair{
+			Result: xdr.TransactionResult{
+				Result: xdr.TransactionResultResult{
+					Code:    code,
+					Results: &results,
+				},
+			},
+		},
+		Meta: xdr.TransactionMeta{
+			V:  2,
+			V2: &xdr.TransactionMetaV2{Operations: []xdr.OperationMeta{{}}},
+		},
+	}
+}
+
+func TestLedgerTransactionEffects(t *testing.T) {
+	transaction := paymentTransaction(xdr.TransactionResultCodeTxSuccess)
+	effects, err := transaction.Effects()
+	assert.NoError(t, err)
+
+	details := map[string]interface{}{
+		"amount":     "10.0000000",
+		"asset_type": "native",
+	}
+	assert.Equal(t, []Effect{
+		{
+			Address:        "GAXI33UCLQTCKM2NMRBS7XYBR535LLEVAHL5YBN4FTCB4HZHT7ZA5CVK",
+			OperationIndex: 0,
+			Type:           EffectAccountCredited,
+			Order:          1,
+			Details:        details,
+		},
+		{
+			Address:        "GBRPYHIL2CI3FNQ4BXLFMNDLFJUNPU2HY3ZMFSHONUCEOASW7QC7OX2H",
+			OperationIndex: 0,
+			Type:           EffectAccountDebited,
+			Order:          2,
+			Details:        details,
+		},
+	}, effects)
+
+	participants, err := transaction.Operations()[0].Participants()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []xdr.AccountId{
+		xdr.MustAddress("GBRPYHIL2CI3FNQ4BXLFMNDLFJUNPU2HY3ZMFSHONUCEOASW7QC7OX2H"),
+		xdr.MustAddress("GAXI33UCLQTCKM2NMRBS7XYBR535LLEVAHL5YBN4FTCB4HZHT7ZA5CVK"),
+	}, participants)
+}
+
+func TestFailedLedgerTransactionEffects(t *testing.T) {
+	transaction := paymentTransaction(xdr.TransactionResultCodeTxFailed)
+	effects, err := transaction.Effects()
+	assert.NoError(t, err)
+	assert.Empty(t, effects)
+}
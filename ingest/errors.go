@@ -7,6 +7,11 @@ import (
 // ErrNotFound is returned when the requested ledger is not found
 var ErrNotFound = errors.New("ledger not found")
 
+// ErrMetaUnavailable is returned by LedgerTransaction methods requiring
+// transaction meta when the transaction was read from a backend which does
+// not provide meta (ex. ledgerbackend.HistoryArchiveBackend).
+var ErrMetaUnavailable = errors.New("transaction meta is not available")
+
 // StateError is a fatal error indicating that the Change stream
 // produced a result which violates fundamental invariants (e.g. an account
 // transferred more XLM than the account held in its balance).
@@ -0,0 +1,393 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// bucketIndexEntrySize is the size of an encoded bucketIndexEntry.
+const bucketIndexEntrySize = 16
+
+type bucketIndexEntry struct {
+	keyHash uint64
+	offset  int64
+}
+
+// BucketIndex maps ledger keys of a bucket to offsets of their entries in the
+// uncompressed bucket. Keys are stored as 64-bit hashes so the index of a
+// bucket takes 16 bytes per entry. Entries found using the index must be
+// checked against the key because of hash collisions.
+type BucketIndex struct {
+	entries []bucketIndexEntry
+}
+
+// Len returns the number of entries in the index.
+func (i *BucketIndex) Len() int {
+	return len(i.entries)
+}
+
+// offsets returns offsets of entries with the hash of the given key.
+func (i *BucketIndex) offsets(keyHash uint64) []int64 {
+	var offsets []int64
+	start := sort.Search(len(i.entries), func(j int) bool {
+		return i.entries[j].keyHash >= keyHash
+	})
+	for j := start; j < len(i.entries) && i.entries[j].keyHash == keyHash; j++ {
+		offsets = append(offsets, i.entries[j].offset)
+	}
+	return offsets
+}
+
+func (i *BucketIndex) MarshalBinary() ([]byte, error) {
+	b := make([]byte, len(i.entries)*bucketIndexEntrySize)
+	for j, entry := range i.entries {
+		binary.BigEndian.PutUint64(b[j*bucketIndexEntrySize:], entry.keyHash)
+		binary.BigEndian.PutUint64(b[j*bucketIndexEntrySize+8:], uint64(entry.offset))
+	}
+	return b, nil
+}
+
+func (i *BucketIndex) UnmarshalBinary(b []byte) error {
+	if len(b)%bucketIndexEntrySize != 0 {
+		return errors.Errorf("invalid bucket index size %d", len(b))
+	}
+	i.entries = make([]bucketIndexEntry, len(b)/bucketIndexEntrySize)
+	for j := range i.entries {
+		i.entries[j].keyHash = binary.BigEndian.Uint64(b[j*bucketIndexEntrySize:])
+		i.entries[j].offset = int64(binary.BigEndian.Uint64(b[j*bucketIndexEntrySize+8:]))
+	}
+	return nil
+}
+
+// LedgerEntryLookup resolves ledger keys at checkpoints without streaming
+// the whole bucket list. A BucketIndex is built for every bucket of the
+// checkpoint the first time the bucket is used. After that, buckets are
+// searched from the newest to the oldest using their indexes and only the
+// newest bucket containing a key is read, up to the offset of its entry.
+//
+// Buckets are immutable so indexes are kept in memory and, if a directory is
+// given, stored in it as sidecar files named after the bucket hash, so they
+// can be reused by later lookups. Buckets are validated against their hash
+// when indexes are built but not when entries are read using an index.
+type LedgerEntryLookup struct {
+	archive  historyarchive.ArchiveInterface
+	indexDir string
+
+	mutex   sync.Mutex
+	indexes map[historyarchive.Hash]*BucketIndex
+}
+
+// NewLedgerEntryLookup creates a LedgerEntryLookup reading buckets from the
+// archive. If indexDir is not empty, bucket indexes are loaded from and
+// stored in it.
+func NewLedgerEntryLookup(archive historyarchive.ArchiveInterface, indexDir string) (*LedgerEntryLookup, error) {
+	if indexDir != "" {
+		if err := os.MkdirAll(indexDir, 0755); err != nil {
+			return nil, errors.Wrapf(err, "error creating index directory %s", indexDir)
+		}
+	}
+	return &LedgerEntryLookup{
+		archive:  archive,
+		indexDir: indexDir,
+		indexes:  map[historyarchive.Hash]*BucketIndex{},
+	}, nil
+}
+
+// GetLedgerEntries returns the state of the keys at the given checkpoint
+// ledger. The returned slice has an entry for every key: the ledger entry or
+// nil if the key does not exist at the checkpoint.
+func (l *LedgerEntryLookup) GetLedgerEntries(
+	ctx context.Context,
+	checkpoint uint32,
+	keys []xdr.LedgerKey,
+) ([]*xdr.LedgerEntry, error) {
+	if !l.archive.GetCheckpointManager().IsCheckpoint(checkpoint) {
+		return nil, errors.Errorf("%d is not a checkpoint ledger", checkpoint)
+	}
+	has, err := l.archive.GetCheckpointHAS(checkpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get checkpoint HAS at ledger sequence %d", checkpoint)
+	}
+	hashes, err := bucketListHashes(has)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid bucket list of checkpoint %d", checkpoint)
+	}
+
+	type pendingKey struct {
+		index    int
+		keyBytes []byte
+		keyHash  uint64
+	}
+	pending := make([]pendingKey, 0, len(keys))
+	for i, key := range keys {
+		keyBytes, err := key.MarshalBinary()
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling ledger key")
+		}
+		pending = append(pending, pendingKey{i, keyBytes, hashLedgerKey(keyBytes)})
+	}
+
+	// Buckets are ordered from the newest to the oldest so the first entry
+	// found for a key shadows entries in older buckets.
+	results := make([]*xdr.LedgerEntry, len(keys))
+	for _, hash := range hashes {
+		if len(pending) == 0 {
+			break
+		}
+		if hash.IsZero() {
+			continue
+		}
+		index, err := l.BucketIndex(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates := map[int64][]int{}
+		for i, key := range pending {
+			for _, offset := range index.offsets(key.keyHash) {
+				candidates[offset] = append(candidates[offset], i)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
+		resolved := make([]bool, len(pending))
+		err = l.readBucketEntries(ctx, hash, candidates, func(entry xdr.BucketEntry, keyBytes []byte, candidates []int) {
+			for _, i := range candidates {
+				if resolved[i] || !bytes.Equal(pending[i].keyBytes, keyBytes) {
+					continue
+				}
+				resolved[i] = true
+				if entry.Type != xdr.BucketEntryTypeDeadentry {
+					results[pending[i].index] = entry.LiveEntry
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		remaining := pending[:0]
+		for i, key := range pending {
+			if !resolved[i] {
+				remaining = append(remaining, key)
+			}
+		}
+		pending = remaining
+	}
+	return results, nil
+}
+
+// readBucketEntries reads entries at the given offsets of the bucket and
+// calls fn with every entry, its marshaled key and the candidates at its
+// offset.
+func (l *LedgerEntryLookup) readBucketEntries(
+	ctx context.Context,
+	hash historyarchive.Hash,
+	candidates map[int64][]int,
+	fn func(xdr.BucketEntry, []byte, []int),
+) error {
+	offsets := make([]int64, 0, len(candidates))
+	for offset := range candidates {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	stream, err := l.archive.GetXdrStreamForHash(hash)
+	if err != nil {
+		return errors.Wrapf(err, "error opening bucket %s", hash)
+	}
+	defer stream.Close()
+
+	for _, offset := range offsets {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if _, err = stream.Discard(offset - stream.BytesRead()); err != nil {
+			return errors.Wrapf(err, "error seeking to offset %d of bucket %s", offset, hash)
+		}
+		var entry xdr.BucketEntry
+		if err = stream.ReadOne(&entry); err != nil {
+			return errors.Wrapf(err, "error reading entry at offset %d of bucket %s", offset, hash)
+		}
+		key, ok := bucketEntryKey(entry)
+		if !ok {
+			return errors.Errorf("no ledger entry at offset %d of bucket %s", offset, hash)
+		}
+		keyBytes, err := key.MarshalBinary()
+		if err != nil {
+			return errors.Wrap(err, "error marshaling ledger key")
+		}
+		fn(entry, keyBytes, candidates[offset])
+	}
+	return nil
+}
+
+// BucketIndex returns the index of the bucket. It's loaded from memory or
+// from the index directory if possible, otherwise the bucket is read to
+// build it.
+func (l *LedgerEntryLookup) BucketIndex(ctx context.Context, hash historyarchive.Hash) (*BucketIndex, error) {
+	l.mutex.Lock()
+	index, ok := l.indexes[hash]
+	l.mutex.Unlock()
+	if ok {
+		return index, nil
+	}
+
+	index, err := l.loadBucketIndex(hash)
+	if err != nil {
+		return nil, err
+	}
+	if index == nil {
+		index, err = buildBucketIndex(ctx, l.archive, hash)
+		if err != nil {
+			return nil, err
+		}
+		if err = l.storeBucketIndex(hash, index); err != nil {
+			return nil, err
+		}
+	}
+
+	l.mutex.Lock()
+	l.indexes[hash] = index
+	l.mutex.Unlock()
+	return index, nil
+}
+
+func (l *LedgerEntryLookup) indexPath(hash historyarchive.Hash) string {
+	return filepath.Join(l.indexDir, hash.String()+".index")
+}
+
+// loadBucketIndex returns nil if the index is not stored.
+func (l *LedgerEntryLookup) loadBucketIndex(hash historyarchive.Hash) (*BucketIndex, error) {
+	if l.indexDir == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(l.indexPath(hash))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error reading index of bucket %s", hash)
+	}
+	index := &BucketIndex{}
+	if err = index.UnmarshalBinary(b); err != nil {
+		return nil, errors.Wrapf(err, "error decoding index of bucket %s", hash)
+	}
+	return index, nil
+}
+
+func (l *LedgerEntryLookup) storeBucketIndex(hash historyarchive.Hash, index *BucketIndex) error {
+	if l.indexDir == "" {
+		return nil
+	}
+	b, err := index.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a partially
+	// written index.
+	tmpFile, err := ioutil.TempFile(l.indexDir, hash.String()+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "error creating temporary file")
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = tmpFile.Write(b)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error writing index of bucket %s", hash)
+	}
+	if err = os.Rename(tmpPath, l.indexPath(hash)); err != nil {
+		return errors.Wrapf(err, "error renaming %s", tmpPath)
+	}
+	return nil
+}
+
+// buildBucketIndex reads the bucket and returns the index of its entries.
+// The bucket is validated against its hash.
+func buildBucketIndex(
+	ctx context.Context,
+	archive historyarchive.ArchiveInterface,
+	hash historyarchive.Hash,
+) (*BucketIndex, error) {
+	stream, err := archive.GetXdrStreamForHash(hash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening bucket %s", hash)
+	}
+	stream.SetExpectedHash(hash)
+
+	index := &BucketIndex{}
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		offset := stream.BytesRead()
+		var entry xdr.BucketEntry
+		if err = stream.ReadOne(&entry); err != nil {
+			break
+		}
+		key, ok := bucketEntryKey(entry)
+		if !ok {
+			continue
+		}
+		var keyBytes []byte
+		if keyBytes, err = key.MarshalBinary(); err != nil {
+			break
+		}
+		index.entries = append(index.entries, bucketIndexEntry{
+			keyHash: hashLedgerKey(keyBytes),
+			offset:  offset,
+		})
+	}
+	if err != io.EOF {
+		stream.Close()
+		return nil, errors.Wrapf(err, "error reading bucket %s", hash)
+	}
+	if err = stream.Close(); err != nil {
+		return nil, errors.Wrapf(err, "error closing bucket %s", hash)
+	}
+
+	sort.Slice(index.entries, func(i, j int) bool {
+		a, b := index.entries[i], index.entries[j]
+		if a.keyHash != b.keyHash {
+			return a.keyHash < b.keyHash
+		}
+		return a.offset < b.offset
+	})
+	return index, nil
+}
+
+// bucketEntryKey returns the ledger key of live, init and dead entries.
+func bucketEntryKey(entry xdr.BucketEntry) (xdr.LedgerKey, bool) {
+	switch entry.Type {
+	case xdr.BucketEntryTypeLiveentry, xdr.BucketEntryTypeInitentry:
+		return entry.LiveEntry.LedgerKey(), true
+	case xdr.BucketEntryTypeDeadentry:
+		return *entry.DeadEntry, true
+	default:
+		return xdr.LedgerKey{}, false
+	}
+}
+
+func hashLedgerKey(keyBytes []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(keyBytes)
+	return h.Sum64()
+}
@@ -0,0 +1,114 @@
+package ingest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func accountKey(address string) xdr.LedgerKey {
+	return xdr.LedgerKey{
+		Type:    xdr.LedgerEntryTypeAccount,
+		Account: &xdr.LedgerKeyAccount{AccountId: xdr.MustAddress(address)},
+	}
+}
+
+func TestLedgerEntryLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bucket-index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var accounts []string
+	var keys []xdr.LedgerKey
+	for i := 0; i < 5; i++ {
+		accounts = append(accounts, keypair.MustRandom().Address())
+		keys = append(keys, accountKey(accounts[i]))
+	}
+
+	archive := &historyarchive.MockArchive{}
+	archive.On("GetCheckpointManager").Return(historyarchive.NewCheckpointManager(64))
+
+	a := []xdr.BucketEntry{
+		metaEntry(15),
+		entryAccount(xdr.BucketEntryTypeLiveentry, accounts[0], 10),
+		entryAccount(xdr.BucketEntryTypeDeadentry, accounts[1], 0),
+	}
+	b := []xdr.BucketEntry{
+		metaEntry(15),
+		entryAccount(xdr.BucketEntryTypeLiveentry, accounts[1], 20),
+		entryAccount(xdr.BucketEntryTypeLiveentry, accounts[2], 30),
+		entryAccount(xdr.BucketEntryTypeInitentry, accounts[3], 40),
+	}
+	c := []xdr.BucketEntry{
+		metaEntry(15),
+		entryAccount(xdr.BucketEntryTypeLiveentry, accounts[0], 1),
+		entryAccount(xdr.BucketEntryTypeLiveentry, accounts[2], 3),
+	}
+	// Every bucket is read to build its index. The bucket with the oldest
+	// entries is not read again because its entries are shadowed.
+	aHash := mockBucket(archive, a...)
+	mockBucket(archive, a...)
+	bHash := mockBucket(archive, b...)
+	mockBucket(archive, b...)
+	cHash := mockBucket(archive, c...)
+	archive.On("GetCheckpointHAS", uint32(63)).
+		Return(testHAS(map[int]historyarchive.Hash{0: aHash, 1: bHash, 4: cHash}), nil)
+
+	lookup, err := NewLedgerEntryLookup(archive, dir)
+	require.NoError(t, err)
+	entries, err := lookup.GetLedgerEntries(context.Background(), 63, keys)
+	require.NoError(t, err)
+	archive.AssertExpectations(t)
+
+	require.Len(t, entries, 5)
+	assert.Equal(t, xdr.Int64(10), entries[0].Data.Account.Balance)
+	assert.Nil(t, entries[1])
+	assert.Equal(t, xdr.Int64(30), entries[2].Data.Account.Balance)
+	assert.Equal(t, xdr.Int64(40), entries[3].Data.Account.Balance)
+	assert.Nil(t, entries[4])
+
+	for _, hash := range []historyarchive.Hash{aHash, bHash, cHash} {
+		_, err = os.Stat(filepath.Join(dir, hash.String()+".index"))
+		assert.NoError(t, err)
+	}
+
+	// Indexes are loaded from the index directory, only the bucket with the
+	// entry is read.
+	mockBucket(archive, b...)
+	lookup, err = NewLedgerEntryLookup(archive, dir)
+	require.NoError(t, err)
+	entries, err = lookup.GetLedgerEntries(context.Background(), 63, keys[2:3])
+	require.NoError(t, err)
+	archive.AssertExpectations(t)
+	assert.Equal(t, xdr.Int64(30), entries[0].Data.Account.Balance)
+
+	index, err := lookup.BucketIndex(context.Background(), bHash)
+	require.NoError(t, err)
+	assert.Equal(t, 3, index.Len())
+
+	_, err = lookup.GetLedgerEntries(context.Background(), 100, keys)
+	assert.EqualError(t, err, "100 is not a checkpoint ledger")
+}
+
+func TestBucketIndexMarshaling(t *testing.T) {
+	index := &BucketIndex{entries: []bucketIndexEntry{{1, 0}, {1, 120}, {5, 60}}}
+	b, err := index.MarshalBinary()
+	require.NoError(t, err)
+	assert.Len(t, b, 48)
+
+	var decoded BucketIndex
+	require.NoError(t, decoded.UnmarshalBinary(b))
+	assert.Equal(t, index, &decoded)
+	assert.Equal(t, []int64{0, 120}, decoded.offsets(1))
+	assert.Empty(t, decoded.offsets(2))
+
+	assert.EqualError(t, decoded.UnmarshalBinary(b[:20]), "invalid bucket index size 20")
+}
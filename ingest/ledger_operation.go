@@ -0,0 +1,142 @@
+package ingest
+
+import (
+	"github.com/stellar/go/xdr"
+)
+
+// LedgerOperation represents a single operation within a LedgerTransaction.
+type LedgerOperation struct {
+	// Index is the index of the operation in the transaction.
+	Index       uint32
+	Transaction *LedgerTransaction
+	Operation   xdr.Operation
+}
+
+// Operations returns all operations of the transaction.
+func (t *LedgerTransaction) Operations() []LedgerOperation {
+	var operations []LedgerOperation
+	for i, op := range t.Envelope.Operations() {
+		operations = append(operations, LedgerOperation{
+			Index:       uint32(i),
+			Transaction: t,
+			Operation:   op,
+		})
+	}
+	return operations
+}
+
+// SourceAccount returns the operation's source account. If the operation does
+// not set it, the source account of the transaction is returned.
+func (operation *LedgerOperation) SourceAccount() *xdr.AccountId {
+	sourceAccount := operation.Operation.SourceAccount
+	var sa xdr.AccountId
+	if sourceAccount != nil {
+		sa = sourceAccount.ToAccountId()
+	} else {
+		sa = operation.Transaction.Envelope.SourceAccount().ToAccountId()
+	}
+
+	return &sa
+}
+
+// OperationType returns the operation type.
+func (operation *LedgerOperation) OperationType() xdr.OperationType {
+	return operation.Operation.Body.Type
+}
+
+// OperationResult returns the operation's result record
+func (operation *LedgerOperation) OperationResult() *xdr.OperationResultTr {
+	results, _ := operation.Transaction.Result.OperationResults()
+	tr := results[operation.Index].MustTr()
+	return &tr
+}
+
+func (operation *LedgerOperation) getSignerSponsorInChange(signerKey string, change Change) xdr.SponsorshipDescriptor {
+	if change.Type != xdr.LedgerEntryTypeAccount || change.Post == nil {
+		return nil
+	}
+
+	preSigners := map[string]xdr.AccountId{}
+	if change.Pre != nil {
+		account := change.Pre.Data.MustAccount()
+		preSigners = account.SponsorPerSigner()
+	}
+
+	account := change.Post.Data.MustAccount()
+	postSigners := account.SponsorPerSigner()
+
+	pre, preFound := preSigners[signerKey]
+	post, postFound := postSigners[signerKey]
+
+	if !postFound {
+		return nil
+	}
+
+	if preFound {
+		formerSponsor := pre.Address()
+		newSponsor := post.Address()
+		if formerSponsor == newSponsor {
+			return nil
+		}
+	}
+
+	return &post
+}
+
+// Sponsor returns the account sponsoring the ledger entry or signer created
+// by the operation or nil if it's not sponsored.
+func (operation *LedgerOperation) Sponsor() (*xdr.AccountId, error) {
+	changes, err := operation.Transaction.GetOperationChanges(operation.Index)
+	if err != nil {
+		return nil, err
+	}
+	var signerKey string
+	if setOps, ok := operation.Operation.Body.GetSetOptionsOp(); ok && setOps.Signer != nil {
+		signerKey = setOps.Signer.Key.Address()
+	}
+
+	for _, c := range changes {
+		// Check Signer changes
+		if signerKey != "" {
+			if sponsorAccount := operation.getSignerSponsorInChange(signerKey, c); sponsorAccount != nil {
+				return sponsorAccount, nil
+			}
+		}
+
+		// Check Ledger key changes
+		if c.Pre != nil || c.Post == nil {
+			// We are only looking for entry creations denoting that a sponsor
+			// is associated to the ledger entry of the operation.
+			continue
+		}
+		if sponsorAccount := c.Post.SponsoringID(); sponsorAccount != nil {
+			return sponsorAccount, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// BeginSponsoringOperation returns the BeginSponsoringFutureReserves operation
+// which started the sponsorship of the operation's source account or nil if
+// there's no such operation.
+func (operation *LedgerOperation) BeginSponsoringOperation() *LedgerOperation {
+	if !operation.Transaction.Result.Successful() {
+		// Failed transactions may not have a compliant sandwich structure
+		// we can rely on (e.g. invalid nesting or a being operation with the wrong sponsoree ID)
+		// and thus we bail out since we could return incorrect information.
+		return nil
+	}
+	sponsoree := operation.SourceAccount()
+	operations := operation.Transaction.Envelope.Operations()
+	for i := int(operation.Index) - 1; i >= 0; i-- {
+		if beginOp, ok := operations[i].Body.GetBeginSponsoringFutureReservesOp(); ok &&
+			beginOp.SponsoredId.Address() == sponsoree.Address() {
+			result := *operation
+			result.Index = uint32(i)
+			result.Operation = operations[i]
+			return &result
+		}
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package ingest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// Cursor persists the progress of a LedgerStream so streaming can be resumed
+// after a restart.
+type Cursor interface {
+	// Load returns the sequence of the last processed ledger or 0 if no
+	// ledgers were processed yet.
+	Load(ctx context.Context) (uint32, error)
+	// Save is called with the sequence of a ledger after all its data was
+	// processed by a handler.
+	Save(ctx context.Context, sequence uint32) error
+}
+
+// FileCursor is a Cursor storing the last processed ledger in a file.
+type FileCursor struct {
+	Path string
+}
+
+// Ensure FileCursor implements Cursor
+var _ Cursor = (*FileCursor)(nil)
+
+// Load returns the ledger stored in the file or 0 if the file does not exist.
+func (c *FileCursor) Load(ctx context.Context) (uint32, error) {
+	data, err := ioutil.ReadFile(c.Path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "error reading cursor file %s", c.Path)
+	}
+
+	sequence, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid cursor in file %s", c.Path)
+	}
+	return uint32(sequence), nil
+}
+
+// Save writes the ledger to a temporary file first and then renames it so the
+// cursor file is never left partially written.
+func (c *FileCursor) Save(ctx context.Context, sequence uint32) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(c.Path), filepath.Base(c.Path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "error creating temporary cursor file")
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(strconv.FormatUint(uint64(sequence), 10))
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "error writing temporary cursor file")
+	}
+
+	if err = os.Rename(tmpFile.Name(), c.Path); err != nil {
+		return errors.Wrapf(err, "error renaming temporary cursor file to %s", c.Path)
+	}
+	return nil
+}
+
+// LedgerStreamConfig configures a LedgerStream.
+type LedgerStreamConfig struct {
+	// Backend is the source of ledgers. The stream prepares the range itself
+	// so the backend does not have to be prepared.
+	Backend           ledgerbackend.LedgerBackend
+	NetworkPassphrase string
+	// Range is the range of ledgers to stream. Streaming an unbounded range
+	// continues until the context is cancelled.
+	Range ledgerbackend.Range
+	// Cursor is optional. When set, streaming starts after the ledger returned
+	// by Cursor.Load (if it's in Range) and Cursor.Save is called after every
+	// ledger processed.
+	Cursor Cursor
+	// BufferSize is the maximum number of ledgers fetched from the backend
+	// ahead of the ledger being processed. Fetching is paused when the buffer
+	// is full so slow handlers do not make the stream hold an unbounded number
+	// of ledgers in memory.
+	BufferSize int
+	// MaxRetries is the number of times getting a ledger from the backend is
+	// retried after an error before streaming fails. The backend is prepared
+	// again before a retry if it's no longer prepared for the remaining range.
+	MaxRetries int
+	// RetryBackoff is the time to wait before the first retry. It's doubled
+	// after every failed retry. Defaults to 1 second.
+	RetryBackoff time.Duration
+}
+
+const defaultLedgerStreamRetryBackoff = time.Second
+
+// LedgerStream streams data of multiple ledgers to handlers. Ledgers are
+// fetched in a separate go routine, handlers are always called sequentially
+// in the ledger order.
+type LedgerStream struct {
+	config LedgerStreamConfig
+}
+
+// LedgerHandler processes a single ledger.
+type LedgerHandler func(ledger xdr.LedgerCloseMeta) error
+
+// TransactionHandler processes a single transaction of the ledger with the
+// given header.
+type TransactionHandler func(header xdr.LedgerHeaderHistoryEntry, tx LedgerTransaction) error
+
+// ChangeHandler processes a single change of the ledger with the given header.
+type ChangeHandler func(header xdr.LedgerHeaderHistoryEntry, change Change) error
+
+// NewLedgerStream constructs a new LedgerStream.
+func NewLedgerStream(config LedgerStreamConfig) (*LedgerStream, error) {
+	if config.Backend == nil {
+		return nil, errors.New("backend is required")
+	}
+	if config.Range.From() == 0 {
+		return nil, errors.New("range must start at ledger greater than 0")
+	}
+	if config.Range.Bounded() && config.Range.To() < config.Range.From() {
+		return nil, errors.Errorf("invalid range %s", config.Range)
+	}
+	if config.BufferSize < 0 {
+		return nil, errors.New("buffer size cannot be negative")
+	}
+	if config.MaxRetries < 0 {
+		return nil, errors.New("max retries cannot be negative")
+	}
+	if config.RetryBackoff < 0 {
+		return nil, errors.New("retry backoff cannot be negative")
+	}
+	if config.RetryBackoff == 0 {
+		config.RetryBackoff = defaultLedgerStreamRetryBackoff
+	}
+	return &LedgerStream{config: config}, nil
+}
+
+// StreamTransactions calls handler for every transaction in the range.
+func (s *LedgerStream) StreamTransactions(ctx context.Context, handler TransactionHandler) error {
+	return s.StreamLedgers(ctx, func(ledger xdr.LedgerCloseMeta) error {
+		reader, err := NewLedgerTransactionReaderFromLedgerCloseMeta(s.config.NetworkPassphrase, ledger)
+		if err != nil {
+			return errors.Wrapf(err, "error creating transaction reader for ledger %d", ledger.LedgerSequence())
+		}
+
+		for {
+			tx, err := reader.Read()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return errors.Wrapf(err, "error reading transaction in ledger %d", ledger.LedgerSequence())
+			}
+
+			if err = handler(reader.GetHeader(), tx); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// StreamChanges calls handler for every change (fees, transaction meta and
+// upgrades) in the range.
+func (s *LedgerStream) StreamChanges(ctx context.Context, handler ChangeHandler) error {
+	return s.StreamLedgers(ctx, func(ledger xdr.LedgerCloseMeta) error {
+		reader, err := NewLedgerChangeReaderFromLedgerCloseMeta(s.config.NetworkPassphrase, ledger)
+		if err != nil {
+			return errors.Wrapf(err, "error creating change reader for ledger %d", ledger.LedgerSequence())
+		}
+		defer reader.Close()
+
+		for {
+			change, err := reader.Read()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return errors.Wrapf(err, "error reading change in ledger %d", ledger.LedgerSequence())
+			}
+
+			if err = handler(reader.GetHeader(), change); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// StreamLedgers calls handler for every ledger in the range. It returns when
+// all ledgers in a bounded range are processed, when handler returns an error,
+// when getting a ledger fails more than MaxRetries times in a row or when ctx
+// is cancelled.
+func (s *LedgerStream) StreamLedgers(ctx context.Context, handler LedgerHandler) error {
+	streamRange, done, err := s.streamRange(ctx)
+	if err != nil {
+		return err
+	}
+	if done {
+		return nil
+	}
+
+	backend := ledgerbackend.WithContext(s.config.Backend)
+	prepared, err := backend.IsPreparedContext(ctx, streamRange)
+	if err != nil {
+		return errors.Wrap(err, "error checking if range is prepared")
+	}
+	if !prepared {
+		if err = backend.PrepareRangeContext(ctx, streamRange); err != nil {
+			return errors.Wrapf(err, "error preparing range %s", streamRange)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ledgers := make(chan xdr.LedgerCloseMeta, s.config.BufferSize)
+	fetchErr := make(chan error, 1)
+	go func() {
+		defer close(ledgers)
+		for sequence := streamRange.From(); !streamRange.Bounded() || sequence <= streamRange.To(); sequence++ {
+			ledger, err := s.getLedger(ctx, backend, streamRange, sequence)
+			if err != nil {
+				fetchErr <- err
+				return
+			}
+
+			select {
+			case ledgers <- ledger:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for ledger := range ledgers {
+		if err = handler(ledger); err != nil {
+			return err
+		}
+		if s.config.Cursor != nil {
+			if err = s.config.Cursor.Save(ctx, ledger.LedgerSequence()); err != nil {
+				return errors.Wrapf(err, "error saving cursor for ledger %d", ledger.LedgerSequence())
+			}
+		}
+	}
+
+	select {
+	case err = <-fetchErr:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// getLedger gets the ledger from the backend retrying up to MaxRetries times
+// with exponential backoff.
+func (s *LedgerStream) getLedger(
+	ctx context.Context,
+	backend ledgerbackend.ContextLedgerBackend,
+	streamRange ledgerbackend.Range,
+	sequence uint32,
+) (xdr.LedgerCloseMeta, error) {
+	remaining := ledgerbackend.UnboundedRange(sequence)
+	if streamRange.Bounded() {
+		remaining = ledgerbackend.BoundedRange(sequence, streamRange.To())
+	}
+
+	backoff := s.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		ledger, err := tryGetLedger(ctx, backend, remaining, attempt > 0)
+		if err == nil {
+			return ledger, nil
+		}
+		if attempt >= s.config.MaxRetries || ctx.Err() != nil {
+			return xdr.LedgerCloseMeta{}, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return xdr.LedgerCloseMeta{}, err
+		}
+		backoff *= 2
+	}
+}
+
+// tryGetLedger gets the first ledger of remaining. When retrying, the backend
+// is prepared again first if it's no longer prepared (ex. Stellar-Core
+// crashed).
+func tryGetLedger(
+	ctx context.Context,
+	backend ledgerbackend.ContextLedgerBackend,
+	remaining ledgerbackend.Range,
+	retry bool,
+) (xdr.LedgerCloseMeta, error) {
+	if retry {
+		prepared, err := backend.IsPreparedContext(ctx, remaining)
+		if err != nil {
+			return xdr.LedgerCloseMeta{}, errors.Wrap(err, "error checking if range is prepared")
+		}
+		if !prepared {
+			if err = backend.PrepareRangeContext(ctx, remaining); err != nil {
+				return xdr.LedgerCloseMeta{}, errors.Wrapf(err, "error preparing range %s", remaining)
+			}
+		}
+	}
+
+	ledger, err := backend.GetLedgerBlockingContext(ctx, remaining.From())
+	if err != nil {
+		return xdr.LedgerCloseMeta{}, errors.Wrapf(err, "error getting ledger %d", remaining.From())
+	}
+	return ledger, nil
+}
+
+// streamRange returns the range left to stream taking the cursor into
+// account. done is true when all ledgers in the range were already processed.
+func (s *LedgerStream) streamRange(ctx context.Context) (ledgerbackend.Range, bool, error) {
+	from := s.config.Range.From()
+	if s.config.Cursor != nil {
+		last, err := s.config.Cursor.Load(ctx)
+		if err != nil {
+			return ledgerbackend.Range{}, false, errors.Wrap(err, "error loading cursor")
+		}
+		if last >= from {
+			from = last + 1
+		}
+	}
+
+	if !s.config.Range.Bounded() {
+		return ledgerbackend.UnboundedRange(from), false, nil
+	}
+	if from > s.config.Range.To() {
+		return ledgerbackend.Range{}, true, nil
+	}
+	return ledgerbackend.BoundedRange(from, s.config.Range.To()), false, nil
+}
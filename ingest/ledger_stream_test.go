@@ -0,0 +1,244 @@
+package ingest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+func streamLedger(sequence uint32) xdr.LedgerCloseMeta {
+	return xdr.LedgerCloseMeta{
+		V0: &xdr.LedgerCloseMetaV0{
+			LedgerHeader: xdr.LedgerHeaderHistoryEntry{
+				Header: xdr.LedgerHeader{
+					LedgerSeq:     xdr.Uint32(sequence),
+					LedgerVersion: 14,
+				},
+			},
+		},
+	}
+}
+
+type memoryCursor struct {
+	sequence uint32
+	saved    []uint32
+}
+
+func (c *memoryCursor) Load(ctx context.Context) (uint32, error) {
+	return c.sequence, nil
+}
+
+func (c *memoryCursor) Save(ctx context.Context, sequence uint32) error {
+	c.sequence = sequence
+	c.saved = append(c.saved, sequence)
+	return nil
+}
+
+func TestLedgerStreamBoundedRange(t *testing.T) {
+	backend := &ledgerbackend.MockDatabaseBackend{}
+	backend.On("IsPrepared", ledgerbackend.BoundedRange(2, 4)).Return(false, nil).Once()
+	backend.On("PrepareRange", ledgerbackend.BoundedRange(2, 4)).Return(nil).Once()
+	for sequence := uint32(2); sequence <= 4; sequence++ {
+		backend.On("GetLedger", sequence).Return(true, streamLedger(sequence), nil).Once()
+	}
+
+	cursor := &memoryCursor{}
+	stream, err := NewLedgerStream(LedgerStreamConfig{
+		Backend:           backend,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Range:             ledgerbackend.BoundedRange(2, 4),
+		Cursor:            cursor,
+		BufferSize:        1,
+	})
+	require.NoError(t, err)
+
+	var processed []uint32
+	err = stream.StreamLedgers(context.Background(), func(ledger xdr.LedgerCloseMeta) error {
+		processed = append(processed, ledger.LedgerSequence())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{2, 3, 4}, processed)
+	assert.Equal(t, []uint32{2, 3, 4}, cursor.saved)
+	backend.AssertExpectations(t)
+
+	// Everything was processed so the backend is not used again
+	processed = nil
+	err = stream.StreamLedgers(context.Background(), func(ledger xdr.LedgerCloseMeta) error {
+		processed = append(processed, ledger.LedgerSequence())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, processed)
+	backend.AssertExpectations(t)
+}
+
+func TestLedgerStreamResumesFromCursor(t *testing.T) {
+	backend := &ledgerbackend.MockDatabaseBackend{}
+	backend.On("IsPrepared", ledgerbackend.UnboundedRange(6)).Return(true, nil).Once()
+	backend.On("GetLedger", uint32(6)).Return(true, streamLedger(6), nil).Once()
+	backend.On("GetLedger", uint32(7)).Return(true, streamLedger(7), nil).Once()
+	// Ledger 8 can be fetched before the handler fails
+	backend.On("GetLedger", uint32(8)).Return(true, streamLedger(8), nil).Maybe()
+
+	cursor := &memoryCursor{sequence: 5}
+	stream, err := NewLedgerStream(LedgerStreamConfig{
+		Backend:           backend,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Range:             ledgerbackend.UnboundedRange(2),
+		Cursor:            cursor,
+	})
+	require.NoError(t, err)
+
+	handlerErr := errors.New("handler error")
+	err = stream.StreamLedgers(context.Background(), func(ledger xdr.LedgerCloseMeta) error {
+		if ledger.LedgerSequence() == 7 {
+			return handlerErr
+		}
+		return nil
+	})
+	assert.Equal(t, handlerErr, err)
+	assert.Equal(t, []uint32{6}, cursor.saved)
+}
+
+func TestLedgerStreamCancelled(t *testing.T) {
+	backend := &ledgerbackend.MockDatabaseBackend{}
+	backend.On("IsPrepared", ledgerbackend.UnboundedRange(2)).Return(true, nil).Once()
+	backend.On("GetLedger", uint32(2)).Return(true, streamLedger(2), nil).Once()
+	backend.On("GetLedger", uint32(3)).Return(false, xdr.LedgerCloseMeta{}, nil).Maybe()
+
+	stream, err := NewLedgerStream(LedgerStreamConfig{
+		Backend:           backend,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Range:             ledgerbackend.UnboundedRange(2),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = stream.StreamLedgers(ctx, func(ledger xdr.LedgerCloseMeta) error {
+		cancel()
+		return nil
+	})
+	assert.EqualError(t, err, "error getting ledger 3: context canceled")
+}
+
+func TestLedgerStreamRetries(t *testing.T) {
+	backend := &ledgerbackend.MockDatabaseBackend{}
+	backend.On("IsPrepared", ledgerbackend.BoundedRange(2, 3)).Return(true, nil).Once()
+	backend.On("GetLedger", uint32(2)).Return(true, streamLedger(2), nil).Once()
+	backend.On("GetLedger", uint32(3)).Return(false, xdr.LedgerCloseMeta{}, errors.New("core crashed")).Once()
+	backend.On("IsPrepared", ledgerbackend.BoundedRange(3, 3)).Return(false, nil).Once()
+	backend.On("PrepareRange", ledgerbackend.BoundedRange(3, 3)).Return(nil).Once()
+	backend.On("GetLedger", uint32(3)).Return(true, streamLedger(3), nil).Once()
+	defer backend.AssertExpectations(t)
+
+	stream, err := NewLedgerStream(LedgerStreamConfig{
+		Backend:           backend,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Range:             ledgerbackend.BoundedRange(2, 3),
+		MaxRetries:        1,
+		RetryBackoff:      time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	var sequences []uint32
+	err = stream.StreamLedgers(context.Background(), func(ledger xdr.LedgerCloseMeta) error {
+		sequences = append(sequences, ledger.LedgerSequence())
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{2, 3}, sequences)
+}
+
+func TestLedgerStreamRetriesExhausted(t *testing.T) {
+	backend := &ledgerbackend.MockDatabaseBackend{}
+	backend.On("IsPrepared", ledgerbackend.BoundedRange(2, 3)).Return(true, nil).Once()
+	backend.On("GetLedger", uint32(2)).Return(false, xdr.LedgerCloseMeta{}, errors.New("core crashed")).Twice()
+	backend.On("IsPrepared", ledgerbackend.BoundedRange(2, 3)).Return(true, nil).Once()
+	defer backend.AssertExpectations(t)
+
+	stream, err := NewLedgerStream(LedgerStreamConfig{
+		Backend:           backend,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Range:             ledgerbackend.BoundedRange(2, 3),
+		MaxRetries:        1,
+		RetryBackoff:      time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	err = stream.StreamLedgers(context.Background(), func(ledger xdr.LedgerCloseMeta) error {
+		return nil
+	})
+	assert.EqualError(t, err, "error getting ledger 2: core crashed")
+}
+
+func TestLedgerStreamTransactions(t *testing.T) {
+	backend := &ledgerbackend.MockDatabaseBackend{}
+	backend.On("IsPrepared", ledgerbackend.SingleLedgerRange(2)).Return(true, nil).Once()
+	backend.On("GetLedger", uint32(2)).Return(true, streamLedger(2), nil).Once()
+
+	stream, err := NewLedgerStream(LedgerStreamConfig{
+		Backend:           backend,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Range:             ledgerbackend.SingleLedgerRange(2),
+	})
+	require.NoError(t, err)
+
+	transactions := 0
+	err = stream.StreamTransactions(context.Background(), func(xdr.LedgerHeaderHistoryEntry, LedgerTransaction) error {
+		transactions++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, transactions)
+	backend.AssertExpectations(t)
+}
+
+func TestNewLedgerStreamInvalidConfig(t *testing.T) {
+	_, err := NewLedgerStream(LedgerStreamConfig{Range: ledgerbackend.UnboundedRange(2)})
+	assert.EqualError(t, err, "backend is required")
+
+	_, err = NewLedgerStream(LedgerStreamConfig{
+		Backend: &ledgerbackend.MockDatabaseBackend{},
+		Range:   ledgerbackend.BoundedRange(5, 4),
+	})
+	assert.EqualError(t, err, "invalid range [5,4]")
+
+	_, err = NewLedgerStream(LedgerStreamConfig{
+		Backend:    &ledgerbackend.MockDatabaseBackend{},
+		Range:      ledgerbackend.UnboundedRange(2),
+		MaxRetries: -1,
+	})
+	assert.EqualError(t, err, "max retries cannot be negative")
+}
+
+func TestFileCursor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger-stream")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cursor := &FileCursor{Path: filepath.Join(dir, "cursor")}
+	sequence, err := cursor.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), sequence)
+
+	require.NoError(t, cursor.Save(context.Background(), 123))
+	sequence, err = cursor.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(123), sequence)
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
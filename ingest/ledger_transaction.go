@@ -21,6 +21,14 @@ func (t *LedgerTransaction) txInternalError() bool {
 	return t.Result.Result.Result.Code == xdr.TransactionResultCodeTxInternalError
 }
 
+// HasMeta returns false when the transaction was read from a backend which
+// does not provide transaction meta (ex. ledgerbackend.HistoryArchiveBackend).
+// Such backends leave Meta empty: V=0 without operations meta, which is never
+// the case for legacy V=0 meta produced by Stellar-Core.
+func (t *LedgerTransaction) HasMeta() bool {
+	return t.Meta.V != 0 || t.Meta.Operations != nil
+}
+
 // GetFeeChanges returns a developer friendly representation of LedgerEntryChanges
 // connected to fees.
 func (t *LedgerTransaction) GetFeeChanges() []Change {
@@ -30,9 +38,13 @@ func (t *LedgerTransaction) GetFeeChanges() []Change {
 // GetChanges returns a developer friendly representation of LedgerEntryChanges.
 // It contains transaction changes and operation changes in that order. If the
 // transaction failed with TxInternalError, operations and txChangesAfter are
-// omitted. It doesn't support legacy TransactionMeta.V=0.
+// omitted. It doesn't support legacy TransactionMeta.V=0. It returns
+// ErrMetaUnavailable if the transaction has no meta (see HasMeta).
 func (t *LedgerTransaction) GetChanges() ([]Change, error) {
 	var changes []Change
+	if !t.HasMeta() {
+		return changes, ErrMetaUnavailable
+	}
 
 	// Transaction meta
 	switch t.Meta.V {
@@ -83,9 +95,13 @@ func (t *LedgerTransaction) GetChanges() ([]Change, error) {
 }
 
 // GetOperationChanges returns a developer friendly representation of LedgerEntryChanges.
-// It contains only operation changes.
+// It contains only operation changes. It returns ErrMetaUnavailable if the
+// transaction has no meta (see HasMeta).
 func (t *LedgerTransaction) GetOperationChanges(operationIndex uint32) ([]Change, error) {
 	changes := []Change{}
+	if !t.HasMeta() {
+		return changes, ErrMetaUnavailable
+	}
 
 	// Transaction meta
 	switch t.Meta.V {
@@ -334,7 +334,8 @@ func TestMetaV2Order(t *testing.T) {
 func TestMetaV0(t *testing.T) {
 	tx := LedgerTransaction{
 		Meta: xdr.TransactionMeta{
-			V: 0,
+			V:          0,
+			Operations: &[]xdr.OperationMeta{},
 		}}
 
 	_, err := tx.GetChanges()
@@ -342,6 +343,43 @@ func TestMetaV0(t *testing.T) {
 	assert.EqualError(t, err, "TransactionMeta.V=0 not supported")
 }
 
+func TestMetaUnavailable(t *testing.T) {
+	tx := LedgerTransaction{}
+	assert.False(t, tx.HasMeta())
+
+	_, err := tx.GetChanges()
+	assert.Equal(t, ErrMetaUnavailable, err)
+
+	_, err = tx.GetOperationChanges(0)
+	assert.Equal(t, ErrMetaUnavailable, err)
+
+	tx = LedgerTransaction{
+		Envelope: xdr.TransactionEnvelope{
+			Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+			V1: &xdr.TransactionV1Envelope{
+				Tx: xdr.Transaction{
+					Operations: []xdr.Operation{{
+						Body: xdr.OperationBody{
+							Type:           xdr.OperationTypeBumpSequence,
+							BumpSequenceOp: &xdr.BumpSequenceOp{BumpTo: 1},
+						},
+					}},
+				},
+			},
+		},
+		Result: xdr.TransactionResultPair{
+			Result: xdr.TransactionResult{
+				Result: xdr.TransactionResultResult{
+					Code:    xdr.TransactionResultCodeTxSuccess,
+					Results: &[]xdr.OperationResult{},
+				},
+			},
+		},
+	}
+	_, err = tx.Effects()
+	assert.Equal(t, ErrMetaUnavailable, err)
+}
+
 func TestChangeAccountChangedExceptSignersLastModifiedLedgerSeq(t *testing.T) {
 	change := Change{
 		Type: xdr.LedgerEntryTypeAccount,
@@ -40,6 +40,8 @@ const (
 type metaResult struct {
 	*xdr.LedgerCloseMeta
 	err error
+	// size is the size in bytes of the frame read from the meta pipe.
+	size uint32
 }
 
 // bufferedLedgerMetaReader is responsible for buffering meta pipe data in a
@@ -81,10 +83,10 @@ func newBufferedLedgerMetaReader(reader io.Reader) *bufferedLedgerMetaReader {
 //   * Meta pipe buffer is full so it will wait until it refills.
 //   * The next ledger available in the buffer exceeds the meta pipe buffer size.
 //     In such case the method will block until LedgerCloseMeta buffer is empty.
-func (b *bufferedLedgerMetaReader) readLedgerMetaFromPipe() (*xdr.LedgerCloseMeta, error) {
+func (b *bufferedLedgerMetaReader) readLedgerMetaFromPipe() (*xdr.LedgerCloseMeta, uint32, error) {
 	frameLength, err := xdr.ReadFrameLength(b.r)
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading frame length")
+		return nil, 0, errors.Wrap(err, "error reading frame length")
 	}
 
 	for frameLength > metaPipeBufferSize && len(b.c) > 0 {
@@ -95,9 +97,9 @@ func (b *bufferedLedgerMetaReader) readLedgerMetaFromPipe() (*xdr.LedgerCloseMet
 	var xlcm xdr.LedgerCloseMeta
 	_, err = xdr.Unmarshal(b.r, &xlcm)
 	if err != nil {
-		return nil, errors.Wrap(err, "unmarshalling framed LedgerCloseMeta")
+		return nil, 0, errors.Wrap(err, "unmarshalling framed LedgerCloseMeta")
 	}
-	return &xlcm, nil
+	return &xlcm, frameLength, nil
 }
 
 func (b *bufferedLedgerMetaReader) getChannel() <-chan metaResult {
@@ -118,12 +120,12 @@ func (b *bufferedLedgerMetaReader) start() {
 		default:
 		}
 
-		meta, err := b.readLedgerMetaFromPipe()
+		meta, size, err := b.readLedgerMetaFromPipe()
 		if err != nil {
-			b.c <- metaResult{nil, err}
+			b.c <- metaResult{err: err}
 			return
 		}
 
-		b.c <- metaResult{meta, nil}
+		b.c <- metaResult{LedgerCloseMeta: meta, size: size}
 	}
 }
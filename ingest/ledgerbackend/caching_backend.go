@@ -0,0 +1,404 @@
+package ledgerbackend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// Ensure CachingBackend implements LedgerBackend
+var _ LedgerBackend = (*CachingBackend)(nil)
+
+// CachingBackendConfig contains the configuration of CachingBackend.
+type CachingBackendConfig struct {
+	// Path is the directory in which ledgers are stored. It is created if it
+	// does not exist. The directory must not be shared by multiple
+	// CachingBackend instances running at the same time.
+	Path string
+	// MaxSize is the maximum size (in bytes) of the stored ledgers. When it is
+	// exceeded the least recently used ledgers are removed.
+	MaxSize int64
+}
+
+// CachingBackend is a LedgerBackend decorator which stores every
+// LedgerCloseMeta returned by the wrapped backend in a local directory (in
+// the layout used by MetaArchiveBackend). Ledgers found in the store are
+// returned without calling the wrapped backend at all: PrepareRange is
+// forwarded to the wrapped backend only when a requested ledger is missing
+// from the store.
+type CachingBackend struct {
+	backend LedgerBackend
+	store   *ledgerStore
+
+	mutex sync.Mutex
+	// ledgerRange is the range passed to the last PrepareRange call, nil if
+	// PrepareRange was not called or the backend was closed.
+	ledgerRange *Range
+}
+
+// NewCachingBackend returns a CachingBackend wrapping the given backend.
+func NewCachingBackend(backend LedgerBackend, config CachingBackendConfig) (*CachingBackend, error) {
+	if config.Path == "" {
+		return nil, errors.New("path is empty")
+	}
+	if config.MaxSize <= 0 {
+		return nil, errors.New("max size must be positive")
+	}
+
+	store, err := newLedgerStore(config.Path, config.MaxSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening ledger store")
+	}
+
+	return &CachingBackend{
+		backend: backend,
+		store:   store,
+	}, nil
+}
+
+// GetLatestLedgerSequence returns the last ledger of the prepared range if the
+// range is bounded and the wrapped backend was not needed so far. Otherwise
+// the call is forwarded to the wrapped backend.
+func (c *CachingBackend) GetLatestLedgerSequence() (uint32, error) {
+	c.mutex.Lock()
+	ledgerRange := c.ledgerRange
+	c.mutex.Unlock()
+
+	if ledgerRange != nil && ledgerRange.bounded {
+		prepared, err := c.backend.IsPrepared(*ledgerRange)
+		if err != nil {
+			return 0, err
+		}
+		if !prepared {
+			return ledgerRange.to, nil
+		}
+	}
+
+	return c.backend.GetLatestLedgerSequence()
+}
+
+// GetLedger returns the ledger from the store if it's there. Otherwise it
+// gets the ledger from the wrapped backend and stores it.
+func (c *CachingBackend) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
+	exists, meta, err := c.store.get(sequence)
+	if err != nil {
+		return false, xdr.LedgerCloseMeta{}, err
+	}
+	if exists {
+		return true, meta, nil
+	}
+
+	if err = c.prepareBackend(sequence); err != nil {
+		return false, xdr.LedgerCloseMeta{}, err
+	}
+
+	exists, meta, err = c.backend.GetLedger(sequence)
+	if err != nil || !exists {
+		return exists, meta, err
+	}
+
+	if err = c.store.put(meta); err != nil {
+		return false, xdr.LedgerCloseMeta{}, err
+	}
+	return true, meta, nil
+}
+
+// GetLedgerBlocking works as GetLedger but will block until the ledger is
+// available in the wrapped backend.
+func (c *CachingBackend) GetLedgerBlocking(sequence uint32) (xdr.LedgerCloseMeta, error) {
+	exists, meta, err := c.store.get(sequence)
+	if err != nil {
+		return xdr.LedgerCloseMeta{}, err
+	}
+	if exists {
+		return meta, nil
+	}
+
+	if err = c.prepareBackend(sequence); err != nil {
+		return xdr.LedgerCloseMeta{}, err
+	}
+
+	meta, err = c.backend.GetLedgerBlocking(sequence)
+	if err != nil {
+		return xdr.LedgerCloseMeta{}, err
+	}
+
+	if err = c.store.put(meta); err != nil {
+		return xdr.LedgerCloseMeta{}, err
+	}
+	return meta, nil
+}
+
+// PrepareRange prepares the range in the wrapped backend only when the first
+// ledger of the range is not stored. If it is, the wrapped backend is
+// prepared later, starting at the first requested ledger which is not
+// stored.
+func (c *CachingBackend) PrepareRange(ledgerRange Range) error {
+	c.mutex.Lock()
+	c.ledgerRange = &ledgerRange
+	c.mutex.Unlock()
+
+	if c.store.has(ledgerRange.from) {
+		return nil
+	}
+	return c.prepareBackend(ledgerRange.from)
+}
+
+// prepareBackend makes sure the wrapped backend is prepared to return the
+// given ledger. The prepared range starts at the ledger and ends where the
+// range passed to PrepareRange ends. Ledgers outside of the prepared range
+// are requested from the wrapped backend as they are.
+func (c *CachingBackend) prepareBackend(sequence uint32) error {
+	c.mutex.Lock()
+	ledgerRange := c.ledgerRange
+	c.mutex.Unlock()
+
+	if ledgerRange == nil || sequence < ledgerRange.from ||
+		(ledgerRange.bounded && sequence > ledgerRange.to) {
+		return nil
+	}
+
+	backendRange := UnboundedRange(sequence)
+	if ledgerRange.bounded {
+		backendRange = BoundedRange(sequence, ledgerRange.to)
+	}
+
+	prepared, err := c.backend.IsPrepared(backendRange)
+	if err != nil {
+		return errors.Wrap(err, "error checking if range is prepared")
+	}
+	if prepared {
+		return nil
+	}
+	return c.backend.PrepareRange(backendRange)
+}
+
+// IsPrepared returns true if the given range is within the range passed to
+// PrepareRange or if it's prepared in the wrapped backend.
+func (c *CachingBackend) IsPrepared(ledgerRange Range) (bool, error) {
+	c.mutex.Lock()
+	preparedRange := c.ledgerRange
+	c.mutex.Unlock()
+
+	if preparedRange != nil && ledgerRange.from >= preparedRange.from {
+		if !preparedRange.bounded {
+			return true, nil
+		}
+		if ledgerRange.bounded && ledgerRange.to <= preparedRange.to {
+			return true, nil
+		}
+	}
+
+	return c.backend.IsPrepared(ledgerRange)
+}
+
+// Close closes the wrapped backend. Stored ledgers are kept.
+func (c *CachingBackend) Close() error {
+	c.mutex.Lock()
+	c.ledgerRange = nil
+	c.mutex.Unlock()
+
+	return c.backend.Close()
+}
+
+// ledgerStore is a size bounded directory of gzipped LedgerCloseMeta files.
+// The least recently used files are removed when the size is exceeded.
+// Modification times of files are updated when they are read so the order
+// of use is preserved between restarts.
+type ledgerStore struct {
+	path    string
+	maxSize int64
+
+	mutex sync.Mutex
+	size  int64
+	// lru contains *storedLedger values, the most recently used at the front.
+	lru     *list.List
+	ledgers map[uint32]*list.Element
+}
+
+type storedLedger struct {
+	sequence uint32
+	size     int64
+	modTime  time.Time
+}
+
+func newLedgerStore(path string, maxSize int64) (*ledgerStore, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+
+	store := &ledgerStore{
+		path:    path,
+		maxSize: maxSize,
+		lru:     list.New(),
+		ledgers: map[uint32]*list.Element{},
+	}
+
+	var found []*storedLedger
+	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		// Remove leftovers of interrupted writes
+		if filepath.Ext(filePath) == ".tmp" {
+			return os.Remove(filePath)
+		}
+
+		var sequence uint32
+		if _, scanErr := fmt.Sscanf(info.Name(), metaArchiveCategory+"-%08x.xdr.gz", &sequence); scanErr != nil {
+			return nil
+		}
+		found = append(found, &storedLedger{
+			sequence: sequence,
+			size:     info.Size(),
+			modTime:  info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].modTime.Before(found[j].modTime)
+	})
+	for _, ledger := range found {
+		store.ledgers[ledger.sequence] = store.lru.PushFront(ledger)
+		store.size += ledger.size
+	}
+
+	return store, store.evict()
+}
+
+func (s *ledgerStore) filePath(sequence uint32) string {
+	return filepath.Join(s.path, filepath.FromSlash(MetaArchivePath(sequence)))
+}
+
+func (s *ledgerStore) has(sequence uint32) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.ledgers[sequence]
+	return ok
+}
+
+func (s *ledgerStore) get(sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	element, ok := s.ledgers[sequence]
+	if !ok {
+		return false, xdr.LedgerCloseMeta{}, nil
+	}
+
+	filePath := s.filePath(sequence)
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		// The file was removed outside of the store
+		s.remove(element)
+		return false, xdr.LedgerCloseMeta{}, nil
+	} else if err != nil {
+		return false, xdr.LedgerCloseMeta{}, errors.Wrapf(err, "error opening %s", filePath)
+	}
+
+	stream, err := historyarchive.NewXdrGzStream(file)
+	if err != nil {
+		file.Close()
+		return false, xdr.LedgerCloseMeta{}, errors.Wrapf(err, "error reading %s", filePath)
+	}
+	defer stream.Close()
+
+	var meta xdr.LedgerCloseMeta
+	if err = stream.ReadOne(&meta); err != nil {
+		return false, xdr.LedgerCloseMeta{}, errors.Wrapf(err, "error decoding %s", filePath)
+	}
+
+	now := time.Now()
+	if err = os.Chtimes(filePath, now, now); err != nil {
+		return false, xdr.LedgerCloseMeta{}, errors.Wrapf(err, "error updating modification time of %s", filePath)
+	}
+	element.Value.(*storedLedger).modTime = now
+	s.lru.MoveToFront(element)
+
+	return true, meta, nil
+}
+
+func (s *ledgerStore) put(meta xdr.LedgerCloseMeta) error {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	if err := xdr.MarshalFramed(gzipWriter, meta); err != nil {
+		return errors.Wrap(err, "error marshaling ledger close meta")
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return errors.Wrap(err, "error compressing ledger close meta")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sequence := meta.LedgerSequence()
+	if element, ok := s.ledgers[sequence]; ok {
+		s.remove(element)
+	}
+
+	filePath := s.filePath(sequence)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return errors.Wrapf(err, "error creating directory for %s", filePath)
+	}
+	// Write to a temporary file first so a crash never leaves a partially
+	// written ledger in the store.
+	tmpPath := filePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, buf.Bytes(), 0644); err != nil {
+		return errors.Wrapf(err, "error writing %s", tmpPath)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return errors.Wrapf(err, "error renaming %s", tmpPath)
+	}
+	// Set the modification time explicitly because the time set by the
+	// filesystem can be behind the time set by get.
+	now := time.Now()
+	if err := os.Chtimes(filePath, now, now); err != nil {
+		return errors.Wrapf(err, "error updating modification time of %s", filePath)
+	}
+
+	ledger := &storedLedger{
+		sequence: sequence,
+		size:     int64(buf.Len()),
+		modTime:  now,
+	}
+	s.ledgers[sequence] = s.lru.PushFront(ledger)
+	s.size += ledger.size
+
+	return s.evict()
+}
+
+// evict removes the least recently used ledgers until the size of the store
+// is within the limit. The most recently used ledger is never removed.
+func (s *ledgerStore) evict() error {
+	for s.size > s.maxSize && s.lru.Len() > 1 {
+		element := s.lru.Back()
+		filePath := s.filePath(element.Value.(*storedLedger).sequence)
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "error removing %s", filePath)
+		}
+		s.remove(element)
+	}
+	return nil
+}
+
+func (s *ledgerStore) remove(element *list.Element) {
+	ledger := s.lru.Remove(element).(*storedLedger)
+	delete(s.ledgers, ledger.sequence)
+	s.size -= ledger.size
+}
@@ -0,0 +1,120 @@
+package ledgerbackend
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingBackendServesStoredLedgers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caching-backend")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	inner := &MockDatabaseBackend{}
+	backend, err := NewCachingBackend(inner, CachingBackendConfig{Path: dir, MaxSize: 1 << 20})
+	require.NoError(t, err)
+
+	inner.On("IsPrepared", BoundedRange(2, 4)).Return(false, nil).Once()
+	inner.On("PrepareRange", BoundedRange(2, 4)).Return(nil).Once()
+	assert.NoError(t, backend.PrepareRange(BoundedRange(2, 4)))
+
+	for sequence := uint32(2); sequence <= 4; sequence++ {
+		inner.On("IsPrepared", BoundedRange(sequence, 4)).Return(true, nil).Once()
+		inner.On("GetLedger", sequence).Return(true, metaArchiveLedger(sequence), nil).Once()
+
+		exists, meta, err := backend.GetLedger(sequence)
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		assert.Equal(t, metaArchiveLedger(sequence), meta)
+	}
+	inner.On("Close").Return(nil).Once()
+	assert.NoError(t, backend.Close())
+	inner.AssertExpectations(t)
+
+	// A new instance reading the same directory does not use the wrapped
+	// backend at all.
+	inner = &MockDatabaseBackend{}
+	backend, err = NewCachingBackend(inner, CachingBackendConfig{Path: dir, MaxSize: 1 << 20})
+	require.NoError(t, err)
+
+	assert.NoError(t, backend.PrepareRange(BoundedRange(2, 4)))
+	prepared, err := backend.IsPrepared(BoundedRange(3, 4))
+	assert.NoError(t, err)
+	assert.True(t, prepared)
+
+	inner.On("IsPrepared", BoundedRange(2, 4)).Return(false, nil).Once()
+	latest, err := backend.GetLatestLedgerSequence()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(4), latest)
+
+	for sequence := uint32(2); sequence <= 4; sequence++ {
+		meta, err := backend.GetLedgerBlocking(sequence)
+		assert.NoError(t, err)
+		assert.Equal(t, metaArchiveLedger(sequence), meta)
+	}
+	inner.AssertExpectations(t)
+}
+
+func TestCachingBackendPreparesFromFirstMissingLedger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caching-backend")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	inner := &MockDatabaseBackend{}
+	backend, err := NewCachingBackend(inner, CachingBackendConfig{Path: dir, MaxSize: 1 << 20})
+	require.NoError(t, err)
+	require.NoError(t, backend.store.put(metaArchiveLedger(2)))
+
+	assert.NoError(t, backend.PrepareRange(UnboundedRange(2)))
+	_, err = backend.GetLedgerBlocking(2)
+	assert.NoError(t, err)
+
+	inner.On("IsPrepared", UnboundedRange(3)).Return(false, nil).Once()
+	inner.On("PrepareRange", UnboundedRange(3)).Return(nil).Once()
+	inner.On("GetLedgerBlocking", uint32(3)).Return(metaArchiveLedger(3), nil).Once()
+	meta, err := backend.GetLedgerBlocking(3)
+	assert.NoError(t, err)
+	assert.Equal(t, metaArchiveLedger(3), meta)
+	assert.True(t, backend.store.has(3))
+	inner.AssertExpectations(t)
+}
+
+func TestLedgerStoreEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caching-backend")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := newLedgerStore(dir, 1<<20)
+	require.NoError(t, err)
+	require.NoError(t, store.put(metaArchiveLedger(1)))
+	ledgerSize := store.size
+
+	// Room for two ledgers only
+	store, err = newLedgerStore(dir, 2*ledgerSize)
+	require.NoError(t, err)
+	require.NoError(t, store.put(metaArchiveLedger(2)))
+
+	// Reading ledger 1 makes ledger 2 the least recently used one
+	exists, _, err := store.get(1)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.NoError(t, store.put(metaArchiveLedger(3)))
+	assert.True(t, store.has(1))
+	assert.False(t, store.has(2))
+	assert.True(t, store.has(3))
+	assert.Equal(t, 2*ledgerSize, store.size)
+
+	_, err = os.Stat(store.filePath(2))
+	assert.True(t, os.IsNotExist(err))
+
+	// The order of use is kept between restarts
+	store, err = newLedgerStore(dir, ledgerSize)
+	require.NoError(t, err)
+	assert.False(t, store.has(1))
+	assert.True(t, store.has(3))
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -14,8 +15,31 @@ import (
 	"github.com/stellar/go/xdr"
 )
 
-// Ensure CaptiveStellarCore implements LedgerBackend
+// Ensure CaptiveStellarCore implements LedgerBackend and ContextLedgerBackend
 var _ LedgerBackend = (*CaptiveStellarCore)(nil)
+var _ ContextLedgerBackend = (*CaptiveStellarCore)(nil)
+
+const (
+	// defaultRestartBackoff is the time to wait before the first restart of
+	// Stellar-Core when CaptiveCoreConfig.RestartBackoff is not set.
+	defaultRestartBackoff = time.Second
+	// maxRestartBackoff is the maximum time to wait before a restart of
+	// Stellar-Core.
+	maxRestartBackoff = time.Minute
+)
+
+// coreExitedError is returned when Stellar-Core process exits while ledgers
+// are streamed.
+type coreExitedError struct {
+	err error
+}
+
+func (e coreExitedError) Error() string {
+	if e.err == nil {
+		return "stellar core exited unexpectedly"
+	}
+	return "stellar core exited unexpectedly: " + e.err.Error()
+}
 
 func (c *CaptiveStellarCore) roundDownToFirstReplayAfterCheckpointStart(ledger uint32) uint32 {
 	r := c.checkpointManager.GetCheckpointRange(ledger)
@@ -32,14 +56,18 @@ func (c *CaptiveStellarCore) roundDownToFirstReplayAfterCheckpointStart(ledger u
 // than DatabaseBackend but requires some extra init time.
 //
 // It operates in two modes:
-//   * When a BoundedRange is prepared it starts Stellar-Core in catchup mode that
+//   - When a BoundedRange is prepared it starts Stellar-Core in catchup mode that
 //     replays ledgers in memory. This is very fast but requires Stellar-Core to
 //     keep ledger state in RAM. It requires around 3GB of RAM as of August 2020.
-//   * When a UnboundedRange is prepared it runs Stellar-Core catchup mode to
+//   - When a UnboundedRange is prepared it runs Stellar-Core catchup mode to
 //     sync with the first ledger and then runs it in a normal mode. This
 //     requires the configAppendPath to be provided because a quorum set needs to
 //     be selected.
 //
+// When MaxRestarts is set and Stellar-Core exits unexpectedly, GetLedger
+// restarts it from the last delivered ledger (replaying the checkpoint
+// containing it) and continues streaming as if nothing happened.
+//
 // When running CaptiveStellarCore will create a temporary folder to store
 // bucket files and other temporary files. The folder is removed when Close is
 // called.
@@ -52,9 +80,9 @@ func (c *CaptiveStellarCore) roundDownToFirstReplayAfterCheckpointStart(ledger u
 //
 // While using BoundedRanges is straightforward there are a few gotchas connected
 // to UnboundedRanges:
-//   * PrepareRange takes more time because all ledger entries must be stored on
+//   - PrepareRange takes more time because all ledger entries must be stored on
 //     disk instead of RAM.
-//   * If GetLedger is not called frequently (every 5 sec. on average) the
+//   - If GetLedger is not called frequently (every 5 sec. on average) the
 //     Stellar-Core process can go out of sync with the network. This happens
 //     because there is no buffering of communication pipe and CaptiveStellarCore
 //     has a very small internal buffer and Stellar-Core will not close the new
@@ -70,11 +98,16 @@ type CaptiveStellarCore struct {
 	archive           historyarchive.ArchiveInterface
 	checkpointManager historyarchive.CheckpointManager
 	ledgerHashStore   TrustedLedgerHashStore
+	// archivePool is the pool used as archive, its stats are reported by
+	// Status. It's nil if archive is not a pool.
+	archivePool *historyarchive.FailoverArchivePool
 
 	// cancel is the CancelFunc for context which controls the lifetime of a CaptiveStellarCore instance.
 	// Once it is invoked CaptiveStellarCore will not be able to stream ledgers from Stellar Core or
 	// spawn new instances of Stellar Core.
 	cancel context.CancelFunc
+	// ctx is the context cancelled by cancel, nil means context.Background.
+	ctx context.Context
 
 	stellarCoreRunner stellarCoreRunnerInterface
 	// stellarCoreLock protects access to stellarCoreRunner. When the read lock
@@ -100,6 +133,27 @@ type CaptiveStellarCore struct {
 	nextLedger         uint32  // next ledger expected, error w/ restart if not seen
 	lastLedger         *uint32 // end of current segment if offline, nil if online
 	previousLedgerHash *string
+
+	// maxRestarts and restartBackoff configure restarting Stellar-Core when
+	// it exits unexpectedly. restarts is the number of restarts since the
+	// last ledger returned by GetLedger.
+	maxRestarts    int
+	restartBackoff time.Duration
+	restarts       int
+	// resumeLedger and resumeLedgerHash are the sequence and hash of the last
+	// ledger streamed before a restart. Stellar-Core replays it after the
+	// restart and its hash must not change. resumeLedger is 0 if there is
+	// nothing to check.
+	resumeLedger     uint32
+	resumeLedgerHash string
+
+	// httpPort is the Stellar-Core HTTP server port queried by Status, 0 if
+	// the server is disabled.
+	httpPort uint
+	// statusLock protects status which, unlike other fields, can be accessed
+	// by Status from another go routine.
+	statusLock sync.Mutex
+	status     captiveCoreStatusTracker
 }
 
 // CaptiveCoreConfig contains all the parameters required to create a CaptiveStellarCore instance
@@ -142,6 +196,20 @@ type CaptiveCoreConfig struct {
 	// stored. We always append /captive-core to this directory, since we clean
 	// it up entirely on shutdown.
 	StoragePath string
+	// MaxRestarts is the (optional) maximum number of consecutive restarts of
+	// Stellar-Core after it exits unexpectedly. The counter is reset when a
+	// ledger is returned by GetLedger. If MaxRestarts is 0 (default) an error
+	// is returned when Stellar-Core exits.
+	MaxRestarts int
+	// RestartBackoff is the (optional) time to wait before the first restart
+	// of Stellar-Core. It is doubled for each consecutive restart up to one
+	// minute. Defaults to one second.
+	RestartBackoff time.Duration
+	// HistoryArchiveHedgeDelay enables (optional) hedged bucket downloads
+	// when more than one history archive is configured: if an archive does
+	// not respond within HistoryArchiveHedgeDelay the bucket is requested from
+	// another archive too. See historyarchive.FailoverArchivePoolOptions.
+	HistoryArchiveHedgeDelay time.Duration
 }
 
 // NewCaptive returns a new CaptiveStellarCore instance.
@@ -163,13 +231,16 @@ func NewCaptive(config CaptiveCoreConfig) (*CaptiveStellarCore, error) {
 	var cancel context.CancelFunc
 	config.Context, cancel = context.WithCancel(parentCtx)
 
-	archivePool, err := historyarchive.NewArchivePool(
+	archivePool, err := historyarchive.NewFailoverArchivePool(
 		config.HistoryArchiveURLs,
 		historyarchive.ConnectOptions{
 			NetworkPassphrase:   config.NetworkPassphrase,
 			CheckpointFrequency: config.CheckpointFrequency,
 			Context:             config.Context,
 		},
+		historyarchive.FailoverArchivePoolOptions{
+			HedgeDelay: config.HistoryArchiveHedgeDelay,
+		},
 	)
 
 	if err != nil {
@@ -178,10 +249,15 @@ func NewCaptive(config CaptiveCoreConfig) (*CaptiveStellarCore, error) {
 	}
 
 	c := &CaptiveStellarCore{
-		archive:           &archivePool,
+		archive:           archivePool,
+		archivePool:       archivePool,
 		ledgerHashStore:   config.LedgerHashStore,
 		cancel:            cancel,
 		checkpointManager: historyarchive.NewCheckpointManager(config.CheckpointFrequency),
+		ctx:               config.Context,
+		httpPort:          config.HTTPPort,
+		maxRestarts:       config.MaxRestarts,
+		restartBackoff:    config.RestartBackoff,
 	}
 
 	c.stellarCoreRunnerFactory = func(mode stellarCoreRunnerMode) (stellarCoreRunnerInterface, error) {
@@ -237,6 +313,7 @@ func (c *CaptiveStellarCore) openOfflineReplaySubprocess(from, to uint32) error
 	c.lastLedger = &to
 	c.setBlocking(true)
 	c.previousLedgerHash = nil
+	c.recordProcessStart(CaptiveCoreModeOffline, c.nextLedger, to)
 
 	return nil
 }
@@ -282,6 +359,7 @@ func (c *CaptiveStellarCore) openOnlineReplaySubprocess(from uint32) error {
 	c.nextLedger = nextLedger
 	c.lastLedger = nil
 	c.previousLedgerHash = nil
+	c.recordProcessStart(CaptiveCoreModeOnline, nextLedger, from)
 
 	if c.ledgerHashStore != nil {
 		var exists bool
@@ -388,12 +466,25 @@ func (c *CaptiveStellarCore) startPreparingRange(ledgerRange Range) (bool, error
 // Captive stellar-core backend needs to initalize Stellar-Core state to be
 // able to stream ledgers.
 // Stellar-Core mode depends on the provided ledgerRange:
-//   * For BoundedRange it will start Stellar-Core in catchup mode.
-//   * For UnboundedRange it will first catchup to starting ledger and then run
+//   - For BoundedRange it will start Stellar-Core in catchup mode.
+//   - For UnboundedRange it will first catchup to starting ledger and then run
 //     it normally (including connecting to the Stellar network).
+//
 // Please note that using a BoundedRange, currently, requires a full-trust on
 // history archive. This issue is being fixed in Stellar-Core.
 func (c *CaptiveStellarCore) PrepareRange(ledgerRange Range) error {
+	return c.PrepareRangeContext(context.Background(), ledgerRange)
+}
+
+// PrepareRangeContext works like PrepareRange but waiting for the first
+// ledger of the range can be interrupted by the context. Stellar-Core keeps
+// running when the context is done so a subsequent PrepareRange call with the
+// same range does not start it again.
+func (c *CaptiveStellarCore) PrepareRangeContext(ctx context.Context, ledgerRange Range) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if alreadyPrepared, err := c.startPreparingRange(ledgerRange); err != nil {
 		return errors.Wrap(err, "error starting prepare range")
 	} else if alreadyPrepared {
@@ -402,7 +493,7 @@ func (c *CaptiveStellarCore) PrepareRange(ledgerRange Range) error {
 
 	old := c.isBlocking()
 	c.setBlocking(true)
-	_, _, err := c.GetLedger(ledgerRange.from)
+	_, _, err := c.GetLedgerContext(ctx, ledgerRange.from)
 	c.setBlocking(old)
 
 	if err != nil {
@@ -414,6 +505,15 @@ func (c *CaptiveStellarCore) PrepareRange(ledgerRange Range) error {
 
 // IsPrepared returns true if a given ledgerRange is prepared.
 func (c *CaptiveStellarCore) IsPrepared(ledgerRange Range) (bool, error) {
+	return c.IsPreparedContext(context.Background(), ledgerRange)
+}
+
+// IsPreparedContext returns true if a given ledgerRange is prepared.
+func (c *CaptiveStellarCore) IsPreparedContext(ctx context.Context, ledgerRange Range) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
 	c.stellarCoreLock.RLock()
 	defer c.stellarCoreLock.RUnlock()
 
@@ -459,9 +559,15 @@ func (c *CaptiveStellarCore) isPrepared(ledgerRange Range) bool {
 // Please note that requesting a ledger sequence far after current ledger will
 // block the execution for a long time.
 func (c *CaptiveStellarCore) GetLedgerBlocking(sequence uint32) (xdr.LedgerCloseMeta, error) {
+	return c.GetLedgerBlockingContext(context.Background(), sequence)
+}
+
+// GetLedgerBlockingContext works as GetLedgerBlocking but waiting for the
+// ledger can be interrupted by the context.
+func (c *CaptiveStellarCore) GetLedgerBlockingContext(ctx context.Context, sequence uint32) (xdr.LedgerCloseMeta, error) {
 	old := c.isBlocking()
 	c.setBlocking(true)
-	_, meta, err := c.GetLedger(sequence)
+	_, meta, err := c.GetLedgerContext(ctx, sequence)
 	c.setBlocking(old)
 	return meta, err
 }
@@ -477,13 +583,107 @@ func (c *CaptiveStellarCore) GetLedgerBlocking(sequence uint32) (xdr.LedgerClose
 // is less than the last requested sequence number, an error will be returned.
 //
 // This function behaves differently for bounded and unbounded ranges:
-//   * BoundedRange makes GetLedger blocking if the requested ledger is not yet
+//   - BoundedRange makes GetLedger blocking if the requested ledger is not yet
 //     available in the ledger. After getting the last ledger in a range this
 //     method will also Close() the backend.
-//   * UnboundedRange makes GetLedger non-blocking. The method will return with
+//   - UnboundedRange makes GetLedger non-blocking. The method will return with
 //     the first argument equal false.
+//
 // This is done to provide maximum performance when streaming old ledgers.
 func (c *CaptiveStellarCore) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
+	return c.GetLedgerContext(context.Background(), sequence)
+}
+
+// GetLedgerContext works as GetLedger but waiting for the ledger can be
+// interrupted by the context. In such case the context error is returned and,
+// unlike other errors, the Stellar-Core session is not closed: ledgers
+// streamed so far are not lost and GetLedger can be called again.
+func (c *CaptiveStellarCore) GetLedgerContext(ctx context.Context, sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
+	for {
+		exists, meta, err := c.getLedger(ctx, sequence)
+		if _, exited := err.(coreExitedError); !exited || c.restarts >= c.maxRestarts {
+			return exists, meta, err
+		}
+
+		if restartErr := c.restart(ctx); restartErr != nil {
+			return false, xdr.LedgerCloseMeta{}, errors.Wrapf(restartErr, "error restarting stellar-core (%v)", err)
+		}
+	}
+}
+
+// restart waits for the backoff duration and starts Stellar-Core again so it
+// streams ledgers starting from the next ledger expected by GetLedger.
+func (c *CaptiveStellarCore) restart(ctx context.Context) error {
+	c.restarts++
+
+	backoff := c.restartBackoff
+	if backoff <= 0 {
+		backoff = defaultRestartBackoff
+	}
+	for i := 1; i < c.restarts && backoff < maxRestartBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRestartBackoff {
+		backoff = maxRestartBackoff
+	}
+
+	instanceCtx := c.ctx
+	if instanceCtx == nil {
+		instanceCtx = context.Background()
+	}
+
+	log.Warnf(
+		"Stellar-Core exited unexpectedly, restarting in %v (restart %d of %d)",
+		backoff, c.restarts, c.maxRestarts,
+	)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-instanceCtx.Done():
+		return instanceCtx.Err()
+	case <-time.After(backoff):
+	}
+
+	c.stellarCoreLock.Lock()
+	defer c.stellarCoreLock.Unlock()
+
+	// Close could be called while waiting
+	if err := instanceCtx.Err(); err != nil {
+		return err
+	}
+
+	resumeLedger := c.nextLedger
+	resumeLedgerHash := c.previousLedgerHash
+	blocking := c.isBlocking()
+
+	var err error
+	if c.lastLedger != nil {
+		err = c.openOfflineReplaySubprocess(resumeLedger, *c.lastLedger)
+	} else {
+		err = c.openOnlineReplaySubprocess(resumeLedger)
+	}
+	if err != nil {
+		return errors.Wrap(err, "opening subprocess")
+	}
+	c.setBlocking(blocking)
+
+	// Stellar-Core starts streaming from the beginning of the checkpoint so
+	// ledgers delivered before it crashed are streamed again.
+	c.resumeLedger = 0
+	if resumeLedgerHash != nil && c.nextLedger < resumeLedger {
+		c.resumeLedger = resumeLedger - 1
+		c.resumeLedgerHash = *resumeLedgerHash
+	}
+	c.recordRestart()
+
+	return nil
+}
+
+func (c *CaptiveStellarCore) getLedger(ctx context.Context, sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return false, xdr.LedgerCloseMeta{}, err
+	}
+
 	c.stellarCoreLock.RLock()
 	defer c.stellarCoreLock.RUnlock()
 
@@ -520,12 +720,19 @@ func (c *CaptiveStellarCore) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMe
 			return false, xdr.LedgerCloseMeta{}, nil
 		}
 
-		result, ok := <-c.stellarCoreRunner.getMetaPipe()
+		var result metaResult
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return false, xdr.LedgerCloseMeta{}, ctx.Err()
+		case result, ok = <-c.stellarCoreRunner.getMetaPipe():
+		}
 		if errOut = c.checkMetaPipeResult(result, ok); errOut != nil {
 			break
 		}
 
 		seq := result.LedgerCloseMeta.LedgerSequence()
+		c.recordLedgerReceived(seq, result.size)
 		if seq != c.nextLedger {
 			// We got something unexpected; close and reset
 			errOut = errors.Errorf(
@@ -548,14 +755,28 @@ func (c *CaptiveStellarCore) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMe
 			break
 		}
 
-		c.nextLedger++
 		currentLedgerHash := result.LedgerCloseMeta.LedgerHash().HexString()
+		if c.resumeLedger != 0 && seq == c.resumeLedger {
+			if currentLedgerHash != c.resumeLedgerHash {
+				errOut = errors.Errorf(
+					"unexpected hash for ledger %d after stellar-core restart (expected=%s actual=%s)",
+					seq,
+					c.resumeLedgerHash,
+					currentLedgerHash,
+				)
+				break
+			}
+			c.resumeLedger = 0
+		}
+
+		c.nextLedger++
 		c.previousLedgerHash = &currentLedgerHash
 
 		// Update cache with the latest value because we incremented nextLedger.
 		c.cachedMeta = result.LedgerCloseMeta
 
 		if seq == sequence {
+			c.restarts = 0
 			// If we got the _last_ ledger in a segment, close before returning.
 			if c.lastLedger != nil && *c.lastLedger == seq {
 				if err := c.stellarCoreRunner.close(); err != nil {
@@ -584,11 +805,8 @@ func (c *CaptiveStellarCore) checkMetaPipeResult(result metaResult, ok bool) err
 	if !ok || result.err != nil {
 		if exited, err := c.stellarCoreRunner.getProcessExitError(); exited {
 			// Case 2 - The stellar core process exited unexpectedly
-			if err == nil {
-				return errors.Errorf("stellar core exited unexpectedly")
-			} else {
-				return errors.Wrap(err, "stellar core exited unexpectedly")
-			}
+			c.recordUnexpectedExit()
+			return coreExitedError{err: err}
 		} else if !ok {
 			// This case should never happen because the ledger buffer channel can only be closed
 			// if and only if the process exits or the context is cancelled.
@@ -610,6 +828,15 @@ func (c *CaptiveStellarCore) checkMetaPipeResult(result metaResult, ok bool) err
 // the latest sequence closed by the network. It's always the last value available
 // in the backend.
 func (c *CaptiveStellarCore) GetLatestLedgerSequence() (uint32, error) {
+	return c.GetLatestLedgerSequenceContext(context.Background())
+}
+
+// GetLatestLedgerSequenceContext works as GetLatestLedgerSequence.
+func (c *CaptiveStellarCore) GetLatestLedgerSequenceContext(ctx context.Context) (uint32, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
 	c.stellarCoreLock.RLock()
 	defer c.stellarCoreLock.RUnlock()
 
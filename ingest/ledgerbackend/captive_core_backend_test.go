@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -1301,3 +1302,212 @@ func TestCaptivePreviousLedgerCheck(t *testing.T) {
 	mockArchive.AssertExpectations(t)
 	mockLedgerHashStore.AssertExpectations(t)
 }
+
+func TestCaptiveGetLedgerContextDone(t *testing.T) {
+	metaChan := make(chan metaResult, 100)
+	for i := 64; i <= 65; i++ {
+		meta := buildLedgerCloseMeta(testLedgerHeader{sequence: uint32(i)})
+		metaChan <- metaResult{
+			LedgerCloseMeta: &meta,
+		}
+	}
+
+	mockRunner := &stellarCoreRunnerMock{}
+	mockRunner.On("catchup", uint32(65), uint32(66)).Return(nil)
+	mockRunner.On("getMetaPipe").Return((<-chan metaResult)(metaChan))
+	mockRunner.On("context").Return(context.Background())
+
+	mockArchive := &historyarchive.MockArchive{}
+	mockArchive.
+		On("GetRootHAS").
+		Return(historyarchive.HistoryArchiveState{
+			CurrentLedger: uint32(200),
+		}, nil)
+
+	captiveBackend := CaptiveStellarCore{
+		archive: mockArchive,
+		stellarCoreRunnerFactory: func(_ stellarCoreRunnerMode) (stellarCoreRunnerInterface, error) {
+			return mockRunner, nil
+		},
+		checkpointManager: historyarchive.NewCheckpointManager(64),
+	}
+
+	err := captiveBackend.PrepareRangeContext(context.Background(), BoundedRange(65, 66))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err = captiveBackend.GetLedgerContext(ctx, 66)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// The session is not closed so the ledger can be read later
+	prepared, err := captiveBackend.IsPreparedContext(context.Background(), BoundedRange(66, 66))
+	assert.NoError(t, err)
+	assert.True(t, prepared)
+
+	meta := buildLedgerCloseMeta(testLedgerHeader{sequence: uint32(66)})
+	metaChan <- metaResult{
+		LedgerCloseMeta: &meta,
+	}
+	mockRunner.On("close").Return(nil).Once()
+
+	exists, ledger, err := captiveBackend.GetLedgerContext(context.Background(), 66)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, uint32(66), ledger.LedgerSequence())
+
+	mockArchive.AssertExpectations(t)
+	mockRunner.AssertExpectations(t)
+}
+
+// crashingRunner returns a runner mock streaming ledgers from..to (with
+// hashes offset by hashOffset) and then exiting.
+func crashingRunner(from, to, hashOffset uint32) (*stellarCoreRunnerMock, chan metaResult) {
+	metaChan := make(chan metaResult, 100)
+	for i := from; i <= to; i++ {
+		meta := buildLedgerCloseMeta(testLedgerHeader{
+			sequence:           i,
+			hash:               fmt.Sprintf("%064x", i+hashOffset),
+			previousLedgerHash: fmt.Sprintf("%064x", i-1+hashOffset),
+		})
+		metaChan <- metaResult{LedgerCloseMeta: &meta}
+	}
+
+	mockRunner := &stellarCoreRunnerMock{}
+	mockRunner.On("getMetaPipe").Return((<-chan metaResult)(metaChan))
+	mockRunner.On("context").Return(context.Background())
+	mockRunner.On("getProcessExitError").Return(true, errors.New("exit code -1")).Maybe()
+	mockRunner.On("close").Return(nil)
+	return mockRunner, metaChan
+}
+
+func TestCaptiveRestartAfterCrash(t *testing.T) {
+	firstRunner, firstChan := crashingRunner(64, 70, 0)
+	firstRunner.On("catchup", uint32(65), uint32(100)).Return(nil).Once()
+	close(firstChan)
+
+	secondRunner, _ := crashingRunner(64, 100, 0)
+	secondRunner.On("catchup", uint32(71), uint32(100)).Return(nil).Once()
+
+	mockArchive := &historyarchive.MockArchive{}
+	mockArchive.
+		On("GetRootHAS").
+		Return(historyarchive.HistoryArchiveState{
+			CurrentLedger: uint32(200),
+		}, nil)
+
+	runners := []*stellarCoreRunnerMock{firstRunner, secondRunner}
+	captiveBackend := CaptiveStellarCore{
+		archive: mockArchive,
+		stellarCoreRunnerFactory: func(_ stellarCoreRunnerMode) (stellarCoreRunnerInterface, error) {
+			runner := runners[0]
+			runners = runners[1:]
+			return runner, nil
+		},
+		checkpointManager: historyarchive.NewCheckpointManager(64),
+		maxRestarts:       1,
+		restartBackoff:    time.Millisecond,
+	}
+
+	assert.NoError(t, captiveBackend.PrepareRange(BoundedRange(65, 100)))
+	for i := uint32(66); i <= 100; i++ {
+		exists, meta, err := captiveBackend.GetLedger(i)
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		assert.Equal(t, i, meta.LedgerSequence())
+	}
+
+	status := captiveBackend.Status(context.Background())
+	assert.Equal(t, uint64(2), status.ProcessStarts)
+	assert.Equal(t, uint64(1), status.ProcessRestarts)
+	assert.Equal(t, uint64(1), status.UnexpectedExits)
+
+	firstRunner.AssertExpectations(t)
+	secondRunner.AssertExpectations(t)
+	mockArchive.AssertExpectations(t)
+}
+
+func TestCaptiveRestartBudgetExhausted(t *testing.T) {
+	firstRunner, firstChan := crashingRunner(64, 70, 0)
+	firstRunner.On("catchup", uint32(65), uint32(100)).Return(nil).Once()
+	close(firstChan)
+
+	// The second runner crashes before reaching the ledger requested
+	secondRunner, secondChan := crashingRunner(64, 68, 0)
+	secondRunner.On("catchup", uint32(71), uint32(100)).Return(nil).Once()
+	close(secondChan)
+
+	mockArchive := &historyarchive.MockArchive{}
+	mockArchive.
+		On("GetRootHAS").
+		Return(historyarchive.HistoryArchiveState{
+			CurrentLedger: uint32(200),
+		}, nil)
+
+	runners := []*stellarCoreRunnerMock{firstRunner, secondRunner}
+	captiveBackend := CaptiveStellarCore{
+		archive: mockArchive,
+		stellarCoreRunnerFactory: func(_ stellarCoreRunnerMode) (stellarCoreRunnerInterface, error) {
+			runner := runners[0]
+			runners = runners[1:]
+			return runner, nil
+		},
+		checkpointManager: historyarchive.NewCheckpointManager(64),
+		maxRestarts:       1,
+		restartBackoff:    time.Millisecond,
+	}
+
+	assert.NoError(t, captiveBackend.PrepareRange(BoundedRange(65, 100)))
+	_, _, err := captiveBackend.GetLedger(70)
+	assert.NoError(t, err)
+
+	_, _, err = captiveBackend.GetLedger(71)
+	assert.EqualError(t, err, "stellar core exited unexpectedly: exit code -1")
+
+	firstRunner.AssertExpectations(t)
+	secondRunner.AssertExpectations(t)
+}
+
+func TestCaptiveRestartHashMismatch(t *testing.T) {
+	firstRunner, firstChan := crashingRunner(64, 70, 0)
+	firstRunner.On("catchup", uint32(65), uint32(100)).Return(nil).Once()
+	close(firstChan)
+
+	// Ledgers replayed after restart have different hashes
+	secondRunner, _ := crashingRunner(64, 100, 1000)
+	secondRunner.On("catchup", uint32(71), uint32(100)).Return(nil).Once()
+
+	mockArchive := &historyarchive.MockArchive{}
+	mockArchive.
+		On("GetRootHAS").
+		Return(historyarchive.HistoryArchiveState{
+			CurrentLedger: uint32(200),
+		}, nil)
+
+	runners := []*stellarCoreRunnerMock{firstRunner, secondRunner}
+	captiveBackend := CaptiveStellarCore{
+		archive: mockArchive,
+		stellarCoreRunnerFactory: func(_ stellarCoreRunnerMode) (stellarCoreRunnerInterface, error) {
+			runner := runners[0]
+			runners = runners[1:]
+			return runner, nil
+		},
+		checkpointManager: historyarchive.NewCheckpointManager(64),
+		maxRestarts:       1,
+		restartBackoff:    time.Millisecond,
+	}
+
+	assert.NoError(t, captiveBackend.PrepareRange(BoundedRange(65, 100)))
+	_, _, err := captiveBackend.GetLedger(70)
+	assert.NoError(t, err)
+
+	_, _, err = captiveBackend.GetLedger(71)
+	assert.EqualError(
+		t,
+		err,
+		fmt.Sprintf(
+			"unexpected hash for ledger 70 after stellar-core restart (expected=%064x actual=%064x)",
+			70, 1070,
+		),
+	)
+}
@@ -0,0 +1,379 @@
+package ledgerbackend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/stellar/go/clients/stellarcore"
+	"github.com/stellar/go/historyarchive"
+)
+
+// captiveCoreInfoTimeout is the timeout of requests to Stellar-Core HTTP
+// server sent by CaptiveStellarCore.Status.
+const captiveCoreInfoTimeout = 2 * time.Second
+
+// CaptiveCoreMode describes what the Stellar-Core subprocess of
+// CaptiveStellarCore is doing.
+type CaptiveCoreMode string
+
+const (
+	// CaptiveCoreModeStopped means that Stellar-Core is not running.
+	CaptiveCoreModeStopped CaptiveCoreMode = "stopped"
+	// CaptiveCoreModeOffline means that Stellar-Core is replaying a bounded
+	// range using catchup.
+	CaptiveCoreModeOffline CaptiveCoreMode = "offline"
+	// CaptiveCoreModeOnline means that Stellar-Core catches up to the first
+	// ledger of an unbounded range and then follows the network.
+	CaptiveCoreModeOnline CaptiveCoreMode = "online"
+)
+
+var captiveCoreModes = []CaptiveCoreMode{
+	CaptiveCoreModeStopped,
+	CaptiveCoreModeOffline,
+	CaptiveCoreModeOnline,
+}
+
+// CaptiveCoreStatus is a snapshot of the state of CaptiveStellarCore.
+type CaptiveCoreStatus struct {
+	Mode CaptiveCoreMode `json:"mode"`
+	// From is the first ledger streamed by Stellar-Core in the current
+	// session. It's usually the first ledger of the checkpoint containing the
+	// ledger passed to PrepareRange.
+	From uint32 `json:"from"`
+	// Target is the ledger Stellar-Core catches up to: the last ledger of a
+	// bounded range or the first ledger of an unbounded range.
+	Target uint32 `json:"target"`
+	// CatchupProgress is the fraction (0 to 1) of ledgers between From and
+	// Target already received from Stellar-Core.
+	CatchupProgress float64 `json:"catchup_progress"`
+	// MetaPipeBuffered is the number of ledgers read from the meta pipe and
+	// not yet returned by GetLedger.
+	MetaPipeBuffered int `json:"meta_pipe_buffered"`
+
+	// LastLedger is the sequence of the last ledger received from the meta
+	// pipe. It's 0 when no ledger has been received yet.
+	LastLedger           uint32    `json:"last_ledger"`
+	LastLedgerReceivedAt time.Time `json:"last_ledger_received_at"`
+	// LedgersPerSecond and MetaBytesPerSecond is the meta pipe throughput
+	// in the current session measured since the first ledger was received.
+	LedgersPerSecond   float64 `json:"ledgers_per_second"`
+	MetaBytesPerSecond float64 `json:"meta_bytes_per_second"`
+
+	// LedgersReceived and MetaBytesReceived count all ledgers and bytes
+	// received from the meta pipe by the CaptiveStellarCore instance.
+	LedgersReceived   uint64 `json:"ledgers_received"`
+	MetaBytesReceived uint64 `json:"meta_bytes_received"`
+	// ProcessStarts is the number of times Stellar-Core was started.
+	ProcessStarts uint64 `json:"process_starts"`
+	// ProcessRestarts is the number of times Stellar-Core was restarted
+	// after it exited unexpectedly.
+	ProcessRestarts uint64 `json:"process_restarts"`
+	// UnexpectedExits is the number of times Stellar-Core exited while
+	// ledgers were streamed.
+	UnexpectedExits uint64 `json:"unexpected_exits"`
+
+	// CoreState and CoreStatus are the state and status messages (ex.
+	// bucket download and apply progress) reported by Stellar-Core info
+	// endpoint. They are set only when HTTPPort is configured.
+	CoreState  string   `json:"core_state,omitempty"`
+	CoreStatus []string `json:"core_status,omitempty"`
+	// CoreInfoError is set when Stellar-Core info endpoint cannot be queried.
+	CoreInfoError string `json:"core_info_error,omitempty"`
+
+	// HistoryArchives are statistics of requests sent to every configured
+	// history archive.
+	HistoryArchives []historyarchive.FailoverArchivePoolStats `json:"history_archives,omitempty"`
+}
+
+// captiveCoreStatusTracker keeps the data returned by
+// CaptiveStellarCore.Status. Unlike the other fields of CaptiveStellarCore it
+// can be accessed by multiple go routines.
+type captiveCoreStatusTracker struct {
+	runner stellarCoreRunnerInterface
+	mode   CaptiveCoreMode
+	from   uint32
+	target uint32
+
+	lastLedger           uint32
+	lastLedgerReceivedAt time.Time
+	sessionStartedAt     time.Time
+	sessionLedgers       uint64
+	sessionBytes         uint64
+
+	ledgersReceived   uint64
+	metaBytesReceived uint64
+	processStarts     uint64
+	processRestarts   uint64
+	unexpectedExits   uint64
+}
+
+func (c *CaptiveStellarCore) recordProcessStart(mode CaptiveCoreMode, from, target uint32) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	c.status.runner = c.stellarCoreRunner
+	c.status.mode = mode
+	c.status.from = from
+	c.status.target = target
+	c.status.lastLedger = 0
+	c.status.lastLedgerReceivedAt = time.Time{}
+	c.status.sessionStartedAt = time.Time{}
+	c.status.sessionLedgers = 0
+	c.status.sessionBytes = 0
+	c.status.processStarts++
+}
+
+func (c *CaptiveStellarCore) recordLedgerReceived(sequence, size uint32) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	now := time.Now()
+	if c.status.sessionLedgers == 0 {
+		c.status.sessionStartedAt = now
+	}
+	c.status.lastLedger = sequence
+	c.status.lastLedgerReceivedAt = now
+	c.status.sessionLedgers++
+	c.status.sessionBytes += uint64(size)
+	c.status.ledgersReceived++
+	c.status.metaBytesReceived += uint64(size)
+}
+
+func (c *CaptiveStellarCore) recordRestart() {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	c.status.processRestarts++
+}
+
+func (c *CaptiveStellarCore) recordUnexpectedExit() {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	c.status.unexpectedExits++
+}
+
+// localStatus returns the status without querying Stellar-Core.
+func (c *CaptiveStellarCore) localStatus() CaptiveCoreStatus {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	s := c.status
+	status := CaptiveCoreStatus{
+		Mode:                 CaptiveCoreModeStopped,
+		From:                 s.from,
+		Target:               s.target,
+		LastLedger:           s.lastLedger,
+		LastLedgerReceivedAt: s.lastLedgerReceivedAt,
+		LedgersReceived:      s.ledgersReceived,
+		MetaBytesReceived:    s.metaBytesReceived,
+		ProcessStarts:        s.processStarts,
+		ProcessRestarts:      s.processRestarts,
+		UnexpectedExits:      s.unexpectedExits,
+	}
+
+	if c.archivePool != nil {
+		status.HistoryArchives = c.archivePool.Stats()
+	}
+
+	if s.runner != nil && s.runner.context().Err() == nil {
+		status.Mode = s.mode
+		status.MetaPipeBuffered = len(s.runner.getMetaPipe())
+	}
+
+	switch {
+	case s.lastLedger >= s.target && s.lastLedger != 0:
+		status.CatchupProgress = 1
+	case s.lastLedger >= s.from && s.target > s.from:
+		status.CatchupProgress = float64(s.lastLedger-s.from+1) / float64(s.target-s.from+1)
+	}
+
+	// The first ledger marks the start of measurement so at least two are
+	// needed to calculate throughput.
+	if elapsed := s.lastLedgerReceivedAt.Sub(s.sessionStartedAt).Seconds(); s.sessionLedgers > 1 && elapsed > 0 {
+		status.LedgersPerSecond = float64(s.sessionLedgers-1) / elapsed
+		status.MetaBytesPerSecond = float64(s.sessionBytes) / elapsed
+	}
+
+	return status
+}
+
+// Status returns the current status of CaptiveStellarCore: the mode of
+// Stellar-Core, catchup progress, meta pipe statistics and, if HTTPPort is
+// configured, the state reported by Stellar-Core itself.
+// Status is thread-safe and can be called from another go routine.
+func (c *CaptiveStellarCore) Status(ctx context.Context) CaptiveCoreStatus {
+	status := c.localStatus()
+	if c.httpPort == 0 || status.Mode == CaptiveCoreModeStopped {
+		return status
+	}
+
+	client := stellarcore.Client{
+		HTTP: &http.Client{Timeout: captiveCoreInfoTimeout},
+		URL:  fmt.Sprintf("http://localhost:%d", c.httpPort),
+	}
+	info, err := client.Info(ctx)
+	if err != nil {
+		status.CoreInfoError = err.Error()
+		return status
+	}
+	status.CoreState = info.Info.State
+	status.CoreStatus = info.Info.Status
+	return status
+}
+
+// captiveCoreCollector is a prometheus.Collector exposing CaptiveStellarCore
+// status.
+type captiveCoreCollector struct {
+	core *CaptiveStellarCore
+
+	mode              *prometheus.Desc
+	catchupProgress   *prometheus.Desc
+	metaPipeBuffered  *prometheus.Desc
+	lastLedger        *prometheus.Desc
+	lastLedgerAge     *prometheus.Desc
+	ledgersReceived   *prometheus.Desc
+	metaBytesReceived *prometheus.Desc
+	processStarts     *prometheus.Desc
+	processRestarts   *prometheus.Desc
+	unexpectedExits   *prometheus.Desc
+
+	archiveRequests *prometheus.Desc
+	archiveErrors   *prometheus.Desc
+	archiveLatency  *prometheus.Desc
+	archiveHealthy  *prometheus.Desc
+}
+
+// NewCaptiveCoreCollector returns a prometheus.Collector exposing the status
+// of the given CaptiveStellarCore instance. All metrics names start with
+// `captive_core_` prefixed by namespace and subsystem (if not empty).
+func NewCaptiveCoreCollector(core *CaptiveStellarCore, namespace, subsystem string) prometheus.Collector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "captive_core_"+name),
+			help, labels, nil,
+		)
+	}
+
+	return &captiveCoreCollector{
+		core: core,
+		mode: desc(
+			"mode",
+			"1 for the current mode of Stellar-Core (stopped, offline, online), 0 for other modes.",
+			"mode",
+		),
+		catchupProgress: desc(
+			"catchup_progress",
+			"Fraction (0 to 1) of ledgers in the catchup range already received from Stellar-Core.",
+		),
+		metaPipeBuffered: desc(
+			"meta_pipe_buffered_ledgers",
+			"Number of ledgers read from the meta pipe and not yet processed.",
+		),
+		lastLedger: desc(
+			"last_ledger",
+			"Sequence of the last ledger received from Stellar-Core.",
+		),
+		lastLedgerAge: desc(
+			"last_ledger_age_seconds",
+			"Number of seconds since the last ledger was received from Stellar-Core, -1 if none was received.",
+		),
+		ledgersReceived: desc(
+			"ledgers_received_total",
+			"Number of ledgers received from Stellar-Core.",
+		),
+		metaBytesReceived: desc(
+			"meta_pipe_bytes_total",
+			"Number of bytes received from Stellar-Core meta pipe.",
+		),
+		processStarts: desc(
+			"process_starts_total",
+			"Number of times Stellar-Core process was started.",
+		),
+		processRestarts: desc(
+			"process_restarts_total",
+			"Number of times Stellar-Core process was restarted after exiting unexpectedly.",
+		),
+		unexpectedExits: desc(
+			"process_unexpected_exits_total",
+			"Number of times Stellar-Core process exited unexpectedly.",
+		),
+		archiveRequests: desc(
+			"history_archive_requests_total",
+			"Number of requests sent to the history archive.",
+			"archive",
+		),
+		archiveErrors: desc(
+			"history_archive_errors_total",
+			"Number of requests to the history archive which failed.",
+			"archive",
+		),
+		archiveLatency: desc(
+			"history_archive_average_latency_seconds",
+			"Average duration of requests to the history archive.",
+			"archive",
+		),
+		archiveHealthy: desc(
+			"history_archive_healthy",
+			"1 if the history archive is used, 0 if it's skipped after an error.",
+			"archive",
+		),
+	}
+}
+
+func (cc *captiveCoreCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.mode
+	ch <- cc.catchupProgress
+	ch <- cc.metaPipeBuffered
+	ch <- cc.lastLedger
+	ch <- cc.lastLedgerAge
+	ch <- cc.ledgersReceived
+	ch <- cc.metaBytesReceived
+	ch <- cc.processStarts
+	ch <- cc.processRestarts
+	ch <- cc.unexpectedExits
+	ch <- cc.archiveRequests
+	ch <- cc.archiveErrors
+	ch <- cc.archiveLatency
+	ch <- cc.archiveHealthy
+}
+
+func (cc *captiveCoreCollector) Collect(ch chan<- prometheus.Metric) {
+	status := cc.core.localStatus()
+
+	for _, mode := range captiveCoreModes {
+		value := 0.0
+		if mode == status.Mode {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(cc.mode, prometheus.GaugeValue, value, string(mode))
+	}
+
+	lastLedgerAge := -1.0
+	if !status.LastLedgerReceivedAt.IsZero() {
+		lastLedgerAge = time.Since(status.LastLedgerReceivedAt).Seconds()
+	}
+
+	ch <- prometheus.MustNewConstMetric(cc.catchupProgress, prometheus.GaugeValue, status.CatchupProgress)
+	ch <- prometheus.MustNewConstMetric(cc.metaPipeBuffered, prometheus.GaugeValue, float64(status.MetaPipeBuffered))
+	ch <- prometheus.MustNewConstMetric(cc.lastLedger, prometheus.GaugeValue, float64(status.LastLedger))
+	ch <- prometheus.MustNewConstMetric(cc.lastLedgerAge, prometheus.GaugeValue, lastLedgerAge)
+	ch <- prometheus.MustNewConstMetric(cc.ledgersReceived, prometheus.CounterValue, float64(status.LedgersReceived))
+	ch <- prometheus.MustNewConstMetric(cc.metaBytesReceived, prometheus.CounterValue, float64(status.MetaBytesReceived))
+	ch <- prometheus.MustNewConstMetric(cc.processStarts, prometheus.CounterValue, float64(status.ProcessStarts))
+	ch <- prometheus.MustNewConstMetric(cc.processRestarts, prometheus.CounterValue, float64(status.ProcessRestarts))
+	ch <- prometheus.MustNewConstMetric(cc.unexpectedExits, prometheus.CounterValue, float64(status.UnexpectedExits))
+
+	for _, archive := range status.HistoryArchives {
+		healthy := 1.0
+		if !archive.UnhealthyUntil.IsZero() {
+			healthy = 0
+		}
+		ch <- prometheus.MustNewConstMetric(cc.archiveRequests, prometheus.CounterValue, float64(archive.Requests), archive.Archive)
+		ch <- prometheus.MustNewConstMetric(cc.archiveErrors, prometheus.CounterValue, float64(archive.Errors), archive.Archive)
+		ch <- prometheus.MustNewConstMetric(cc.archiveLatency, prometheus.GaugeValue, archive.AverageLatency.Seconds(), archive.Archive)
+		ch <- prometheus.MustNewConstMetric(cc.archiveHealthy, prometheus.GaugeValue, healthy, archive.Archive)
+	}
+}
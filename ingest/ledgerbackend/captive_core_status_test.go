@@ -0,0 +1,132 @@
+package ledgerbackend
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stellar/go/historyarchive"
+)
+
+func TestCaptiveStatus(t *testing.T) {
+	metaChan := make(chan metaResult, 100)
+	for i := 64; i <= 110; i++ {
+		meta := buildLedgerCloseMeta(testLedgerHeader{sequence: uint32(i)})
+		metaChan <- metaResult{
+			LedgerCloseMeta: &meta,
+			size:            100,
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mockRunner := &stellarCoreRunnerMock{}
+	mockRunner.On("catchup", uint32(100), uint32(200)).Return(nil).Once()
+	mockRunner.On("getMetaPipe").Return((<-chan metaResult)(metaChan))
+	mockRunner.On("context").Return(ctx)
+
+	mockArchive := &historyarchive.MockArchive{}
+	mockArchive.
+		On("GetRootHAS").
+		Return(historyarchive.HistoryArchiveState{
+			CurrentLedger: uint32(200),
+		}, nil)
+
+	captiveBackend := CaptiveStellarCore{
+		archive: mockArchive,
+		stellarCoreRunnerFactory: func(_ stellarCoreRunnerMode) (stellarCoreRunnerInterface, error) {
+			return mockRunner, nil
+		},
+		checkpointManager: historyarchive.NewCheckpointManager(64),
+	}
+
+	status := captiveBackend.Status(context.Background())
+	assert.Equal(t, CaptiveCoreModeStopped, status.Mode)
+	assert.Equal(t, uint64(0), status.ProcessStarts)
+
+	require.NoError(t, captiveBackend.PrepareRange(BoundedRange(100, 200)))
+
+	status = captiveBackend.Status(context.Background())
+	assert.Equal(t, CaptiveCoreModeOffline, status.Mode)
+	assert.Equal(t, uint32(64), status.From)
+	assert.Equal(t, uint32(200), status.Target)
+	assert.Equal(t, uint32(100), status.LastLedger)
+	assert.False(t, status.LastLedgerReceivedAt.IsZero())
+	assert.Equal(t, 10, status.MetaPipeBuffered)
+	assert.Equal(t, uint64(37), status.LedgersReceived)
+	assert.Equal(t, uint64(3700), status.MetaBytesReceived)
+	assert.Equal(t, uint64(1), status.ProcessStarts)
+	assert.Equal(t, uint64(0), status.UnexpectedExits)
+	assert.InDelta(t, 37.0/137.0, status.CatchupProgress, 0.0001)
+	assert.Empty(t, status.CoreState)
+
+	collector := NewCaptiveCoreCollector(&captiveBackend, "horizon", "ingest")
+	expected := `
+# HELP horizon_ingest_captive_core_ledgers_received_total Number of ledgers received from Stellar-Core.
+# TYPE horizon_ingest_captive_core_ledgers_received_total counter
+horizon_ingest_captive_core_ledgers_received_total 37
+# HELP horizon_ingest_captive_core_mode 1 for the current mode of Stellar-Core (stopped, offline, online), 0 for other modes.
+# TYPE horizon_ingest_captive_core_mode gauge
+horizon_ingest_captive_core_mode{mode="offline"} 1
+horizon_ingest_captive_core_mode{mode="online"} 0
+horizon_ingest_captive_core_mode{mode="stopped"} 0
+# HELP horizon_ingest_captive_core_last_ledger Sequence of the last ledger received from Stellar-Core.
+# TYPE horizon_ingest_captive_core_last_ledger gauge
+horizon_ingest_captive_core_last_ledger 100
+`
+	assert.NoError(t, testutil.CollectAndCompare(
+		collector,
+		strings.NewReader(expected),
+		"horizon_ingest_captive_core_ledgers_received_total",
+		"horizon_ingest_captive_core_mode",
+		"horizon_ingest_captive_core_last_ledger",
+	))
+
+	cancel()
+	status = captiveBackend.Status(context.Background())
+	assert.Equal(t, CaptiveCoreModeStopped, status.Mode)
+	assert.Equal(t, 0, status.MetaPipeBuffered)
+	assert.Equal(t, uint32(100), status.LastLedger)
+}
+
+func TestCaptiveStatusHistoryArchives(t *testing.T) {
+	pool, err := historyarchive.NewFailoverArchivePool(
+		[]string{"mock://empty"},
+		historyarchive.ConnectOptions{CheckpointFrequency: 64},
+		historyarchive.FailoverArchivePoolOptions{},
+	)
+	require.NoError(t, err)
+	captiveBackend := CaptiveStellarCore{
+		archive:           pool,
+		archivePool:       pool,
+		checkpointManager: historyarchive.NewCheckpointManager(64),
+	}
+
+	_, err = captiveBackend.getLatestCheckpointSequence()
+	assert.Error(t, err)
+
+	status := captiveBackend.Status(context.Background())
+	require.Len(t, status.HistoryArchives, 1)
+	assert.Equal(t, "mock://empty", status.HistoryArchives[0].Archive)
+	assert.Equal(t, int64(1), status.HistoryArchives[0].Requests)
+	assert.Equal(t, int64(1), status.HistoryArchives[0].Errors)
+
+	collector := NewCaptiveCoreCollector(&captiveBackend, "horizon", "ingest")
+	expected := `
+# HELP horizon_ingest_captive_core_history_archive_errors_total Number of requests to the history archive which failed.
+# TYPE horizon_ingest_captive_core_history_archive_errors_total counter
+horizon_ingest_captive_core_history_archive_errors_total{archive="mock://empty"} 1
+# HELP horizon_ingest_captive_core_history_archive_healthy 1 if the history archive is used, 0 if it's skipped after an error.
+# TYPE horizon_ingest_captive_core_history_archive_healthy gauge
+horizon_ingest_captive_core_history_archive_healthy{archive="mock://empty"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(
+		collector,
+		strings.NewReader(expected),
+		"horizon_ingest_captive_core_history_archive_errors_total",
+		"horizon_ingest_captive_core_history_archive_healthy",
+	))
+}
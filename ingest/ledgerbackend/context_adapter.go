@@ -0,0 +1,81 @@
+package ledgerbackend
+
+import (
+	"context"
+	"time"
+
+	"github.com/stellar/go/xdr"
+)
+
+// contextAdapterPollDelay is the delay between GetLedger calls when waiting
+// for a ledger in contextAdapter.GetLedgerBlockingContext.
+const contextAdapterPollDelay = time.Second
+
+// WithContext returns a ContextLedgerBackend for the given LedgerBackend. If
+// the backend implements ContextLedgerBackend (like CaptiveStellarCore,
+// DatabaseBackend and RemoteCaptiveStellarCore) it is returned as it is.
+// Otherwise it's wrapped in an adapter which:
+//   * checks the context before calling the backend,
+//   * waits for ledgers in GetLedgerBlockingContext by polling GetLedger so
+//     waiting can be interrupted by the context.
+// Calls to the wrapped backend itself cannot be interrupted.
+func WithContext(backend LedgerBackend) ContextLedgerBackend {
+	if contextBackend, ok := backend.(ContextLedgerBackend); ok {
+		return contextBackend
+	}
+	return contextAdapter{backend: backend}
+}
+
+type contextAdapter struct {
+	backend LedgerBackend
+}
+
+func (a contextAdapter) GetLatestLedgerSequenceContext(ctx context.Context) (uint32, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return a.backend.GetLatestLedgerSequence()
+}
+
+func (a contextAdapter) GetLedgerContext(ctx context.Context, sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return false, xdr.LedgerCloseMeta{}, err
+	}
+	return a.backend.GetLedger(sequence)
+}
+
+func (a contextAdapter) GetLedgerBlockingContext(ctx context.Context, sequence uint32) (xdr.LedgerCloseMeta, error) {
+	for {
+		exists, meta, err := a.GetLedgerContext(ctx, sequence)
+		if err != nil {
+			return xdr.LedgerCloseMeta{}, err
+		}
+		if exists {
+			return meta, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return xdr.LedgerCloseMeta{}, ctx.Err()
+		case <-time.After(contextAdapterPollDelay):
+		}
+	}
+}
+
+func (a contextAdapter) PrepareRangeContext(ctx context.Context, ledgerRange Range) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.backend.PrepareRange(ledgerRange)
+}
+
+func (a contextAdapter) IsPreparedContext(ctx context.Context, ledgerRange Range) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return a.backend.IsPrepared(ledgerRange)
+}
+
+func (a contextAdapter) Close() error {
+	return a.backend.Close()
+}
@@ -0,0 +1,39 @@
+package ledgerbackend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/stellar/go/xdr"
+)
+
+func TestWithContextReturnsContextLedgerBackend(t *testing.T) {
+	backend := &DatabaseBackend{}
+	assert.Equal(t, backend, WithContext(backend))
+}
+
+func TestContextAdapter(t *testing.T) {
+	mockBackend := &MockDatabaseBackend{}
+	backend := WithContext(mockBackend)
+
+	mockBackend.On("PrepareRange", UnboundedRange(10)).Return(nil).Once()
+	assert.NoError(t, backend.PrepareRangeContext(context.Background(), UnboundedRange(10)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mockBackend.On("GetLedger", uint32(10)).
+		Run(func(mock.Arguments) { cancel() }).
+		Return(false, xdr.LedgerCloseMeta{}, nil).Once()
+	_, err := backend.GetLedgerBlockingContext(ctx, 10)
+	assert.Equal(t, context.Canceled, err)
+
+	// Calls with done contexts don't reach the backend
+	_, err = backend.GetLatestLedgerSequenceContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+	_, err = backend.IsPreparedContext(ctx, UnboundedRange(10))
+	assert.Equal(t, context.Canceled, err)
+
+	mockBackend.AssertExpectations(t)
+}
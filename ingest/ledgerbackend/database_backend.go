@@ -1,6 +1,7 @@
 package ledgerbackend
 
 import (
+	"context"
 	"database/sql"
 	"sort"
 	"time"
@@ -21,8 +22,9 @@ const (
 	dbDriver             = "postgres"
 )
 
-// Ensure DatabaseBackend implements LedgerBackend
+// Ensure DatabaseBackend implements LedgerBackend and ContextLedgerBackend
 var _ LedgerBackend = (*DatabaseBackend)(nil)
+var _ ContextLedgerBackend = (*DatabaseBackend)(nil)
 
 // DatabaseBackend implements a database data store.
 type DatabaseBackend struct {
@@ -43,8 +45,25 @@ func NewDatabaseBackendFromSession(session *db.Session, networkPassphrase string
 	return &DatabaseBackend{session: session, networkPassphrase: networkPassphrase}, nil
 }
 
+// sessionWithContext returns a session running queries with the given
+// context.
+func (dbb *DatabaseBackend) sessionWithContext(ctx context.Context) session {
+	if dbSession, ok := dbb.session.(*db.Session); ok {
+		dbSession = dbSession.Clone()
+		dbSession.Ctx = ctx
+		return dbSession
+	}
+	return dbb.session
+}
+
 func (dbb *DatabaseBackend) PrepareRange(ledgerRange Range) error {
-	fromExists, _, err := dbb.GetLedger(ledgerRange.from)
+	return dbb.PrepareRangeContext(context.Background(), ledgerRange)
+}
+
+// PrepareRangeContext checks if the starting and ending (if bounded) ledgers
+// exist.
+func (dbb *DatabaseBackend) PrepareRangeContext(ctx context.Context, ledgerRange Range) error {
+	fromExists, _, err := dbb.GetLedgerContext(ctx, ledgerRange.from)
 	if err != nil {
 		return errors.Wrap(err, "error getting ledger")
 	}
@@ -54,7 +73,7 @@ func (dbb *DatabaseBackend) PrepareRange(ledgerRange Range) error {
 	}
 
 	if ledgerRange.bounded {
-		toExists, _, err := dbb.GetLedger(ledgerRange.to)
+		toExists, _, err := dbb.GetLedgerContext(ctx, ledgerRange.to)
 		if err != nil {
 			return errors.Wrap(err, "error getting ledger")
 		}
@@ -72,10 +91,24 @@ func (*DatabaseBackend) IsPrepared(ledgerRange Range) (bool, error) {
 	return true, nil
 }
 
+// IsPreparedContext returns true if a given ledgerRange is prepared.
+func (dbb *DatabaseBackend) IsPreparedContext(ctx context.Context, ledgerRange Range) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return dbb.IsPrepared(ledgerRange)
+}
+
 // GetLatestLedgerSequence returns the most recent ledger sequence number present in the database.
 func (dbb *DatabaseBackend) GetLatestLedgerSequence() (uint32, error) {
+	return dbb.GetLatestLedgerSequenceContext(context.Background())
+}
+
+// GetLatestLedgerSequenceContext works as GetLatestLedgerSequence running
+// the query with the given context.
+func (dbb *DatabaseBackend) GetLatestLedgerSequenceContext(ctx context.Context) (uint32, error) {
 	var ledger []ledgerHeader
-	err := dbb.session.SelectRaw(&ledger, latestLedgerSeqQuery)
+	err := dbb.sessionWithContext(ctx).SelectRaw(&ledger, latestLedgerSeqQuery)
 	if err != nil {
 		return 0, errors.Wrap(err, "couldn't select ledger sequence")
 	}
@@ -123,16 +156,26 @@ func sortByHash(transactions []xdr.TransactionEnvelope, passphrase string) error
 // Please note that requesting a ledger sequence far after current ledger will
 // block the execution for a long time.
 func (dbb *DatabaseBackend) GetLedgerBlocking(sequence uint32) (xdr.LedgerCloseMeta, error) {
+	return dbb.GetLedgerBlockingContext(context.Background(), sequence)
+}
+
+// GetLedgerBlockingContext works as GetLedgerBlocking but returns the context
+// error when the context is done before the ledger is available.
+func (dbb *DatabaseBackend) GetLedgerBlockingContext(ctx context.Context, sequence uint32) (xdr.LedgerCloseMeta, error) {
 	for {
-		exists, meta, err := dbb.GetLedger(sequence)
+		exists, meta, err := dbb.GetLedgerContext(ctx, sequence)
 		if err != nil {
 			return xdr.LedgerCloseMeta{}, err
 		}
 
 		if exists {
 			return meta, nil
-		} else {
-			time.Sleep(time.Second)
+		}
+
+		select {
+		case <-ctx.Done():
+			return xdr.LedgerCloseMeta{}, ctx.Err()
+		case <-time.After(time.Second):
 		}
 	}
 }
@@ -140,6 +183,17 @@ func (dbb *DatabaseBackend) GetLedgerBlocking(sequence uint32) (xdr.LedgerCloseM
 // GetLedger returns the LedgerCloseMeta for the given ledger sequence number.
 // The first returned value is false when the ledger does not exist in the database.
 func (dbb *DatabaseBackend) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
+	return dbb.GetLedgerContext(context.Background(), sequence)
+}
+
+// GetLedgerContext works as GetLedger running the queries with the given
+// context.
+func (dbb *DatabaseBackend) GetLedgerContext(ctx context.Context, sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return false, xdr.LedgerCloseMeta{}, err
+	}
+
+	querySession := dbb.sessionWithContext(ctx)
 	lcm := xdr.LedgerCloseMeta{
 		V0: &xdr.LedgerCloseMetaV0{},
 	}
@@ -147,7 +201,7 @@ func (dbb *DatabaseBackend) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMet
 	// Query - ledgerheader
 	var lRow ledgerHeaderHistory
 
-	err := dbb.session.GetRaw(&lRow, ledgerHeaderQuery, sequence)
+	err := querySession.GetRaw(&lRow, ledgerHeaderQuery, sequence)
 	// Return errors...
 	if err != nil {
 		switch err {
@@ -168,7 +222,7 @@ func (dbb *DatabaseBackend) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMet
 
 	// Query - txhistory
 	var txhRows []txHistory
-	err = dbb.session.SelectRaw(&txhRows, txHistoryQuery+orderBy, sequence)
+	err = querySession.SelectRaw(&txhRows, txHistoryQuery+orderBy, sequence)
 	// Return errors...
 	if err != nil {
 		return false, lcm, errors.Wrap(err, "Error getting txHistory")
@@ -194,7 +248,7 @@ func (dbb *DatabaseBackend) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMet
 
 	// Query - txfeehistory
 	var txfhRows []txFeeHistory
-	err = dbb.session.SelectRaw(&txfhRows, txFeeHistoryQuery+orderBy, sequence)
+	err = querySession.SelectRaw(&txfhRows, txFeeHistoryQuery+orderBy, sequence)
 	// Return errors...
 	if err != nil {
 		return false, lcm, errors.Wrap(err, "Error getting txFeeHistory")
@@ -211,7 +265,7 @@ func (dbb *DatabaseBackend) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMet
 
 	// Query - upgradehistory
 	var upgradeHistoryRows []upgradeHistory
-	err = dbb.session.SelectRaw(&upgradeHistoryRows, upgradeHistoryQuery, sequence)
+	err = querySession.SelectRaw(&upgradeHistoryRows, upgradeHistoryQuery, sequence)
 	// Return errors...
 	if err != nil {
 		return false, lcm, errors.Wrap(err, "Error getting upgradeHistoryRows")
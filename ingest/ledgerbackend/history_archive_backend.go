@@ -0,0 +1,201 @@
+package ledgerbackend
+
+import (
+	"sync"
+	"time"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// Ensure HistoryArchiveBackend implements LedgerBackend
+var _ LedgerBackend = (*HistoryArchiveBackend)(nil)
+
+const historyArchivePollDelay = 10 * time.Second
+
+// HistoryArchiveBackend is a LedgerBackend which builds ledgers from the
+// headers, transaction sets and transaction results published in history
+// archives, without running Stellar-Core.
+//
+// History archives do not contain transaction meta so LedgerCloseMeta
+// returned by this backend only contains the ledger header, transactions and
+// their results. Fee changes, transaction meta, upgrades and SCP info are
+// empty. As a consequence, when reading transactions with
+// ingest.LedgerTransactionReader:
+//
+//   * Envelopes, results, Operations() and fees are available.
+//   * GetChanges(), GetOperationChanges() and Effects() return
+//     ingest.ErrMetaUnavailable.
+//   * Participants() only returns accounts found in envelopes (accounts
+//     found only in meta, ex. sponsors, are missing).
+//   * ingest.LedgerChangeReader cannot be used.
+//
+// Ledgers are available only after the checkpoint containing them has been
+// published. Ledgers of an entire checkpoint are fetched at once and kept in
+// memory until a ledger from another checkpoint is requested.
+type HistoryArchiveBackend struct {
+	archive historyarchive.ArchiveInterface
+
+	mutex            sync.Mutex
+	closed           bool
+	latestLedger     uint32
+	cachedCheckpoint uint32
+	cachedLedgers    map[uint32]*historyarchive.Ledger
+}
+
+// NewHistoryArchiveBackend creates a HistoryArchiveBackend reading from the
+// given history archive.
+func NewHistoryArchiveBackend(archive historyarchive.ArchiveInterface) *HistoryArchiveBackend {
+	return &HistoryArchiveBackend{archive: archive}
+}
+
+// GetLatestLedgerSequence returns the sequence of the latest ledger published
+// in the archive.
+func (hab *HistoryArchiveBackend) GetLatestLedgerSequence() (uint32, error) {
+	hab.mutex.Lock()
+	defer hab.mutex.Unlock()
+	return hab.updateLatestLedger()
+}
+
+func (hab *HistoryArchiveBackend) updateLatestLedger() (uint32, error) {
+	has, err := hab.archive.GetRootHAS()
+	if err != nil {
+		return 0, errors.Wrap(err, "error getting root HAS")
+	}
+	hab.latestLedger = has.CurrentLedger
+	return hab.latestLedger, nil
+}
+
+// GetLedger returns the LedgerCloseMeta (without transaction meta, see
+// HistoryArchiveBackend) for the given ledger sequence number. The first
+// returned value is false when the checkpoint containing the ledger has not
+// been published yet.
+func (hab *HistoryArchiveBackend) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
+	hab.mutex.Lock()
+	defer hab.mutex.Unlock()
+
+	if hab.closed {
+		return false, xdr.LedgerCloseMeta{}, errors.New("session is closed, call PrepareRange first")
+	}
+
+	if sequence > hab.latestLedger {
+		latest, err := hab.updateLatestLedger()
+		if err != nil {
+			return false, xdr.LedgerCloseMeta{}, err
+		}
+		if sequence > latest {
+			return false, xdr.LedgerCloseMeta{}, nil
+		}
+	}
+
+	checkpoint := hab.archive.GetCheckpointManager().GetCheckpoint(sequence)
+	if hab.cachedLedgers == nil || hab.cachedCheckpoint != checkpoint {
+		ledgers, err := hab.archive.GetLedgers(sequence, sequence)
+		if err != nil {
+			return false, xdr.LedgerCloseMeta{}, errors.Wrapf(err, "error getting checkpoint %d", checkpoint)
+		}
+		hab.cachedCheckpoint = checkpoint
+		hab.cachedLedgers = ledgers
+	}
+
+	ledger, ok := hab.cachedLedgers[sequence]
+	if !ok {
+		return false, xdr.LedgerCloseMeta{}, errors.Errorf("ledger %d not found in checkpoint %d", sequence, checkpoint)
+	}
+	meta, err := ledgerCloseMetaFromArchive(sequence, ledger)
+	if err != nil {
+		return false, xdr.LedgerCloseMeta{}, err
+	}
+	return true, meta, nil
+}
+
+func ledgerCloseMetaFromArchive(sequence uint32, ledger *historyarchive.Ledger) (xdr.LedgerCloseMeta, error) {
+	if seq := uint32(ledger.Header.Header.LedgerSeq); seq != sequence {
+		return xdr.LedgerCloseMeta{}, errors.Errorf(
+			"unexpected ledger header sequence (expected=%d actual=%d)", sequence, seq,
+		)
+	}
+
+	results := ledger.TransactionResult.TxResultSet.Results
+	if len(results) != len(ledger.Transaction.TxSet.Txs) {
+		return xdr.LedgerCloseMeta{}, errors.Errorf(
+			"number of transactions (%d) and results (%d) in ledger %d do not match",
+			len(ledger.Transaction.TxSet.Txs),
+			len(results),
+			sequence,
+		)
+	}
+
+	meta := xdr.LedgerCloseMeta{
+		V0: &xdr.LedgerCloseMetaV0{
+			LedgerHeader: ledger.Header,
+			TxSet:        ledger.Transaction.TxSet,
+		},
+	}
+	// Results are stored in the apply order, the same order as TxProcessing.
+	// TxApplyProcessing is left empty (V=0 without operations) which is how
+	// ingest.LedgerTransaction detects missing meta.
+	for _, result := range results {
+		meta.V0.TxProcessing = append(meta.V0.TxProcessing, xdr.TransactionResultMeta{
+			Result: result,
+		})
+	}
+	return meta, nil
+}
+
+// GetLedgerBlocking works as GetLedger but will block until the checkpoint
+// containing the ledger is published.
+func (hab *HistoryArchiveBackend) GetLedgerBlocking(sequence uint32) (xdr.LedgerCloseMeta, error) {
+	for {
+		exists, meta, err := hab.GetLedger(sequence)
+		if err != nil {
+			return xdr.LedgerCloseMeta{}, err
+		}
+
+		if exists {
+			return meta, nil
+		}
+		time.Sleep(historyArchivePollDelay)
+	}
+}
+
+// PrepareRange checks if the ending ledger of bounded ranges has been
+// published. For unbounded ranges it blocks until the first ledger is
+// available.
+func (hab *HistoryArchiveBackend) PrepareRange(ledgerRange Range) error {
+	hab.mutex.Lock()
+	hab.closed = false
+	hab.mutex.Unlock()
+
+	if ledgerRange.bounded {
+		latest, err := hab.GetLatestLedgerSequence()
+		if err != nil {
+			return err
+		}
+		if ledgerRange.to > latest {
+			return errors.Errorf("`to` ledger has not been published yet (latest=%d)", latest)
+		}
+		return nil
+	}
+
+	_, err := hab.GetLedgerBlocking(ledgerRange.from)
+	return err
+}
+
+// IsPrepared returns true if the backend is not closed. Ledgers are read
+// directly from the archive so there is no other state to prepare.
+func (hab *HistoryArchiveBackend) IsPrepared(ledgerRange Range) (bool, error) {
+	hab.mutex.Lock()
+	defer hab.mutex.Unlock()
+	return !hab.closed, nil
+}
+
+// Close marks the backend as closed and drops cached ledgers.
+func (hab *HistoryArchiveBackend) Close() error {
+	hab.mutex.Lock()
+	defer hab.mutex.Unlock()
+	hab.closed = true
+	hab.cachedLedgers = nil
+	return nil
+}
@@ -0,0 +1,101 @@
+package ledgerbackend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/xdr"
+)
+
+func archiveLedger(sequence uint32, txs int) *historyarchive.Ledger {
+	ledger := &historyarchive.Ledger{
+		Header: xdr.LedgerHeaderHistoryEntry{
+			Header: xdr.LedgerHeader{LedgerSeq: xdr.Uint32(sequence)},
+		},
+	}
+	for i := 0; i < txs; i++ {
+		ledger.Transaction.TxSet.Txs = append(ledger.Transaction.TxSet.Txs, xdr.TransactionEnvelope{
+			Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+			V1: &xdr.TransactionV1Envelope{
+				Tx: xdr.Transaction{Fee: xdr.Uint32(100 + i)},
+			},
+		})
+		ledger.TransactionResult.TxResultSet.Results = append(ledger.TransactionResult.TxResultSet.Results, xdr.TransactionResultPair{
+			TransactionHash: xdr.Hash{byte(i)},
+			Result:          xdr.TransactionResult{FeeCharged: xdr.Int64(100 + i)},
+		})
+	}
+	return ledger
+}
+
+func TestHistoryArchiveBackend(t *testing.T) {
+	archive := &historyarchive.MockArchive{}
+	archive.On("GetCheckpointManager").Return(historyarchive.NewCheckpointManager(64))
+	archive.On("GetRootHAS").Return(historyarchive.HistoryArchiveState{CurrentLedger: 127}, nil).Once()
+	archive.On("GetLedgers", uint32(64), uint32(64)).Return(map[uint32]*historyarchive.Ledger{
+		64: archiveLedger(64, 2),
+		65: archiveLedger(65, 0),
+	}, nil).Once()
+
+	backend := NewHistoryArchiveBackend(archive)
+	require.NoError(t, backend.PrepareRange(BoundedRange(64, 127)))
+
+	exists, meta, err := backend.GetLedger(64)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, uint32(64), meta.LedgerSequence())
+	assert.Len(t, meta.V0.TxSet.Txs, 2)
+	require.Len(t, meta.V0.TxProcessing, 2)
+	for i, processing := range meta.V0.TxProcessing {
+		assert.Equal(t, xdr.Int64(100+i), processing.Result.Result.FeeCharged)
+		assert.Empty(t, processing.FeeProcessing)
+		assert.Equal(t, xdr.TransactionMeta{}, processing.TxApplyProcessing)
+	}
+
+	// Ledgers from the same checkpoint are cached
+	exists, meta, err = backend.GetLedger(65)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Empty(t, meta.V0.TxProcessing)
+
+	// Checkpoint not published yet
+	archive.On("GetRootHAS").Return(historyarchive.HistoryArchiveState{CurrentLedger: 127}, nil).Once()
+	exists, _, err = backend.GetLedger(128)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, backend.Close())
+	_, _, err = backend.GetLedger(64)
+	assert.EqualError(t, err, "session is closed, call PrepareRange first")
+	archive.AssertExpectations(t)
+}
+
+func TestHistoryArchiveBackendPrepareRange(t *testing.T) {
+	archive := &historyarchive.MockArchive{}
+	archive.On("GetRootHAS").Return(historyarchive.HistoryArchiveState{CurrentLedger: 127}, nil).Once()
+
+	backend := NewHistoryArchiveBackend(archive)
+	err := backend.PrepareRange(BoundedRange(64, 191))
+	assert.EqualError(t, err, "`to` ledger has not been published yet (latest=127)")
+	archive.AssertExpectations(t)
+}
+
+func TestHistoryArchiveBackendResultsMismatch(t *testing.T) {
+	ledger := archiveLedger(70, 2)
+	ledger.TransactionResult.TxResultSet.Results = ledger.TransactionResult.TxResultSet.Results[:1]
+
+	archive := &historyarchive.MockArchive{}
+	archive.On("GetCheckpointManager").Return(historyarchive.NewCheckpointManager(64))
+	archive.On("GetRootHAS").Return(historyarchive.HistoryArchiveState{CurrentLedger: 127}, nil).Once()
+	archive.On("GetLedgers", uint32(70), uint32(70)).Return(map[uint32]*historyarchive.Ledger{
+		70: ledger,
+	}, nil).Once()
+
+	backend := NewHistoryArchiveBackend(archive)
+	_, _, err := backend.GetLedger(70)
+	assert.EqualError(t, err, "number of transactions (2) and results (1) in ledger 70 do not match")
+	archive.AssertExpectations(t)
+}
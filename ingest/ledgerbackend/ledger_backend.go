@@ -1,6 +1,8 @@
 package ledgerbackend
 
 import (
+	"context"
+
 	"github.com/stellar/go/xdr"
 )
 
@@ -22,6 +24,29 @@ type LedgerBackend interface {
 	Close() error
 }
 
+// ContextLedgerBackend is a version of LedgerBackend which methods accept a
+// context. When the context is cancelled or its deadline is exceeded pending
+// calls return the context error. Unlike Close, cancelling a context does not
+// shut down the backend so it can still be used with another context.
+// Use WithContext to get a ContextLedgerBackend from any LedgerBackend.
+type ContextLedgerBackend interface {
+	// GetLatestLedgerSequenceContext returns the sequence of the latest ledger
+	// available in the backend.
+	GetLatestLedgerSequenceContext(ctx context.Context) (sequence uint32, err error)
+	// The first returned value is false when the ledger does not exist in a backend.
+	GetLedgerContext(ctx context.Context, sequence uint32) (bool, xdr.LedgerCloseMeta, error)
+	// Works like GetLedgerContext but will block until the ledger is available
+	// or the context is done.
+	GetLedgerBlockingContext(ctx context.Context, sequence uint32) (xdr.LedgerCloseMeta, error)
+	// PrepareRangeContext prepares the given range (including from and to) to
+	// be loaded. Blocks until the first ledger is available or the context is
+	// done.
+	PrepareRangeContext(ctx context.Context, ledgerRange Range) error
+	// IsPreparedContext returns true if a given ledgerRange is prepared.
+	IsPreparedContext(ctx context.Context, ledgerRange Range) (bool, error)
+	Close() error
+}
+
 // session is the interface needed to access a persistent database session.
 // TODO can't use this until we add Close() to the existing db.Session object
 type session interface {
@@ -0,0 +1,252 @@
+package ledgerbackend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// Ensure MetaArchiveBackend implements LedgerBackend
+var _ LedgerBackend = (*MetaArchiveBackend)(nil)
+
+const (
+	metaArchiveCategory   = "ledger-meta"
+	metaArchiveLatestPath = metaArchiveCategory + "/latest.json"
+	metaArchivePollDelay  = time.Second
+)
+
+// metaArchiveLatest is the content of the file pointing to the latest ledger
+// stored in a meta archive.
+type metaArchiveLatest struct {
+	Sequence uint32 `json:"sequence"`
+}
+
+// MetaArchivePath returns the path of the file containing the LedgerCloseMeta
+// of the given ledger. Files are grouped in directories the same way as
+// checkpoint files in history archives, ex:
+// ledger-meta/00/12/34/ledger-meta-00123456.xdr.gz
+func MetaArchivePath(sequence uint32) string {
+	return path.Join(
+		metaArchiveCategory,
+		historyarchive.CheckpointPrefix(sequence).Path(),
+		fmt.Sprintf("%s-%08x.xdr.gz", metaArchiveCategory, sequence),
+	)
+}
+
+// MetaArchiveBackend is a LedgerBackend which reads LedgerCloseMeta files
+// exported to a directory or an S3 bucket (see PutLedger). Every ledger is
+// stored in a separate gzipped file containing a single framed
+// LedgerCloseMeta XDR.
+type MetaArchiveBackend struct {
+	archive historyarchive.ArchiveBackend
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+// NewMetaArchiveBackend connects to the meta archive at the given URL. All
+// URL schemes supported by history archives (file, s3, http(s)) can be used.
+func NewMetaArchiveBackend(url string, opts historyarchive.ConnectOptions) (*MetaArchiveBackend, error) {
+	archive, err := historyarchive.ConnectBackend(url, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error connecting to meta archive")
+	}
+	return NewMetaArchiveBackendFromArchive(archive), nil
+}
+
+// NewMetaArchiveBackendFromArchive creates a MetaArchiveBackend reading from
+// the given ArchiveBackend.
+func NewMetaArchiveBackendFromArchive(archive historyarchive.ArchiveBackend) *MetaArchiveBackend {
+	return &MetaArchiveBackend{archive: archive}
+}
+
+// GetLatestLedgerSequence returns the sequence of the latest ledger stored in
+// the archive.
+func (mab *MetaArchiveBackend) GetLatestLedgerSequence() (uint32, error) {
+	exists, sequence, err := mab.latestLedger()
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, errors.New("no ledgers exist in meta archive")
+	}
+	return sequence, nil
+}
+
+func (mab *MetaArchiveBackend) latestLedger() (bool, uint32, error) {
+	exists, err := mab.archive.Exists(metaArchiveLatestPath)
+	if err != nil {
+		return false, 0, errors.Wrap(err, "error checking latest ledger file")
+	}
+	if !exists {
+		return false, 0, nil
+	}
+
+	reader, err := mab.archive.GetFile(metaArchiveLatestPath)
+	if err != nil {
+		return false, 0, errors.Wrap(err, "error opening latest ledger file")
+	}
+	defer reader.Close()
+
+	var latest metaArchiveLatest
+	if err = json.NewDecoder(reader).Decode(&latest); err != nil {
+		return false, 0, errors.Wrap(err, "error decoding latest ledger file")
+	}
+	return true, latest.Sequence, nil
+}
+
+// GetLedger returns the LedgerCloseMeta for the given ledger sequence number.
+// The first returned value is false when the ledger does not exist in the
+// archive.
+func (mab *MetaArchiveBackend) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
+	if mab.isClosed() {
+		return false, xdr.LedgerCloseMeta{}, errors.New("session is closed, call PrepareRange first")
+	}
+
+	filePath := MetaArchivePath(sequence)
+	exists, err := mab.archive.Exists(filePath)
+	if err != nil {
+		return false, xdr.LedgerCloseMeta{}, errors.Wrapf(err, "error checking if %s exists", filePath)
+	}
+	if !exists {
+		return false, xdr.LedgerCloseMeta{}, nil
+	}
+
+	reader, err := mab.archive.GetFile(filePath)
+	if err != nil {
+		return false, xdr.LedgerCloseMeta{}, errors.Wrapf(err, "error opening %s", filePath)
+	}
+	stream, err := historyarchive.NewXdrGzStream(reader)
+	if err != nil {
+		reader.Close()
+		return false, xdr.LedgerCloseMeta{}, errors.Wrapf(err, "error reading %s", filePath)
+	}
+	defer stream.Close()
+
+	var meta xdr.LedgerCloseMeta
+	if err = stream.ReadOne(&meta); err != nil {
+		return false, xdr.LedgerCloseMeta{}, errors.Wrapf(err, "error decoding %s", filePath)
+	}
+
+	if seq := meta.LedgerSequence(); seq != sequence {
+		return false, xdr.LedgerCloseMeta{}, errors.Errorf(
+			"unexpected ledger sequence in %s (expected=%d actual=%d)", filePath, sequence, seq,
+		)
+	}
+
+	return true, meta, nil
+}
+
+// GetLedgerBlocking works as GetLedger but will block until the ledger is
+// available in the archive. It returns an error when the backend is closed
+// while waiting.
+func (mab *MetaArchiveBackend) GetLedgerBlocking(sequence uint32) (xdr.LedgerCloseMeta, error) {
+	for {
+		exists, meta, err := mab.GetLedger(sequence)
+		if err != nil {
+			return xdr.LedgerCloseMeta{}, err
+		}
+
+		if exists {
+			return meta, nil
+		}
+		time.Sleep(metaArchivePollDelay)
+	}
+}
+
+// PrepareRange checks if the starting and ending (if bounded) ledgers exist.
+// For unbounded ranges it blocks until the first ledger is available.
+func (mab *MetaArchiveBackend) PrepareRange(ledgerRange Range) error {
+	mab.mutex.Lock()
+	mab.closed = false
+	mab.mutex.Unlock()
+
+	if ledgerRange.bounded {
+		exists, err := mab.archive.Exists(MetaArchivePath(ledgerRange.to))
+		if err != nil {
+			return errors.Wrap(err, "error checking if `to` ledger exists")
+		}
+		if !exists {
+			return errors.New("`to` ledger does not exist")
+		}
+
+		exists, err = mab.archive.Exists(MetaArchivePath(ledgerRange.from))
+		if err != nil {
+			return errors.Wrap(err, "error checking if `from` ledger exists")
+		}
+		if !exists {
+			return errors.New("`from` ledger does not exist")
+		}
+		return nil
+	}
+
+	_, err := mab.GetLedgerBlocking(ledgerRange.from)
+	return err
+}
+
+// IsPrepared returns true if the backend is not closed. Ledgers are read
+// directly from the archive so there is no other state to prepare.
+func (mab *MetaArchiveBackend) IsPrepared(ledgerRange Range) (bool, error) {
+	return !mab.isClosed(), nil
+}
+
+// Close makes GetLedger and GetLedgerBlocking return an error until
+// PrepareRange is called again.
+func (mab *MetaArchiveBackend) Close() error {
+	mab.mutex.Lock()
+	defer mab.mutex.Unlock()
+	mab.closed = true
+	return nil
+}
+
+func (mab *MetaArchiveBackend) isClosed() bool {
+	mab.mutex.Lock()
+	defer mab.mutex.Unlock()
+	return mab.closed
+}
+
+// PutLedger writes the given LedgerCloseMeta to the archive and advances the
+// latest ledger pointer if the ledger is newer than the current one.
+func (mab *MetaArchiveBackend) PutLedger(meta xdr.LedgerCloseMeta) error {
+	sequence := meta.LedgerSequence()
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	if err := xdr.MarshalFramed(gzipWriter, meta); err != nil {
+		return errors.Wrap(err, "error marshaling ledger close meta")
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return errors.Wrap(err, "error compressing ledger close meta")
+	}
+
+	filePath := MetaArchivePath(sequence)
+	if err := mab.archive.PutFile(filePath, ioutil.NopCloser(&buf)); err != nil {
+		return errors.Wrapf(err, "error writing %s", filePath)
+	}
+
+	exists, latest, err := mab.latestLedger()
+	if err != nil {
+		return err
+	}
+	if exists && latest >= sequence {
+		return nil
+	}
+
+	content, err := json.Marshal(metaArchiveLatest{Sequence: sequence})
+	if err != nil {
+		return errors.Wrap(err, "error marshaling latest ledger file")
+	}
+	if err = mab.archive.PutFile(metaArchiveLatestPath, ioutil.NopCloser(bytes.NewReader(content))); err != nil {
+		return errors.Wrap(err, "error writing latest ledger file")
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package ledgerbackend
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/xdr"
+)
+
+func metaArchiveLedger(sequence uint32) xdr.LedgerCloseMeta {
+	return xdr.LedgerCloseMeta{
+		V0: &xdr.LedgerCloseMetaV0{
+			LedgerHeader: xdr.LedgerHeaderHistoryEntry{
+				Header: xdr.LedgerHeader{
+					LedgerSeq: xdr.Uint32(sequence),
+				},
+			},
+		},
+	}
+}
+
+func TestMetaArchivePath(t *testing.T) {
+	assert.Equal(t, "ledger-meta/00/12/34/ledger-meta-00123456.xdr.gz", MetaArchivePath(0x123456))
+}
+
+func TestMetaArchiveBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger-meta")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	backend, err := NewMetaArchiveBackend("file://"+dir, historyarchive.ConnectOptions{})
+	require.NoError(t, err)
+
+	_, err = backend.GetLatestLedgerSequence()
+	assert.EqualError(t, err, "no ledgers exist in meta archive")
+
+	for _, sequence := range []uint32{3, 4, 2} {
+		require.NoError(t, backend.PutLedger(metaArchiveLedger(sequence)))
+	}
+
+	latest, err := backend.GetLatestLedgerSequence()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(4), latest)
+
+	assert.EqualError(t, backend.PrepareRange(BoundedRange(1, 4)), "`from` ledger does not exist")
+	assert.EqualError(t, backend.PrepareRange(BoundedRange(2, 5)), "`to` ledger does not exist")
+	assert.NoError(t, backend.PrepareRange(BoundedRange(2, 4)))
+	assert.NoError(t, backend.PrepareRange(UnboundedRange(3)))
+
+	exists, meta, err := backend.GetLedger(3)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, metaArchiveLedger(3), meta)
+
+	exists, _, err = backend.GetLedger(5)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.NoError(t, backend.Close())
+	prepared, err := backend.IsPrepared(UnboundedRange(3))
+	assert.NoError(t, err)
+	assert.False(t, prepared)
+	_, err = backend.GetLedgerBlocking(3)
+	assert.EqualError(t, err, "session is closed, call PrepareRange first")
+}
@@ -39,6 +39,21 @@ func (r Range) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// From returns the first ledger of the range.
+func (r Range) From() uint32 {
+	return r.from
+}
+
+// To returns the last ledger of the range. It's 0 for unbounded ranges.
+func (r Range) To() uint32 {
+	return r.to
+}
+
+// Bounded returns true if the range has a fixed ending ledger.
+func (r Range) Bounded() bool {
+	return r.bounded
+}
+
 func (r Range) String() string {
 	if r.bounded {
 		return fmt.Sprintf("[%d,%d]", r.from, r.to)
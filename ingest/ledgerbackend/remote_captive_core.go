@@ -16,6 +16,10 @@ import (
 	"github.com/stellar/go/xdr"
 )
 
+// Ensure RemoteCaptiveStellarCore implements LedgerBackend and ContextLedgerBackend
+var _ LedgerBackend = RemoteCaptiveStellarCore{}
+var _ ContextLedgerBackend = RemoteCaptiveStellarCore{}
+
 // PrepareRangeResponse describes the status of the pending PrepareRange operation.
 type PrepareRangeResponse struct {
 	LedgerRange   Range     `json:"ledgerRange"`
@@ -128,10 +132,21 @@ func decodeResponse(response *http.Response, payload interface{}) error {
 // the latest sequence closed by the network. It's always the last value available
 // in the backend.
 func (c RemoteCaptiveStellarCore) GetLatestLedgerSequence() (sequence uint32, err error) {
+	return c.GetLatestLedgerSequenceContext(context.Background())
+}
+
+// GetLatestLedgerSequenceContext works as GetLatestLedgerSequence sending
+// the request with the given context.
+func (c RemoteCaptiveStellarCore) GetLatestLedgerSequenceContext(ctx context.Context) (sequence uint32, err error) {
 	u := *c.url
 	u.Path = path.Join(u.Path, "latest-sequence")
 
-	response, err := c.client.Get(u.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot construct http request")
+	}
+
+	response, err := c.client.Do(req)
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to execute request")
 	}
@@ -154,7 +169,7 @@ func (c RemoteCaptiveStellarCore) Close() error {
 	return nil
 }
 
-func (c RemoteCaptiveStellarCore) createContext() context.Context {
+func (c RemoteCaptiveStellarCore) createContext(parent context.Context) context.Context {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
@@ -162,7 +177,7 @@ func (c RemoteCaptiveStellarCore) createContext() context.Context {
 		c.cancel()
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(parent)
 	c.cancel = cancel
 	return ctx
 }
@@ -177,7 +192,13 @@ func (c RemoteCaptiveStellarCore) createContext() context.Context {
 // Please note that using a BoundedRange, currently, requires a full-trust on
 // history archive. This issue is being fixed in Stellar-Core.
 func (c RemoteCaptiveStellarCore) PrepareRange(ledgerRange Range) error {
-	ctx := c.createContext()
+	return c.PrepareRangeContext(context.Background(), ledgerRange)
+}
+
+// PrepareRangeContext works as PrepareRange but polling the server stops when
+// the context is done.
+func (c RemoteCaptiveStellarCore) PrepareRangeContext(parent context.Context, ledgerRange Range) error {
+	ctx := c.createContext(parent)
 	u := *c.url
 	u.Path = path.Join(u.Path, "prepare-range")
 	rangeBytes, err := json.Marshal(ledgerRange)
@@ -220,6 +241,12 @@ func (c RemoteCaptiveStellarCore) PrepareRange(ledgerRange Range) error {
 
 // IsPrepared returns true if a given ledgerRange is prepared.
 func (c RemoteCaptiveStellarCore) IsPrepared(ledgerRange Range) (bool, error) {
+	return c.IsPreparedContext(context.Background(), ledgerRange)
+}
+
+// IsPreparedContext works as IsPrepared sending the request with the given
+// context.
+func (c RemoteCaptiveStellarCore) IsPreparedContext(ctx context.Context, ledgerRange Range) (bool, error) {
 	u := *c.url
 	u.Path = path.Join(u.Path, "prepare-range")
 	rangeBytes, err := json.Marshal(ledgerRange)
@@ -228,8 +255,14 @@ func (c RemoteCaptiveStellarCore) IsPrepared(ledgerRange Range) (bool, error) {
 	}
 	body := bytes.NewReader(rangeBytes)
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot construct http request")
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
 	var response *http.Response
-	response, err = c.client.Post(u.String(), "application/json; charset=utf-8", body)
+	response, err = c.client.Do(req)
 	if err != nil {
 		return false, errors.Wrap(err, "failed to execute request")
 	}
@@ -260,10 +293,21 @@ func (c RemoteCaptiveStellarCore) IsPrepared(ledgerRange Range) (bool, error) {
 //     the first argument equal false.
 // This is done to provide maximum performance when streaming old ledgers.
 func (c RemoteCaptiveStellarCore) GetLedger(sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
+	return c.GetLedgerContext(context.Background(), sequence)
+}
+
+// GetLedgerContext works as GetLedger sending the request with the given
+// context.
+func (c RemoteCaptiveStellarCore) GetLedgerContext(ctx context.Context, sequence uint32) (bool, xdr.LedgerCloseMeta, error) {
 	u := *c.url
 	u.Path = path.Join(u.Path, "ledger", strconv.FormatUint(uint64(sequence), 10))
 
-	response, err := c.client.Get(u.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false, xdr.LedgerCloseMeta{}, errors.Wrap(err, "cannot construct http request")
+	}
+
+	response, err := c.client.Do(req)
 	if err != nil {
 		return false, xdr.LedgerCloseMeta{}, errors.Wrap(err, "failed to execute request")
 	}
@@ -277,16 +321,26 @@ func (c RemoteCaptiveStellarCore) GetLedger(sequence uint32) (bool, xdr.LedgerCl
 }
 
 func (c RemoteCaptiveStellarCore) GetLedgerBlocking(sequence uint32) (xdr.LedgerCloseMeta, error) {
+	return c.GetLedgerBlockingContext(context.Background(), sequence)
+}
+
+// GetLedgerBlockingContext works as GetLedgerBlocking but returns the context
+// error when the context is done before the ledger is available.
+func (c RemoteCaptiveStellarCore) GetLedgerBlockingContext(ctx context.Context, sequence uint32) (xdr.LedgerCloseMeta, error) {
 	for {
-		exists, meta, err := c.GetLedger(sequence)
+		exists, meta, err := c.GetLedgerContext(ctx, sequence)
 		if err != nil {
 			return xdr.LedgerCloseMeta{}, err
 		}
 
 		if exists {
 			return meta, nil
-		} else {
-			time.Sleep(time.Second)
+		}
+
+		select {
+		case <-ctx.Done():
+			return xdr.LedgerCloseMeta{}, ctx.Err()
+		case <-time.After(time.Second):
 		}
 	}
 }
@@ -0,0 +1,226 @@
+package ingest
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// Participants returns the accounts taking part in the transaction: the
+// source accounts, the fee bump account, the accounts changed by the
+// transaction and the participants of all its operations. If the transaction
+// has no meta (see HasMeta) only the accounts found in the envelope are
+// returned.
+func (t *LedgerTransaction) Participants() ([]xdr.AccountId, error) {
+	participants := []xdr.AccountId{
+		t.Envelope.SourceAccount().ToAccountId(),
+	}
+	if t.Envelope.IsFeeBump() {
+		participants = append(participants, t.Envelope.FeeBumpAccount().ToAccountId())
+	}
+
+	p, err := participantsForMeta(t.Meta)
+	if err != nil {
+		return nil, err
+	}
+	participants = append(participants, p...)
+
+	p, err = participantsForChanges(t.FeeChanges)
+	if err != nil {
+		return nil, err
+	}
+	participants = append(participants, p...)
+
+	for _, operation := range t.Operations() {
+		p, err := operation.Participants()
+		if err != nil {
+			return nil, errors.Wrapf(
+				err, "could not determine operation %d participants", operation.Index,
+			)
+		}
+		participants = append(participants, p...)
+	}
+
+	return dedupeParticipants(participants), nil
+}
+
+// Participants returns the accounts taking part in the operation. The sponsor
+// of the operation is only included if the transaction has meta.
+func (operation *LedgerOperation) Participants() ([]xdr.AccountId, error) {
+	participants := []xdr.AccountId{}
+	participants = append(participants, *operation.SourceAccount())
+	op := operation.Operation
+
+	switch operation.OperationType() {
+	case xdr.OperationTypeCreateAccount:
+		participants = append(participants, op.Body.MustCreateAccountOp().Destination)
+	case xdr.OperationTypePayment:
+		participants = append(participants, op.Body.MustPaymentOp().Destination.ToAccountId())
+	case xdr.OperationTypePathPaymentStrictReceive:
+		participants = append(participants, op.Body.MustPathPaymentStrictReceiveOp().Destination.ToAccountId())
+	case xdr.OperationTypePathPaymentStrictSend:
+		participants = append(participants, op.Body.MustPathPaymentStrictSendOp().Destination.ToAccountId())
+	case xdr.OperationTypeManageBuyOffer:
+		// the only direct participant is the source_account
+	case xdr.OperationTypeManageSellOffer:
+		// the only direct participant is the source_account
+	case xdr.OperationTypeCreatePassiveSellOffer:
+		// the only direct participant is the source_account
+	case xdr.OperationTypeSetOptions:
+		// the only direct participant is the source_account
+	case xdr.OperationTypeChangeTrust:
+		// the only direct participant is the source_account
+	case xdr.OperationTypeAllowTrust:
+		participants = append(participants, op.Body.MustAllowTrustOp().Trustor)
+	case xdr.OperationTypeAccountMerge:
+		participants = append(participants, op.Body.MustDestination().ToAccountId())
+	case xdr.OperationTypeInflation:
+		// the only direct participant is the source_account
+	case xdr.OperationTypeManageData:
+		// the only direct participant is the source_account
+	case xdr.OperationTypeBumpSequence:
+		// the only direct participant is the source_account
+	case xdr.OperationTypeCreateClaimableBalance:
+		for _, c := range op.Body.MustCreateClaimableBalanceOp().Claimants {
+			participants = append(participants, c.MustV0().Destination)
+		}
+	case xdr.OperationTypeClaimClaimableBalance:
+		// the only direct participant is the source_account
+	case xdr.OperationTypeBeginSponsoringFutureReserves:
+		participants = append(participants, op.Body.MustBeginSponsoringFutureReservesOp().SponsoredId)
+	case xdr.OperationTypeEndSponsoringFutureReserves:
+		beginSponsorshipOp := operation.BeginSponsoringOperation()
+		if beginSponsorshipOp != nil {
+			participants = append(participants, *beginSponsorshipOp.SourceAccount())
+		}
+	case xdr.OperationTypeRevokeSponsorship:
+		op := operation.Operation.Body.MustRevokeSponsorshipOp()
+		switch op.Type {
+		case xdr.RevokeSponsorshipTypeRevokeSponsorshipLedgerEntry:
+			participants = append(participants, getLedgerKeyParticipants(*op.LedgerKey)...)
+		case xdr.RevokeSponsorshipTypeRevokeSponsorshipSigner:
+			participants = append(participants, op.Signer.AccountId)
+			// We don't add signer as a participant because a signer can be arbitrary account.
+			// This can spam successful operations history of any account.
+		}
+	case xdr.OperationTypeClawback:
+		op := operation.Operation.Body.MustClawbackOp()
+		participants = append(participants, op.From.ToAccountId())
+	case xdr.OperationTypeClawbackClaimableBalance:
+	// Nothing to do here
+	case xdr.OperationTypeSetTrustLineFlags:
+		op := operation.Operation.Body.MustSetTrustLineFlagsOp()
+		participants = append(participants, op.Trustor)
+	default:
+		return participants, fmt.Errorf("Unknown operation type: %s", op.Body.Type)
+	}
+
+	if operation.Transaction.HasMeta() {
+		sponsor, err := operation.Sponsor()
+		if err != nil {
+			return nil, err
+		}
+		if sponsor != nil {
+			participants = append(participants, *sponsor)
+		}
+	}
+
+	return dedupeParticipants(participants), nil
+}
+
+func getLedgerKeyParticipants(ledgerKey xdr.LedgerKey) []xdr.AccountId {
+	var result []xdr.AccountId
+	switch ledgerKey.Type {
+	case xdr.LedgerEntryTypeAccount:
+		result = append(result, ledgerKey.Account.AccountId)
+	case xdr.LedgerEntryTypeClaimableBalance:
+		// nothing to do
+	case xdr.LedgerEntryTypeData:
+		result = append(result, ledgerKey.Data.AccountId)
+	case xdr.LedgerEntryTypeOffer:
+		result = append(result, ledgerKey.Offer.SellerId)
+	case xdr.LedgerEntryTypeTrustline:
+		result = append(result, ledgerKey.TrustLine.AccountId)
+	}
+	return result
+}
+
+func participantsForChanges(
+	changes xdr.LedgerEntryChanges,
+) ([]xdr.AccountId, error) {
+	var participants []xdr.AccountId
+
+	for _, c := range changes {
+		var participant *xdr.AccountId
+
+		switch c.Type {
+		case xdr.LedgerEntryChangeTypeLedgerEntryCreated:
+			participant = participantsForLedgerEntry(c.MustCreated())
+		case xdr.LedgerEntryChangeTypeLedgerEntryRemoved:
+			participant = participantsForLedgerKey(c.MustRemoved())
+		case xdr.LedgerEntryChangeTypeLedgerEntryUpdated:
+			participant = participantsForLedgerEntry(c.MustUpdated())
+		case xdr.LedgerEntryChangeTypeLedgerEntryState:
+			participant = participantsForLedgerEntry(c.MustState())
+		default:
+			return nil, errors.Errorf("Unknown change type: %s", c.Type)
+		}
+
+		if participant != nil {
+			participants = append(participants, *participant)
+		}
+	}
+
+	return participants, nil
+}
+
+func participantsForLedgerEntry(le xdr.LedgerEntry) *xdr.AccountId {
+	if le.Data.Type != xdr.LedgerEntryTypeAccount {
+		return nil
+	}
+	aid := le.Data.MustAccount().AccountId
+	return &aid
+}
+
+func participantsForLedgerKey(lk xdr.LedgerKey) *xdr.AccountId {
+	if lk.Type != xdr.LedgerEntryTypeAccount {
+		return nil
+	}
+	aid := lk.MustAccount().AccountId
+	return &aid
+}
+
+func participantsForMeta(
+	meta xdr.TransactionMeta,
+) ([]xdr.AccountId, error) {
+	var participants []xdr.AccountId
+	if meta.Operations == nil {
+		return participants, nil
+	}
+
+	for _, op := range *meta.Operations {
+		var accounts []xdr.AccountId
+		accounts, err := participantsForChanges(op.Changes)
+		if err != nil {
+			return nil, err
+		}
+
+		participants = append(participants, accounts...)
+	}
+
+	return participants, nil
+}
+
+// dedupeParticipants remove any duplicate ids from `in`
+func dedupeParticipants(in []xdr.AccountId) (out []xdr.AccountId) {
+	set := map[string]xdr.AccountId{}
+	for _, id := range in {
+		set[id.Address()] = id
+	}
+
+	for _, id := range set {
+		out = append(out, id)
+	}
+	return
+}
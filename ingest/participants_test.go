@@ -0,0 +1,123 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+)
+
+func TestLedgerTransactionParticipants(t *testing.T) {
+	var envelope xdr.TransactionEnvelope
+	var meta xdr.TransactionMeta
+	var feeChanges xdr.LedgerEntryChanges
+	assert.NoError(
+		t,
+		xdr.SafeUnmarshalBase64(
+			"AAAAAGL8HQvQkbK2HA3WVjRrKmjX00fG8sLI7m0ERwJW/AX3AAAAZAAAAAAAAAABAAAAAQAAAAAAAABkAAAAAF4L0vAAAAAAAAAAAQAAAAAAAAAAAAAAAC6N7oJcJiUzTWRDL98Bj3fVrJUB19wFvCzEHh8nn/IOAAAAAlQL5AAAAAAAAAAAAVb8BfcAAABA8CyjzEXXVTMwnZTAbHfJeq2HCFzAWkU98ds2ZXFqjXR4EiN0YDSAb/pJwXc0TjMa//SiX83UvUFSqLa8hOXICQ==",
+			&envelope,
+		),
+	)
+	assert.NoError(
+		t,
+		xdr.SafeUnmarshalBase64(
+			"AAAAAQAAAAIAAAADAAAAAwAAAAAAAAAAYvwdC9CRsrYcDdZWNGsqaNfTR8bywsjubQRHAlb8BfcN4Lazp2P/nAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAEAAAAAAAAAAAAAAAAAAAAAAAABAAAAAwAAAAAAAAAAYvwdC9CRsrYcDdZWNGsqaNfTR8bywsjubQRHAlb8BfcN4Lazp2P/nAAAAAAAAAABAAAAAAAAAAAAAAAAAAAAAAEAAAAAAAAAAAAAAAAAAAAAAAABAAAAAwAAAAMAAAADAAAAAAAAAABi/B0L0JGythwN1lY0aypo19NHxvLCyO5tBEcCVvwF9w3gtrOnY/+cAAAAAAAAAAEAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAEAAAADAAAAAAAAAABi/B0L0JGythwN1lY0aypo19NHxvLCyO5tBEcCVvwF9w3gtrFTWBucAAAAAAAAAAEAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAAAAAADAAAAAAAAAAAuje6CXCYlM01kQy/fAY931ayVAdfcBbwsxB4fJ5/yDgAAAAJUC+QAAAAAAwAAAAAAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAA==",
+			&meta,
+		),
+	)
+	assert.NoError(
+		t,
+		xdr.SafeUnmarshalBase64(
+			"AAAAAgAAAAMAAAABAAAAAAAAAABi/B0L0JGythwN1lY0aypo19NHxvLCyO5tBEcCVvwF9w3gtrOnZAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAEAAAADAAAAAAAAAABi/B0L0JGythwN1lY0aypo19NHxvLCyO5tBEcCVvwF9w3gtrOnY/+cAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAA==",
+			&feeChanges,
+		),
+	)
+
+	transaction := LedgerTransaction{
+		Index:      1,
+		Envelope:   envelope,
+		FeeChanges: feeChanges,
+		Meta:       meta,
+		Result: xdr.TransactionResultPair{
+			Result: xdr.TransactionResult{
+				Result: xdr.TransactionResultResult{
+					Code: xdr.TransactionResultCodeTxSuccess,
+				},
+			},
+		},
+	}
+	particpants, err := transaction.Participants()
+	assert.NoError(t, err)
+	assert.Len(t, particpants, 2)
+	assert.Contains(
+		t,
+		particpants,
+		xdr.MustAddress("GBRPYHIL2CI3FNQ4BXLFMNDLFJUNPU2HY3ZMFSHONUCEOASW7QC7OX2H"),
+	)
+	assert.Contains(
+		t,
+		particpants,
+		xdr.MustAddress("GAXI33UCLQTCKM2NMRBS7XYBR535LLEVAHL5YBN4FTCB4HZHT7ZA5CVK"),
+	)
+}
+
+func TestLedgerTransactionParticipantsWithoutMeta(t *testing.T) {
+	var envelope xdr.TransactionEnvelope
+	require.NoError(
+		t,
+		xdr.SafeUnmarshalBase64(
+			"AAAAAGL8HQvQkbK2HA3WVjRrKmjX00fG8sLI7m0ERwJW/AX3AAAAZAAAAAAAAAABAAAAAQAAAAAAAABkAAAAAF4L0vAAAAAAAAAAAQAAAAAAAAAAAAAAAC6N7oJcJiUzTWRDL98Bj3fVrJUB19wFvCzEHh8nn/IOAAAAAlQL5AAAAAAAAAAAAVb8BfcAAABA8CyjzEXXVTMwnZTAbHfJeq2HCFzAWkU98ds2ZXFqjXR4EiN0YDSAb/pJwXc0TjMa//SiX83UvUFSqLa8hOXICQ==",
+			&envelope,
+		),
+	)
+
+	hash, err := network.HashTransactionInEnvelope(envelope, network.TestNetworkPassphrase)
+	require.NoError(t, err)
+
+	ledger := &historyarchive.Ledger{
+		Header: xdr.LedgerHeaderHistoryEntry{
+			Header: xdr.LedgerHeader{LedgerSeq: 64},
+		},
+	}
+	ledger.Transaction.TxSet.Txs = []xdr.TransactionEnvelope{envelope}
+	ledger.TransactionResult.TxResultSet.Results = []xdr.TransactionResultPair{{
+		TransactionHash: hash,
+		Result: xdr.TransactionResult{
+			Result: xdr.TransactionResultResult{
+				Code: xdr.TransactionResultCodeTxSuccess,
+			},
+		},
+	}}
+
+	archive := &historyarchive.MockArchive{}
+	archive.On("GetCheckpointManager").Return(historyarchive.NewCheckpointManager(64))
+	archive.On("GetRootHAS").Return(historyarchive.HistoryArchiveState{CurrentLedger: 127}, nil).Once()
+	archive.On("GetLedgers", uint32(64), uint32(64)).
+		Return(map[uint32]*historyarchive.Ledger{64: ledger}, nil).Once()
+
+	backend := ledgerbackend.NewHistoryArchiveBackend(archive)
+	require.NoError(t, backend.PrepareRange(ledgerbackend.BoundedRange(64, 64)))
+	reader, err := NewLedgerTransactionReader(backend, network.TestNetworkPassphrase, 64)
+	require.NoError(t, err)
+
+	transaction, err := reader.Read()
+	require.NoError(t, err)
+	assert.False(t, transaction.HasMeta())
+
+	particpants, err := transaction.Participants()
+	assert.NoError(t, err)
+	assert.ElementsMatch(
+		t,
+		[]xdr.AccountId{
+			xdr.MustAddress("GBRPYHIL2CI3FNQ4BXLFMNDLFJUNPU2HY3ZMFSHONUCEOASW7QC7OX2H"),
+			xdr.MustAddress("GAXI33UCLQTCKM2NMRBS7XYBR535LLEVAHL5YBN4FTCB4HZHT7ZA5CVK"),
+		},
+		particpants,
+	)
+	archive.AssertExpectations(t)
+}
@@ -267,6 +267,39 @@ func (o Offer) PagingToken() string {
 	return o.PT
 }
 
+// MarketStats represents the trade statistics of the last 24 hours and the
+// best bid and ask of an asset pair. Prices are expressed in units of the
+// counter asset. Fields which can't be computed, for example the open price of
+// a pair without recent trades, are omitted.
+type MarketStats struct {
+	Base               Asset      `json:"base"`
+	Counter            Asset      `json:"counter"`
+	PT                 string     `json:"paging_token"`
+	TradeCount         int64      `json:"trade_count,string"`
+	BaseVolume         string     `json:"base_volume"`
+	CounterVolume      string     `json:"counter_volume"`
+	Average            string     `json:"avg,omitempty"`
+	Open               string     `json:"open,omitempty"`
+	OpenR              *xdr.Price `json:"open_r,omitempty"`
+	High               string     `json:"high,omitempty"`
+	HighR              *xdr.Price `json:"high_r,omitempty"`
+	Low                string     `json:"low,omitempty"`
+	LowR               *xdr.Price `json:"low_r,omitempty"`
+	Close              string     `json:"close,omitempty"`
+	CloseR             *xdr.Price `json:"close_r,omitempty"`
+	Bid                string     `json:"bid,omitempty"`
+	BidR               *xdr.Price `json:"bid_r,omitempty"`
+	Ask                string     `json:"ask,omitempty"`
+	AskR               *xdr.Price `json:"ask_r,omitempty"`
+	Spread             string     `json:"spread,omitempty"`
+	LastModifiedLedger uint32     `json:"last_modified_ledger"`
+}
+
+// PagingToken implementation for hal.Pageable
+func (res MarketStats) PagingToken() string {
+	return res.PT
+}
+
 // OrderBookSummary represents a snapshot summary of a given order book
 type OrderBookSummary struct {
 	Bids    []PriceLevel `json:"bids"`
@@ -602,6 +635,14 @@ type TradeAggregationsPage struct {
 	} `json:"_embedded"`
 }
 
+// MarketStatsPage returns a list of market stats records
+type MarketStatsPage struct {
+	Links    hal.Links `json:"_links"`
+	Embedded struct {
+		Records []MarketStats `json:"records"`
+	} `json:"_embedded"`
+}
+
 // TradesPage returns a list of trade records
 type TradesPage struct {
 	Links    hal.Links `json:"_links"`
@@ -9,6 +9,9 @@ type InfoResponse struct {
 		ProtocolVersion int        `json:"protocol_version"`
 		State           string     `json:"state"`
 		Ledger          LedgerInfo `json:"ledger"`
+		// Status contains messages describing work in progress, ex. catchup
+		// progress.
+		Status []string `json:"status"`
 
 		// TODO: all the other fields
 	}
@@ -12,6 +12,7 @@ import (
 	"github.com/spf13/viper"
 
 	horizon "github.com/stellar/go/services/horizon/internal"
+	"github.com/stellar/go/services/horizon/internal/db2/history"
 	"github.com/stellar/go/services/horizon/internal/db2/schema"
 	"github.com/stellar/go/services/horizon/internal/ingest"
 	support "github.com/stellar/go/support/config"
@@ -133,11 +134,12 @@ var dbReingestCmd = &cobra.Command{
 }
 
 var (
-	reingestForce       bool
-	parallelWorkers     uint
-	parallelJobSize     uint32
-	retries             uint
-	retryBackoffSeconds uint
+	reingestForce        bool
+	parallelWorkers      uint
+	parallelJobSize      uint32
+	retries              uint
+	retryBackoffSeconds  uint
+	ledgerMetaArchiveURL string
 )
 var reingestRangeCmdOpts = []*support.ConfigOption{
 	{
@@ -181,6 +183,15 @@ var reingestRangeCmdOpts = []*support.ConfigOption{
 		FlagDefault: uint(5),
 		Usage:       "[optional] backoff seconds between reingest retries",
 	},
+	{
+		Name:        "ledger-meta-archive-url",
+		ConfigKey:   &ledgerMetaArchiveURL,
+		OptType:     types.String,
+		Required:    false,
+		FlagDefault: "",
+		Usage: "[optional] URL (file:// or s3://) of ledger meta exported by `horizon ingest export-ledger-meta`, " +
+			"if set ledgers are reingested from it instead of Stellar-Core",
+	},
 }
 
 var dbReingestRangeCmd = &cobra.Command{
@@ -250,9 +261,10 @@ func RunDBReingestRange(from, to uint32, reingestForce bool, parallelWorkers uin
 		CaptiveCoreBinaryPath:       config.CaptiveCoreBinaryPath,
 		RemoteCaptiveCoreURL:        config.RemoteCaptiveCoreURL,
 		CaptiveCoreConfigAppendPath: config.CaptiveCoreConfigAppendPath,
+		LedgerMetaArchiveURL:        ledgerMetaArchiveURL,
 	}
 
-	if !ingestConfig.EnableCaptiveCore {
+	if !ingestConfig.EnableCaptiveCore && ingestConfig.LedgerMetaArchiveURL == "" {
 		if config.StellarCoreDatabaseURL == "" {
 			return fmt.Errorf("flag --%s cannot be empty", horizon.StellarCoreDBURLFlagName)
 		}
@@ -269,23 +281,198 @@ func RunDBReingestRange(from, to uint32, reingestForce bool, parallelWorkers uin
 			return systemErr
 		}
 
-		return system.ReingestRange(
+		err = system.ReingestRange(
 			from,
 			to,
 			parallelJobSize,
 		)
+	} else {
+		system, systemErr := ingest.NewSystem(ingestConfig)
+		if systemErr != nil {
+			return systemErr
+		}
+
+		err = system.ReingestRange(
+			from,
+			to,
+			reingestForce,
+		)
 	}
+	return err
+}
 
-	system, systemErr := ingest.NewSystem(ingestConfig)
-	if systemErr != nil {
-		return systemErr
+var dbPartitionHistoryCmd = &cobra.Command{
+	Use:   "partition-history [Partition size]",
+	Short: "converts history tables into tables partitioned by ledger",
+	Long: "converts history_transactions, history_operations, history_effects and history_trades into " +
+		"tables range partitioned by ledger, each partition holding the given number of ledgers. " +
+		"Existing rows are kept in a single legacy partition which is dropped by the reaper once all " +
+		"its ledgers are outside of the retention window. Requires PostgreSQL 11 or newer and blocks " +
+		"ingestion until the conversion completes.",
+	Run: func(cmd *cobra.Command, args []string) {
+		requireAndSetFlag(horizon.DatabaseURLFlagName)
+
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		size, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil || size == 0 {
+			cmd.Usage()
+			log.Fatalf(`Invalid partition size "%s"`, args[0])
+		}
+
+		if err = RunDBPartitionHistory(uint32(size), *config); err != nil {
+			log.Fatal(err)
+		}
+
+		hlog.Info("History tables partitioned successfully!")
+	},
+}
+
+// RunDBPartitionHistory converts the history tables into tables partitioned
+// by ledger using partitions of the given size.
+func RunDBPartitionHistory(size uint32, config horizon.Config) error {
+	horizonSession, err := db.Open("postgres", config.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("cannot open Horizon DB: %v", err)
 	}
+	historyQ := &history.Q{horizonSession}
 
-	return system.ReingestRange(
-		from,
-		to,
-		reingestForce,
-	)
+	if err = historyQ.Begin(); err != nil {
+		return errors.Wrap(err, "Error starting a transaction")
+	}
+	defer historyQ.Rollback()
+
+	// acquire distributed lock so no one else can perform ingestion operations.
+	lastIngestedLedger, err := historyQ.GetLastLedgerIngest()
+	if err != nil {
+		return errors.Wrap(err, "Error getting last ingested ledger")
+	}
+
+	latestHistoryLedger, err := historyQ.GetLatestHistoryLedger()
+	if err != nil {
+		return errors.Wrap(err, "Error getting latest history ledger")
+	}
+	if latestHistoryLedger > lastIngestedLedger {
+		lastIngestedLedger = latestHistoryLedger
+	}
+
+	if err = historyQ.PartitionHistoryTables(size, lastIngestedLedger); err != nil {
+		return errors.Wrap(err, "cannot partition history tables")
+	}
+
+	return historyQ.Commit()
+}
+
+// rebuildTradeAggregationsBatchSize is the number of ledgers for which trade
+// aggregation buckets are rebuilt in a single db transaction. Ingestion waits
+// for the buckets tables lock of each batch, so batches are kept short.
+const rebuildTradeAggregationsBatchSize = 1000
+
+var dbRebuildTradeAggregationsCmd = &cobra.Command{
+	Use:   "rebuild-trade-aggregations [Start sequence number] [End sequence number]",
+	Short: "rebuilds the trade aggregation buckets",
+	Long: "rebuilds the pre-aggregated trade buckets used by the trade aggregations endpoint for ledgers " +
+		"between X and Y sequence number (closed intervals). If the range is omitted the buckets are rebuilt " +
+		"for every ledger in the history database and the trade aggregations endpoint starts using them.",
+	Run: func(cmd *cobra.Command, args []string) {
+		requireAndSetFlag(horizon.DatabaseURLFlagName)
+
+		if len(args) != 0 && len(args) != 2 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		argsUInt32 := make([]uint32, 2)
+		for i, arg := range args {
+			seq, err := strconv.Atoi(arg)
+			if err != nil {
+				cmd.Usage()
+				log.Fatalf(`Invalid sequence number "%s"`, arg)
+			}
+			argsUInt32[i] = uint32(seq)
+		}
+
+		err := RunDBRebuildTradeAggregations(argsUInt32[0], argsUInt32[1], *config)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		hlog.Info("Trade aggregations rebuilt successfully!")
+	},
+}
+
+// RunDBRebuildTradeAggregations rebuilds the trade aggregation buckets for
+// ledgers in the [from, to] range. If both from and to are 0 the buckets are
+// rebuilt for the whole history stored in the database and marked as
+// backfilled, so the trade aggregations endpoint starts using them.
+func RunDBRebuildTradeAggregations(from, to uint32, config horizon.Config) error {
+	horizonSession, err := db.Open("postgres", config.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("cannot open Horizon DB: %v", err)
+	}
+	historyQ := &history.Q{horizonSession}
+
+	if from != 0 || to != 0 {
+		return rebuildTradeAggregations(historyQ, from, to)
+	}
+
+	if err = historyQ.ElderLedger(&from); err != nil {
+		return errors.Wrap(err, "cannot get elder ledger")
+	}
+	if err = historyQ.LatestLedger(&to); err != nil {
+		return errors.Wrap(err, "cannot get latest ledger")
+	}
+	// Empty history has no trades to backfill
+	if to != 0 {
+		if err = rebuildTradeAggregations(historyQ, from, to); err != nil {
+			return err
+		}
+	}
+
+	return historyQ.UpdateTradeAggregationBucketsBackfilled(true)
+}
+
+// rebuildTradeAggregations rebuilds the trade aggregation buckets for ledgers
+// in the [from, to] range in batches of rebuildTradeAggregationsBatchSize
+// ledgers.
+func rebuildTradeAggregations(historyQ *history.Q, from, to uint32) error {
+	if from == 0 || from > to {
+		return errors.Errorf("invalid range: [%d, %d]", from, to)
+	}
+
+	for cur := from; cur <= to; cur += rebuildTradeAggregationsBatchSize {
+		batchTo := cur + rebuildTradeAggregationsBatchSize - 1
+		if batchTo > to || batchTo < cur {
+			batchTo = to
+		}
+
+		err := func() error {
+			if err := historyQ.Begin(); err != nil {
+				return errors.Wrap(err, "Error starting a transaction")
+			}
+			defer historyQ.Rollback()
+
+			if err := historyQ.RebuildTradeAggregationBuckets(cur, batchTo); err != nil {
+				return errors.Wrapf(err, "cannot rebuild trade aggregations for range [%d, %d]", cur, batchTo)
+			}
+
+			return historyQ.Commit()
+		}()
+		if err != nil {
+			return err
+		}
+
+		hlog.WithField("from", cur).WithField("to", batchTo).Info("Rebuilt trade aggregations")
+
+		if batchTo == to {
+			break
+		}
+	}
+
+	return nil
 }
 
 func init() {
@@ -304,6 +491,8 @@ func init() {
 		dbMigrateCmd,
 		dbReapCmd,
 		dbReingestCmd,
+		dbRebuildTradeAggregationsCmd,
+		dbPartitionHistoryCmd,
 	)
 	dbReingestCmd.AddCommand(dbReingestRangeCmd)
 }
@@ -5,10 +5,12 @@ import (
 	"go/types"
 	"net/http"
 	_ "net/http/pprof"
+	"sort"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/ingest/ledgerbackend"
 	horizon "github.com/stellar/go/services/horizon/internal"
 	"github.com/stellar/go/services/horizon/internal/db2/history"
 	"github.com/stellar/go/services/horizon/internal/ingest"
@@ -302,6 +304,219 @@ var ingestInitGenesisStateCmd = &cobra.Command{
 	},
 }
 
+var exportLedgerMetaFrom, exportLedgerMetaTo uint32
+var exportLedgerMetaArchiveURL string
+
+var exportLedgerMetaCmdOpts = []*support.ConfigOption{
+	{
+		Name:        "from",
+		ConfigKey:   &exportLedgerMetaFrom,
+		OptType:     types.Uint32,
+		Required:    true,
+		FlagDefault: uint32(0),
+		Usage:       "first ledger of the range to export",
+	},
+	{
+		Name:        "to",
+		ConfigKey:   &exportLedgerMetaTo,
+		OptType:     types.Uint32,
+		Required:    true,
+		FlagDefault: uint32(0),
+		Usage:       "last ledger of the range to export",
+	},
+	{
+		Name:        "ledger-meta-archive-url",
+		ConfigKey:   &exportLedgerMetaArchiveURL,
+		OptType:     types.String,
+		Required:    true,
+		FlagDefault: "",
+		Usage:       "URL (file:// or s3://) where ledger meta files are written",
+	},
+}
+
+var ingestExportLedgerMetaCmd = &cobra.Command{
+	Use:   "export-ledger-meta",
+	Short: "exports ledger meta of a range from captive core",
+	Long: "runs captive core between X and Y sequence number (inclusive) and writes the meta of every ledger " +
+		"to a directory or S3 bucket which can be used later by `horizon db reingest range --ledger-meta-archive-url`",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, co := range exportLedgerMetaCmdOpts {
+			co.Require()
+			co.SetValue()
+		}
+
+		horizon.ApplyFlags(config, flags)
+
+		if !config.EnableCaptiveCoreIngestion {
+			log.Fatal("captive core ingestion must be enabled to export ledger meta")
+		}
+		if exportLedgerMetaFrom == 0 || exportLedgerMetaFrom > exportLedgerMetaTo {
+			log.Fatal("`--from` must be positive and not greater than `--to`")
+		}
+
+		metaArchive, err := ledgerbackend.NewMetaArchiveBackend(
+			exportLedgerMetaArchiveURL,
+			historyarchive.ConnectOptions{},
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var core ledgerbackend.LedgerBackend
+		if config.RemoteCaptiveCoreURL != "" {
+			core, err = ledgerbackend.NewRemoteCaptive(config.RemoteCaptiveCoreURL)
+		} else {
+			core, err = ledgerbackend.NewCaptive(
+				ledgerbackend.CaptiveCoreConfig{
+					LogPath:             config.CaptiveCoreLogPath,
+					BinaryPath:          config.CaptiveCoreBinaryPath,
+					StoragePath:         config.CaptiveCoreStoragePath,
+					ConfigAppendPath:    config.CaptiveCoreConfigAppendPath,
+					HTTPPort:            config.CaptiveCoreHTTPPort,
+					PeerPort:            config.CaptiveCorePeerPort,
+					NetworkPassphrase:   config.NetworkPassphrase,
+					HistoryArchiveURLs:  config.HistoryArchiveURLs,
+					CheckpointFrequency: config.CheckpointFrequency,
+					Log:                 log.WithField("subservice", "stellar-core"),
+				},
+			)
+		}
+		if err != nil {
+			log.Fatalf("cannot create captive core backend: %v", err)
+		}
+		defer core.Close()
+
+		err = core.PrepareRange(ledgerbackend.BoundedRange(exportLedgerMetaFrom, exportLedgerMetaTo))
+		if err != nil {
+			log.Fatalf("cannot prepare range: %v", err)
+		}
+
+		for sequence := exportLedgerMetaFrom; sequence <= exportLedgerMetaTo; sequence++ {
+			meta, err := core.GetLedgerBlocking(sequence)
+			if err != nil {
+				log.Fatalf("cannot get ledger %d: %v", sequence, err)
+			}
+			if err = metaArchive.PutLedger(meta); err != nil {
+				log.Fatalf("cannot export ledger %d: %v", sequence, err)
+			}
+			if sequence%100 == 0 {
+				log.WithField("ledger", sequence).Info("Exported ledger meta")
+			}
+		}
+
+		log.Info("Range exported successfully!")
+	},
+}
+
+var ingestExplainLedger uint32
+
+var ingestExplainCmdOpts = []*support.ConfigOption{
+	{
+		Name:        "ledger",
+		ConfigKey:   &ingestExplainLedger,
+		OptType:     types.Uint32,
+		Required:    true,
+		FlagDefault: uint32(0),
+		Usage:       "ledger to explain",
+	},
+}
+
+var ingestExplainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "prints rows the ingestion processors insert, update and delete for a ledger without committing them",
+	Long: "runs the ingestion processors on a single ledger in a transaction which is rolled back and prints " +
+		"the number of rows each processor inserts, updates and deletes in every table together with ledger " +
+		"changes and transactions stats. State processors are run only when the ledger is the next ledger to ingest.",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, co := range ingestExplainCmdOpts {
+			co.Require()
+			co.SetValue()
+		}
+
+		horizon.ApplyFlags(config, flags)
+
+		horizonSession, err := db.Open("postgres", config.DatabaseURL)
+		if err != nil {
+			log.Fatalf("cannot open Horizon DB: %v", err)
+		}
+
+		ingestConfig := ingest.Config{
+			NetworkPassphrase:     config.NetworkPassphrase,
+			HistorySession:        horizonSession,
+			HistoryArchiveURL:     config.HistoryArchiveURLs[0],
+			EnableCaptiveCore:     config.EnableCaptiveCoreIngestion,
+			CaptiveCoreBinaryPath: config.CaptiveCoreBinaryPath,
+			RemoteCaptiveCoreURL:  config.RemoteCaptiveCoreURL,
+			CheckpointFrequency:   config.CheckpointFrequency,
+		}
+
+		if !ingestConfig.EnableCaptiveCore {
+			if config.StellarCoreDatabaseURL == "" {
+				log.Fatalf("flag --%s cannot be empty", horizon.StellarCoreDBURLFlagName)
+			}
+
+			coreSession, dbErr := db.Open("postgres", config.StellarCoreDatabaseURL)
+			if dbErr != nil {
+				log.Fatalf("cannot open Core DB: %v", dbErr)
+			}
+			ingestConfig.CoreSession = coreSession
+		}
+
+		system, err := ingest.NewSystem(ingestConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer system.Shutdown()
+
+		explanation, err := system.ExplainLedger(ingestExplainLedger)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		printLedgerExplanation(explanation)
+	},
+}
+
+func printLedgerExplanation(explanation ingest.LedgerExplanation) {
+	fmt.Printf("Ledger %d\n", explanation.Sequence)
+	if explanation.StateSkipped {
+		fmt.Println("State processors skipped: ledger is not the next ledger to ingest")
+	}
+
+	fmt.Println()
+	for _, processor := range explanation.Processors {
+		fmt.Println(processor.Processor)
+		if len(processor.Tables) == 0 {
+			fmt.Println("    no changes")
+		}
+		for _, table := range processor.Tables {
+			fmt.Printf(
+				"    %-40s inserts=%d updates=%d deletes=%d\n",
+				table.Table, table.Inserts, table.Updates, table.Deletes,
+			)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Change stats")
+	printStatsMap(explanation.ChangeStats.Map())
+	fmt.Println()
+	fmt.Println("Transaction stats")
+	printStatsMap(explanation.TransactionStats.Map())
+}
+
+func printStatsMap(stats map[string]interface{}) {
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Printf("    %-40s %v\n", key, stats[key])
+	}
+}
+
 func init() {
 	for _, co := range ingestVerifyRangeCmdOpts {
 		err := co.Init(ingestVerifyRangeCmd)
@@ -317,6 +532,20 @@ func init() {
 		}
 	}
 
+	for _, co := range exportLedgerMetaCmdOpts {
+		err := co.Init(ingestExportLedgerMetaCmd)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
+	for _, co := range ingestExplainCmdOpts {
+		err := co.Init(ingestExplainCmd)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
 	viper.BindPFlags(ingestVerifyRangeCmd.PersistentFlags())
 
 	rootCmd.AddCommand(ingestCmd)
@@ -325,5 +554,7 @@ func init() {
 		ingestStressTestCmd,
 		ingestTriggerStateRebuildCmd,
 		ingestInitGenesisStateCmd,
+		ingestExportLedgerMetaCmd,
+		ingestExplainCmd,
 	)
 }
@@ -0,0 +1,125 @@
+package actions
+
+import (
+	"net/http"
+
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/services/horizon/internal/context"
+	"github.com/stellar/go/services/horizon/internal/db2/history"
+	"github.com/stellar/go/services/horizon/internal/ledger"
+	"github.com/stellar/go/services/horizon/internal/resourceadapter"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/support/render/hal"
+	"github.com/stellar/go/support/render/problem"
+)
+
+// MarketStatsQuery query struct for market_stats end-point
+type MarketStatsQuery struct {
+	TradeAssetsQueryParams `valid:"optional"`
+}
+
+// Validate runs custom validations on base and counter
+func (q MarketStatsQuery) Validate() error {
+	base, err := q.Base()
+	if err != nil {
+		return err
+	}
+	counter, err := q.Counter()
+	if err != nil {
+		return err
+	}
+
+	if base == nil && counter != nil {
+		return problem.MakeInvalidFieldProblem(
+			"base_asset_type",
+			errors.New("base asset is required when counter asset is supplied"),
+		)
+	}
+
+	return nil
+}
+
+// GetMarketStatsHandler is the action handler for the /market_stats endpoint
+type GetMarketStatsHandler struct {
+	LedgerState *ledger.State
+}
+
+// GetResourcePage returns a page of market stats.
+func (handler GetMarketStatsHandler) GetResourcePage(w HeaderWriter, r *http.Request) ([]hal.Pageable, error) {
+	ctx := r.Context()
+
+	pq, err := GetPageQuery(handler.LedgerState, r, DisableCursorValidation)
+	if err != nil {
+		return nil, err
+	}
+
+	if pq.Cursor != "" {
+		if _, _, err = history.ParseMarketStatsCursor(pq.Cursor); err != nil {
+			return nil, problem.MakeInvalidFieldProblem(
+				"cursor",
+				errors.New("the cursor is not a valid paging_token"),
+			)
+		}
+	}
+
+	qp := MarketStatsQuery{}
+	if err = getParams(&qp, r); err != nil {
+		return nil, err
+	}
+
+	historyQ, err := context.HistoryQFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	query := history.MarketStatsQuery{Page: pq}
+	baseAsset, err := qp.Base()
+	if err != nil {
+		return nil, err
+	}
+	if baseAsset != nil {
+		query.BaseAssetID, err = historyQ.GetAssetID(*baseAsset)
+		if historyQ.NoRows(err) {
+			// an asset which was never traded nor offered has no markets
+			return []hal.Pageable{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	counterAsset, err := qp.Counter()
+	if err != nil {
+		return nil, err
+	}
+	if counterAsset != nil {
+		query.CounterAssetID, err = historyQ.GetAssetID(*counterAsset)
+		if historyQ.NoRows(err) {
+			return []hal.Pageable{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	records, err := historyQ.GetMarketStats(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var response []hal.Pageable
+	for _, record := range records {
+		// the paging token always refers to the canonical order of the pair
+		pagingToken := record.PagingToken()
+		if query.BaseAssetID != 0 && record.BaseAssetID != query.BaseAssetID {
+			record = record.Invert()
+		}
+
+		var res horizon.MarketStats
+		if err = resourceadapter.PopulateMarketStats(ctx, &res, record); err != nil {
+			return nil, err
+		}
+		res.PT = pagingToken
+		response = append(response, res)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,68 @@
+package actions
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stellar/go/support/render/problem"
+)
+
+func TestMarketStatsValidation(t *testing.T) {
+	handler := GetMarketStatsHandler{}
+
+	for _, testCase := range []struct {
+		name               string
+		queryParams        map[string]string
+		expectedErrorField string
+		expectedError      string
+	}{
+		{
+			"invalid cursor",
+			map[string]string{
+				"cursor": "12_abc",
+			},
+			"cursor",
+			"not a valid paging_token",
+		},
+		{
+			"counter asset without base asset",
+			map[string]string{
+				"counter_asset_type": "native",
+			},
+			"base_asset_type",
+			"base asset is required",
+		},
+		{
+			"invalid base asset",
+			map[string]string{
+				"base_asset_type": "credit_alphanum4",
+				"base_asset_code": "USD",
+			},
+			"base_asset",
+			"invalid base_asset",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := makeRequest(t, testCase.queryParams, map[string]string{}, nil)
+			_, err := handler.GetResourcePage(httptest.NewRecorder(), r)
+			if err == nil {
+				t.Fatalf("expected error %v but got %v", testCase.expectedError, err)
+			}
+
+			problem := err.(*problem.P)
+			if field := problem.Extras["invalid_field"]; field != testCase.expectedErrorField {
+				t.Fatalf(
+					"expected error field %v but got %v",
+					testCase.expectedErrorField,
+					field,
+				)
+			}
+
+			reason := problem.Extras["reason"]
+			if !strings.Contains(reason.(string), testCase.expectedError) {
+				t.Fatalf("expected reason %v but got %v", testCase.expectedError, reason)
+			}
+		})
+	}
+}
@@ -357,6 +357,16 @@ func (handler GetTradeAggregationsHandler) fetchRecords(historyQ *history.Q, qp
 		}
 	}
 
+	// Buckets pre-aggregated during ingestion can only be used once they
+	// contain the whole history.
+	backfilled, err := historyQ.GetTradeAggregationBucketsBackfilled()
+	if err != nil {
+		return nil, err
+	}
+	if backfilled {
+		tradeAggregationsQ = tradeAggregationsQ.WithBuckets()
+	}
+
 	var records []history.TradeAggregation
 	err = historyQ.Select(&records, tradeAggregationsQ.GetSql())
 	if err != nil {
@@ -501,6 +501,9 @@ func (a *App) init() error {
 			cache: newHealthCache(healthCacheTTL),
 		},
 	}
+	if a.ingester != nil {
+		routerConfig.CaptiveCoreStatus = captiveCoreStatus{getter: a.ingester}
+	}
 
 	var err error
 	config := httpx.ServerConfig{
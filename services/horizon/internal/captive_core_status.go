@@ -0,0 +1,33 @@
+package horizon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/support/log"
+)
+
+type captiveCoreStatusGetter interface {
+	CaptiveCoreStatus(ctx context.Context) (ledgerbackend.CaptiveCoreStatus, bool)
+}
+
+// captiveCoreStatus is an http.Handler returning the status of Captive
+// Stellar-Core run by the ingestion system.
+type captiveCoreStatus struct {
+	getter captiveCoreStatusGetter
+}
+
+func (c captiveCoreStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status, ok := c.getter.CaptiveCoreStatus(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Ctx(r.Context()).WithError(err).Warn("could not write captive core status response")
+	}
+}
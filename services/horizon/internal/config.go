@@ -13,8 +13,12 @@ import (
 type Config struct {
 	DatabaseURL        string
 	HistoryArchiveURLs []string
-	Port               uint
-	AdminPort          uint
+	// HistoryArchiveCachePath enables caching of history archive files in the
+	// given directory. HistoryArchiveCacheMaxSize is its maximum size in MB.
+	HistoryArchiveCachePath    string
+	HistoryArchiveCacheMaxSize uint
+	Port                       uint
+	AdminPort                  uint
 
 	EnableCaptiveCoreIngestion  bool
 	CaptiveCoreBinaryPath       string
@@ -23,6 +27,7 @@ type Config struct {
 	CaptiveCoreHTTPPort         uint
 	CaptiveCorePeerPort         uint
 	CaptiveCoreLogPath          string
+	CaptiveCoreMaxRestarts      int
 	CaptiveCoreStoragePath      string
 
 	StellarCoreDatabaseURL string
@@ -0,0 +1,78 @@
+package history
+
+import (
+	"github.com/stellar/go/support/db"
+	"github.com/stellar/go/support/errors"
+)
+
+// TableChanges holds the number of rows inserted, updated and deleted in a
+// table by the current transaction.
+type TableChanges struct {
+	Table   string `db:"relname"`
+	Inserts int64  `db:"n_tup_ins"`
+	Updates int64  `db:"n_tup_upd"`
+	Deletes int64  `db:"n_tup_del"`
+}
+
+// DryRunQ is a Q which never persists data: Commit rolls back the
+// transaction instead. It is used to run ingestion processors against the
+// database and inspect what they would write.
+type DryRunQ struct {
+	*Q
+}
+
+var _ IngestionQ = (*DryRunQ)(nil)
+
+// NewDryRunQ returns a DryRunQ using a clone of the given session.
+func NewDryRunQ(session *db.Session) *DryRunQ {
+	return &DryRunQ{&Q{session.Clone()}}
+}
+
+// Commit rolls back the transaction.
+func (q *DryRunQ) Commit() error {
+	return q.Rollback()
+}
+
+// CloneIngestionQ clones underlying db.Session and returns a DryRunQ.
+func (q *DryRunQ) CloneIngestionQ() IngestionQ {
+	return NewDryRunQ(q.Session)
+}
+
+// GetTableChanges returns the number of rows inserted, updated and deleted
+// in every table by the current transaction so far. Tables without changes
+// are omitted. It must be called inside a transaction.
+func (q *DryRunQ) GetTableChanges() ([]TableChanges, error) {
+	if q.GetTx() == nil {
+		return nil, errors.New("cannot get table changes outside of a transaction")
+	}
+
+	var changes []TableChanges
+	err := q.SelectRaw(&changes, `
+		SELECT relname, n_tup_ins, n_tup_upd, n_tup_del
+		FROM pg_stat_xact_user_tables
+		WHERE n_tup_ins > 0 OR n_tup_upd > 0 OR n_tup_del > 0
+		ORDER BY relname
+	`)
+	return changes, err
+}
+
+// SubtractTableChanges returns the changes made after the before snapshot
+// was taken. Tables without changes in between are omitted.
+func SubtractTableChanges(after, before []TableChanges) []TableChanges {
+	previous := map[string]TableChanges{}
+	for _, change := range before {
+		previous[change.Table] = change
+	}
+
+	var diff []TableChanges
+	for _, change := range after {
+		prev := previous[change.Table]
+		change.Inserts -= prev.Inserts
+		change.Updates -= prev.Updates
+		change.Deletes -= prev.Deletes
+		if change.Inserts != 0 || change.Updates != 0 || change.Deletes != 0 {
+			diff = append(diff, change)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,25 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubtractTableChanges(t *testing.T) {
+	before := []TableChanges{
+		{Table: "accounts", Inserts: 1, Updates: 2},
+		{Table: "history_ledgers", Inserts: 1},
+	}
+	after := []TableChanges{
+		{Table: "accounts", Inserts: 1, Updates: 5, Deletes: 1},
+		{Table: "history_ledgers", Inserts: 1},
+		{Table: "offers", Inserts: 3},
+	}
+
+	assert.Equal(t, []TableChanges{
+		{Table: "accounts", Updates: 3, Deletes: 1},
+		{Table: "offers", Inserts: 3},
+	}, SubtractTableChanges(after, before))
+	assert.Nil(t, SubtractTableChanges(before, before))
+}
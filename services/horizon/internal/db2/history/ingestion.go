@@ -12,6 +12,7 @@ func (q *Q) TruncateIngestStateTables() error {
 		"accounts_signers",
 		"claimable_balances",
 		"exp_asset_stats",
+		"exp_market_stats",
 		"offers",
 		"trust_lines",
 	})
@@ -16,6 +16,9 @@ const (
 	lastLedgerKey           = "exp_ingest_last_ledger"
 	stateInvalid            = "exp_state_invalid"
 	offerCompactionSequence = "offer_compaction_sequence"
+	// tradeAggregationBucketsBackfilled is also set in migration files, if
+	// you need to update the key name remember to upgrade it there too!
+	tradeAggregationBucketsBackfilled = "trade_aggregation_buckets_backfilled"
 )
 
 // GetLastLedgerIngestNonBlocking works like GetLastLedgerIngest but
@@ -159,6 +162,35 @@ func (q *Q) UpdateOfferCompactionSequence(sequence uint32) error {
 	)
 }
 
+// GetTradeAggregationBucketsBackfilled returns true if the pre-aggregated
+// trade buckets contain all trades of the history, i.e. the history was empty
+// when the buckets were added or they were rebuilt since then.
+func (q *Q) GetTradeAggregationBucketsBackfilled() (bool, error) {
+	backfilled, err := q.getValueFromStore(tradeAggregationBucketsBackfilled, false)
+	if err != nil {
+		return false, err
+	}
+
+	if backfilled == "" {
+		return false, nil
+	}
+	val, err := strconv.ParseBool(backfilled)
+	if err != nil {
+		return false, errors.Wrap(err, "Error converting backfilled value")
+	}
+
+	return val, nil
+}
+
+// UpdateTradeAggregationBucketsBackfilled marks the pre-aggregated trade
+// buckets as backfilled.
+func (q *Q) UpdateTradeAggregationBucketsBackfilled(val bool) error {
+	return q.updateValueInStore(
+		tradeAggregationBucketsBackfilled,
+		strconv.FormatBool(val),
+	)
+}
+
 // getValueFromStore returns a value for a given key from KV store. If value
 // is not present in the key value store "" will be returned.
 func (q *Q) getValueFromStore(key string, forUpdate bool) (string, error) {
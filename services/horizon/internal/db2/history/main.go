@@ -14,9 +14,11 @@ import (
 	"github.com/guregu/null"
 	"github.com/jmoiron/sqlx"
 
+	"github.com/stellar/go/ingest"
 	"github.com/stellar/go/services/horizon/internal/db2"
 	"github.com/stellar/go/support/db"
 	"github.com/stellar/go/support/errors"
+	strtime "github.com/stellar/go/support/time"
 	"github.com/stellar/go/xdr"
 )
 
@@ -24,167 +26,167 @@ const (
 	// account effects
 
 	// EffectAccountCreated effects occur when a new account is created
-	EffectAccountCreated EffectType = 0 // from create_account
+	EffectAccountCreated = ingest.EffectAccountCreated // from create_account
 
 	// EffectAccountRemoved effects occur when one account is merged into another
-	EffectAccountRemoved EffectType = 1 // from merge_account
+	EffectAccountRemoved = ingest.EffectAccountRemoved // from merge_account
 
 	// EffectAccountCredited effects occur when an account receives some currency
-	EffectAccountCredited EffectType = 2 // from create_account, payment, path_payment, merge_account
+	EffectAccountCredited = ingest.EffectAccountCredited // from create_account, payment, path_payment, merge_account
 
 	// EffectAccountDebited effects occur when an account sends some currency
-	EffectAccountDebited EffectType = 3 // from create_account, payment, path_payment, create_account
+	EffectAccountDebited = ingest.EffectAccountDebited // from create_account, payment, path_payment, create_account
 
 	// EffectAccountThresholdsUpdated effects occur when an account changes its
 	// multisig thresholds.
-	EffectAccountThresholdsUpdated EffectType = 4 // from set_options
+	EffectAccountThresholdsUpdated = ingest.EffectAccountThresholdsUpdated // from set_options
 
 	// EffectAccountHomeDomainUpdated effects occur when an account changes its
 	// home domain.
-	EffectAccountHomeDomainUpdated EffectType = 5 // from set_options
+	EffectAccountHomeDomainUpdated = ingest.EffectAccountHomeDomainUpdated // from set_options
 
 	// EffectAccountFlagsUpdated effects occur when an account changes its
 	// account flags, either clearing or setting.
-	EffectAccountFlagsUpdated EffectType = 6 // from set_options
+	EffectAccountFlagsUpdated = ingest.EffectAccountFlagsUpdated // from set_options
 
 	// EffectAccountInflationDestinationUpdated effects occur when an account changes its
 	// inflation destination.
-	EffectAccountInflationDestinationUpdated EffectType = 7 // from set_options
+	EffectAccountInflationDestinationUpdated = ingest.EffectAccountInflationDestinationUpdated // from set_options
 
 	// signer effects
 
 	// EffectSignerCreated occurs when an account gains a signer
-	EffectSignerCreated EffectType = 10 // from set_options
+	EffectSignerCreated = ingest.EffectSignerCreated // from set_options
 
 	// EffectSignerRemoved occurs when an account loses a signer
-	EffectSignerRemoved EffectType = 11 // from set_options
+	EffectSignerRemoved = ingest.EffectSignerRemoved // from set_options
 
 	// EffectSignerUpdated occurs when an account changes the weight of one of its
 	// signers.
-	EffectSignerUpdated EffectType = 12 // from set_options
+	EffectSignerUpdated = ingest.EffectSignerUpdated // from set_options
 
 	// trustline effects
 
 	// EffectTrustlineCreated occurs when an account trusts an anchor
-	EffectTrustlineCreated EffectType = 20 // from change_trust
+	EffectTrustlineCreated = ingest.EffectTrustlineCreated // from change_trust
 
 	// EffectTrustlineRemoved occurs when an account removes struct by setting the
 	// limit of a trustline to 0
-	EffectTrustlineRemoved EffectType = 21 // from change_trust
+	EffectTrustlineRemoved = ingest.EffectTrustlineRemoved // from change_trust
 
 	// EffectTrustlineUpdated occurs when an account changes a trustline's limit
-	EffectTrustlineUpdated EffectType = 22 // from change_trust, allow_trust
+	EffectTrustlineUpdated = ingest.EffectTrustlineUpdated // from change_trust, allow_trust
 
 	// Deprecated: use EffectTrustlineFlagsUpdated instead.
 	// EffectTrustlineAuthorized occurs when an anchor has AUTH_REQUIRED flag set
 	// to true and it authorizes another account's trustline
-	EffectTrustlineAuthorized EffectType = 23 // from allow_trust
+	EffectTrustlineAuthorized = ingest.EffectTrustlineAuthorized // from allow_trust
 
 	// Deprecated: use EffectTrustlineFlagsUpdated instead.
 	// EffectTrustlineDeauthorized occurs when an anchor revokes access to a asset
 	// it issues.
-	EffectTrustlineDeauthorized EffectType = 24 // from allow_trust
+	EffectTrustlineDeauthorized = ingest.EffectTrustlineDeauthorized // from allow_trust
 
 	// Deprecated: use EffectTrustlineFlagsUpdated instead.
 	// EffectTrustlineAuthorizedToMaintainLiabilities occurs when an anchor has AUTH_REQUIRED flag set
 	// to true and it authorizes another account's trustline to maintain liabilities
-	EffectTrustlineAuthorizedToMaintainLiabilities EffectType = 25 // from allow_trust
+	EffectTrustlineAuthorizedToMaintainLiabilities = ingest.EffectTrustlineAuthorizedToMaintainLiabilities // from allow_trust
 
 	// EffectTrustlineFlagsUpdated effects occur when a TrustLine changes its
 	// flags, either clearing or setting.
-	EffectTrustlineFlagsUpdated EffectType = 26 // from set_trust_line flags
+	EffectTrustlineFlagsUpdated = ingest.EffectTrustlineFlagsUpdated // from set_trust_line flags
 
 	// trading effects
 
 	// EffectOfferCreated occurs when an account offers to trade an asset
-	EffectOfferCreated EffectType = 30 // from manage_offer, creat_passive_offer
+	EffectOfferCreated = ingest.EffectOfferCreated // from manage_offer, creat_passive_offer
 
 	// EffectOfferRemoved occurs when an account removes an offer
-	EffectOfferRemoved EffectType = 31 // from manage_offer, create_passive_offer, path_payment
+	EffectOfferRemoved = ingest.EffectOfferRemoved // from manage_offer, create_passive_offer, path_payment
 
 	// EffectOfferUpdated occurs when an offer is updated by the offering account.
-	EffectOfferUpdated EffectType = 32 // from manage_offer, creat_passive_offer, path_payment
+	EffectOfferUpdated = ingest.EffectOfferUpdated // from manage_offer, creat_passive_offer, path_payment
 
 	// EffectTrade occurs when a trade is initiated because of a path payment or
 	// offer operation.
-	EffectTrade EffectType = 33 // from manage_offer, creat_passive_offer, path_payment
+	EffectTrade = ingest.EffectTrade // from manage_offer, creat_passive_offer, path_payment
 
 	// data effects
 
 	// EffectDataCreated occurs when an account gets a new data field
-	EffectDataCreated EffectType = 40 // from manage_data
+	EffectDataCreated = ingest.EffectDataCreated // from manage_data
 
 	// EffectDataRemoved occurs when an account removes a data field
-	EffectDataRemoved EffectType = 41 // from manage_data
+	EffectDataRemoved = ingest.EffectDataRemoved // from manage_data
 
 	// EffectDataUpdated occurs when an account changes a data field's value
-	EffectDataUpdated EffectType = 42 // from manage_data
+	EffectDataUpdated = ingest.EffectDataUpdated // from manage_data
 
 	// EffectSequenceBumped occurs when an account bumps their sequence number
-	EffectSequenceBumped EffectType = 43 // from bump_sequence
+	EffectSequenceBumped = ingest.EffectSequenceBumped // from bump_sequence
 
 	// claimable balance effects
 
 	// EffectClaimableBalanceCreated occurs when a claimable balance is created
-	EffectClaimableBalanceCreated EffectType = 50 // from create_claimable_balance
+	EffectClaimableBalanceCreated = ingest.EffectClaimableBalanceCreated // from create_claimable_balance
 
 	// EffectClaimableBalanceClaimantCreated occurs when a claimable balance claimant is created
-	EffectClaimableBalanceClaimantCreated EffectType = 51 // from create_claimable_balance
+	EffectClaimableBalanceClaimantCreated = ingest.EffectClaimableBalanceClaimantCreated // from create_claimable_balance
 
 	// EffectClaimableBalanceClaimed occurs when a claimable balance is claimed
-	EffectClaimableBalanceClaimed EffectType = 52 // from claim_claimable_balance
+	EffectClaimableBalanceClaimed = ingest.EffectClaimableBalanceClaimed // from claim_claimable_balance
 
 	// sponsorship effects
 
 	// EffectAccountSponsorshipCreated occurs when an account ledger entry is sponsored
-	EffectAccountSponsorshipCreated EffectType = 60 // from create_account
+	EffectAccountSponsorshipCreated = ingest.EffectAccountSponsorshipCreated // from create_account
 
 	// EffectAccountSponsorshipUpdated occurs when the sponsoring of an account ledger entry is updated
-	EffectAccountSponsorshipUpdated EffectType = 61 // from revoke_sponsorship
+	EffectAccountSponsorshipUpdated = ingest.EffectAccountSponsorshipUpdated // from revoke_sponsorship
 
 	// EffectAccountSponsorshipRemoved occurs when the sponsorship of an account ledger entry is removed
-	EffectAccountSponsorshipRemoved EffectType = 62 // from revoke_sponsorship
+	EffectAccountSponsorshipRemoved = ingest.EffectAccountSponsorshipRemoved // from revoke_sponsorship
 
 	// EffectTrustlineSponsorshipCreated occurs when a trustline ledger entry is sponsored
-	EffectTrustlineSponsorshipCreated EffectType = 63 // from change_trust
+	EffectTrustlineSponsorshipCreated = ingest.EffectTrustlineSponsorshipCreated // from change_trust
 
 	// EffectTrustlineSponsorshipUpdated occurs when the sponsoring of a trustline ledger entry is updated
-	EffectTrustlineSponsorshipUpdated EffectType = 64 // from revoke_sponsorship
+	EffectTrustlineSponsorshipUpdated = ingest.EffectTrustlineSponsorshipUpdated // from revoke_sponsorship
 
 	// EffectTrustlineSponsorshipRemoved occurs when the sponsorship of a trustline ledger entry is removed
-	EffectTrustlineSponsorshipRemoved EffectType = 65 // from revoke_sponsorship
+	EffectTrustlineSponsorshipRemoved = ingest.EffectTrustlineSponsorshipRemoved // from revoke_sponsorship
 
 	// EffectDataSponsorshipCreated occurs when a trustline ledger entry is sponsored
-	EffectDataSponsorshipCreated EffectType = 66 // from manage_data
+	EffectDataSponsorshipCreated = ingest.EffectDataSponsorshipCreated // from manage_data
 
 	// EffectDataSponsorshipUpdated occurs when the sponsoring of a trustline ledger entry is updated
-	EffectDataSponsorshipUpdated EffectType = 67 // from revoke_sponsorship
+	EffectDataSponsorshipUpdated = ingest.EffectDataSponsorshipUpdated // from revoke_sponsorship
 
 	// EffectDataSponsorshipRemoved occurs when the sponsorship of a trustline ledger entry is removed
-	EffectDataSponsorshipRemoved EffectType = 68 // from revoke_sponsorship
+	EffectDataSponsorshipRemoved = ingest.EffectDataSponsorshipRemoved // from revoke_sponsorship
 
 	// EffectClaimableBalanceSponsorshipCreated occurs when a claimable balance ledger entry is sponsored
-	EffectClaimableBalanceSponsorshipCreated EffectType = 69 // from create_claimable_balance
+	EffectClaimableBalanceSponsorshipCreated = ingest.EffectClaimableBalanceSponsorshipCreated // from create_claimable_balance
 
 	// EffectClaimableBalanceSponsorshipUpdated occurs when the sponsoring of a claimable balance ledger entry
 	// is updated
-	EffectClaimableBalanceSponsorshipUpdated EffectType = 70 // from revoke_sponsorship
+	EffectClaimableBalanceSponsorshipUpdated = ingest.EffectClaimableBalanceSponsorshipUpdated // from revoke_sponsorship
 
 	// EffectClaimableBalanceSponsorshipRemoved occurs when the sponsorship of a claimable balance ledger entry
 	// is removed
-	EffectClaimableBalanceSponsorshipRemoved EffectType = 71 // from claim_claimable_balance
+	EffectClaimableBalanceSponsorshipRemoved = ingest.EffectClaimableBalanceSponsorshipRemoved // from claim_claimable_balance
 
 	// EffectSignerSponsorshipCreated occurs when the sponsorship of a signer is created
-	EffectSignerSponsorshipCreated EffectType = 72 // from set_options
+	EffectSignerSponsorshipCreated = ingest.EffectSignerSponsorshipCreated // from set_options
 
 	// EffectSignerSponsorshipUpdated occurs when the sponsorship of a signer is updated
-	EffectSignerSponsorshipUpdated EffectType = 73 // from revoke_sponsorship
+	EffectSignerSponsorshipUpdated = ingest.EffectSignerSponsorshipUpdated // from revoke_sponsorship
 
 	// EffectSignerSponsorshipRemoved occurs when the sponsorship of a signer is removed
-	EffectSignerSponsorshipRemoved EffectType = 74 // from revoke_sponsorship
+	EffectSignerSponsorshipRemoved = ingest.EffectSignerSponsorshipRemoved // from revoke_sponsorship
 
 	// EffectClaimableBalanceClawedBack occurs when a claimable balance is clawed back
-	EffectClaimableBalanceClawedBack EffectType = 80 // from clawback_claimable_balance
+	EffectClaimableBalanceClawedBack = ingest.EffectClaimableBalanceClawedBack // from clawback_claimable_balance
 )
 
 // Account is a row of data from the `history_accounts` table
@@ -238,6 +240,12 @@ type IngestionQ interface {
 	//QTrades
 	NewTradeBatchInsertBuilder(maxBatchSize int) TradeBatchInsertBuilder
 	CreateAssets(assets []xdr.Asset, batchSize int) (map[string]Asset, error)
+	UpsertTradeAggregationBuckets(ledger uint32) error
+	// QMarketStats
+	UpdateMarketStatsOrderBook(ledger uint32, pairs []MarketStatsPair) error
+	ResetMarketStatsOrderBook() error
+	UpdateMarketStatsTrades(ledger uint32, windowStart strtime.Millis, pairs []MarketStatsPair) error
+	DeleteEmptyMarketStats() (int64, error)
 	QTransactions
 	QTrustLines
 
@@ -255,6 +263,8 @@ type IngestionQ interface {
 	GetOfferCompactionSequence() (uint32, error)
 	TruncateIngestStateTables() error
 	DeleteRangeAll(start, end int64) error
+	RebuildTradeAggregationBuckets(fromLedger, toLedger uint32) error
+	EnsureHistoryPartitions(ledger uint32) (uint32, uint32, error)
 }
 
 // QAccounts defines account related queries.
@@ -454,7 +464,7 @@ type EffectsQ struct {
 
 // EffectType is the numeric type for an effect, used as the `type` field in the
 // `history_effects` table.
-type EffectType int
+type EffectType = ingest.EffectType
 
 // FeeStats is a row of data from the min, mode, percentile aggregate functions over the
 // `history_transactions` table.
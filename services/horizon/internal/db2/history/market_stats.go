@@ -0,0 +1,550 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/guregu/null"
+	"github.com/lib/pq"
+	"github.com/stellar/go/services/horizon/internal/db2"
+	"github.com/stellar/go/services/horizon/internal/toid"
+	"github.com/stellar/go/support/errors"
+	strtime "github.com/stellar/go/support/time"
+	"github.com/stellar/go/xdr"
+)
+
+// MarketStatsPair identifies an asset pair in the exp_market_stats table. The
+// pair is in canonical order: BaseAssetID is lower than CounterAssetID.
+type MarketStatsPair struct {
+	BaseAssetID    int64
+	CounterAssetID int64
+	BaseAsset      xdr.Asset
+	CounterAsset   xdr.Asset
+}
+
+// NewMarketStatsPair returns the MarketStatsPair of the given assets, ordering
+// them canonically.
+func NewMarketStatsPair(asset1 Asset, xdrAsset1 xdr.Asset, asset2 Asset, xdrAsset2 xdr.Asset) MarketStatsPair {
+	if asset1.ID < asset2.ID {
+		return MarketStatsPair{
+			BaseAssetID:    asset1.ID,
+			CounterAssetID: asset2.ID,
+			BaseAsset:      xdrAsset1,
+			CounterAsset:   xdrAsset2,
+		}
+	}
+	return MarketStatsPair{
+		BaseAssetID:    asset2.ID,
+		CounterAssetID: asset1.ID,
+		BaseAsset:      xdrAsset2,
+		CounterAsset:   xdrAsset1,
+	}
+}
+
+// MarketStats is a row of data from the `exp_market_stats` table joined with
+// the details of both assets of the pair.
+type MarketStats struct {
+	BaseAssetID         int64      `db:"base_asset_id"`
+	BaseAssetType       string     `db:"base_asset_type"`
+	BaseAssetCode       string     `db:"base_asset_code"`
+	BaseAssetIssuer     string     `db:"base_asset_issuer"`
+	CounterAssetID      int64      `db:"counter_asset_id"`
+	CounterAssetType    string     `db:"counter_asset_type"`
+	CounterAssetCode    string     `db:"counter_asset_code"`
+	CounterAssetIssuer  string     `db:"counter_asset_issuer"`
+	TradeCount          int64      `db:"trade_count"`
+	BaseVolume          string     `db:"base_volume"`
+	CounterVolume       string     `db:"counter_volume"`
+	OpenN               null.Int   `db:"open_n"`
+	OpenD               null.Int   `db:"open_d"`
+	HighN               null.Int   `db:"high_n"`
+	HighD               null.Int   `db:"high_d"`
+	LowN                null.Int   `db:"low_n"`
+	LowD                null.Int   `db:"low_d"`
+	CloseN              null.Int   `db:"close_n"`
+	CloseD              null.Int   `db:"close_d"`
+	BidN                null.Int   `db:"bid_n"`
+	BidD                null.Int   `db:"bid_d"`
+	AskN                null.Int   `db:"ask_n"`
+	AskD                null.Int   `db:"ask_d"`
+	WindowStart         int64      `db:"window_start"`
+	LastModifiedLedger  uint32     `db:"last_modified_ledger"`
+	VolumeWeightedPrice null.Float `db:"vwap"`
+}
+
+// PagingToken returns a cursor for this record
+func (m MarketStats) PagingToken() string {
+	return fmt.Sprintf("%d_%d", m.BaseAssetID, m.CounterAssetID)
+}
+
+// Invert returns the statistics of the reversed pair, in which the counter
+// asset is the base asset and prices are expressed in units of the base asset.
+func (m MarketStats) Invert() MarketStats {
+	inverted := m
+	inverted.BaseAssetID, inverted.CounterAssetID = m.CounterAssetID, m.BaseAssetID
+	inverted.BaseAssetType, inverted.CounterAssetType = m.CounterAssetType, m.BaseAssetType
+	inverted.BaseAssetCode, inverted.CounterAssetCode = m.CounterAssetCode, m.BaseAssetCode
+	inverted.BaseAssetIssuer, inverted.CounterAssetIssuer = m.CounterAssetIssuer, m.BaseAssetIssuer
+	inverted.BaseVolume, inverted.CounterVolume = m.CounterVolume, m.BaseVolume
+	inverted.OpenN, inverted.OpenD = m.OpenD, m.OpenN
+	inverted.CloseN, inverted.CloseD = m.CloseD, m.CloseN
+	// inverting the prices swaps the highest and the lowest one and the
+	// best bid becomes the best ask
+	inverted.HighN, inverted.HighD = m.LowD, m.LowN
+	inverted.LowN, inverted.LowD = m.HighD, m.HighN
+	inverted.BidN, inverted.BidD = m.AskD, m.AskN
+	inverted.AskN, inverted.AskD = m.BidD, m.BidN
+	if m.VolumeWeightedPrice.Valid && m.VolumeWeightedPrice.Float64 != 0 {
+		inverted.VolumeWeightedPrice = null.FloatFrom(1 / m.VolumeWeightedPrice.Float64)
+	}
+	return inverted
+}
+
+// MarketStatsQuery is a helper struct to filter the rows of the
+// `exp_market_stats` table. A zero asset id matches any asset.
+type MarketStatsQuery struct {
+	BaseAssetID    int64
+	CounterAssetID int64
+	Page           db2.PageQuery
+}
+
+// QMarketStats defines market stats related queries.
+type QMarketStats interface {
+	CreateAssets(assets []xdr.Asset, maxBatchSize int) (map[string]Asset, error)
+	UpdateMarketStatsOrderBook(ledger uint32, pairs []MarketStatsPair) error
+	ResetMarketStatsOrderBook() error
+	UpdateMarketStatsTrades(ledger uint32, windowStart strtime.Millis, pairs []MarketStatsPair) error
+	DeleteEmptyMarketStats() (int64, error)
+}
+
+// UpdateMarketStatsOrderBook updates the best bid and ask of the given pairs
+// using the current contents of the offers table.
+func (q *Q) UpdateMarketStatsOrderBook(ledger uint32, pairs []MarketStatsPair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	var baseAssetIDs, counterAssetIDs []int64
+	var baseAssets, counterAssets []string
+	for _, pair := range pairs {
+		baseAsset, err := xdr.MarshalBase64(pair.BaseAsset)
+		if err != nil {
+			return errors.Wrap(err, "could not encode base asset")
+		}
+		counterAsset, err := xdr.MarshalBase64(pair.CounterAsset)
+		if err != nil {
+			return errors.Wrap(err, "could not encode counter asset")
+		}
+
+		baseAssetIDs = append(baseAssetIDs, pair.BaseAssetID)
+		counterAssetIDs = append(counterAssetIDs, pair.CounterAssetID)
+		baseAssets = append(baseAssets, baseAsset)
+		counterAssets = append(counterAssets, counterAsset)
+	}
+
+	// asks are offers selling the base asset, their price is already
+	// expressed in units of the counter asset. bids are offers selling the
+	// counter asset so their price must be inverted.
+	sql := `
+	INSERT INTO exp_market_stats (
+		base_asset_id,
+		counter_asset_id,
+		bid_n,
+		bid_d,
+		ask_n,
+		ask_d,
+		last_modified_ledger
+	)
+	SELECT
+		pairs.base_asset_id,
+		pairs.counter_asset_id,
+		bid.priced,
+		bid.pricen,
+		ask.pricen,
+		ask.priced,
+		?
+	FROM unnest(?::bigint[], ?::bigint[], ?::text[], ?::text[])
+		AS pairs(base_asset_id, counter_asset_id, base_asset, counter_asset)
+	LEFT JOIN LATERAL (
+		SELECT pricen, priced FROM offers
+		WHERE selling_asset = pairs.base_asset AND buying_asset = pairs.counter_asset AND deleted = false
+		ORDER BY price ASC LIMIT 1
+	) ask ON true
+	LEFT JOIN LATERAL (
+		SELECT pricen, priced FROM offers
+		WHERE selling_asset = pairs.counter_asset AND buying_asset = pairs.base_asset AND deleted = false
+		ORDER BY price ASC LIMIT 1
+	) bid ON true
+	ON CONFLICT (base_asset_id, counter_asset_id) DO UPDATE SET
+		bid_n = excluded.bid_n,
+		bid_d = excluded.bid_d,
+		ask_n = excluded.ask_n,
+		ask_d = excluded.ask_d,
+		last_modified_ledger = excluded.last_modified_ledger`
+
+	_, err := q.ExecRaw(sql,
+		ledger,
+		pq.Array(baseAssetIDs),
+		pq.Array(counterAssetIDs),
+		pq.Array(baseAssets),
+		pq.Array(counterAssets),
+	)
+	return err
+}
+
+// ResetMarketStatsOrderBook clears the best bid and ask of all pairs. It is
+// used before rebuilding the order book statistics from a history archive
+// snapshot.
+func (q *Q) ResetMarketStatsOrderBook() error {
+	sql := sq.Update("exp_market_stats").SetMap(map[string]interface{}{
+		"bid_n": nil,
+		"bid_d": nil,
+		"ask_n": nil,
+		"ask_d": nil,
+	})
+	_, err := q.Exec(sql)
+	return err
+}
+
+// UpdateMarketStatsTrades updates the trade statistics of the window of
+// trades executed since windowStart after the given ledger was ingested. The
+// trades of the ledger are added to the statistics and the 1 minute trade
+// aggregation buckets which left the window since the last update of a pair are
+// subtracted from them, so old trades expire even when a pair is no longer
+// traded. The statistics of a pair are aggregated from all the buckets of the
+// window only when they were not computed yet, or when its highest or lowest
+// price expired. It must be called after the trades of the ledger were added to
+// the buckets.
+//
+// Trade statistics are not updated until the buckets are backfilled (see
+// GetTradeAggregationBucketsBackfilled), the statistics of every pair are then
+// aggregated from all the buckets of the window on the next update.
+func (q *Q) UpdateMarketStatsTrades(ledger uint32, windowStart strtime.Millis, pairs []MarketStatsPair) error {
+	backfilled, err := q.GetTradeAggregationBucketsBackfilled()
+	if err != nil {
+		return errors.Wrap(err, "could not get trade aggregation buckets backfilled")
+	}
+	if !backfilled {
+		return nil
+	}
+
+	var baseAssetIDs, counterAssetIDs []int64
+	for _, pair := range pairs {
+		baseAssetIDs = append(baseAssetIDs, pair.BaseAssetID)
+		counterAssetIDs = append(counterAssetIDs, pair.CounterAssetID)
+	}
+
+	start, end, err := toid.LedgerRangeInclusive(int32(ledger), int32(ledger))
+	if err != nil {
+		return errors.Wrap(err, "could not get ledger toid range")
+	}
+
+	// A zero window_start means the trade statistics of the pair were not
+	// computed yet (ex. the row was inserted by UpdateMarketStatsOrderBook).
+	sql := `
+	WITH ledger_trades AS (
+		SELECT
+			base_asset_id,
+			counter_asset_id,
+			base_amount,
+			counter_amount,
+			ARRAY[price_n, price_d]::numeric[] as price
+		FROM history_trades
+		WHERE history_operation_id >= ? AND history_operation_id < ?
+		ORDER BY history_operation_id, "order"
+	), added AS (
+		SELECT
+			base_asset_id,
+			counter_asset_id,
+			count(*) as trade_count,
+			sum(base_amount) as base_volume,
+			sum(counter_amount) as counter_volume,
+			first(price) as open_price,
+			max_price(price) as high_price,
+			min_price(price) as low_price,
+			last(price) as close_price
+		FROM ledger_trades
+		GROUP BY base_asset_id, counter_asset_id
+	), pairs AS (
+		SELECT base_asset_id, counter_asset_id FROM exp_market_stats
+		WHERE (trade_count > 0 AND window_start < ?) OR window_start = 0
+		UNION
+		SELECT * FROM unnest(?::bigint[], ?::bigint[])
+		UNION
+		SELECT base_asset_id, counter_asset_id FROM added
+	), existing AS (
+		SELECT
+			pairs.base_asset_id,
+			pairs.counter_asset_id,
+			coalesce(m.trade_count, 0) as trade_count,
+			coalesce(m.base_volume, 0) as base_volume,
+			coalesce(m.counter_volume, 0) as counter_volume,
+			ARRAY[m.open_n, m.open_d]::numeric[] as open_price,
+			ARRAY[m.high_n, m.high_d]::numeric[] as high_price,
+			ARRAY[m.low_n, m.low_d]::numeric[] as low_price,
+			ARRAY[m.close_n, m.close_d]::numeric[] as close_price,
+			coalesce(m.window_start, 0) as window_start
+		FROM pairs
+		LEFT JOIN exp_market_stats m USING (base_asset_id, counter_asset_id)
+	), expired AS (
+		SELECT
+			base_asset_id,
+			counter_asset_id,
+			sum(buckets.count) as trade_count,
+			sum(buckets.base_volume) as base_volume,
+			sum(buckets.counter_volume) as counter_volume,
+			max_price(ARRAY[buckets.high_n, buckets.high_d]) as high_price,
+			min_price(ARRAY[buckets.low_n, buckets.low_d]) as low_price
+		FROM history_trades_60000 buckets
+		JOIN existing USING (base_asset_id, counter_asset_id)
+		WHERE existing.window_start > 0
+			AND buckets."timestamp" >= existing.window_start
+			AND buckets."timestamp" < ?
+		GROUP BY base_asset_id, counter_asset_id
+	), rescanned AS (
+		SELECT existing.base_asset_id, existing.counter_asset_id
+		FROM existing
+		LEFT JOIN expired USING (base_asset_id, counter_asset_id)
+		WHERE existing.window_start = 0
+			OR expired.high_price[1] * existing.high_price[2] >= existing.high_price[1] * expired.high_price[2]
+			OR expired.low_price[1] * existing.low_price[2] <= existing.low_price[1] * expired.low_price[2]
+	), incremental AS (
+		SELECT
+			existing.base_asset_id,
+			existing.counter_asset_id,
+			existing.trade_count + coalesce(added.trade_count, 0) - coalesce(expired.trade_count, 0) as trade_count,
+			existing.base_volume + coalesce(added.base_volume, 0) - coalesce(expired.base_volume, 0) as base_volume,
+			existing.counter_volume + coalesce(added.counter_volume, 0) - coalesce(expired.counter_volume, 0) as counter_volume,
+			CASE
+				WHEN expired.trade_count > 0 THEN first_bucket.open_price
+				WHEN existing.trade_count = 0 THEN added.open_price
+				ELSE existing.open_price
+			END as open_price,
+			CASE
+				WHEN existing.trade_count = 0 THEN added.high_price
+				WHEN added.high_price[1] * existing.high_price[2] > existing.high_price[1] * added.high_price[2] THEN added.high_price
+				ELSE existing.high_price
+			END as high_price,
+			CASE
+				WHEN existing.trade_count = 0 THEN added.low_price
+				WHEN added.low_price[1] * existing.low_price[2] < existing.low_price[1] * added.low_price[2] THEN added.low_price
+				ELSE existing.low_price
+			END as low_price,
+			CASE
+				WHEN added.trade_count > 0 THEN added.close_price
+				ELSE existing.close_price
+			END as close_price
+		FROM existing
+		LEFT JOIN added USING (base_asset_id, counter_asset_id)
+		LEFT JOIN expired USING (base_asset_id, counter_asset_id)
+		LEFT JOIN LATERAL (
+			SELECT ARRAY[buckets.open_n, buckets.open_d] as open_price
+			FROM history_trades_60000 buckets
+			WHERE buckets.base_asset_id = existing.base_asset_id
+				AND buckets.counter_asset_id = existing.counter_asset_id
+				AND buckets."timestamp" >= ?
+			ORDER BY buckets."timestamp" ASC LIMIT 1
+		) first_bucket ON expired.trade_count > 0
+		WHERE NOT EXISTS (
+			SELECT 1 FROM rescanned
+			WHERE rescanned.base_asset_id = existing.base_asset_id
+				AND rescanned.counter_asset_id = existing.counter_asset_id
+		)
+	), window_stats AS (
+		SELECT
+			base_asset_id,
+			counter_asset_id,
+			sum(count) as trade_count,
+			sum(base_volume) as base_volume,
+			sum(counter_volume) as counter_volume,
+			first(ARRAY[open_n, open_d]) as open_price,
+			max_price(ARRAY[high_n, high_d]) as high_price,
+			min_price(ARRAY[low_n, low_d]) as low_price,
+			last(ARRAY[close_n, close_d]) as close_price
+		FROM (
+			SELECT buckets.* FROM history_trades_60000 buckets
+			JOIN rescanned USING (base_asset_id, counter_asset_id)
+			WHERE buckets."timestamp" >= ?
+			ORDER BY buckets.open_ledger_toid
+		) htrd
+		GROUP BY base_asset_id, counter_asset_id
+	), stats AS (
+		SELECT * FROM incremental
+		UNION ALL
+		SELECT
+			rescanned.base_asset_id,
+			rescanned.counter_asset_id,
+			coalesce(window_stats.trade_count, 0),
+			coalesce(window_stats.base_volume, 0),
+			coalesce(window_stats.counter_volume, 0),
+			window_stats.open_price,
+			window_stats.high_price,
+			window_stats.low_price,
+			window_stats.close_price
+		FROM rescanned
+		LEFT JOIN window_stats USING (base_asset_id, counter_asset_id)
+	)
+	INSERT INTO exp_market_stats (
+		base_asset_id,
+		counter_asset_id,
+		trade_count,
+		base_volume,
+		counter_volume,
+		open_n,
+		open_d,
+		high_n,
+		high_d,
+		low_n,
+		low_d,
+		close_n,
+		close_d,
+		window_start,
+		last_modified_ledger
+	)
+	SELECT
+		base_asset_id,
+		counter_asset_id,
+		trade_count,
+		base_volume,
+		counter_volume,
+		open_price[1],
+		open_price[2],
+		high_price[1],
+		high_price[2],
+		low_price[1],
+		low_price[2],
+		close_price[1],
+		close_price[2],
+		?,
+		?
+	FROM stats
+	ON CONFLICT (base_asset_id, counter_asset_id) DO UPDATE SET
+		trade_count = excluded.trade_count,
+		base_volume = excluded.base_volume,
+		counter_volume = excluded.counter_volume,
+		open_n = excluded.open_n,
+		open_d = excluded.open_d,
+		high_n = excluded.high_n,
+		high_d = excluded.high_d,
+		low_n = excluded.low_n,
+		low_d = excluded.low_d,
+		close_n = excluded.close_n,
+		close_d = excluded.close_d,
+		window_start = excluded.window_start,
+		last_modified_ledger = excluded.last_modified_ledger`
+
+	_, err = q.ExecRaw(sql,
+		start,
+		end,
+		windowStart.ToInt64(),
+		pq.Array(baseAssetIDs),
+		pq.Array(counterAssetIDs),
+		windowStart.ToInt64(),
+		windowStart.ToInt64(),
+		windowStart.ToInt64(),
+		windowStart.ToInt64(),
+		ledger,
+	)
+	return err
+}
+
+// DeleteEmptyMarketStats removes the pairs which have neither trades in the
+// current window nor open offers.
+func (q *Q) DeleteEmptyMarketStats() (int64, error) {
+	sql := sq.Delete("exp_market_stats").Where(sq.Eq{
+		"trade_count": 0,
+		"bid_n":       nil,
+		"ask_n":       nil,
+	})
+	result, err := q.Exec(sql)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetMarketStats returns a page of exp_market_stats rows. When only one of the
+// assets is given, the pairs in which it is either the base or the counter
+// asset are returned.
+func (q *Q) GetMarketStats(query MarketStatsQuery) ([]MarketStats, error) {
+	sql := selectMarketStats
+	switch {
+	case query.BaseAssetID != 0 && query.CounterAssetID != 0:
+		_, baseAssetID, counterAssetID := getCanonicalAssetOrder(query.BaseAssetID, query.CounterAssetID)
+		sql = sql.Where(sq.Eq{
+			"m.base_asset_id":    baseAssetID,
+			"m.counter_asset_id": counterAssetID,
+		})
+	case query.BaseAssetID != 0:
+		sql = sql.Where("(m.base_asset_id = ? OR m.counter_asset_id = ?)", query.BaseAssetID, query.BaseAssetID)
+	case query.CounterAssetID != 0:
+		sql = sql.Where("(m.base_asset_id = ? OR m.counter_asset_id = ?)", query.CounterAssetID, query.CounterAssetID)
+	}
+
+	var cursorComparison, orderBy string
+	switch query.Page.Order {
+	case "asc":
+		cursorComparison, orderBy = ">", "asc"
+	case "desc":
+		cursorComparison, orderBy = "<", "desc"
+	default:
+		return nil, fmt.Errorf("invalid page order %s", query.Page.Order)
+	}
+
+	if query.Page.Cursor != "" {
+		cursorBase, cursorCounter, err := ParseMarketStatsCursor(query.Page.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		sql = sql.Where(
+			"((m.base_asset_id, m.counter_asset_id) "+cursorComparison+" (?,?))",
+			cursorBase, cursorCounter,
+		)
+	}
+
+	sql = sql.OrderBy("(m.base_asset_id, m.counter_asset_id) " + orderBy).Limit(query.Page.Limit)
+
+	var results []MarketStats
+	if err := q.Select(&results, sql); err != nil {
+		return nil, errors.Wrap(err, "could not run select query")
+	}
+
+	return results, nil
+}
+
+// ParseMarketStatsCursor parses the paging token of a MarketStats record.
+func ParseMarketStatsCursor(cursor string) (int64, int64, error) {
+	parts := strings.Split(cursor, "_")
+	if len(parts) != 2 {
+		return 0, 0, errors.New("invalid market stats cursor")
+	}
+
+	base, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "invalid market stats cursor")
+	}
+	counter, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "invalid market stats cursor")
+	}
+
+	return base, counter, nil
+}
+
+var selectMarketStats = sq.Select(
+	"m.*",
+	"ba.asset_type as base_asset_type",
+	"ba.asset_code as base_asset_code",
+	"ba.asset_issuer as base_asset_issuer",
+	"ca.asset_type as counter_asset_type",
+	"ca.asset_code as counter_asset_code",
+	"ca.asset_issuer as counter_asset_issuer",
+	"CASE WHEN m.base_volume > 0 THEN m.counter_volume/m.base_volume END as vwap",
+).
+	From("exp_market_stats m").
+	Join("history_assets ba ON ba.id = m.base_asset_id").
+	Join("history_assets ca ON ca.id = m.counter_asset_id")
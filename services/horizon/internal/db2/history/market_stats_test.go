@@ -0,0 +1,243 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/guregu/null"
+	"github.com/stellar/go/services/horizon/internal/db2"
+	"github.com/stellar/go/services/horizon/internal/test"
+	strtime "github.com/stellar/go/support/time"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMarketStatsPair(t *testing.T) {
+	native := xdr.MustNewNativeAsset()
+	usd := xdr.MustNewCreditAsset("USD", "GBZ35ZJRIKJGYH5PBKLKOZ5L6EXCNTO7BKIL7DAVVDFQ2ODJEEHHJXIM")
+	expected := MarketStatsPair{
+		BaseAssetID:    1,
+		CounterAssetID: 2,
+		BaseAsset:      usd,
+		CounterAsset:   native,
+	}
+
+	assert.Equal(t, expected, NewMarketStatsPair(Asset{ID: 1}, usd, Asset{ID: 2}, native))
+	assert.Equal(t, expected, NewMarketStatsPair(Asset{ID: 2}, native, Asset{ID: 1}, usd))
+}
+
+func TestMarketStatsInvert(t *testing.T) {
+	stats := MarketStats{
+		BaseAssetID:         1,
+		BaseAssetCode:       "EUR",
+		CounterAssetID:      2,
+		CounterAssetCode:    "USD",
+		BaseVolume:          "100",
+		CounterVolume:       "50",
+		OpenN:               null.IntFrom(1),
+		OpenD:               null.IntFrom(2),
+		HighN:               null.IntFrom(3),
+		HighD:               null.IntFrom(4),
+		LowN:                null.IntFrom(1),
+		LowD:                null.IntFrom(4),
+		CloseN:              null.IntFrom(2),
+		CloseD:              null.IntFrom(3),
+		BidN:                null.IntFrom(1),
+		BidD:                null.IntFrom(3),
+		VolumeWeightedPrice: null.FloatFrom(0.5),
+	}
+
+	inverted := stats.Invert()
+	assert.Equal(t, int64(2), inverted.BaseAssetID)
+	assert.Equal(t, "USD", inverted.BaseAssetCode)
+	assert.Equal(t, int64(1), inverted.CounterAssetID)
+	assert.Equal(t, "EUR", inverted.CounterAssetCode)
+	assert.Equal(t, "50", inverted.BaseVolume)
+	assert.Equal(t, "100", inverted.CounterVolume)
+	assert.Equal(t, null.IntFrom(2), inverted.OpenN)
+	assert.Equal(t, null.IntFrom(1), inverted.OpenD)
+	assert.Equal(t, null.IntFrom(4), inverted.HighN)
+	assert.Equal(t, null.IntFrom(1), inverted.HighD)
+	assert.Equal(t, null.IntFrom(4), inverted.LowN)
+	assert.Equal(t, null.IntFrom(3), inverted.LowD)
+	assert.Equal(t, null.IntFrom(3), inverted.CloseN)
+	assert.Equal(t, null.IntFrom(2), inverted.CloseD)
+	assert.False(t, inverted.BidN.Valid)
+	assert.Equal(t, null.IntFrom(3), inverted.AskN)
+	assert.Equal(t, null.IntFrom(1), inverted.AskD)
+	assert.Equal(t, null.FloatFrom(2), inverted.VolumeWeightedPrice)
+
+	assert.Equal(t, stats, inverted.Invert())
+}
+
+func TestParseMarketStatsCursor(t *testing.T) {
+	base, counter, err := ParseMarketStatsCursor("12_34")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), base)
+	assert.Equal(t, int64(34), counter)
+
+	for _, cursor := range []string{"12", "12_34_56", "a_34", "12_b"} {
+		_, _, err = ParseMarketStatsCursor(cursor)
+		assert.Error(t, err, cursor)
+	}
+}
+
+func getAllMarketStats(tt *test.T, q *Q) []MarketStats {
+	stats, err := q.GetMarketStats(MarketStatsQuery{
+		Page: db2.PageQuery{Order: "asc", Limit: 100},
+	})
+	tt.Assert.NoError(err)
+	for i := range stats {
+		stats[i].LastModifiedLedger = 0
+	}
+	return stats
+}
+
+func TestUpdateMarketStatsOrderBook(t *testing.T) {
+	tt := test.Start(t)
+	defer tt.Finish()
+	test.ResetHorizonDB(t, tt.HorizonDB)
+	q := &Q{tt.HorizonSession()}
+
+	eurBid := Offer{
+		SellerID:           twoEurOfferSeller.Address(),
+		OfferID:            int64(51),
+		BuyingAsset:        nativeAsset,
+		SellingAsset:       eurAsset,
+		Amount:             int64(500),
+		Pricen:             int32(2),
+		Priced:             int32(1),
+		Price:              float64(2),
+		LastModifiedLedger: uint32(1234),
+	}
+	deletedOffer := eurOffer
+	deletedOffer.OfferID = 52
+	deletedOffer.Pricen, deletedOffer.Priced, deletedOffer.Price = 1, 2, 0.5
+	deletedOffer.Deleted = true
+	for _, offer := range []Offer{eurOffer, twoEurOffer, eurBid, deletedOffer} {
+		tt.Assert.NoError(insertOffer(q, offer))
+	}
+
+	assets, err := q.CreateAssets([]xdr.Asset{nativeAsset, eurAsset, usdAsset}, 10)
+	tt.Assert.NoError(err)
+	nativeID := assets[nativeAsset.String()].ID
+	pairs := []MarketStatsPair{
+		NewMarketStatsPair(assets[nativeAsset.String()], nativeAsset, assets[eurAsset.String()], eurAsset),
+		NewMarketStatsPair(assets[usdAsset.String()], usdAsset, assets[eurAsset.String()], eurAsset),
+	}
+	tt.Assert.NoError(q.UpdateMarketStatsOrderBook(10, pairs))
+
+	stats := getAllMarketStats(tt, q)
+	tt.Assert.Len(stats, 2)
+	for _, pairStats := range stats {
+		if pairStats.BaseAssetID != nativeID && pairStats.CounterAssetID != nativeID {
+			// no offers for USD/EUR
+			tt.Assert.False(pairStats.BidN.Valid)
+			tt.Assert.False(pairStats.AskN.Valid)
+			continue
+		}
+		if pairStats.BaseAssetID != nativeID {
+			pairStats = pairStats.Invert()
+		}
+		// the best ask is the cheapest offer selling XLM, deleted offers are
+		// ignored, and the bid is the inverted price of the offer selling EUR
+		tt.Assert.Equal(null.IntFrom(1), pairStats.AskN)
+		tt.Assert.Equal(null.IntFrom(1), pairStats.AskD)
+		tt.Assert.Equal(null.IntFrom(1), pairStats.BidN)
+		tt.Assert.Equal(null.IntFrom(2), pairStats.BidD)
+	}
+
+	tt.Assert.NoError(q.ResetMarketStatsOrderBook())
+	deleted, err := q.DeleteEmptyMarketStats()
+	tt.Assert.NoError(err)
+	tt.Assert.Equal(int64(2), deleted)
+}
+
+// assertMarketStatsTrades checks the incrementally updated trade statistics
+// against statistics aggregated from all the buckets of the window.
+func assertMarketStatsTrades(tt *test.T, q *Q, windowStart strtime.Millis) []MarketStats {
+	incremental := getAllMarketStats(tt, q)
+
+	_, err := q.ExecRaw("UPDATE exp_market_stats SET window_start = 0")
+	tt.Assert.NoError(err)
+	// ledger without trades
+	tt.Assert.NoError(q.UpdateMarketStatsTrades(1000, windowStart, nil))
+
+	tt.Assert.Equal(getAllMarketStats(tt, q), incremental)
+	return incremental
+}
+
+func TestUpdateMarketStatsTrades(t *testing.T) {
+	tt := test.Start(t)
+	defer tt.Finish()
+	test.ResetHorizonDB(t, tt.HorizonDB)
+	q := &Q{tt.HorizonSession()}
+
+	addresses := []string{
+		"GB2QIYT2IAUFMRXKLSLLPRECC6OCOGJMADSPTRK7TGNT2SFR2YGWDARD",
+		"GAXMF43TGZHW3QN3REOUA2U5PW5BTARXGGYJ3JIFHW3YT6QRKRL3CPPU",
+	}
+	accountIDs, assetIDs := createAccountsAndAssets(
+		tt, q,
+		addresses,
+		[]xdr.Asset{eurAsset, usdAsset, nativeAsset},
+	)
+
+	closeTime := time.Unix(1599998400, 0).UTC()
+	ingestTrades := func(ledger int32, closeTime time.Time, prices [2]xdr.Price) {
+		first, second, third := createInsertTrades(accountIDs, assetIDs, ledger)
+		first.SellPrice, second.SellPrice = prices[0], prices[1]
+		for _, trade := range []*InsertTrade{&first, &second, &third} {
+			trade.LedgerCloseTime = closeTime
+		}
+		builder := q.NewTradeBatchInsertBuilder(0)
+		tt.Assert.NoError(builder.Add(first, second, third))
+		tt.Assert.NoError(builder.Exec())
+		tt.Assert.NoError(q.UpsertTradeAggregationBuckets(uint32(ledger)))
+	}
+	tradeCounts := func(stats []MarketStats) []int64 {
+		var counts []int64
+		for _, pairStats := range stats {
+			counts = append(counts, pairStats.TradeCount)
+		}
+		return counts
+	}
+
+	windowStart := strtime.MillisFromSeconds(closeTime.Add(-24 * time.Hour).Unix())
+	ingestTrades(3, closeTime, [2]xdr.Price{{N: 2, D: 3}, {N: 1, D: 1}})
+	// trade statistics are not updated until the buckets are backfilled
+	tt.Assert.NoError(q.UpdateTradeAggregationBucketsBackfilled(false))
+	tt.Assert.NoError(q.UpdateMarketStatsTrades(3, windowStart, nil))
+	tt.Assert.Empty(getAllMarketStats(tt, q))
+
+	tt.Assert.NoError(q.UpdateTradeAggregationBucketsBackfilled(true))
+	tt.Assert.NoError(q.UpdateMarketStatsTrades(3, windowStart, nil))
+	stats := assertMarketStatsTrades(tt, q, windowStart)
+	tt.Assert.ElementsMatch([]int64{2, 1}, tradeCounts(stats))
+
+	ingestTrades(4, closeTime.Add(2*time.Minute), [2]xdr.Price{{N: 1, D: 3}, {N: 5, D: 2}})
+	tt.Assert.NoError(q.UpdateMarketStatsTrades(4, windowStart, nil))
+	stats = assertMarketStatsTrades(tt, q, windowStart)
+	tt.Assert.ElementsMatch([]int64{4, 2}, tradeCounts(stats))
+
+	// trades of ledger 3 expire, they include neither the highest nor the
+	// lowest price of the first pair
+	windowStart = strtime.MillisFromSeconds(closeTime.Add(time.Minute).Unix())
+	ingestTrades(5, closeTime.Add(2*time.Hour), [2]xdr.Price{{N: 1, D: 2}, {N: 2, D: 1}})
+	tt.Assert.NoError(q.UpdateMarketStatsTrades(5, windowStart, nil))
+	stats = assertMarketStatsTrades(tt, q, windowStart)
+	tt.Assert.ElementsMatch([]int64{4, 2}, tradeCounts(stats))
+
+	// all trades expire
+	windowStart = strtime.MillisFromSeconds(closeTime.Add(3 * time.Hour).Unix())
+	tt.Assert.NoError(q.UpdateMarketStatsTrades(6, windowStart, nil))
+	stats = getAllMarketStats(tt, q)
+	tt.Assert.ElementsMatch([]int64{0, 0}, tradeCounts(stats))
+	tt.Assert.Equal("0", stats[0].BaseVolume)
+	tt.Assert.False(stats[0].OpenN.Valid)
+	tt.Assert.False(stats[0].HighN.Valid)
+
+	deleted, err := q.DeleteEmptyMarketStats()
+	tt.Assert.NoError(err)
+	tt.Assert.Equal(int64(2), deleted)
+}
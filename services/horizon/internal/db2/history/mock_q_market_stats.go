@@ -0,0 +1,37 @@
+package history
+
+import (
+	strtime "github.com/stellar/go/support/time"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockQMarketStats is a mock implementation of the QMarketStats interface
+type MockQMarketStats struct {
+	mock.Mock
+}
+
+func (m *MockQMarketStats) CreateAssets(assets []xdr.Asset, maxBatchSize int) (map[string]Asset, error) {
+	a := m.Called(assets, maxBatchSize)
+	return a.Get(0).(map[string]Asset), a.Error(1)
+}
+
+func (m *MockQMarketStats) UpdateMarketStatsOrderBook(ledger uint32, pairs []MarketStatsPair) error {
+	a := m.Called(ledger, pairs)
+	return a.Error(0)
+}
+
+func (m *MockQMarketStats) ResetMarketStatsOrderBook() error {
+	a := m.Called()
+	return a.Error(0)
+}
+
+func (m *MockQMarketStats) UpdateMarketStatsTrades(ledger uint32, windowStart strtime.Millis, pairs []MarketStatsPair) error {
+	a := m.Called(ledger, windowStart, pairs)
+	return a.Error(0)
+}
+
+func (m *MockQMarketStats) DeleteEmptyMarketStats() (int64, error) {
+	a := m.Called()
+	return a.Get(0).(int64), a.Error(1)
+}
@@ -24,6 +24,11 @@ func (m *MockQTrades) NewTradeBatchInsertBuilder(maxBatchSize int) TradeBatchIns
 	return a.Get(0).(TradeBatchInsertBuilder)
 }
 
+func (m *MockQTrades) UpsertTradeAggregationBuckets(ledger uint32) error {
+	a := m.Called(ledger)
+	return a.Error(0)
+}
+
 type MockTradeBatchInsertBuilder struct {
 	mock.Mock
 }
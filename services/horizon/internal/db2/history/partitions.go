@@ -0,0 +1,342 @@
+package history
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stellar/go/services/horizon/internal/toid"
+	"github.com/stellar/go/support/errors"
+)
+
+const (
+	historyPartitionSizeKey  = "history_partition_size"
+	historyPartitionStartKey = "history_partition_start"
+
+	legacyPartitionSuffix = "_legacy"
+)
+
+// historyTable is a history table with the column storing its toid. Tables in
+// partitionedHistoryTables can be stored in range partitions keyed by the toid
+// stored in idCol. Because the ledger sequence is the most significant part of
+// a toid, ranges of toids map to ranges of ledgers.
+type historyTable struct {
+	name  string
+	idCol string
+}
+
+var partitionedHistoryTables = []historyTable{
+	{name: "history_transactions", idCol: "id"},
+	{name: "history_operations", idCol: "id"},
+	{name: "history_effects", idCol: "history_operation_id"},
+	{name: "history_trades", idCol: "history_operation_id"},
+}
+
+// unpartitionedHistoryTables are the history tables cleared by DeleteRangeAll
+// which are not partitioned.
+var unpartitionedHistoryTables = []historyTable{
+	{name: "history_operation_participants", idCol: "history_operation_id"},
+	{name: "history_transaction_participants", idCol: "history_transaction_id"},
+	{name: "history_ledgers", idCol: "id"},
+}
+
+// HistoryPartitioning describes how history tables are partitioned. Rows for
+// ledgers lower than Start are kept in a single legacy partition (the table
+// which existed before partitioning was enabled). Ledgers starting from Start
+// are stored in partitions of Size ledgers each, aligned to multiples of Size.
+// A zero Size means history tables are not partitioned.
+type HistoryPartitioning struct {
+	Size  uint32
+	Start uint32
+}
+
+// Enabled returns true if history tables are partitioned.
+func (p HistoryPartitioning) Enabled() bool {
+	return p.Size > 0
+}
+
+// PartitionStart returns the first ledger of the partition containing the
+// given ledger.
+func (p HistoryPartitioning) PartitionStart(ledger uint32) uint32 {
+	return ledger - ledger%p.Size
+}
+
+// GetHistoryPartitioning returns the partitioning of history tables.
+func (q *Q) GetHistoryPartitioning() (HistoryPartitioning, error) {
+	var partitioning HistoryPartitioning
+
+	size, err := q.getValueFromStore(historyPartitionSizeKey, false)
+	if err != nil {
+		return partitioning, err
+	}
+	if size == "" {
+		return partitioning, nil
+	}
+
+	start, err := q.getValueFromStore(historyPartitionStartKey, false)
+	if err != nil {
+		return partitioning, err
+	}
+
+	parsed, err := strconv.ParseUint(size, 10, 32)
+	if err != nil {
+		return partitioning, errors.Wrap(err, "Error converting partition size value")
+	}
+	partitioning.Size = uint32(parsed)
+
+	parsed, err = strconv.ParseUint(start, 10, 32)
+	if err != nil {
+		return partitioning, errors.Wrap(err, "Error converting partition start value")
+	}
+	partitioning.Start = uint32(parsed)
+
+	return partitioning, nil
+}
+
+// PartitionHistoryTables converts the history tables into tables range
+// partitioned by ledger. The existing tables, with all their rows, are attached
+// as legacy partitions holding every ledger before the partition following
+// `latestLedger`, so no rows are copied. Partitions of `size` ledgers are used
+// for the following ledgers.
+//
+// It must be run in a transaction which holds the ingestion lock and requires
+// PostgreSQL 11 or newer.
+func (q *Q) PartitionHistoryTables(size, latestLedger uint32) error {
+	if size == 0 {
+		return errors.New("partition size must be greater than 0")
+	}
+
+	existing, err := q.GetHistoryPartitioning()
+	if err != nil {
+		return errors.Wrap(err, "could not get history partitioning")
+	}
+	if existing.Enabled() {
+		return errors.New("history tables are already partitioned")
+	}
+
+	partitioning := HistoryPartitioning{Size: size}
+	partitioning.Start = partitioning.PartitionStart(latestLedger) + size
+
+	for _, table := range partitionedHistoryTables {
+		if err = q.partitionHistoryTable(table, partitioning); err != nil {
+			return errors.Wrapf(err, "could not partition %s", table.name)
+		}
+	}
+
+	err = q.updateValueInStore(historyPartitionSizeKey, strconv.FormatUint(uint64(size), 10))
+	if err != nil {
+		return err
+	}
+	err = q.updateValueInStore(
+		historyPartitionStartKey,
+		strconv.FormatUint(uint64(partitioning.Start), 10),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = q.EnsureHistoryPartitions(partitioning.Start)
+	return err
+}
+
+func (q *Q) partitionHistoryTable(table historyTable, partitioning HistoryPartitioning) error {
+	legacyName := table.name + legacyPartitionSuffix
+
+	var indexes []struct {
+		Name       string `db:"indexname"`
+		Definition string `db:"indexdef"`
+	}
+	err := q.Select(&indexes, sq.Select("indexname", "indexdef").
+		From("pg_indexes").
+		Where(sq.Eq{"schemaname": "public", "tablename": table.name}))
+	if err != nil {
+		return errors.Wrap(err, "could not get indexes")
+	}
+
+	var foreignKeys []struct {
+		Name       string `db:"conname"`
+		Definition string `db:"condef"`
+	}
+	err = q.SelectRaw(&foreignKeys, `
+		SELECT conname, pg_get_constraintdef(oid) AS condef
+		FROM pg_constraint
+		WHERE conrelid = $1::regclass AND contype = 'f'`,
+		table.name,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not get foreign keys")
+	}
+
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", table.name, legacyName),
+	}
+	// index names are unique in a schema so the indexes of the legacy
+	// table need to be renamed before they can be created on the new table
+	for _, index := range indexes {
+		statements = append(statements, fmt.Sprintf(
+			"ALTER INDEX %s RENAME TO %s", index.Name, index.Name+legacyPartitionSuffix,
+		))
+	}
+	statements = append(statements, fmt.Sprintf(
+		"CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS) PARTITION BY RANGE (%s)",
+		table.name, legacyName, table.idCol,
+	))
+	for _, index := range indexes {
+		statements = append(statements, index.Definition)
+	}
+	for _, foreignKey := range foreignKeys {
+		statements = append(statements, fmt.Sprintf(
+			"ALTER TABLE %s ADD CONSTRAINT %s %s", table.name, foreignKey.Name, foreignKey.Definition,
+		))
+	}
+	// attaching the legacy table automatically attaches its indexes to the
+	// matching indexes of the partitioned table
+	statements = append(statements, fmt.Sprintf(
+		"ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM (MINVALUE) TO (%d)",
+		table.name, legacyName, ledgerToid(partitioning.Start),
+	))
+
+	for _, statement := range statements {
+		if _, err = q.ExecRaw(statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnsureHistoryPartitions creates the partitions of all partitioned history
+// tables which are required to store rows of the given ledger. It's a no-op if
+// history tables are not partitioned or the partitions already exist.
+//
+// Ledgers before Start are stored in the legacy partitions. Once a legacy
+// partition is dropped by the reaper, partitions of Size ledgers are created
+// for the old ledgers instead, so they can be reingested.
+//
+// It returns the range [from, to) of ledgers, including the given one, which
+// can be stored without creating more partitions.
+func (q *Q) EnsureHistoryPartitions(ledger uint32) (from uint32, to uint32, err error) {
+	partitioning, err := q.GetHistoryPartitioning()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "could not get history partitioning")
+	}
+	if !partitioning.Enabled() {
+		return 0, math.MaxUint32, nil
+	}
+
+	from, to = partitioning.PartitionStart(ledger), partitioning.PartitionStart(ledger)+partitioning.Size
+	legacyPartitions := 0
+	for _, table := range partitionedHistoryTables {
+		if ledger < partitioning.Start {
+			var exists bool
+			err = q.GetRaw(
+				&exists,
+				"SELECT to_regclass($1) IS NOT NULL",
+				table.name+legacyPartitionSuffix,
+			)
+			if err != nil {
+				return 0, 0, errors.Wrapf(err, "could not check legacy partition of %s", table.name)
+			}
+			if exists {
+				legacyPartitions++
+				continue
+			}
+		}
+
+		_, err = q.ExecRaw(fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM (%d) TO (%d)",
+			historyPartitionName(table.name, from),
+			table.name,
+			ledgerToid(from),
+			ledgerToid(to),
+		))
+		if err != nil {
+			return 0, 0, errors.Wrapf(err, "could not create partition of %s", table.name)
+		}
+	}
+
+	if legacyPartitions == len(partitionedHistoryTables) {
+		return 0, partitioning.Start, nil
+	}
+	return from, to, nil
+}
+
+// DeleteUnpartitionedHistoryRange removes the rows of history tables which
+// are not partitioned in the given toid range. Partitioned history tables are
+// reaped with DropHistoryPartitionsBefore instead.
+func (q *Q) DeleteUnpartitionedHistoryRange(start, end int64) error {
+	for _, table := range unpartitionedHistoryTables {
+		if err := q.DeleteRange(start, end, table.name, table.idCol); err != nil {
+			return errors.Wrapf(err, "Error clearing %s", table.name)
+		}
+	}
+	return nil
+}
+
+// DropHistoryPartitionsBefore drops all partitions of the partitioned history
+// tables which contain only ledgers lower than the given ledger. It returns the
+// first ledger which is still stored in the partitioned tables, or 0 if no
+// partitions were dropped.
+func (q *Q) DropHistoryPartitionsBefore(ledger uint32) (uint32, error) {
+	partitioning, err := q.GetHistoryPartitioning()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get history partitioning")
+	}
+	if !partitioning.Enabled() {
+		return 0, errors.New("history tables are not partitioned")
+	}
+
+	var elder uint32
+	for _, table := range partitionedHistoryTables {
+		var partitions []string
+		err = q.SelectRaw(&partitions, `
+			SELECT child.relname
+			FROM pg_inherits
+			JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+			JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+			WHERE parent.relname = $1`,
+			table.name,
+		)
+		if err != nil {
+			return 0, errors.Wrapf(err, "could not get partitions of %s", table.name)
+		}
+
+		for _, partition := range partitions {
+			var end uint32
+			if partition == table.name+legacyPartitionSuffix {
+				end = partitioning.Start
+			} else {
+				start, parseErr := strconv.ParseUint(
+					strings.TrimPrefix(partition, table.name+"_p"), 10, 32,
+				)
+				if parseErr != nil {
+					return 0, errors.Wrapf(parseErr, "unexpected partition %s", partition)
+				}
+				end = uint32(start) + partitioning.Size
+			}
+
+			if end > ledger {
+				continue
+			}
+
+			if _, err = q.ExecRaw(fmt.Sprintf("DROP TABLE %s", partition)); err != nil {
+				return 0, errors.Wrapf(err, "could not drop partition %s", partition)
+			}
+			if end > elder {
+				elder = end
+			}
+		}
+	}
+
+	return elder, nil
+}
+
+func historyPartitionName(table string, start uint32) string {
+	return fmt.Sprintf("%s_p%d", table, start)
+}
+
+func ledgerToid(ledger uint32) int64 {
+	return toid.New(int32(ledger), 0, 0).ToInt64()
+}
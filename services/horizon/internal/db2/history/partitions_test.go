@@ -0,0 +1,128 @@
+package history
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stellar/go/services/horizon/internal/db2"
+	"github.com/stellar/go/services/horizon/internal/test"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryPartitioning(t *testing.T) {
+	partitioning := HistoryPartitioning{}
+	assert.False(t, partitioning.Enabled())
+
+	partitioning = HistoryPartitioning{Size: 1000, Start: 3000}
+	assert.True(t, partitioning.Enabled())
+	assert.Equal(t, uint32(0), partitioning.PartitionStart(999))
+	assert.Equal(t, uint32(3000), partitioning.PartitionStart(3000))
+	assert.Equal(t, uint32(3000), partitioning.PartitionStart(3999))
+	assert.Equal(t, uint32(4000), partitioning.PartitionStart(4000))
+
+	assert.Equal(t, "history_effects_p4000", historyPartitionName("history_effects", 4000))
+	assert.Equal(t, int64(4000)<<32, ledgerToid(4000))
+}
+
+func historyPartitions(tt *test.T, q *Q, table string) []string {
+	var partitions []string
+	tt.Assert.NoError(q.SelectRaw(&partitions, `
+		SELECT child.relname
+		FROM pg_inherits
+		JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+		JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		WHERE parent.relname = $1
+		ORDER BY child.relname`,
+		table,
+	))
+	return partitions
+}
+
+func TestPartitionHistoryTables(t *testing.T) {
+	tt := test.Start(t)
+	defer tt.Finish()
+	test.ResetHorizonDB(t, tt.HorizonDB)
+	q := &Q{tt.HorizonSession()}
+
+	from, to, err := q.EnsureHistoryPartitions(2500)
+	tt.Assert.NoError(err)
+	tt.Assert.Equal(uint32(0), from)
+	tt.Assert.Equal(uint32(math.MaxUint32), to)
+
+	addresses := []string{
+		"GB2QIYT2IAUFMRXKLSLLPRECC6OCOGJMADSPTRK7TGNT2SFR2YGWDARD",
+		"GAXMF43TGZHW3QN3REOUA2U5PW5BTARXGGYJ3JIFHW3YT6QRKRL3CPPU",
+	}
+	accountIDs, assetIDs := createAccountsAndAssets(
+		tt, q,
+		addresses,
+		[]xdr.Asset{eurAsset, usdAsset, nativeAsset},
+	)
+	first, second, third := createInsertTrades(accountIDs, assetIDs, 2500)
+	builder := q.NewTradeBatchInsertBuilder(0)
+	tt.Assert.NoError(builder.Add(first, second, third))
+	tt.Assert.NoError(builder.Exec())
+
+	tt.Assert.NoError(q.PartitionHistoryTables(1000, 2500))
+	partitioning, err := q.GetHistoryPartitioning()
+	tt.Assert.NoError(err)
+	tt.Assert.Equal(HistoryPartitioning{Size: 1000, Start: 3000}, partitioning)
+	tt.Assert.EqualError(
+		q.PartitionHistoryTables(1000, 2500),
+		"history tables are already partitioned",
+	)
+
+	for _, table := range partitionedHistoryTables {
+		tt.Assert.Equal(
+			[]string{table.name + "_legacy", table.name + "_p3000"},
+			historyPartitions(tt, q, table.name),
+		)
+	}
+
+	// legacy partitions store ledgers before Start
+	from, to, err = q.EnsureHistoryPartitions(10)
+	tt.Assert.NoError(err)
+	tt.Assert.Equal(uint32(0), from)
+	tt.Assert.Equal(uint32(3000), to)
+
+	from, to, err = q.EnsureHistoryPartitions(4500)
+	tt.Assert.NoError(err)
+	tt.Assert.Equal(uint32(4000), from)
+	tt.Assert.Equal(uint32(5000), to)
+
+	first, second, third = createInsertTrades(accountIDs, assetIDs, 4500)
+	builder = q.NewTradeBatchInsertBuilder(0)
+	tt.Assert.NoError(builder.Add(first, second, third))
+	tt.Assert.NoError(builder.Exec())
+
+	var trades []Trade
+	tt.Assert.NoError(q.Trades().Page(db2.MustPageQuery("", false, "asc", 100)).Select(&trades))
+	tt.Assert.Len(trades, 6)
+
+	elder, err := q.DropHistoryPartitionsBefore(4500)
+	tt.Assert.NoError(err)
+	tt.Assert.Equal(uint32(4000), elder)
+	tt.Assert.Equal(
+		[]string{"history_trades_p4000"},
+		historyPartitions(tt, q, "history_trades"),
+	)
+	tt.Assert.NoError(q.Trades().Page(db2.MustPageQuery("", false, "asc", 100)).Select(&trades))
+	tt.Assert.Len(trades, 3)
+
+	// partitions are created to reingest ledgers of the dropped legacy
+	// partitions
+	from, to, err = q.EnsureHistoryPartitions(2500)
+	tt.Assert.NoError(err)
+	tt.Assert.Equal(uint32(2000), from)
+	tt.Assert.Equal(uint32(3000), to)
+
+	first, second, third = createInsertTrades(accountIDs, assetIDs, 2500)
+	builder = q.NewTradeBatchInsertBuilder(0)
+	tt.Assert.NoError(builder.Add(first, second, third))
+	tt.Assert.NoError(builder.Exec())
+	tt.Assert.Equal(
+		[]string{"history_trades_p2000", "history_trades_p4000"},
+		historyPartitions(tt, q, "history_trades"),
+	)
+}
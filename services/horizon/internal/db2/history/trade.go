@@ -270,4 +270,5 @@ type QTrades interface {
 	QCreateAccountsHistory
 	NewTradeBatchInsertBuilder(maxBatchSize int) TradeBatchInsertBuilder
 	CreateAssets(assets []xdr.Asset, maxBatchSize int) (map[string]Asset, error)
+	UpsertTradeAggregationBuckets(ledger uint32) error
 }
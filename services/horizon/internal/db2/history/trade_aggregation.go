@@ -2,10 +2,13 @@ package history
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/guregu/null"
 	"github.com/stellar/go/services/horizon/internal/db2"
+	"github.com/stellar/go/services/horizon/internal/toid"
 	"github.com/stellar/go/support/errors"
 	strtime "github.com/stellar/go/support/time"
 	"github.com/stellar/go/xdr"
@@ -22,6 +25,14 @@ var AllowedResolutions = map[time.Duration]struct{}{
 	time.Hour * 24 * 7: {}, //week
 }
 
+// tradeAggregationBucketResolutions lists, from the coarsest to the finest, the
+// resolutions for which trades are pre-aggregated during ingestion into the
+// `history_trades_<resolution>` tables.
+var tradeAggregationBucketResolutions = []int64{
+	int64(time.Hour / time.Millisecond),
+	int64(time.Minute / time.Millisecond),
+}
+
 // StrictResolutionFiltering represents a simple feature flag to determine whether only
 // predetermined resolutions of trade aggregations are allowed.
 var StrictResolutionFiltering = true
@@ -69,6 +80,7 @@ type TradeAggregationsQ struct {
 	startTime      strtime.Millis
 	endTime        strtime.Millis
 	pagingParams   db2.PageQuery
+	useBuckets     bool
 }
 
 // GetTradeAggregationsQ initializes a TradeAggregationsQ query builder based on the required parameters
@@ -137,11 +149,24 @@ func (q *TradeAggregationsQ) WithEndTime(endTime strtime.Millis) (*TradeAggregat
 	}
 }
 
+// WithBuckets makes the query merge the pre-aggregated trade buckets instead
+// of scanning the `history_trades` table, when buckets can be used for the
+// resolution and offset. It must only be used once the buckets were
+// backfilled, see GetTradeAggregationBucketsBackfilled.
+func (q *TradeAggregationsQ) WithBuckets() *TradeAggregationsQ {
+	q.useBuckets = true
+	return q
+}
+
 // GetSql generates a sql statement to aggregate Trades based on given parameters
 func (q *TradeAggregationsQ) GetSql() sq.SelectBuilder {
 	var orderPreserved bool
 	orderPreserved, q.baseAssetID, q.counterAssetID = getCanonicalAssetOrder(q.baseAssetID, q.counterAssetID)
 
+	if bucketResolution := tradeAggregationBucketResolutionFor(q.resolution, q.offset); q.useBuckets && bucketResolution > 0 {
+		return q.getBucketsSql(orderPreserved, bucketResolution)
+	}
+
 	var bucketSQL sq.SelectBuilder
 	if orderPreserved {
 		bucketSQL = bucketTrades(q.resolution, q.offset)
@@ -184,6 +209,365 @@ func (q *TradeAggregationsQ) GetSql() sq.SelectBuilder {
 		OrderBy("timestamp " + q.pagingParams.Order)
 }
 
+// getBucketsSql generates a sql statement to aggregate trades by merging the
+// pre-aggregated buckets of the given resolution instead of scanning the
+// `history_trades` table.
+func (q *TradeAggregationsQ) getBucketsSql(orderPreserved bool, bucketResolution int64) sq.SelectBuilder {
+	var bucketSQL sq.SelectBuilder
+	if orderPreserved {
+		bucketSQL = selectTradeAggregationBuckets(q.resolution, q.offset)
+	} else {
+		bucketSQL = selectReverseTradeAggregationBuckets(q.resolution, q.offset)
+	}
+
+	bucketSQL = bucketSQL.From(tradeAggregationBucketTable(bucketResolution)).
+		Where(sq.Eq{"base_asset_id": q.baseAssetID, "counter_asset_id": q.counterAssetID})
+
+	// bucket timestamps are aligned to the bucket resolution, which divides
+	// both the requested resolution and offset, so no bucket straddles the
+	// time range boundaries.
+	bucketSQL = bucketSQL.Where(sq.GtOrEq{"\"timestamp\"": q.startTime.ToInt64()})
+	if !q.endTime.IsNil() {
+		bucketSQL = bucketSQL.Where(sq.Lt{"\"timestamp\"": q.endTime.ToInt64()})
+	}
+
+	//ensure open/close order when merging buckets
+	bucketSQL = bucketSQL.OrderBy("open_ledger_toid")
+
+	return sq.Select(
+		"timestamp",
+		"sum(count) as count",
+		"sum(base_volume) as base_volume",
+		"sum(counter_volume) as counter_volume",
+		"sum(counter_volume)/sum(base_volume) as avg",
+		"(max_price(high_price))[1] as high_n",
+		"(max_price(high_price))[2] as high_d",
+		"(min_price(low_price))[1] as low_n",
+		"(min_price(low_price))[2] as low_d",
+		"(first(open_price))[1] as open_n",
+		"(first(open_price))[2] as open_d",
+		"(last(close_price))[1] as close_n",
+		"(last(close_price))[2] as close_d",
+	).
+		FromSelect(bucketSQL, "htrd").
+		GroupBy("timestamp").
+		Limit(q.pagingParams.Limit).
+		OrderBy("timestamp " + q.pagingParams.Order)
+}
+
+// UpsertTradeAggregationBuckets adds the trades of the given ledger to the
+// pre-aggregated buckets of every resolution. It must be called once per
+// ledger, after the trades were inserted into `history_trades`.
+func (q *Q) UpsertTradeAggregationBuckets(ledger uint32) error {
+	start, end, err := toid.LedgerRangeInclusive(int32(ledger), int32(ledger))
+	if err != nil {
+		return errors.Wrap(err, "could not get ledger toid range")
+	}
+
+	for _, resolution := range tradeAggregationBucketResolutions {
+		tradesSQL := bucketTrades(resolution, 0).
+			From("history_trades").
+			Where(sq.GtOrEq{"history_operation_id": start}).
+			Where(sq.Lt{"history_operation_id": end}).
+			OrderBy("history_operation_id", "\"order\"")
+
+		table := tradeAggregationBucketTable(resolution)
+		if _, err = q.Exec(insertTradeAggregationBuckets(table, tradesSQL)); err != nil {
+			return errors.Wrapf(err, "could not upsert buckets into %s", table)
+		}
+	}
+
+	return nil
+}
+
+// RebuildTradeAggregationBuckets rebuilds the pre-aggregated trade buckets
+// covering all the ledgers in the [fromLedger, toLedger] range. It is used
+// after reingesting history and to backfill the buckets of existing history.
+func (q *Q) RebuildTradeAggregationBuckets(fromLedger, toLedger uint32) error {
+	var closedAt struct {
+		From null.Time `db:"from_closed_at"`
+		To   null.Time `db:"to_closed_at"`
+	}
+	err := q.Get(&closedAt, sq.Select(
+		"min(closed_at) as from_closed_at",
+		"max(closed_at) as to_closed_at",
+	).From("history_ledgers").
+		Where(sq.GtOrEq{"sequence": fromLedger}).
+		Where(sq.LtOrEq{"sequence": toLedger}))
+	if err != nil {
+		return errors.Wrap(err, "could not get ledgers close time")
+	}
+
+	// no ledgers in the range, nothing to rebuild
+	if !closedAt.From.Valid || !closedAt.To.Valid {
+		return nil
+	}
+
+	return q.RebuildTradeAggregationTimes(
+		strtime.MillisFromSeconds(closedAt.From.Time.Unix()),
+		strtime.MillisFromSeconds(closedAt.To.Time.Unix()),
+	)
+}
+
+// RebuildTradeAggregationTimes rebuilds the pre-aggregated trade buckets of
+// every resolution which overlap the [from, to] time range. The finest buckets
+// are aggregated from `history_trades`, coarser ones from the buckets of the
+// next finer resolution, so they rely on these being correct for the whole
+// coarser bucket.
+//
+// It must be called in a transaction. The buckets tables are locked until the
+// transaction ends, so concurrent upserts of new ledgers wait for the rebuild
+// instead of being counted twice by the separate delete and insert statements.
+func (q *Q) RebuildTradeAggregationTimes(from, to strtime.Millis) error {
+	if q.GetTx() == nil {
+		return errors.New("cannot be called outside of a transaction")
+	}
+
+	tables := make([]string, len(tradeAggregationBucketResolutions))
+	for i, resolution := range tradeAggregationBucketResolutions {
+		tables[i] = tradeAggregationBucketTable(resolution)
+	}
+	// SHARE ROW EXCLUSIVE conflicts with the ROW EXCLUSIVE lock taken by
+	// upserts and with itself, but not with reads.
+	_, err := q.ExecRaw(fmt.Sprintf(
+		"LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE",
+		strings.Join(tables, ", "),
+	))
+	if err != nil {
+		return errors.Wrap(err, "could not lock buckets tables")
+	}
+
+	for i := len(tradeAggregationBucketResolutions) - 1; i >= 0; i-- {
+		resolution := tradeAggregationBucketResolutions[i]
+		table := tables[i]
+		start := from.RoundDown(resolution)
+		end := to.RoundDown(resolution) + strtime.Millis(resolution)
+
+		_, err = q.Exec(sq.Delete(table).
+			Where(sq.GtOrEq{"\"timestamp\"": start.ToInt64()}).
+			Where(sq.Lt{"\"timestamp\"": end.ToInt64()}))
+		if err != nil {
+			return errors.Wrapf(err, "could not delete buckets from %s", table)
+		}
+
+		var insertSQL sq.SelectBuilder
+		if i == len(tradeAggregationBucketResolutions)-1 {
+			tradesSQL := bucketTrades(resolution, 0).
+				From("history_trades").
+				Where(sq.GtOrEq{"ledger_closed_at": start.ToTime()}).
+				Where(sq.Lt{"ledger_closed_at": end.ToTime()}).
+				OrderBy("history_operation_id", "\"order\"")
+			insertSQL = insertTradeAggregationBuckets(table, tradesSQL)
+		} else {
+			insertSQL = mergeFinerTradeAggregationBuckets(table, resolution, tables[i+1], start, end)
+		}
+
+		if _, err = q.Exec(insertSQL); err != nil {
+			return errors.Wrapf(err, "could not insert buckets into %s", table)
+		}
+	}
+
+	return nil
+}
+
+// DeleteTradeAggregationBucketsBefore removes the pre-aggregated trade buckets
+// which end before the close time of the given ledger, it's used when history
+// is reaped. Buckets containing both reaped and retained trades are kept, so
+// aggregations over the reaped boundary include trades which are no longer
+// in `history_trades` and differ from the ones computed without buckets.
+func (q *Q) DeleteTradeAggregationBucketsBefore(ledger uint32) error {
+	var closedAt null.Time
+	err := q.Get(&closedAt, sq.Select("min(closed_at)").
+		From("history_ledgers").
+		Where(sq.GtOrEq{"sequence": ledger}))
+	if err != nil {
+		return errors.Wrap(err, "could not get ledger close time")
+	}
+	if !closedAt.Valid {
+		return nil
+	}
+
+	closeTime := strtime.MillisFromSeconds(closedAt.Time.Unix())
+	for _, resolution := range tradeAggregationBucketResolutions {
+		table := tradeAggregationBucketTable(resolution)
+		_, err = q.Exec(sq.Delete(table).
+			Where(sq.Lt{"\"timestamp\"": closeTime.RoundDown(resolution).ToInt64()}))
+		if err != nil {
+			return errors.Wrapf(err, "could not delete buckets from %s", table)
+		}
+	}
+
+	return nil
+}
+
+// insertTradeAggregationBuckets generates a statement aggregating trades
+// selected by tradesSQL (a bucketTrades select ordered by history_operation_id
+// and order) into the given buckets table. Trades of existing buckets are
+// merged with the new ones.
+func insertTradeAggregationBuckets(table string, tradesSQL sq.SelectBuilder) sq.SelectBuilder {
+	return sq.Select(
+		"timestamp",
+		"base_asset_id",
+		"counter_asset_id",
+		"count(*)",
+		"sum(base_amount)",
+		"sum(counter_amount)",
+		"(max_price(price))[1]",
+		"(max_price(price))[2]",
+		"(min_price(price))[1]",
+		"(min_price(price))[2]",
+		"first(history_operation_id)",
+		"(first(price))[1]",
+		"(first(price))[2]",
+		"last(history_operation_id)",
+		"(last(price))[1]",
+		"(last(price))[2]",
+	).
+		FromSelect(tradesSQL, "htrd").
+		GroupBy("base_asset_id", "counter_asset_id", "timestamp").
+		Prefix(fmt.Sprintf(
+			"INSERT INTO %s AS b (\"timestamp\", base_asset_id, counter_asset_id, count, "+
+				"base_volume, counter_volume, high_n, high_d, low_n, low_d, "+
+				"open_ledger_toid, open_n, open_d, close_ledger_toid, close_n, close_d)",
+			table,
+		)).
+		Suffix(mergeTradeAggregationBuckets)
+}
+
+// mergeFinerTradeAggregationBuckets generates a statement aggregating the
+// buckets of finerTable with a timestamp in the [start, end) range into
+// buckets of the given resolution in table.
+func mergeFinerTradeAggregationBuckets(
+	table string, resolution int64, finerTable string, start, end strtime.Millis,
+) sq.SelectBuilder {
+	bucketSQL := sq.Select(
+		formatBucketTimestampColumnSelect(resolution, 0),
+		"base_asset_id",
+		"counter_asset_id",
+		"count",
+		"base_volume",
+		"counter_volume",
+		"ARRAY[high_n, high_d] as high_price",
+		"ARRAY[low_n, low_d] as low_price",
+		"open_ledger_toid",
+		"ARRAY[open_n, open_d] as open_price",
+		"close_ledger_toid",
+		"ARRAY[close_n, close_d] as close_price",
+	).
+		From(finerTable).
+		Where(sq.GtOrEq{"\"timestamp\"": start.ToInt64()}).
+		Where(sq.Lt{"\"timestamp\"": end.ToInt64()}).
+		// buckets of a pair don't overlap, ordering by open also orders by close
+		OrderBy("open_ledger_toid")
+
+	return sq.Select(
+		"timestamp",
+		"base_asset_id",
+		"counter_asset_id",
+		"sum(count)",
+		"sum(base_volume)",
+		"sum(counter_volume)",
+		"(max_price(high_price))[1]",
+		"(max_price(high_price))[2]",
+		"(min_price(low_price))[1]",
+		"(min_price(low_price))[2]",
+		"min(open_ledger_toid)",
+		"(first(open_price))[1]",
+		"(first(open_price))[2]",
+		"max(close_ledger_toid)",
+		"(last(close_price))[1]",
+		"(last(close_price))[2]",
+	).
+		FromSelect(bucketSQL, "htrd").
+		GroupBy("base_asset_id", "counter_asset_id", "timestamp").
+		Prefix(fmt.Sprintf(
+			"INSERT INTO %s AS b (\"timestamp\", base_asset_id, counter_asset_id, count, "+
+				"base_volume, counter_volume, high_n, high_d, low_n, low_d, "+
+				"open_ledger_toid, open_n, open_d, close_ledger_toid, close_n, close_d)",
+			table,
+		)).
+		Suffix(mergeTradeAggregationBuckets)
+}
+
+// mergeTradeAggregationBuckets merges a bucket with the existing bucket of
+// the same asset pair and timestamp. Prices are compared as fractions, open
+// and close prices are taken from the bucket with the lowest open and the
+// highest close operation.
+const mergeTradeAggregationBuckets = `ON CONFLICT (base_asset_id, counter_asset_id, "timestamp") DO UPDATE SET
+	count = b.count + EXCLUDED.count,
+	base_volume = b.base_volume + EXCLUDED.base_volume,
+	counter_volume = b.counter_volume + EXCLUDED.counter_volume,
+	high_n = CASE WHEN EXCLUDED.high_n * b.high_d > b.high_n * EXCLUDED.high_d THEN EXCLUDED.high_n ELSE b.high_n END,
+	high_d = CASE WHEN EXCLUDED.high_n * b.high_d > b.high_n * EXCLUDED.high_d THEN EXCLUDED.high_d ELSE b.high_d END,
+	low_n = CASE WHEN EXCLUDED.low_n * b.low_d < b.low_n * EXCLUDED.low_d THEN EXCLUDED.low_n ELSE b.low_n END,
+	low_d = CASE WHEN EXCLUDED.low_n * b.low_d < b.low_n * EXCLUDED.low_d THEN EXCLUDED.low_d ELSE b.low_d END,
+	open_ledger_toid = LEAST(b.open_ledger_toid, EXCLUDED.open_ledger_toid),
+	open_n = CASE WHEN EXCLUDED.open_ledger_toid < b.open_ledger_toid THEN EXCLUDED.open_n ELSE b.open_n END,
+	open_d = CASE WHEN EXCLUDED.open_ledger_toid < b.open_ledger_toid THEN EXCLUDED.open_d ELSE b.open_d END,
+	close_ledger_toid = GREATEST(b.close_ledger_toid, EXCLUDED.close_ledger_toid),
+	close_n = CASE WHEN EXCLUDED.close_ledger_toid > b.close_ledger_toid THEN EXCLUDED.close_n ELSE b.close_n END,
+	close_d = CASE WHEN EXCLUDED.close_ledger_toid > b.close_ledger_toid THEN EXCLUDED.close_d ELSE b.close_d END`
+
+// tradeAggregationBucketTable returns the name of the table holding trades
+// pre-aggregated into buckets of the given resolution.
+func tradeAggregationBucketTable(resolution int64) string {
+	return fmt.Sprintf("history_trades_%d", resolution)
+}
+
+// tradeAggregationBucketResolutionFor returns the coarsest pre-aggregated
+// resolution which can be merged into buckets of the given resolution and
+// offset. It returns 0 when no such resolution exists and the trades have to be
+// aggregated from the `history_trades` table.
+func tradeAggregationBucketResolutionFor(resolution int64, offset int64) int64 {
+	for _, bucketResolution := range tradeAggregationBucketResolutions {
+		if resolution%bucketResolution == 0 && offset%bucketResolution == 0 {
+			return bucketResolution
+		}
+	}
+	return 0
+}
+
+// selectTradeAggregationBuckets generates a select statement to read rows from a
+// `history_trades_<resolution>` table, with a timestamp rounded to resolution.
+func selectTradeAggregationBuckets(resolution int64, offset int64) sq.SelectBuilder {
+	return sq.Select(
+		formatBucketTimestampColumnSelect(resolution, offset),
+		"open_ledger_toid",
+		"count",
+		"base_volume",
+		"counter_volume",
+		"ARRAY[high_n, high_d] as high_price",
+		"ARRAY[low_n, low_d] as low_price",
+		"ARRAY[open_n, open_d] as open_price",
+		"ARRAY[close_n, close_d] as close_price",
+	)
+}
+
+// selectReverseTradeAggregationBuckets generates a select statement to read rows
+// from a `history_trades_<resolution>` table, with a timestamp rounded to
+// resolution and reversed base/counter.
+func selectReverseTradeAggregationBuckets(resolution int64, offset int64) sq.SelectBuilder {
+	return sq.Select(
+		formatBucketTimestampColumnSelect(resolution, offset),
+		"open_ledger_toid",
+		"count",
+		"counter_volume as base_volume",
+		"base_volume as counter_volume",
+		// inverting the prices swaps the highest and the lowest one
+		"ARRAY[low_d, low_n] as high_price",
+		"ARRAY[high_d, high_n] as low_price",
+		"ARRAY[open_d, open_n] as open_price",
+		"ARRAY[close_d, close_n] as close_price",
+	)
+}
+
+// formatBucketTimestampColumnSelect is the equivalent of
+// formatBucketTimestampSelect for tables which already store bucket timestamps.
+func formatBucketTimestampColumnSelect(resolution int64, offset int64) string {
+	return fmt.Sprintf("div((\"timestamp\" - %d), %d)*%d + %d as timestamp",
+		offset, resolution, resolution, offset)
+}
+
 // formatBucketTimestampSelect formats a sql select clause for a bucketed timestamp, based on given resolution
 // and the offset. Given a time t, it gives it a timestamp defined by
 // f(t) = ((t - offset)/resolution)*resolution + offset.
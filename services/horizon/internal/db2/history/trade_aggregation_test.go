@@ -0,0 +1,248 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stellar/go/services/horizon/internal/db2"
+	"github.com/stellar/go/services/horizon/internal/test"
+	"github.com/stellar/go/services/horizon/internal/toid"
+	strtime "github.com/stellar/go/support/time"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTradeAggregationBucketResolutionFor(t *testing.T) {
+	const (
+		minute = int64(60000)
+		hour   = 60 * minute
+		day    = 24 * hour
+	)
+
+	for _, testCase := range []struct {
+		resolution int64
+		offset     int64
+		expected   int64
+	}{
+		{minute, 0, minute},
+		{5 * minute, 0, minute},
+		{15 * minute, 0, minute},
+		{hour, 0, hour},
+		{hour, hour, hour},
+		{day, 0, hour},
+		{day, 3 * hour, hour},
+		{7 * day, 0, hour},
+		{90 * minute, 0, minute},
+		{1000, 0, 0},
+	} {
+		assert.Equal(
+			t,
+			testCase.expected,
+			tradeAggregationBucketResolutionFor(testCase.resolution, testCase.offset),
+		)
+	}
+}
+
+func TestTradeAggregationsQUsesBuckets(t *testing.T) {
+	q := &Q{}
+	pageQuery := db2.PageQuery{Order: "asc", Limit: 10}
+
+	aggregationsQ, err := q.GetTradeAggregationsQ(1, 2, 86400000, 3600000, pageQuery)
+	assert.NoError(t, err)
+	sql, _, err := aggregationsQ.GetSql().ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, "FROM history_trades ")
+
+	aggregationsQ, err = q.GetTradeAggregationsQ(1, 2, 86400000, 3600000, pageQuery)
+	assert.NoError(t, err)
+	sql, _, err = aggregationsQ.WithBuckets().GetSql().ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, "FROM history_trades_3600000")
+
+	aggregationsQ, err = q.GetTradeAggregationsQ(2, 1, 300000, 0, pageQuery)
+	assert.NoError(t, err)
+	sql, _, err = aggregationsQ.WithBuckets().GetSql().ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, "FROM history_trades_60000")
+	assert.Contains(t, sql, "ARRAY[low_d, low_n] as high_price")
+}
+
+// tradeAggregationsTestCloseTime is a close time in the middle of an hour.
+var tradeAggregationsTestCloseTime = time.Unix(1599998400+10*60, 0).UTC()
+
+func insertTradeAggregationsTestTrades(tt *test.T, q *Q) []int64 {
+	addresses := []string{
+		"GB2QIYT2IAUFMRXKLSLLPRECC6OCOGJMADSPTRK7TGNT2SFR2YGWDARD",
+		"GAXMF43TGZHW3QN3REOUA2U5PW5BTARXGGYJ3JIFHW3YT6QRKRL3CPPU",
+	}
+	accountIDs, assetIDs := createAccountsAndAssets(
+		tt, q,
+		addresses,
+		[]xdr.Asset{eurAsset, usdAsset, nativeAsset},
+	)
+
+	builder := q.NewTradeBatchInsertBuilder(0)
+	// ledgers 3 and 4 close in the same minute, ledger 5 two hours later
+	for i, closeTime := range []time.Time{
+		tradeAggregationsTestCloseTime,
+		tradeAggregationsTestCloseTime.Add(5 * time.Second),
+		tradeAggregationsTestCloseTime.Add(2 * time.Hour),
+	} {
+		first, second, third := createInsertTrades(accountIDs, assetIDs, int32(3+i))
+		first.SellPrice = xdr.Price{N: xdr.Int32(1 + i), D: 3}
+		second.SellPrice = xdr.Price{N: 5, D: xdr.Int32(2 + i)}
+		for _, trade := range []*InsertTrade{&first, &second, &third} {
+			trade.LedgerCloseTime = closeTime
+		}
+		tt.Assert.NoError(builder.Add(first, second, third))
+	}
+	tt.Assert.NoError(builder.Exec())
+
+	return assetIDs
+}
+
+func insertTradeAggregationsTestLedgers(tt *test.T, q *Q) {
+	for i, closeTime := range []time.Time{
+		tradeAggregationsTestCloseTime,
+		tradeAggregationsTestCloseTime.Add(5 * time.Second),
+		tradeAggregationsTestCloseTime.Add(2 * time.Hour),
+	} {
+		sequence := uint32(3 + i)
+		_, err := q.InsertLedger(xdr.LedgerHeaderHistoryEntry{
+			Hash: xdr.Hash{byte(sequence)},
+			Header: xdr.LedgerHeader{
+				LedgerSeq:          xdr.Uint32(sequence),
+				PreviousLedgerHash: xdr.Hash{byte(sequence - 1), 1},
+				ScpValue: xdr.StellarValue{
+					CloseTime: xdr.TimePoint(closeTime.Unix()),
+				},
+			},
+		}, 0, 0, 0, 0, 1)
+		tt.Assert.NoError(err)
+	}
+}
+
+// assertTradeAggregationBuckets checks that aggregating the buckets gives the
+// same results as aggregating history_trades.
+func assertTradeAggregationBuckets(tt *test.T, q *Q, assetIDs []int64) {
+	pageQuery := db2.PageQuery{Order: "asc", Limit: 100}
+	for _, pair := range [][2]int64{
+		{assetIDs[0], assetIDs[1]},
+		{assetIDs[1], assetIDs[0]},
+		{assetIDs[2], assetIDs[1]},
+	} {
+		for _, resolution := range []int64{60000, 300000, 3600000, 86400000} {
+			var expected, actual []TradeAggregation
+
+			aggregationsQ, err := q.GetTradeAggregationsQ(pair[0], pair[1], resolution, 0, pageQuery)
+			tt.Assert.NoError(err)
+			tt.Assert.NoError(q.Select(&expected, aggregationsQ.GetSql()))
+
+			aggregationsQ, err = q.GetTradeAggregationsQ(pair[0], pair[1], resolution, 0, pageQuery)
+			tt.Assert.NoError(err)
+			tt.Assert.NoError(q.Select(&actual, aggregationsQ.WithBuckets().GetSql()))
+
+			tt.Assert.NotEmpty(expected)
+			tt.Assert.Equal(expected, actual)
+		}
+	}
+}
+
+func countTradeAggregationBuckets(tt *test.T, q *Q, resolution int64) int {
+	var count int
+	tt.Assert.NoError(q.GetRaw(&count, "SELECT count(*) FROM "+tradeAggregationBucketTable(resolution)))
+	return count
+}
+
+func TestUpsertTradeAggregationBuckets(t *testing.T) {
+	tt := test.Start(t)
+	defer tt.Finish()
+	test.ResetHorizonDB(t, tt.HorizonDB)
+	q := &Q{tt.HorizonSession()}
+
+	assetIDs := insertTradeAggregationsTestTrades(tt, q)
+	for ledger := uint32(3); ledger <= 5; ledger++ {
+		tt.Assert.NoError(q.UpsertTradeAggregationBuckets(ledger))
+	}
+
+	// trades of ledgers 3 and 4 are merged into the same buckets
+	tt.Assert.Equal(4, countTradeAggregationBuckets(tt, q, 60000))
+	tt.Assert.Equal(4, countTradeAggregationBuckets(tt, q, 3600000))
+	assertTradeAggregationBuckets(tt, q, assetIDs)
+
+	var bucket struct {
+		Count           int64 `db:"count"`
+		OpenLedgerToid  int64 `db:"open_ledger_toid"`
+		CloseLedgerToid int64 `db:"close_ledger_toid"`
+	}
+	tt.Assert.NoError(q.GetRaw(
+		&bucket,
+		"SELECT count, open_ledger_toid, close_ledger_toid FROM history_trades_60000 "+
+			"WHERE base_asset_id = LEAST($1::bigint, $2::bigint) AND counter_asset_id = GREATEST($1::bigint, $2::bigint)",
+		assetIDs[0], assetIDs[1],
+	))
+	tt.Assert.Equal(int64(4), bucket.Count)
+	tt.Assert.Equal(toid.New(3, 1, 1).ToInt64(), bucket.OpenLedgerToid)
+	tt.Assert.Equal(toid.New(4, 1, 1).ToInt64(), bucket.CloseLedgerToid)
+}
+
+func TestRebuildTradeAggregationBuckets(t *testing.T) {
+	tt := test.Start(t)
+	defer tt.Finish()
+	test.ResetHorizonDB(t, tt.HorizonDB)
+	q := &Q{tt.HorizonSession()}
+
+	assetIDs := insertTradeAggregationsTestTrades(tt, q)
+	insertTradeAggregationsTestLedgers(tt, q)
+
+	// the buckets tables are locked, a transaction is required
+	tt.Assert.EqualError(
+		q.RebuildTradeAggregationBuckets(3, 5),
+		"cannot be called outside of a transaction",
+	)
+
+	tt.Assert.NoError(q.Begin())
+	defer q.Rollback()
+
+	tt.Assert.NoError(q.RebuildTradeAggregationBuckets(3, 5))
+	tt.Assert.Equal(4, countTradeAggregationBuckets(tt, q, 60000))
+	assertTradeAggregationBuckets(tt, q, assetIDs)
+
+	// rebuilding existing buckets does not count trades twice
+	tt.Assert.NoError(q.RebuildTradeAggregationTimes(
+		strtime.MillisFromSeconds(tradeAggregationsTestCloseTime.Unix()),
+		strtime.MillisFromSeconds(tradeAggregationsTestCloseTime.Add(2*time.Hour).Unix()),
+	))
+	assertTradeAggregationBuckets(tt, q, assetIDs)
+
+	// ledgers without trades
+	tt.Assert.NoError(q.RebuildTradeAggregationBuckets(100, 200))
+	assertTradeAggregationBuckets(tt, q, assetIDs)
+	tt.Assert.NoError(q.Commit())
+}
+
+func TestDeleteTradeAggregationBucketsBefore(t *testing.T) {
+	tt := test.Start(t)
+	defer tt.Finish()
+	test.ResetHorizonDB(t, tt.HorizonDB)
+	q := &Q{tt.HorizonSession()}
+
+	insertTradeAggregationsTestTrades(tt, q)
+	insertTradeAggregationsTestLedgers(tt, q)
+	for ledger := uint32(3); ledger <= 5; ledger++ {
+		tt.Assert.NoError(q.UpsertTradeAggregationBuckets(ledger))
+	}
+
+	// ledger 4 closes in the buckets of ledger 3, they are kept
+	tt.Assert.NoError(q.DeleteTradeAggregationBucketsBefore(4))
+	tt.Assert.Equal(4, countTradeAggregationBuckets(tt, q, 60000))
+	tt.Assert.Equal(4, countTradeAggregationBuckets(tt, q, 3600000))
+
+	tt.Assert.NoError(q.DeleteTradeAggregationBucketsBefore(5))
+	tt.Assert.Equal(2, countTradeAggregationBuckets(tt, q, 60000))
+	tt.Assert.Equal(2, countTradeAggregationBuckets(tt, q, 3600000))
+
+	// no ledgers left to retain
+	tt.Assert.NoError(q.DeleteTradeAggregationBucketsBefore(6))
+	tt.Assert.Equal(2, countTradeAggregationBuckets(tt, q, 60000))
+}
@@ -40,6 +40,8 @@
 // migrations/43_add_claimable_balances_flags.sql (145B)
 // migrations/44_asset_stat_accounts_and_balances.sql (439B)
 // migrations/45_add_claimable_balances_history.sql (2.163kB)
+// migrations/46_add_trade_aggregation_buckets.sql (1.537kB)
+// migrations/47_add_market_stats.sql (1.083kB)
 // migrations/4_add_protocol_version.sql (188B)
 // migrations/5_create_trades_table.sql (1.1kB)
 // migrations/6_create_assets_table.sql (366B)
@@ -915,6 +917,46 @@ func migrations45_add_claimable_balances_historySql() (*asset, error) {
 	return a, nil
 }
 
+var _migrations46_add_trade_aggregation_bucketsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x54\x4d\x6f\xab\x48\x10\xbc\xf3\x2b\x5a\xb9\xc4\xd1\x9a\x88\x68\xa5\x5c\xac\x3d\x38\xf6\x64\x17\x85\xe0\x08\x63\x25\x39\x91\x01\x3a\x30\x32\x9e\x61\xe7\x23\x16\xef\xd7\x3f\xcd\xe0\x7c\x91\xe0\x97\x2b\x55\x5d\xd5\xdd\x74\x8d\xef\xc3\x5f\x3b\x56\x49\xaa\x11\x36\xad\xe7\xf9\x3e\xd4\x4c\x69\x21\xbb\x4c\x4b\x5a\xa2\xca\x2e\x83\x20\x08\x80\xf2\x72\x08\xfc\xed\x90\x00\x0a\xc1\x35\x65\x1c\x7a\x3e\xb4\x12\x7d\x5a\x55\x12\x2b\xaa\xb1\xb4\x82\x8c\x6b\x01\x17\xb0\x63\xdc\x68\x74\x4a\x17\x50\x0b\x23\x21\x37\xc5\x16\xb5\x3a\x87\xb4\xc6\x0e\xa8\x44\x68\x45\x6b\x1a\x5b\x07\xa5\x91\x8c\x57\xc0\x78\x85\x4a\x33\xc1\x6d\x9d\x15\xb3\x2c\xa3\xb0\x04\x2d\x80\x72\xb5\x47\xd9\x1b\xc3\xab\xa7\xe5\xfe\x6f\x50\x32\x54\xb0\x67\xba\x16\x46\x83\x2a\x28\xe7\x56\xee\xf3\x08\xe7\xde\x22\x21\xf3\x94\x40\x3a\xbf\x8a\xc8\x70\x3e\x37\x1e\x4c\x3c\x00\x80\x13\xcd\x76\xa8\x34\xdd\xb5\x27\x90\xb3\x8a\x71\x0d\xf1\x2a\x85\x78\x13\x45\x53\x47\xc8\xa9\xc2\x8c\x2a\x85\x3a\x63\xe5\xf7\x94\x42\x18\xae\x51\xfe\x84\x05\x8c\x6b\xac\x50\x0e\x30\x67\xf2\x22\x1a\xb3\x43\xe0\x66\x87\x92\x15\xdf\x55\xa3\x3c\x4e\xaa\x59\x55\x67\xfc\x18\x58\x8e\x80\x8d\xd8\x8f\x16\x5a\x6c\xac\x4e\xb4\xc8\xb3\x06\xcb\x0a\x65\xa6\xc5\xd8\xe8\x8e\x35\x26\xef\xc0\x31\xfd\xa2\x11\x0a\xff\x6c\xd0\xd3\xc6\x1c\x7a\x74\xcc\xe2\x2e\x09\x6f\xe7\xc9\x23\xdc\x90\xc7\xc9\xa7\x9f\x3d\xfd\xf2\x63\xa7\x1f\xcf\xe5\xcc\x3b\x9b\x79\x47\xef\xec\x35\x47\xfd\xa5\x45\xe1\xcd\xf7\x97\xe8\xd0\x30\x5e\x44\x9b\x65\x18\xff\x0b\x4b\x72\x3d\xdf\x44\xe9\x7a\xf0\x79\xb1\x8a\xd7\x69\x32\x0f\xe3\x2f\x48\x18\x2f\xc9\x03\x59\xbb\x76\x7c\x1f\xae\xfa\xec\xbd\xe7\x29\xef\x40\xd7\xf8\x35\x4c\x0a\x90\x97\xad\xb0\xdb\x14\xbc\x40\x4b\xea\xde\x32\x4f\x9b\xc6\x86\xf2\x10\x27\xb8\xaf\x91\x0f\x9a\x07\xa6\x80\x0b\x0d\xb8\x6b\x75\x37\xed\xab\x6b\xfa\x82\x36\xbf\x39\x42\x4e\x8b\xed\x33\x6b\x1a\x2c\x5d\x58\xad\xd8\x53\x2d\x24\xfb\x25\x38\x94\x39\x48\xcc\x0d\x6b\x4a\xdf\x19\xbc\x3d\x2b\x4c\x70\xf5\x04\xcf\x4c\x2a\x7d\xee\x85\xf1\x9a\x24\x29\x84\x71\xba\x82\x2d\x76\xd9\x0b\x6d\x0c\x66\x76\x7f\x38\xd9\x62\x37\x05\xf7\xe1\xcc\x6d\x63\x4d\x22\xb2\x48\xe1\xd4\xc9\x65\x1f\xe4\xb2\xc3\x53\x94\xbd\xf7\x73\x3a\xb5\x3c\x83\xa7\xae\xf2\xfe\x3f\x92\x10\x77\xf1\xe4\x21\x5c\xa7\x6b\x98\x1c\xb4\x2e\xe0\x3a\x59\xdd\x0e\x86\x3e\xec\xf8\xed\x65\x5d\x8a\x3d\xf7\xbc\x25\x89\x48\x4a\x7a\xfe\xa0\xd3\x83\xfe\x16\x3b\xf8\xe7\x87\xed\xcd\x3c\x6f\x99\xac\xee\x8e\xde\xd4\xec\x08\xe5\x32\x08\x82\x60\xe6\xfd\x1e\x00\x00\xac\xb2\x78\x01\x06\x00\x00")
+
+func migrations46_add_trade_aggregation_bucketsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_migrations46_add_trade_aggregation_bucketsSql,
+		"migrations/46_add_trade_aggregation_buckets.sql",
+	)
+}
+
+func migrations46_add_trade_aggregation_bucketsSql() (*asset, error) {
+	bytes, err := migrations46_add_trade_aggregation_bucketsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "migrations/46_add_trade_aggregation_buckets.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xad, 0xbf, 0x9a, 0x8c, 0xdf, 0xea, 0xb3, 0x9e, 0xa3, 0x25, 0x6f, 0x5c, 0xfc, 0x7b, 0xca, 0x45, 0x5a, 0x14, 0x72, 0xcd, 0x76, 0xfb, 0xe7, 0x47, 0x1a, 0xf1, 0x58, 0xf7, 0xd8, 0x9f, 0x9d, 0xf4}}
+	return a, nil
+}
+
+var _migrations47_add_market_statsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x94\x4f\x6f\x1a\x31\x10\xc5\xef\xfe\x14\xef\x98\xa8\x10\x55\x55\x6f\xe9\x85\x94\x6d\x85\x4a\x21\xa2\x20\x35\x27\xcb\xbb\x1e\xd8\x11\x8b\x8d\x3c\x26\x94\x6f\x5f\xd9\xfc\x49\x76\x29\x52\xaf\x8f\x9f\xdf\x1b\x8f\x1f\xdb\xef\xe3\xc3\x86\x57\xc1\x44\xc2\x62\xab\x54\xbf\x0f\xfa\xb3\xd5\x1b\x13\xd6\x14\xb5\x44\x13\x05\x95\x77\xd1\xb0\x13\xc4\x9a\x10\x7c\xd3\xb0\x5b\xe1\xd3\x67\xd4\x7e\x17\x10\x83\xb1\x84\x04\xb2\x44\xae\x04\xc6\xd9\x0c\x96\x24\x31\xd9\x95\x6c\xb3\x66\x64\x0d\xbf\x04\xbd\x52\x38\xc0\x88\x50\xc4\xd6\x70\xc0\xbe\xe6\xaa\x06\x0b\x88\x63\x4d\x27\x43\x0b\x1f\x50\x1b\x81\xdf\x92\x83\x5f\x2e\x29\xc8\x43\x72\x1b\xf3\x9a\x50\xb3\x44\x1f\x0e\x3a\xa3\xd2\xcb\x71\xd9\x8b\x05\xe9\x17\xb2\x60\x87\xca\x38\xef\xb8\x32\x0d\x7c\xb0\x14\x70\x57\x1a\x21\x9d\x93\x35\x5b\x7c\x49\x76\x95\xdf\xb9\x48\xe1\xa2\xde\xe7\x51\xb7\x81\x2b\x12\x98\x40\x69\x19\x81\x44\x8e\x8e\x3b\xc7\x51\xd2\x25\x52\xe0\xe9\xe8\xf1\x2a\x0f\xea\xeb\xac\x18\xcc\x0b\xcc\x07\x4f\xe3\xe2\x7a\x85\x77\x0a\x00\xda\x03\x94\xbc\x62\x17\x31\x99\xce\x31\x59\x8c\xc7\xbd\x8c\x74\x07\xfa\x37\x95\x2f\xae\x33\x0b\x76\x91\x56\x14\x2e\x04\x86\xc5\xb7\xc1\x62\x3c\xc7\xc7\xde\x5b\xe8\xab\x6f\x76\x1b\x82\xdb\x6d\x28\x70\x75\x93\x3d\xa7\xff\x27\x9e\x1e\x47\xbb\xd3\x88\xef\xa4\xf3\xd4\x47\xa9\xe6\x55\xdd\xa1\xb2\xd4\xa6\x1a\xbf\xef\x40\x49\x69\x33\x55\xe3\x85\x3a\xd4\x51\x6b\x73\x25\x5b\xed\xce\x8b\x79\x93\x6c\x5b\x32\xb2\xee\x52\x49\xea\x50\x7b\x76\xd6\xef\xd3\x3f\x21\xc4\x53\xc8\xcd\x7d\x34\x46\xa2\xde\x78\xcb\x4b\x26\xab\x1b\xb2\xe9\x5d\x4e\x6e\x97\x43\xc7\xa4\xe7\xd9\xe8\xe7\x60\xf6\x82\x1f\xc5\x4b\xbb\x97\xbd\xeb\x4e\xaa\xfb\x47\x75\xee\xd7\x68\x32\x2c\x7e\x5f\xf5\x4b\x97\x07\xdd\x3a\x86\xe9\xe4\xba\x84\x8b\x5f\xa3\xc9\x77\x3c\xcd\x67\x45\x71\x77\x15\xf2\xa8\xd4\xfb\x6f\xc1\xd0\xef\x9d\x52\xc3\xd9\xf4\xf9\x46\xa5\x1f\xd5\xdf\x01\x00\xa9\xf1\x1a\x19\x3b\x04\x00\x00")
+
+func migrations47_add_market_statsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_migrations47_add_market_statsSql,
+		"migrations/47_add_market_stats.sql",
+	)
+}
+
+func migrations47_add_market_statsSql() (*asset, error) {
+	bytes, err := migrations47_add_market_statsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "migrations/47_add_market_stats.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xb6, 0x6b, 0x75, 0x26, 0x17, 0xaf, 0x13, 0xf4, 0xb9, 0x8d, 0x6e, 0xab, 0xb4, 0x16, 0x9e, 0xa, 0x2e, 0x60, 0x7e, 0xeb, 0xf4, 0xaf, 0xea, 0xc1, 0x40, 0x9b, 0xea, 0x36, 0x38, 0xa8, 0x9d, 0xdc}}
+	return a, nil
+}
+
 var _migrations4_add_protocol_versionSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\xcd\xb1\x0a\xc2\x30\x10\x06\xe0\x3d\x4f\xf1\xef\x52\x70\xef\x14\x4d\x9d\xce\x44\x4a\x32\x38\x15\xd1\xa3\x06\x6a\xae\x5c\x82\xe2\xdb\xbb\xba\x88\x4f\xf0\x75\x1d\x36\x8f\x3c\xeb\xa5\x31\xd2\x6a\x2c\xc5\x61\x44\xb4\x3b\x1a\x10\x3c\x9d\x71\xcf\xb5\x89\xbe\xa7\x85\x6f\x33\x6b\x85\x01\xac\x73\xd8\x07\x4a\x47\x8f\x55\xa5\xc9\x55\x96\xe9\xc9\x5a\xb3\x14\xe4\xd2\x78\x66\x85\x1b\x0e\x36\x51\xc4\x16\x3e\x44\xf8\x44\xd4\x1b\xf3\x6d\x39\x79\x95\xff\x9a\x1b\xc3\xe9\x97\xd5\x9b\x4f\x00\x00\x00\xff\xff\x83\xbb\x30\x2e\xbc\x00\x00\x00")
 
 func migrations4_add_protocol_versionSqlBytes() ([]byte, error) {
@@ -1186,6 +1228,8 @@ var _bindata = map[string]func() (*asset, error){
 	"migrations/43_add_claimable_balances_flags.sql":                     migrations43_add_claimable_balances_flagsSql,
 	"migrations/44_asset_stat_accounts_and_balances.sql":                 migrations44_asset_stat_accounts_and_balancesSql,
 	"migrations/45_add_claimable_balances_history.sql":                   migrations45_add_claimable_balances_historySql,
+	"migrations/46_add_trade_aggregation_buckets.sql":                    migrations46_add_trade_aggregation_bucketsSql,
+	"migrations/47_add_market_stats.sql":                                 migrations47_add_market_statsSql,
 	"migrations/4_add_protocol_version.sql":                              migrations4_add_protocol_versionSql,
 	"migrations/5_create_trades_table.sql":                               migrations5_create_trades_tableSql,
 	"migrations/6_create_assets_table.sql":                               migrations6_create_assets_tableSql,
@@ -1277,6 +1321,8 @@ var _bintree = &bintree{nil, map[string]*bintree{
 		"43_add_claimable_balances_flags.sql":                     &bintree{migrations43_add_claimable_balances_flagsSql, map[string]*bintree{}},
 		"44_asset_stat_accounts_and_balances.sql":                 &bintree{migrations44_asset_stat_accounts_and_balancesSql, map[string]*bintree{}},
 		"45_add_claimable_balances_history.sql":                   &bintree{migrations45_add_claimable_balances_historySql, map[string]*bintree{}},
+		"46_add_trade_aggregation_buckets.sql":                    &bintree{migrations46_add_trade_aggregation_bucketsSql, map[string]*bintree{}},
+		"47_add_market_stats.sql":                                 &bintree{migrations47_add_market_statsSql, map[string]*bintree{}},
 		"4_add_protocol_version.sql":                              &bintree{migrations4_add_protocol_versionSql, map[string]*bintree{}},
 		"5_create_trades_table.sql":                               &bintree{migrations5_create_trades_tableSql, map[string]*bintree{}},
 		"6_create_assets_table.sql":                               &bintree{migrations6_create_assets_tableSql, map[string]*bintree{}},
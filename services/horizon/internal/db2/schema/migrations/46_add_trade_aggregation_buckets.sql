@@ -0,0 +1,45 @@
+-- +migrate Up
+
+-- history_trades_60000 and history_trades_3600000 contain trades pre-aggregated
+-- into 1 minute and 1 hour buckets. They are populated during ingestion and
+-- are used to answer trade aggregation queries without scanning history_trades.
+CREATE TABLE history_trades_60000 (
+    "timestamp" bigint NOT NULL,
+    base_asset_id bigint NOT NULL,
+    counter_asset_id bigint NOT NULL,
+    count integer NOT NULL,
+    base_volume numeric NOT NULL,
+    counter_volume numeric NOT NULL,
+    high_n numeric NOT NULL,
+    high_d numeric NOT NULL,
+    low_n numeric NOT NULL,
+    low_d numeric NOT NULL,
+    open_ledger_toid bigint NOT NULL,
+    open_n numeric NOT NULL,
+    open_d numeric NOT NULL,
+    close_ledger_toid bigint NOT NULL,
+    close_n numeric NOT NULL,
+    close_d numeric NOT NULL,
+    PRIMARY KEY(base_asset_id, counter_asset_id, "timestamp")
+);
+
+CREATE TABLE history_trades_3600000 (
+    LIKE history_trades_60000
+    INCLUDING DEFAULTS
+    INCLUDING CONSTRAINTS
+    INCLUDING INDEXES
+);
+
+-- Buckets are used by the trade aggregations endpoint once they contain all
+-- trades. When history_trades is not empty, they have to be backfilled with
+-- `horizon db rebuild-trade-aggregations` first.
+INSERT INTO key_value_store(key, value)
+    SELECT 'trade_aggregation_buckets_backfilled', 'true'
+    WHERE NOT EXISTS (SELECT 1 FROM history_trades);
+
+-- +migrate Down
+
+DELETE FROM key_value_store WHERE key = 'trade_aggregation_buckets_backfilled';
+
+DROP TABLE history_trades_3600000;
+DROP TABLE history_trades_60000;
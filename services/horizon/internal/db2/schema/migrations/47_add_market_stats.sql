@@ -0,0 +1,34 @@
+-- +migrate Up
+
+-- exp_market_stats contains the rolling 24 hour trade statistics and the best
+-- bid and ask of every asset pair which is either traded or has open offers.
+-- Like history_trades, the pair is stored in canonical order (base_asset_id <
+-- counter_asset_id) and prices are expressed in units of the counter asset.
+CREATE TABLE exp_market_stats (
+    base_asset_id bigint NOT NULL,
+    counter_asset_id bigint NOT NULL,
+    trade_count integer NOT NULL DEFAULT 0,
+    base_volume numeric NOT NULL DEFAULT 0,
+    counter_volume numeric NOT NULL DEFAULT 0,
+    open_n bigint,
+    open_d bigint,
+    high_n bigint,
+    high_d bigint,
+    low_n bigint,
+    low_d bigint,
+    close_n bigint,
+    close_d bigint,
+    bid_n integer,
+    bid_d integer,
+    ask_n integer,
+    ask_d integer,
+    window_start bigint NOT NULL DEFAULT 0,
+    last_modified_ledger integer NOT NULL,
+    PRIMARY KEY(base_asset_id, counter_asset_id)
+);
+
+CREATE INDEX exp_market_stats_by_counter_asset ON exp_market_stats USING BTREE(counter_asset_id);
+
+-- +migrate Down
+
+DROP TABLE exp_market_stats;
@@ -188,6 +188,20 @@ func Flags() (*Config, support.ConfigOptions) {
 			},
 			Usage: "comma-separated list of stellar history archives to connect with",
 		},
+		&support.ConfigOption{
+			Name:        "history-archive-cache-path",
+			ConfigKey:   &config.HistoryArchiveCachePath,
+			OptType:     types.String,
+			FlagDefault: "",
+			Usage:       "directory in which files downloaded from history archives (ex. buckets) are cached, caching is disabled when not set",
+		},
+		&support.ConfigOption{
+			Name:        "history-archive-cache-max-size",
+			ConfigKey:   &config.HistoryArchiveCacheMaxSize,
+			OptType:     types.Uint,
+			FlagDefault: uint(10240),
+			Usage:       "maximum size (in MB) of the history archive cache, the least recently used files are removed when it is exceeded",
+		},
 		&support.ConfigOption{
 			Name:        "port",
 			ConfigKey:   &config.Port,
@@ -290,6 +304,13 @@ func Flags() (*Config, support.ConfigOptions) {
 			OptType:   types.String,
 			Usage:     "name of the path for Core logs (leave empty to log w/ Horizon only)",
 		},
+		&support.ConfigOption{
+			Name:        "captive-core-max-restarts",
+			ConfigKey:   &config.CaptiveCoreMaxRestarts,
+			OptType:     types.Int,
+			FlagDefault: 0,
+			Usage:       "maximum number of consecutive restarts of Captive Core after it exits unexpectedly, ingestion resumes from the last ingested ledger (0 disables restarts)",
+		},
 		&support.ConfigOption{
 			Name:        "max-path-length",
 			ConfigKey:   &config.MaxPathLength,
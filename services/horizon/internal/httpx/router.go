@@ -45,6 +45,7 @@ type RouterConfig struct {
 	HorizonVersion        string
 	FriendbotURL          *url.URL
 	HealthCheck           http.Handler
+	CaptiveCoreStatus     http.Handler
 }
 
 type Router struct {
@@ -161,6 +162,7 @@ func (r *Router) addRoutes(config *RouterConfig, rateLimiter *throttled.HTTPRate
 		})
 
 		r.Method(http.MethodGet, "/assets", restPageHandler(ledgerState, actions.AssetStatsHandler{LedgerState: ledgerState}))
+		r.Method(http.MethodGet, "/market_stats", restPageHandler(ledgerState, actions.GetMarketStatsHandler{LedgerState: ledgerState}))
 
 		findPaths := ObjectActionHandler{actions.FindPathsHandler{
 			StaleThreshold:       config.StaleThreshold,
@@ -312,4 +314,7 @@ func (r *Router) addRoutes(config *RouterConfig, rateLimiter *throttled.HTTPRate
 	r.Internal.Get("/metrics", promhttp.HandlerFor(config.PrometheusRegistry, promhttp.HandlerOpts{}).ServeHTTP)
 	r.Internal.Get("/debug/pprof/heap", pprof.Index)
 	r.Internal.Get("/debug/pprof/profile", pprof.Profile)
+	if config.CaptiveCoreStatus != nil {
+		r.Internal.Method(http.MethodGet, "/captive-core/status", config.CaptiveCoreStatus)
+	}
 }
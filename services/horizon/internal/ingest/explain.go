@@ -0,0 +1,188 @@
+package ingest
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/services/horizon/internal/db2/history"
+	"github.com/stellar/go/services/horizon/internal/ingest/processors"
+	"github.com/stellar/go/services/horizon/internal/toid"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// ProcessorChanges holds the number of rows a processor inserts, updates and
+// deletes in every table when committed.
+type ProcessorChanges struct {
+	Processor string
+	Tables    []history.TableChanges
+}
+
+// LedgerExplanation describes the output of ingesting a single ledger.
+type LedgerExplanation struct {
+	Sequence uint32
+	// StateSkipped is true when the ledger is not the next ledger to ingest.
+	// In such case only history processors are run because applying the
+	// ledger changes to the current state would not reflect what the ledger
+	// did.
+	StateSkipped     bool
+	Processors       []ProcessorChanges
+	ChangeStats      ingest.StatsChangeProcessorResults
+	TransactionStats processors.StatsLedgerTransactionProcessorResults
+}
+
+// ExplainLedger runs the ingestion processors on a single ledger using a
+// history.DryRunQ and returns the rows each of them would insert, update and
+// delete. Nothing is persisted in the database: all changes are made in a
+// transaction which is rolled back.
+func (s *system) ExplainLedger(sequence uint32) (LedgerExplanation, error) {
+	explanation := LedgerExplanation{Sequence: sequence}
+
+	historyQ := history.NewDryRunQ(s.config.HistorySession)
+	historyQ.Ctx = s.ctx
+	if err := historyQ.Begin(); err != nil {
+		return explanation, errors.Wrap(err, "Error starting a transaction")
+	}
+	defer historyQ.Rollback()
+
+	lastIngestedLedger, err := historyQ.GetLastLedgerIngestNonBlocking()
+	if err != nil {
+		return explanation, errors.Wrap(err, getLastIngestedErrMsg)
+	}
+
+	if err = s.ledgerBackend.PrepareRange(ledgerbackend.SingleLedgerRange(sequence)); err != nil {
+		return explanation, errors.Wrap(err, "error preparing range")
+	}
+	exists, ledger, err := s.ledgerBackend.GetLedger(sequence)
+	if err != nil {
+		return explanation, errors.Wrap(err, "error getting ledger")
+	}
+	if !exists {
+		return explanation, errors.New("error getting ledger: ledger does not exist")
+	}
+
+	// Remove history rows of the ledger if it was already ingested so the
+	// processors can insert them again.
+	start, end, err := toid.LedgerRangeInclusive(int32(sequence), int32(sequence))
+	if err != nil {
+		return explanation, errors.Wrap(err, "Invalid range")
+	}
+	if err = historyQ.DeleteRangeAll(start, end); err != nil {
+		return explanation, errors.Wrap(err, "error in DeleteRangeAll")
+	}
+
+	runner := &ProcessorRunner{
+		ctx:            s.ctx,
+		config:         s.config,
+		historyQ:       historyQ,
+		historyAdapter: s.historyAdapter,
+	}
+	return runner.explainLedger(ledger, sequence != lastIngestedLedger+1, historyQ.GetTableChanges)
+}
+
+// explainLedger works like RunAllProcessorsOnLedger but commits processors
+// one by one recording the table changes made by each of them. State
+// processors are not run when skipState is true.
+func (s *ProcessorRunner) explainLedger(
+	ledger xdr.LedgerCloseMeta,
+	skipState bool,
+	getTableChanges func() ([]history.TableChanges, error),
+) (LedgerExplanation, error) {
+	explanation := LedgerExplanation{
+		Sequence:     ledger.LedgerSequence(),
+		StateSkipped: skipState,
+	}
+
+	if err := s.checkIfProtocolVersionSupported(ledger.ProtocolVersion()); err != nil {
+		return explanation, errors.Wrap(err, "Error while checking for supported protocol version")
+	}
+
+	if _, _, err := s.historyQ.EnsureHistoryPartitions(ledger.LedgerSequence()); err != nil {
+		return explanation, errors.Wrap(err, "Error creating history partitions")
+	}
+
+	commit := func(processor interface{ Commit() error }) error {
+		before, err := getTableChanges()
+		if err != nil {
+			return errors.Wrap(err, "Error getting table changes")
+		}
+		if err = processor.Commit(); err != nil {
+			return errors.Wrapf(err, "error in %T.Commit", processor)
+		}
+		after, err := getTableChanges()
+		if err != nil {
+			return errors.Wrap(err, "Error getting table changes")
+		}
+
+		explanation.Processors = append(explanation.Processors, ProcessorChanges{
+			Processor: fmt.Sprintf("%T", processor),
+			Tables:    history.SubtractTableChanges(after, before),
+		})
+		return nil
+	}
+
+	changeStats := ingest.StatsChangeProcessor{}
+	groupChangeProcessors := newGroupChangeProcessors([]horizonChangeProcessor{
+		&statsChangeProcessor{StatsChangeProcessor: &changeStats},
+	})
+	if !skipState {
+		groupChangeProcessors = s.buildChangeProcessor(&changeStats, ledgerSource, ledger.LedgerSequence())
+	}
+
+	changeReader, err := ingest.NewLedgerChangeReaderFromLedgerCloseMeta(s.config.NetworkPassphrase, ledger)
+	if err != nil {
+		return explanation, errors.Wrap(err, "Error creating ledger change reader")
+	}
+	if err = processors.StreamChanges(groupChangeProcessors, changeReader); err != nil {
+		return explanation, errors.Wrap(err, "Error streaming changes from ledger")
+	}
+	for _, processor := range groupChangeProcessors.processors {
+		if _, ok := processor.(*statsChangeProcessor); ok {
+			continue
+		}
+		if err = commit(processor); err != nil {
+			return explanation, err
+		}
+	}
+	explanation.ChangeStats = changeStats.GetResults()
+
+	transactionReader, err := ingest.NewLedgerTransactionReaderFromLedgerCloseMeta(s.config.NetworkPassphrase, ledger)
+	if err != nil {
+		return explanation, errors.Wrap(err, "Error creating ledger reader")
+	}
+	var ledgerTransactionStats processors.StatsLedgerTransactionProcessor
+	groupTransactionProcessors := s.buildTransactionProcessor(&ledgerTransactionStats, transactionReader.GetHeader())
+	if err = processors.StreamLedgerTransactions(groupTransactionProcessors, transactionReader); err != nil {
+		return explanation, errors.Wrap(err, "Error streaming changes from ledger")
+	}
+	for _, processor := range groupTransactionProcessors.processors {
+		if _, ok := processor.(*statsLedgerTransactionProcessor); ok {
+			continue
+		}
+		if err = commit(processor); err != nil {
+			return explanation, err
+		}
+	}
+	explanation.TransactionStats = ledgerTransactionStats.GetResults()
+
+	if !skipState {
+		marketStatsProcessor := processors.NewMarketStatsProcessor(
+			s.historyQ,
+			ledger.LedgerSequence(),
+			ledgerCloseTime(ledger),
+		)
+		changeReader, err = ingest.NewLedgerChangeReaderFromLedgerCloseMeta(s.config.NetworkPassphrase, ledger)
+		if err != nil {
+			return explanation, errors.Wrap(err, "Error creating ledger change reader")
+		}
+		if err = processors.StreamChanges(marketStatsProcessor, changeReader); err != nil {
+			return explanation, errors.Wrap(err, "Error streaming changes from ledger")
+		}
+		if err = commit(marketStatsProcessor); err != nil {
+			return explanation, err
+		}
+	}
+
+	return explanation, nil
+}
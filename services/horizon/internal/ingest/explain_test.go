@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/services/horizon/internal/db2/history"
+	"github.com/stellar/go/xdr"
+)
+
+func TestProcessorRunnerExplainLedgerSkipState(t *testing.T) {
+	maxBatchSize := 100000
+
+	config := Config{
+		NetworkPassphrase: network.PublicNetworkPassphrase,
+	}
+
+	q := &mockDBQ{}
+	defer mock.AssertExpectationsForObjects(t, q)
+
+	ledger := xdr.LedgerCloseMeta{
+		V0: &xdr.LedgerCloseMetaV0{
+			LedgerHeader: xdr.LedgerHeaderHistoryEntry{
+				Header: xdr.LedgerHeader{
+					LedgerSeq: 10,
+				},
+			},
+		},
+	}
+
+	mockOperationsBatchInsertBuilder := &history.MockOperationsBatchInsertBuilder{}
+	defer mock.AssertExpectationsForObjects(t, mockOperationsBatchInsertBuilder)
+	mockOperationsBatchInsertBuilder.On("Exec").Return(nil).Once()
+	q.MockQOperations.On("NewOperationBatchInsertBuilder", maxBatchSize).
+		Return(mockOperationsBatchInsertBuilder).Twice()
+
+	mockTransactionsBatchInsertBuilder := &history.MockTransactionsBatchInsertBuilder{}
+	defer mock.AssertExpectationsForObjects(t, mockTransactionsBatchInsertBuilder)
+	mockTransactionsBatchInsertBuilder.On("Exec").Return(nil).Once()
+	q.MockQTransactions.On("NewTransactionBatchInsertBuilder", maxBatchSize).
+		Return(mockTransactionsBatchInsertBuilder).Twice()
+
+	insertedLedgers := int64(0)
+	q.MockQLedgers.On("InsertLedger", ledger.V0.LedgerHeader, 0, 0, 0, 0, CurrentVersion).
+		Run(func(mock.Arguments) { insertedLedgers++ }).
+		Return(int64(1), nil).Once()
+	q.On("EnsureHistoryPartitions", uint32(10)).Return(uint32(0), uint32(math.MaxUint32), nil).Once()
+
+	runner := ProcessorRunner{
+		ctx:      context.Background(),
+		config:   config,
+		historyQ: q,
+	}
+
+	explanation, err := runner.explainLedger(ledger, true, func() ([]history.TableChanges, error) {
+		return []history.TableChanges{
+			{Table: "history_ledgers", Inserts: insertedLedgers},
+		}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(10), explanation.Sequence)
+	assert.True(t, explanation.StateSkipped)
+	assert.Equal(t, []ProcessorChanges{
+		{Processor: "*processors.EffectProcessor"},
+		{
+			Processor: "*processors.LedgersProcessor",
+			Tables:    []history.TableChanges{{Table: "history_ledgers", Inserts: 1}},
+		},
+		{Processor: "*processors.OperationProcessor"},
+		{Processor: "*processors.TradeProcessor"},
+		{Processor: "*processors.ParticipantsProcessor"},
+		{Processor: "*processors.TransactionProcessor"},
+		{Processor: "*processors.ClaimableBalancesTransactionProcessor"},
+	}, explanation.Processors)
+}
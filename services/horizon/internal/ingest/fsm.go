@@ -669,6 +669,13 @@ func (h reingestHistoryRangeState) ingestRange(s *system, fromLedger, toLedger u
 		}
 	}
 
+	// Trades of reingested ledgers are not upserted into the trade
+	// aggregation buckets, which may already count the trades ingested
+	// before. The buckets are rebuilt in the same transaction instead.
+	if err = s.historyQ.RebuildTradeAggregationBuckets(fromLedger, toLedger); err != nil {
+		return errors.Wrap(err, "error in RebuildTradeAggregationBuckets")
+	}
+
 	return nil
 }
 
@@ -703,6 +710,11 @@ func (h reingestHistoryRangeState) run(s *system) (transition, error) {
 
 	startTime = time.Now()
 
+	// Upserts would take locks on the trade aggregation buckets tables before
+	// the rebuild in ingestRange, deadlocking with parallel workers.
+	s.runner.DisableTradeAggregationUpserts()
+	defer s.runner.EnableTradeAggregationUpserts()
+
 	if h.force {
 		if err := s.historyQ.Begin(); err != nil {
 			return stop(), errors.Wrap(err, "Error starting a transaction")
@@ -293,6 +293,8 @@ func (s *ReingestHistoryRangeStateTestSuite) SetupTest() {
 	s.historyQ.On("Begin").Return(nil).Once()
 
 	s.ledgerBackend.On("PrepareRange", ledgerbackend.BoundedRange(100, 200)).Return(nil).Once()
+	s.runner.On("DisableTradeAggregationUpserts").Maybe()
+	s.runner.On("EnableTradeAggregationUpserts").Maybe()
 }
 
 func (s *ReingestHistoryRangeStateTestSuite) TearDownTest() {
@@ -446,6 +448,7 @@ func (s *ReingestHistoryRangeStateTestSuite) TestCommitFails() {
 		processorsRunDurations{},
 		nil,
 	).Once()
+	s.historyQ.On("RebuildTradeAggregationBuckets", uint32(100), uint32(100)).Return(nil).Once()
 
 	s.historyQ.On("Commit").Return(errors.New("my error")).Once()
 	s.historyQ.On("Rollback").Return(nil).Once()
@@ -454,6 +457,43 @@ func (s *ReingestHistoryRangeStateTestSuite) TestCommitFails() {
 	s.Assert().EqualError(err, "Error committing db transaction: my error")
 }
 
+func (s *ReingestHistoryRangeStateTestSuite) TestRebuildTradeAggregationBucketsFails() {
+	*s.historyQ = mockDBQ{}
+	s.historyQ.On("GetTx").Return(nil).Once()
+	s.historyQ.On("GetLastLedgerIngestNonBlocking").Return(uint32(0), nil).Once()
+
+	s.historyQ.On("Begin").Return(nil).Once()
+	s.historyQ.On("GetTx").Return(&sqlx.Tx{}).Once()
+	toidFrom := toid.New(100, 0, 0)
+	toidTo := toid.New(101, 0, 0)
+	s.historyQ.On(
+		"DeleteRangeAll", toidFrom.ToInt64(), toidTo.ToInt64(),
+	).Return(nil).Once()
+
+	meta := xdr.LedgerCloseMeta{
+		V0: &xdr.LedgerCloseMetaV0{
+			LedgerHeader: xdr.LedgerHeaderHistoryEntry{
+				Header: xdr.LedgerHeader{
+					LedgerSeq: xdr.Uint32(100),
+				},
+			},
+		},
+	}
+	s.ledgerBackend.On("GetLedger", uint32(100)).Return(true, meta, nil).Once()
+
+	s.runner.On("RunTransactionProcessorsOnLedger", meta).Return(
+		processors.StatsLedgerTransactionProcessorResults{},
+		processorsRunDurations{},
+		nil,
+	).Once()
+	s.historyQ.On("RebuildTradeAggregationBuckets", uint32(100), uint32(100)).
+		Return(errors.New("my error")).Once()
+	s.historyQ.On("Rollback").Return(nil).Once()
+
+	err := s.system.ReingestRange(100, 200, false)
+	s.Assert().EqualError(err, "error in RebuildTradeAggregationBuckets: my error")
+}
+
 func (s *ReingestHistoryRangeStateTestSuite) TestSuccess() {
 	*s.historyQ = mockDBQ{}
 	s.historyQ.On("GetTx").Return(nil).Once()
@@ -485,6 +525,7 @@ func (s *ReingestHistoryRangeStateTestSuite) TestSuccess() {
 			processorsRunDurations{},
 			nil,
 		).Once()
+		s.historyQ.On("RebuildTradeAggregationBuckets", i, i).Return(nil).Once()
 
 		s.historyQ.On("Commit").Return(nil).Once()
 		s.historyQ.On("Rollback").Return(nil).Once()
@@ -519,6 +560,7 @@ func (s *ReingestHistoryRangeStateTestSuite) TestSuccessOneLedger() {
 		processorsRunDurations{},
 		nil,
 	).Once()
+	s.historyQ.On("RebuildTradeAggregationBuckets", uint32(100), uint32(100)).Return(nil).Once()
 	s.historyQ.On("Commit").Return(nil).Once()
 
 	// Recreate mock in this single test to remove previous assertion.
@@ -567,8 +609,11 @@ func (s *ReingestHistoryRangeStateTestSuite) TestReingestRangeForce() {
 		).Once()
 	}
 
+	s.historyQ.On("RebuildTradeAggregationBuckets", uint32(100), uint32(200)).Return(nil).Once()
 	s.historyQ.On("Commit").Return(nil).Once()
 
 	err := s.system.ReingestRange(100, 200, true)
 	s.Assert().NoError(err)
+	s.runner.AssertCalled(s.T(), "DisableTradeAggregationUpserts")
+	s.runner.AssertCalled(s.T(), "EnableTradeAggregationUpserts")
 }
@@ -76,12 +76,22 @@ type Config struct {
 	CaptiveCoreHTTPPort         uint
 	CaptiveCorePeerPort         uint
 	CaptiveCoreLogPath          string
+	CaptiveCoreMaxRestarts      int
 	RemoteCaptiveCoreURL        string
 	NetworkPassphrase           string
+	// LedgerMetaArchiveURL is the URL of a directory or S3 bucket with
+	// LedgerCloseMeta files exported by `horizon ingest export-ledger-meta`.
+	// When set, ledgers are read from it instead of Stellar-Core.
+	LedgerMetaArchiveURL string
 
 	HistorySession           *db.Session
 	HistoryArchiveURL        string
 	DisableStateVerification bool
+	// HistoryArchiveCachePath enables caching of files read from the history
+	// archive in a local directory of at most HistoryArchiveCacheMaxSize
+	// bytes.
+	HistoryArchiveCachePath    string
+	HistoryArchiveCacheMaxSize int64
 
 	MaxReingestRetries          int
 	ReingestRetryBackoffSeconds int
@@ -127,6 +137,11 @@ type Metrics struct {
 	// CaptiveStellarCoreSynced exposes synced status of Captive Stellar-Core.
 	// 1 if sync, 0 if not synced, -1 if unable to connect or HTTP server disabled.
 	CaptiveStellarCoreSynced prometheus.GaugeFunc
+
+	// CaptiveStellarCoreStatus exposes status of Captive Stellar-Core (mode,
+	// catchup progress, meta pipe stats). nil if Captive Stellar-Core is not
+	// running in this process.
+	CaptiveStellarCoreStatus prometheus.Collector
 }
 
 type System interface {
@@ -136,6 +151,8 @@ type System interface {
 	VerifyRange(fromLedger, toLedger uint32, verifyState bool) error
 	ReingestRange(fromLedger, toLedger uint32, force bool) error
 	BuildGenesisState() error
+	ExplainLedger(sequence uint32) (LedgerExplanation, error)
+	CaptiveCoreStatus(ctx context.Context) (ledgerbackend.CaptiveCoreStatus, bool)
 	Shutdown()
 }
 
@@ -178,6 +195,8 @@ func NewSystem(config Config) (System, error) {
 			Context:             ctx,
 			NetworkPassphrase:   config.NetworkPassphrase,
 			CheckpointFrequency: config.CheckpointFrequency,
+			CachePath:           config.HistoryArchiveCachePath,
+			CacheMaxSize:        config.HistoryArchiveCacheMaxSize,
 		},
 	)
 	if err != nil {
@@ -186,7 +205,16 @@ func NewSystem(config Config) (System, error) {
 	}
 
 	var ledgerBackend ledgerbackend.LedgerBackend
-	if config.EnableCaptiveCore {
+	if len(config.LedgerMetaArchiveURL) > 0 {
+		ledgerBackend, err = ledgerbackend.NewMetaArchiveBackend(
+			config.LedgerMetaArchiveURL,
+			historyarchive.ConnectOptions{Context: ctx},
+		)
+		if err != nil {
+			cancel()
+			return nil, errors.Wrap(err, "error creating ledger meta archive backend")
+		}
+	} else if config.EnableCaptiveCore {
 		if len(config.RemoteCaptiveCoreURL) > 0 {
 			ledgerBackend, err = ledgerbackend.NewRemoteCaptive(config.RemoteCaptiveCoreURL)
 			if err != nil {
@@ -209,6 +237,7 @@ func NewSystem(config Config) (System, error) {
 					LedgerHashStore:     ledgerbackend.NewHorizonDBLedgerHashStore(config.HistorySession),
 					Log:                 logger,
 					Context:             ctx,
+					MaxRestarts:         config.CaptiveCoreMaxRestarts,
 				},
 			)
 			if err != nil {
@@ -338,12 +367,28 @@ func (s *system) initMetrics() {
 			}
 		},
 	)
+
+	if captiveCore, ok := s.ledgerBackend.(*ledgerbackend.CaptiveStellarCore); ok {
+		s.metrics.CaptiveStellarCoreStatus = ledgerbackend.NewCaptiveCoreCollector(
+			captiveCore, "horizon", "ingest",
+		)
+	}
 }
 
 func (s *system) Metrics() Metrics {
 	return s.metrics
 }
 
+// CaptiveCoreStatus returns the status of Captive Stellar-Core. The second
+// value is false when Captive Stellar-Core is not running in this process.
+func (s *system) CaptiveCoreStatus(ctx context.Context) (ledgerbackend.CaptiveCoreStatus, bool) {
+	captiveCore, ok := s.ledgerBackend.(*ledgerbackend.CaptiveStellarCore)
+	if !ok {
+		return ledgerbackend.CaptiveCoreStatus{}, false
+	}
+	return captiveCore.Status(ctx), true
+}
+
 // Run starts ingestion system. Ingestion system supports distributed ingestion
 // that means that Horizon ingestion can be running on multiple machines and
 // only one, random node will lead the ingestion.
@@ -18,6 +18,7 @@ import (
 	"github.com/stellar/go/support/db"
 	"github.com/stellar/go/support/errors"
 	logpkg "github.com/stellar/go/support/log"
+	strtime "github.com/stellar/go/support/time"
 	"github.com/stellar/go/xdr"
 )
 
@@ -340,6 +341,16 @@ func (m *mockDBQ) DeleteRangeAll(start, end int64) error {
 	return args.Error(0)
 }
 
+func (m *mockDBQ) RebuildTradeAggregationBuckets(fromLedger, toLedger uint32) error {
+	args := m.Called(fromLedger, toLedger)
+	return args.Error(0)
+}
+
+func (m *mockDBQ) EnsureHistoryPartitions(ledger uint32) (uint32, uint32, error) {
+	args := m.Called(ledger)
+	return args.Get(0).(uint32), args.Get(1).(uint32), args.Error(2)
+}
+
 // Methods from interfaces duplicating methods:
 
 func (m *mockDBQ) NewTransactionParticipantsBatchInsertBuilder(maxBatchSize int) history.TransactionParticipantsBatchInsertBuilder {
@@ -362,6 +373,31 @@ func (m *mockDBQ) CreateAssets(assets []xdr.Asset, batchSize int) (map[string]hi
 	return args.Get(0).(map[string]history.Asset), args.Error(1)
 }
 
+func (m *mockDBQ) UpsertTradeAggregationBuckets(ledger uint32) error {
+	args := m.Called(ledger)
+	return args.Error(0)
+}
+
+func (m *mockDBQ) UpdateMarketStatsOrderBook(ledger uint32, pairs []history.MarketStatsPair) error {
+	args := m.Called(ledger, pairs)
+	return args.Error(0)
+}
+
+func (m *mockDBQ) ResetMarketStatsOrderBook() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *mockDBQ) UpdateMarketStatsTrades(ledger uint32, windowStart strtime.Millis, pairs []history.MarketStatsPair) error {
+	args := m.Called(ledger, windowStart, pairs)
+	return args.Error(0)
+}
+
+func (m *mockDBQ) DeleteEmptyMarketStats() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
 type mockLedgerBackend struct {
 	mock.Mock
 }
@@ -412,6 +448,14 @@ func (m *mockProcessorsRunner) DisableMemoryStatsLogging() {
 	m.Called()
 }
 
+func (m *mockProcessorsRunner) EnableTradeAggregationUpserts() {
+	m.Called()
+}
+
+func (m *mockProcessorsRunner) DisableTradeAggregationUpserts() {
+	m.Called()
+}
+
 func (m *mockProcessorsRunner) RunGenesisStateIngestion() (ingest.StatsChangeProcessorResults, error) {
 	args := m.Called()
 	return args.Get(0).(ingest.StatsChangeProcessorResults), args.Error(1)
@@ -478,6 +522,11 @@ func (m *mockSystem) Metrics() Metrics {
 	return args.Get(0).(Metrics)
 }
 
+func (m *mockSystem) CaptiveCoreStatus(ctx context.Context) (ledgerbackend.CaptiveCoreStatus, bool) {
+	args := m.Called(ctx)
+	return args.Get(0).(ledgerbackend.CaptiveCoreStatus), args.Bool(1)
+}
+
 func (m *mockSystem) StressTest(numTransactions, changesPerTransaction int) error {
 	args := m.Called(numTransactions, changesPerTransaction)
 	return args.Error(0)
@@ -493,6 +542,11 @@ func (m *mockSystem) ReingestRange(fromLedger, toLedger uint32, force bool) erro
 	return args.Error(0)
 }
 
+func (m *mockSystem) ExplainLedger(sequence uint32) (LedgerExplanation, error) {
+	args := m.Called(sequence)
+	return args.Get(0).(LedgerExplanation), args.Error(1)
+}
+
 func (m *mockSystem) BuildGenesisState() error {
 	args := m.Called()
 	return args.Error(0)
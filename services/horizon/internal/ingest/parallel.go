@@ -2,8 +2,10 @@ package ingest
 
 import (
 	"fmt"
+	"path/filepath"
 	"sync"
 
+	"github.com/stellar/go/historyarchive"
 	"github.com/stellar/go/support/errors"
 	logpkg "github.com/stellar/go/support/log"
 )
@@ -51,6 +53,27 @@ func newParallelSystems(config Config, workerCount uint, systemFactory func(Conf
 	}, nil
 }
 
+// workerConfig returns the config of the i-th worker. A history archive cache
+// directory can't be shared by multiple systems, so every worker caches files
+// in its own subdirectory with an equal share of the maximum cache size.
+func (ps *ParallelSystems) workerConfig(i uint) Config {
+	config := ps.config
+	if config.HistoryArchiveCachePath == "" {
+		return config
+	}
+
+	maxSize := config.HistoryArchiveCacheMaxSize
+	if maxSize <= 0 {
+		maxSize = historyarchive.DefaultCacheMaxSize
+	}
+	config.HistoryArchiveCachePath = filepath.Join(
+		config.HistoryArchiveCachePath,
+		fmt.Sprintf("worker-%d", i),
+	)
+	config.HistoryArchiveCacheMaxSize = maxSize / int64(ps.workerCount)
+	return config
+}
+
 func (ps *ParallelSystems) runReingestWorker(s System, stop <-chan struct{}, reingestJobQueue <-chan ledgerRange) rangeError {
 
 	for {
@@ -109,7 +132,7 @@ func (ps *ParallelSystems) ReingestRange(fromLedger, toLedger uint32, batchSizeS
 
 	for i := uint(0); i < ps.workerCount; i++ {
 		wg.Add(1)
-		s, err := ps.systemFactory(ps.config)
+		s, err := ps.systemFactory(ps.workerConfig(i))
 		if err != nil {
 			return errors.Wrap(err, "error creating new system")
 		}
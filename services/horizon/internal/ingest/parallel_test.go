@@ -108,3 +108,34 @@ func TestParallelReingestRangeErrorInEarlierJob(t *testing.T) {
 	assert.Equal(t, "job failed, recommended restart range: [1024, 2050]: error when processing [1024, 1279] range: failed because of foo", err.Error())
 
 }
+
+func TestParallelReingestRangeCachePaths(t *testing.T) {
+	config := Config{
+		HistoryArchiveCachePath:    "/cache",
+		HistoryArchiveCacheMaxSize: 3000,
+	}
+	var (
+		configs []Config
+		m       sync.Mutex
+	)
+	factory := func(c Config) (System, error) {
+		m.Lock()
+		defer m.Unlock()
+		configs = append(configs, c)
+		result := &mockSystem{}
+		result.On("ReingestRange", mock.AnythingOfType("uint32"), mock.AnythingOfType("uint32"), mock.AnythingOfType("bool")).
+			Return(error(nil))
+		return result, nil
+	}
+	system, err := newParallelSystems(config, 3, factory)
+	assert.NoError(t, err)
+	assert.NoError(t, system.ReingestRange(0, 2050, 258))
+
+	// workers must not share a cache directory
+	var paths []string
+	for _, c := range configs {
+		paths = append(paths, c.HistoryArchiveCachePath)
+		assert.Equal(t, int64(1000), c.HistoryArchiveCacheMaxSize)
+	}
+	assert.ElementsMatch(t, []string{"/cache/worker-0", "/cache/worker-1", "/cache/worker-2"}, paths)
+}
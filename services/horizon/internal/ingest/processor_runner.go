@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/stellar/go/ingest"
 	"github.com/stellar/go/services/horizon/internal/db2/history"
@@ -51,6 +52,8 @@ type ProcessorRunnerInterface interface {
 	SetHistoryAdapter(historyAdapter historyArchiveAdapterInterface)
 	EnableMemoryStatsLogging()
 	DisableMemoryStatsLogging()
+	EnableTradeAggregationUpserts()
+	DisableTradeAggregationUpserts()
 	RunGenesisStateIngestion() (ingest.StatsChangeProcessorResults, error)
 	RunHistoryArchiveIngestion(
 		checkpointLedger uint32,
@@ -80,6 +83,16 @@ type ProcessorRunner struct {
 	historyQ       history.IngestionQ
 	historyAdapter historyArchiveAdapterInterface
 	logMemoryStats bool
+
+	// skipTradeAggregationUpserts is set when the trade aggregation buckets
+	// of processed ledgers are rebuilt by the caller, see
+	// reingestHistoryRangeState.
+	skipTradeAggregationUpserts bool
+
+	// [historyPartitionsFrom, historyPartitionsTo) is the range of ledgers
+	// which can be stored in the existing history partitions.
+	historyPartitionsFrom uint32
+	historyPartitionsTo   uint32
 }
 
 func (s *ProcessorRunner) SetHistoryAdapter(historyAdapter historyArchiveAdapterInterface) {
@@ -94,6 +107,14 @@ func (s *ProcessorRunner) DisableMemoryStatsLogging() {
 	s.logMemoryStats = false
 }
 
+func (s *ProcessorRunner) EnableTradeAggregationUpserts() {
+	s.skipTradeAggregationUpserts = false
+}
+
+func (s *ProcessorRunner) DisableTradeAggregationUpserts() {
+	s.skipTradeAggregationUpserts = true
+}
+
 func (s *ProcessorRunner) buildChangeProcessor(
 	changeStats *ingest.StatsChangeProcessor,
 	source ingestionSource,
@@ -104,7 +125,7 @@ func (s *ProcessorRunner) buildChangeProcessor(
 	}
 
 	useLedgerCache := source == ledgerSource
-	return newGroupChangeProcessors([]horizonChangeProcessor{
+	changeProcessors := []horizonChangeProcessor{
 		statsChangeProcessor,
 		processors.NewAccountDataProcessor(s.historyQ),
 		processors.NewAccountsProcessor(s.historyQ),
@@ -113,7 +134,17 @@ func (s *ProcessorRunner) buildChangeProcessor(
 		processors.NewSignersProcessor(s.historyQ, useLedgerCache),
 		processors.NewTrustLinesProcessor(s.historyQ),
 		processors.NewClaimableBalancesChangeProcessor(s.historyQ),
-	})
+	}
+	// When ingesting ledgers market stats also depend on trades so they are
+	// updated after running transaction processors, see
+	// RunAllProcessorsOnLedger.
+	if source == historyArchiveSource {
+		changeProcessors = append(
+			changeProcessors,
+			processors.NewMarketStatsProcessor(s.historyQ, ledgerSequence, time.Time{}),
+		)
+	}
+	return newGroupChangeProcessors(changeProcessors)
 }
 
 func (s *ProcessorRunner) buildTransactionProcessor(
@@ -130,7 +161,7 @@ func (s *ProcessorRunner) buildTransactionProcessor(
 		processors.NewEffectProcessor(s.historyQ, sequence),
 		processors.NewLedgerProcessor(s.historyQ, ledger, CurrentVersion),
 		processors.NewOperationProcessor(s.historyQ, sequence),
-		processors.NewTradeProcessor(s.historyQ, ledger),
+		processors.NewTradeProcessor(s.historyQ, ledger, !s.skipTradeAggregationUpserts),
 		processors.NewParticipantsProcessor(s.historyQ, sequence),
 		processors.NewTransactionProcessor(s.historyQ, sequence),
 		processors.NewClaimableBalancesTransactionProcessor(s.historyQ, sequence),
@@ -258,6 +289,22 @@ func (s *ProcessorRunner) runChangeProcessorOnLedger(
 	return nil
 }
 
+// ensureHistoryPartitions creates the history partitions required to store
+// the given ledger. Partitions are only checked when ledgers outside of the
+// range of the partitions checked last are ingested.
+func (s *ProcessorRunner) ensureHistoryPartitions(sequence uint32) error {
+	if sequence >= s.historyPartitionsFrom && sequence < s.historyPartitionsTo {
+		return nil
+	}
+
+	from, to, err := s.historyQ.EnsureHistoryPartitions(sequence)
+	if err != nil {
+		return err
+	}
+	s.historyPartitionsFrom, s.historyPartitionsTo = from, to
+	return nil
+}
+
 func (s *ProcessorRunner) RunTransactionProcessorsOnLedger(ledger xdr.LedgerCloseMeta) (
 	transactionStats processors.StatsLedgerTransactionProcessorResults,
 	transactionDurations processorsRunDurations,
@@ -279,6 +326,20 @@ func (s *ProcessorRunner) RunTransactionProcessorsOnLedger(ledger xdr.LedgerClos
 		return
 	}
 
+	// Partitions created in a transaction which is rolled back, or created or
+	// dropped by other processes (ex. `horizon db partition-history`), can make
+	// the cached range stale. It's checked again when ingesting a ledger fails.
+	defer func() {
+		if err != nil {
+			s.historyPartitionsFrom, s.historyPartitionsTo = 0, 0
+		}
+	}()
+
+	if err = s.ensureHistoryPartitions(ledger.LedgerSequence()); err != nil {
+		err = errors.Wrap(err, "Error creating history partitions")
+		return
+	}
+
 	groupTransactionProcessors := s.buildTransactionProcessor(&ledgerTransactionStats, transactionReader.GetHeader())
 	err = processors.StreamLedgerTransactions(groupTransactionProcessors, transactionReader)
 	if err != nil {
@@ -326,5 +387,22 @@ func (s *ProcessorRunner) RunAllProcessorsOnLedger(ledger xdr.LedgerCloseMeta) (
 		return
 	}
 
+	startTime := time.Now()
+	marketStatsProcessor := processors.NewMarketStatsProcessor(
+		s.historyQ,
+		ledger.LedgerSequence(),
+		ledgerCloseTime(ledger),
+	)
+	err = s.runChangeProcessorOnLedger(marketStatsProcessor, ledger)
+	if err != nil {
+		return
+	}
+	changeDurations.AddRunDuration(fmt.Sprintf("%T", marketStatsProcessor), startTime)
+
 	return
 }
+
+func ledgerCloseTime(ledger xdr.LedgerCloseMeta) time.Time {
+	closeTime := ledger.MustV0().LedgerHeader.Header.ScpValue.CloseTime
+	return time.Unix(int64(closeTime), 0).UTC()
+}
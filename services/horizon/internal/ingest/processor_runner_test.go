@@ -3,6 +3,7 @@ package ingest
 import (
 	"context"
 	"io"
+	"math"
 	"reflect"
 	"testing"
 
@@ -14,6 +15,8 @@ import (
 	"github.com/stellar/go/network"
 	"github.com/stellar/go/services/horizon/internal/db2/history"
 	"github.com/stellar/go/services/horizon/internal/ingest/processors"
+	"github.com/stellar/go/support/errors"
+	strtime "github.com/stellar/go/support/time"
 	"github.com/stellar/go/xdr"
 )
 
@@ -70,6 +73,8 @@ func TestProcessorRunnerRunHistoryArchiveIngestionGenesis(t *testing.T) {
 
 	q.MockQAssetStats.On("InsertAssetStats", []history.ExpAssetStat{}, 100000).
 		Return(nil)
+	q.On("ResetMarketStatsOrderBook").Return(nil).Once()
+	q.On("DeleteEmptyMarketStats").Return(int64(0), nil).Once()
 
 	runner := ProcessorRunner{
 		config: Config{
@@ -160,6 +165,8 @@ func TestProcessorRunnerRunHistoryArchiveIngestionHistoryArchive(t *testing.T) {
 
 	q.MockQAssetStats.On("InsertAssetStats", []history.ExpAssetStat{}, 100000).
 		Return(nil)
+	q.On("ResetMarketStatsOrderBook").Return(nil).Once()
+	q.On("DeleteEmptyMarketStats").Return(int64(0), nil).Once()
 
 	runner := ProcessorRunner{
 		ctx:            context.Background(),
@@ -252,6 +259,7 @@ func TestProcessorRunnerBuildChangeProcessor(t *testing.T) {
 	assert.True(t, reflect.ValueOf(processor.processors[5]).
 		Elem().FieldByName("useLedgerEntryCache").Bool())
 	assert.IsType(t, &processors.TrustLinesProcessor{}, processor.processors[6])
+	assert.Len(t, processor.processors, 8)
 
 	runner = ProcessorRunner{
 		historyQ: q,
@@ -271,6 +279,7 @@ func TestProcessorRunnerBuildChangeProcessor(t *testing.T) {
 	assert.False(t, reflect.ValueOf(processor.processors[5]).
 		Elem().FieldByName("useLedgerEntryCache").Bool())
 	assert.IsType(t, &processors.TrustLinesProcessor{}, processor.processors[6])
+	assert.IsType(t, &processors.MarketStatsProcessor{}, processor.processors[8])
 }
 
 func TestProcessorRunnerBuildTransactionProcessor(t *testing.T) {
@@ -361,6 +370,10 @@ func TestProcessorRunnerRunAllProcessorsOnLedger(t *testing.T) {
 
 	q.MockQLedgers.On("InsertLedger", ledger.V0.LedgerHeader, 0, 0, 0, 0, CurrentVersion).
 		Return(int64(1), nil).Once()
+	q.On("EnsureHistoryPartitions", uint32(0)).Return(uint32(0), uint32(math.MaxUint32), nil).Once()
+	q.On("UpdateMarketStatsTrades", uint32(0), strtime.MillisFromInt64(-24*60*60*1000), []history.MarketStatsPair(nil)).
+		Return(nil).Once()
+	q.On("DeleteEmptyMarketStats").Return(int64(0), nil).Once()
 
 	runner := ProcessorRunner{
 		ctx:      context.Background(),
@@ -432,3 +445,25 @@ func TestProcessorRunnerRunAllProcessorsOnLedgerProtocolVersionNotSupported(t *t
 	_, _, _, _, err := runner.RunAllProcessorsOnLedger(ledger)
 	assert.EqualError(t, err, "Error while checking for supported protocol version: This Horizon version does not support protocol version 200. The latest supported protocol version is 17. Please upgrade to the latest Horizon version.")
 }
+
+func TestProcessorRunnerEnsureHistoryPartitions(t *testing.T) {
+	q := &mockDBQ{}
+	defer mock.AssertExpectationsForObjects(t, q)
+
+	runner := ProcessorRunner{
+		ctx:      context.Background(),
+		historyQ: q,
+	}
+
+	q.On("EnsureHistoryPartitions", uint32(1500)).Return(uint32(1000), uint32(2000), nil).Once()
+	assert.NoError(t, runner.ensureHistoryPartitions(1500))
+	assert.NoError(t, runner.ensureHistoryPartitions(1999))
+
+	q.On("EnsureHistoryPartitions", uint32(2000)).Return(uint32(2000), uint32(3000), nil).Once()
+	assert.NoError(t, runner.ensureHistoryPartitions(2000))
+	assert.NoError(t, runner.ensureHistoryPartitions(2500))
+
+	q.On("EnsureHistoryPartitions", uint32(999)).Return(uint32(0), uint32(0), errors.New("db error")).Once()
+	assert.EqualError(t, runner.ensureHistoryPartitions(999), "db error")
+	assert.NoError(t, runner.ensureHistoryPartitions(2500))
+}
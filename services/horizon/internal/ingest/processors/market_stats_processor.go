@@ -0,0 +1,148 @@
+package processors
+
+import (
+	"sort"
+	"time"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/services/horizon/internal/db2/history"
+	"github.com/stellar/go/support/errors"
+	strtime "github.com/stellar/go/support/time"
+	"github.com/stellar/go/xdr"
+)
+
+// marketStatsWindow is the period covered by the trade statistics in the
+// exp_market_stats table.
+const marketStatsWindow = 24 * time.Hour
+
+// MarketStatsProcessor maintains the rolling 24 hour trade statistics and the
+// best bid and ask of asset pairs in the exp_market_stats table. Every trade
+// updates the offer it crosses, so the pairs affected by a ledger are found
+// in its offer changes. The statistics are computed from the offers table and
+// the trade aggregation buckets so the processor must be committed after
+// OffersProcessor and TradeProcessor.
+type MarketStatsProcessor struct {
+	marketStatsQ history.QMarketStats
+	sequence     uint32
+	closeTime    time.Time
+
+	assets map[string]xdr.Asset
+	pairs  map[[2]string]bool
+}
+
+// NewMarketStatsProcessor constructs a new MarketStatsProcessor instance. A
+// zero closeTime means the changes come from a history archive snapshot: the
+// best bid and ask of all pairs are rebuilt and the trade statistics are left
+// untouched.
+func NewMarketStatsProcessor(
+	marketStatsQ history.QMarketStats,
+	sequence uint32,
+	closeTime time.Time,
+) *MarketStatsProcessor {
+	return &MarketStatsProcessor{
+		marketStatsQ: marketStatsQ,
+		sequence:     sequence,
+		closeTime:    closeTime,
+		assets:       map[string]xdr.Asset{},
+		pairs:        map[[2]string]bool{},
+	}
+}
+
+func (p *MarketStatsProcessor) ProcessChange(change ingest.Change) error {
+	if change.Type != xdr.LedgerEntryTypeOffer {
+		return nil
+	}
+
+	for _, entry := range []*xdr.LedgerEntry{change.Pre, change.Post} {
+		if entry == nil {
+			continue
+		}
+		offer := entry.Data.MustOffer()
+		p.addPair(offer.Selling, offer.Buying)
+	}
+
+	return nil
+}
+
+func (p *MarketStatsProcessor) addPair(asset1, asset2 xdr.Asset) {
+	key1, key2 := asset1.String(), asset2.String()
+	p.assets[key1] = asset1
+	p.assets[key2] = asset2
+	if key1 > key2 {
+		key1, key2 = key2, key1
+	}
+	p.pairs[[2]string{key1, key2}] = true
+}
+
+func (p *MarketStatsProcessor) marketStatsPairs() ([]history.MarketStatsPair, error) {
+	if len(p.pairs) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(p.assets))
+	for key := range p.assets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	assets := make([]xdr.Asset, 0, len(keys))
+	for _, key := range keys {
+		assets = append(assets, p.assets[key])
+	}
+
+	assetMap, err := p.marketStatsQ.CreateAssets(assets, maxBatchSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating asset ids")
+	}
+
+	pairs := make([]history.MarketStatsPair, 0, len(p.pairs))
+	for pair := range p.pairs {
+		pairs = append(pairs, history.NewMarketStatsPair(
+			assetMap[pair[0]], p.assets[pair[0]],
+			assetMap[pair[1]], p.assets[pair[1]],
+		))
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].BaseAssetID != pairs[j].BaseAssetID {
+			return pairs[i].BaseAssetID < pairs[j].BaseAssetID
+		}
+		return pairs[i].CounterAssetID < pairs[j].CounterAssetID
+	})
+
+	return pairs, nil
+}
+
+func (p *MarketStatsProcessor) Commit() error {
+	pairs, err := p.marketStatsPairs()
+	if err != nil {
+		return err
+	}
+
+	fromHistoryArchive := p.closeTime.IsZero()
+	if fromHistoryArchive {
+		if err = p.marketStatsQ.ResetMarketStatsOrderBook(); err != nil {
+			return errors.Wrap(err, "Error resetting market stats order book")
+		}
+	}
+
+	if len(pairs) > 0 {
+		if err = p.marketStatsQ.UpdateMarketStatsOrderBook(p.sequence, pairs); err != nil {
+			return errors.Wrap(err, "Error updating market stats order book")
+		}
+	}
+
+	if !fromHistoryArchive {
+		// the window is aligned to the 1 minute trade aggregation buckets
+		windowStart := strtime.MillisFromSeconds(p.closeTime.Add(-marketStatsWindow).Unix()).
+			RoundDown(int64(time.Minute / time.Millisecond))
+		if err = p.marketStatsQ.UpdateMarketStatsTrades(p.sequence, windowStart, pairs); err != nil {
+			return errors.Wrap(err, "Error updating market stats trades")
+		}
+	}
+
+	if _, err = p.marketStatsQ.DeleteEmptyMarketStats(); err != nil {
+		return errors.Wrap(err, "Error deleting empty market stats")
+	}
+
+	return nil
+}
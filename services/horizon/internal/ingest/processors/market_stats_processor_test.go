@@ -0,0 +1,146 @@
+//lint:file-ignore U1001 Ignore all unused code, staticcheck doesn't understand testify/suite
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/services/horizon/internal/db2/history"
+	"github.com/stellar/go/support/errors"
+	strtime "github.com/stellar/go/support/time"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMarketStatsProcessorTestSuite(t *testing.T) {
+	suite.Run(t, new(MarketStatsProcessorTestSuite))
+}
+
+type MarketStatsProcessorTestSuite struct {
+	suite.Suite
+	mockQ     *history.MockQMarketStats
+	closeTime time.Time
+	eur       xdr.Asset
+	usd       xdr.Asset
+	native    xdr.Asset
+}
+
+func (s *MarketStatsProcessorTestSuite) SetupTest() {
+	s.mockQ = &history.MockQMarketStats{}
+	s.closeTime = time.Date(2021, 3, 4, 12, 30, 45, 0, time.UTC)
+	s.eur = xdr.MustNewCreditAsset("EUR", trustLineIssuer.Address())
+	s.usd = xdr.MustNewCreditAsset("USD", trustLineIssuer.Address())
+	s.native = xdr.MustNewNativeAsset()
+}
+
+func (s *MarketStatsProcessorTestSuite) TearDownTest() {
+	s.mockQ.AssertExpectations(s.T())
+}
+
+func (s *MarketStatsProcessorTestSuite) offerChange(selling, buying xdr.Asset, removed bool) ingest.Change {
+	entry := &xdr.LedgerEntry{
+		Data: xdr.LedgerEntryData{
+			Type: xdr.LedgerEntryTypeOffer,
+			Offer: &xdr.OfferEntry{
+				SellerId: xdr.MustAddress("GAOQJGUAB7NI7K7I62ORBXMN3J4SSWQUQ7FOEPSDJ322W2HMCNWPHXFB"),
+				OfferId:  1,
+				Selling:  selling,
+				Buying:   buying,
+				Amount:   100,
+				Price:    xdr.Price{N: 1, D: 2},
+			},
+		},
+		LastModifiedLedgerSeq: 10,
+	}
+
+	change := ingest.Change{Type: xdr.LedgerEntryTypeOffer}
+	if removed {
+		change.Pre = entry
+	} else {
+		change.Post = entry
+	}
+	return change
+}
+
+func (s *MarketStatsProcessorTestSuite) TestNoChanges() {
+	processor := NewMarketStatsProcessor(s.mockQ, 100, s.closeTime)
+
+	windowStart := strtime.MillisFromSeconds(
+		time.Date(2021, 3, 3, 12, 30, 0, 0, time.UTC).Unix(),
+	)
+	s.mockQ.On("UpdateMarketStatsTrades", uint32(100), windowStart, []history.MarketStatsPair(nil)).
+		Return(nil).Once()
+	s.mockQ.On("DeleteEmptyMarketStats").Return(int64(0), nil).Once()
+
+	s.Assert().NoError(processor.Commit())
+}
+
+func (s *MarketStatsProcessorTestSuite) TestOfferChanges() {
+	processor := NewMarketStatsProcessor(s.mockQ, 100, s.closeTime)
+
+	// changes of the same pair in both directions are merged
+	s.Assert().NoError(processor.ProcessChange(s.offerChange(s.eur, s.native, false)))
+	s.Assert().NoError(processor.ProcessChange(s.offerChange(s.native, s.eur, true)))
+	s.Assert().NoError(processor.ProcessChange(s.offerChange(s.usd, s.eur, false)))
+	s.Assert().NoError(processor.ProcessChange(ingest.Change{
+		Type: xdr.LedgerEntryTypeAccount,
+	}))
+
+	s.mockQ.On("CreateAssets", []xdr.Asset{s.eur, s.usd, s.native}, maxBatchSize).
+		Return(map[string]history.Asset{
+			s.eur.String():    {ID: 3},
+			s.usd.String():    {ID: 2},
+			s.native.String(): {ID: 1},
+		}, nil).Once()
+
+	pairs := []history.MarketStatsPair{
+		{BaseAssetID: 1, CounterAssetID: 3, BaseAsset: s.native, CounterAsset: s.eur},
+		{BaseAssetID: 2, CounterAssetID: 3, BaseAsset: s.usd, CounterAsset: s.eur},
+	}
+	s.mockQ.On("UpdateMarketStatsOrderBook", uint32(100), pairs).Return(nil).Once()
+	s.mockQ.On("UpdateMarketStatsTrades", uint32(100), strtime.MillisFromSeconds(
+		time.Date(2021, 3, 3, 12, 30, 0, 0, time.UTC).Unix(),
+	), pairs).Return(nil).Once()
+	s.mockQ.On("DeleteEmptyMarketStats").Return(int64(1), nil).Once()
+
+	s.Assert().NoError(processor.Commit())
+}
+
+func (s *MarketStatsProcessorTestSuite) TestHistoryArchive() {
+	processor := NewMarketStatsProcessor(s.mockQ, 63, time.Time{})
+
+	s.Assert().NoError(processor.ProcessChange(s.offerChange(s.usd, s.eur, false)))
+
+	s.mockQ.On("CreateAssets", []xdr.Asset{s.eur, s.usd}, maxBatchSize).
+		Return(map[string]history.Asset{
+			s.eur.String(): {ID: 1},
+			s.usd.String(): {ID: 2},
+		}, nil).Once()
+	s.mockQ.On("ResetMarketStatsOrderBook").Return(nil).Once()
+	s.mockQ.On("UpdateMarketStatsOrderBook", uint32(63), []history.MarketStatsPair{
+		{BaseAssetID: 1, CounterAssetID: 2, BaseAsset: s.eur, CounterAsset: s.usd},
+	}).Return(nil).Once()
+	s.mockQ.On("DeleteEmptyMarketStats").Return(int64(0), nil).Once()
+
+	s.Assert().NoError(processor.Commit())
+}
+
+func (s *MarketStatsProcessorTestSuite) TestUpdateOrderBookError() {
+	processor := NewMarketStatsProcessor(s.mockQ, 100, s.closeTime)
+
+	s.Assert().NoError(processor.ProcessChange(s.offerChange(s.usd, s.eur, false)))
+
+	s.mockQ.On("CreateAssets", []xdr.Asset{s.eur, s.usd}, maxBatchSize).
+		Return(map[string]history.Asset{
+			s.eur.String(): {ID: 1},
+			s.usd.String(): {ID: 2},
+		}, nil).Once()
+	s.mockQ.On("UpdateMarketStatsOrderBook", uint32(100), []history.MarketStatsPair{
+		{BaseAssetID: 1, CounterAssetID: 2, BaseAsset: s.eur, CounterAsset: s.usd},
+	}).Return(errors.New("transient error")).Once()
+
+	err := processor.Commit()
+	s.Assert().EqualError(err, "Error updating market stats order book: transient error")
+}
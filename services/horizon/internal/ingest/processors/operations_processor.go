@@ -94,17 +94,19 @@ func (operation *transactionOperationWrapper) TransactionID() int64 {
 	return toid.New(int32(operation.ledgerSequence), int32(operation.transaction.Index), 0).ToInt64()
 }
 
-// SourceAccount returns the operation's source account.
-func (operation *transactionOperationWrapper) SourceAccount() *xdr.AccountId {
-	sourceAccount := operation.operation.SourceAccount
-	var sa xdr.AccountId
-	if sourceAccount != nil {
-		sa = sourceAccount.ToAccountId()
-	} else {
-		sa = operation.transaction.Envelope.SourceAccount().ToAccountId()
+// ledgerOperation returns the ingest.LedgerOperation for the operation.
+func (operation *transactionOperationWrapper) ledgerOperation() ingest.LedgerOperation {
+	return ingest.LedgerOperation{
+		Index:       operation.index,
+		Transaction: &operation.transaction,
+		Operation:   operation.operation,
 	}
+}
 
-	return &sa
+// SourceAccount returns the operation's source account.
+func (operation *transactionOperationWrapper) SourceAccount() *xdr.AccountId {
+	ledgerOperation := operation.ledgerOperation()
+	return ledgerOperation.SourceAccount()
 }
 
 // OperationType returns the operation type.
@@ -112,96 +114,27 @@ func (operation *transactionOperationWrapper) OperationType() xdr.OperationType
 	return operation.operation.Body.Type
 }
 
-func (operation *transactionOperationWrapper) getSignerSponsorInChange(signerKey string, change ingest.Change) xdr.SponsorshipDescriptor {
-	if change.Type != xdr.LedgerEntryTypeAccount || change.Post == nil {
-		return nil
-	}
-
-	preSigners := map[string]xdr.AccountId{}
-	if change.Pre != nil {
-		account := change.Pre.Data.MustAccount()
-		preSigners = account.SponsorPerSigner()
-	}
-
-	account := change.Post.Data.MustAccount()
-	postSigners := account.SponsorPerSigner()
-
-	pre, preFound := preSigners[signerKey]
-	post, postFound := postSigners[signerKey]
-
-	if !postFound {
-		return nil
-	}
-
-	if preFound {
-		formerSponsor := pre.Address()
-		newSponsor := post.Address()
-		if formerSponsor == newSponsor {
-			return nil
-		}
-	}
-
-	return &post
-}
-
 func (operation *transactionOperationWrapper) getSponsor() (*xdr.AccountId, error) {
-	changes, err := operation.transaction.GetOperationChanges(operation.index)
-	if err != nil {
-		return nil, err
-	}
-	var signerKey string
-	if setOps, ok := operation.operation.Body.GetSetOptionsOp(); ok && setOps.Signer != nil {
-		signerKey = setOps.Signer.Key.Address()
-	}
-
-	for _, c := range changes {
-		// Check Signer changes
-		if signerKey != "" {
-			if sponsorAccount := operation.getSignerSponsorInChange(signerKey, c); sponsorAccount != nil {
-				return sponsorAccount, nil
-			}
-		}
-
-		// Check Ledger key changes
-		if c.Pre != nil || c.Post == nil {
-			// We are only looking for entry creations denoting that a sponsor
-			// is associated to the ledger entry of the operation.
-			continue
-		}
-		if sponsorAccount := c.Post.SponsoringID(); sponsorAccount != nil {
-			return sponsorAccount, nil
-		}
-	}
-
-	return nil, nil
+	ledgerOperation := operation.ledgerOperation()
+	return ledgerOperation.Sponsor()
 }
 
 // OperationResult returns the operation's result record
 func (operation *transactionOperationWrapper) OperationResult() *xdr.OperationResultTr {
-	results, _ := operation.transaction.Result.OperationResults()
-	tr := results[operation.index].MustTr()
-	return &tr
+	ledgerOperation := operation.ledgerOperation()
+	return ledgerOperation.OperationResult()
 }
 
 func (operation *transactionOperationWrapper) findInitatingBeginSponsoringOp() *transactionOperationWrapper {
-	if !operation.transaction.Result.Successful() {
-		// Failed transactions may not have a compliant sandwich structure
-		// we can rely on (e.g. invalid nesting or a being operation with the wrong sponsoree ID)
-		// and thus we bail out since we could return incorrect information.
+	ledgerOperation := operation.ledgerOperation()
+	beginOperation := ledgerOperation.BeginSponsoringOperation()
+	if beginOperation == nil {
 		return nil
 	}
-	sponsoree := operation.SourceAccount()
-	operations := operation.transaction.Envelope.Operations()
-	for i := int(operation.index) - 1; i >= 0; i-- {
-		if beginOp, ok := operations[i].Body.GetBeginSponsoringFutureReservesOp(); ok &&
-			beginOp.SponsoredId.Address() == sponsoree.Address() {
-			result := *operation
-			result.index = uint32(i)
-			result.operation = operations[i]
-			return &result
-		}
-	}
-	return nil
+	result := *operation
+	result.index = beginOperation.Index
+	result.operation = beginOperation.Operation
+	return &result
 }
 
 // Details returns the operation details as a map which can be stored as JSON.
@@ -557,115 +490,10 @@ func addLedgerKeyDetails(result map[string]interface{}, ledgerKey xdr.LedgerKey)
 	return nil
 }
 
-func getLedgerKeyParticipants(ledgerKey xdr.LedgerKey) []xdr.AccountId {
-	var result []xdr.AccountId
-	switch ledgerKey.Type {
-	case xdr.LedgerEntryTypeAccount:
-		result = append(result, ledgerKey.Account.AccountId)
-	case xdr.LedgerEntryTypeClaimableBalance:
-		// nothing to do
-	case xdr.LedgerEntryTypeData:
-		result = append(result, ledgerKey.Data.AccountId)
-	case xdr.LedgerEntryTypeOffer:
-		result = append(result, ledgerKey.Offer.SellerId)
-	case xdr.LedgerEntryTypeTrustline:
-		result = append(result, ledgerKey.TrustLine.AccountId)
-	}
-	return result
-}
-
 // Participants returns the accounts taking part in the operation.
 func (operation *transactionOperationWrapper) Participants() ([]xdr.AccountId, error) {
-	participants := []xdr.AccountId{}
-	participants = append(participants, *operation.SourceAccount())
-	op := operation.operation
-
-	switch operation.OperationType() {
-	case xdr.OperationTypeCreateAccount:
-		participants = append(participants, op.Body.MustCreateAccountOp().Destination)
-	case xdr.OperationTypePayment:
-		participants = append(participants, op.Body.MustPaymentOp().Destination.ToAccountId())
-	case xdr.OperationTypePathPaymentStrictReceive:
-		participants = append(participants, op.Body.MustPathPaymentStrictReceiveOp().Destination.ToAccountId())
-	case xdr.OperationTypePathPaymentStrictSend:
-		participants = append(participants, op.Body.MustPathPaymentStrictSendOp().Destination.ToAccountId())
-	case xdr.OperationTypeManageBuyOffer:
-		// the only direct participant is the source_account
-	case xdr.OperationTypeManageSellOffer:
-		// the only direct participant is the source_account
-	case xdr.OperationTypeCreatePassiveSellOffer:
-		// the only direct participant is the source_account
-	case xdr.OperationTypeSetOptions:
-		// the only direct participant is the source_account
-	case xdr.OperationTypeChangeTrust:
-		// the only direct participant is the source_account
-	case xdr.OperationTypeAllowTrust:
-		participants = append(participants, op.Body.MustAllowTrustOp().Trustor)
-	case xdr.OperationTypeAccountMerge:
-		participants = append(participants, op.Body.MustDestination().ToAccountId())
-	case xdr.OperationTypeInflation:
-		// the only direct participant is the source_account
-	case xdr.OperationTypeManageData:
-		// the only direct participant is the source_account
-	case xdr.OperationTypeBumpSequence:
-		// the only direct participant is the source_account
-	case xdr.OperationTypeCreateClaimableBalance:
-		for _, c := range op.Body.MustCreateClaimableBalanceOp().Claimants {
-			participants = append(participants, c.MustV0().Destination)
-		}
-	case xdr.OperationTypeClaimClaimableBalance:
-		// the only direct participant is the source_account
-	case xdr.OperationTypeBeginSponsoringFutureReserves:
-		participants = append(participants, op.Body.MustBeginSponsoringFutureReservesOp().SponsoredId)
-	case xdr.OperationTypeEndSponsoringFutureReserves:
-		beginSponsorshipOp := operation.findInitatingBeginSponsoringOp()
-		if beginSponsorshipOp != nil {
-			participants = append(participants, *beginSponsorshipOp.SourceAccount())
-		}
-	case xdr.OperationTypeRevokeSponsorship:
-		op := operation.operation.Body.MustRevokeSponsorshipOp()
-		switch op.Type {
-		case xdr.RevokeSponsorshipTypeRevokeSponsorshipLedgerEntry:
-			participants = append(participants, getLedgerKeyParticipants(*op.LedgerKey)...)
-		case xdr.RevokeSponsorshipTypeRevokeSponsorshipSigner:
-			participants = append(participants, op.Signer.AccountId)
-			// We don't add signer as a participant because a signer can be arbitrary account.
-			// This can spam successful operations history of any account.
-		}
-	case xdr.OperationTypeClawback:
-		op := operation.operation.Body.MustClawbackOp()
-		participants = append(participants, op.From.ToAccountId())
-	case xdr.OperationTypeClawbackClaimableBalance:
-	// Nothing to do here
-	case xdr.OperationTypeSetTrustLineFlags:
-		op := operation.operation.Body.MustSetTrustLineFlagsOp()
-		participants = append(participants, op.Trustor)
-	default:
-		return participants, fmt.Errorf("Unknown operation type: %s", op.Body.Type)
-	}
-
-	sponsor, err := operation.getSponsor()
-	if err != nil {
-		return nil, err
-	}
-	if sponsor != nil {
-		participants = append(participants, *sponsor)
-	}
-
-	return dedupeParticipants(participants), nil
-}
-
-// dedupeParticipants remove any duplicate ids from `in`
-func dedupeParticipants(in []xdr.AccountId) (out []xdr.AccountId) {
-	set := map[string]xdr.AccountId{}
-	for _, id := range in {
-		set[id.Address()] = id
-	}
-
-	for _, id := range set {
-		out = append(out, id)
-	}
-	return
+	ledgerOperation := operation.ledgerOperation()
+	return ledgerOperation.Participants()
 }
 
 // OperationsParticipants returns a map with all participants per operation
@@ -18,13 +18,22 @@ type TradeProcessor struct {
 	buyers     []string
 	accountSet map[string]int64
 	assets     []xdr.Asset
+
+	// upsertAggregations is false when the trade aggregation buckets of the
+	// ledger are rebuilt after ingestion instead.
+	upsertAggregations bool
 }
 
-func NewTradeProcessor(tradesQ history.QTrades, ledger xdr.LedgerHeaderHistoryEntry) *TradeProcessor {
+func NewTradeProcessor(
+	tradesQ history.QTrades,
+	ledger xdr.LedgerHeaderHistoryEntry,
+	upsertAggregations bool,
+) *TradeProcessor {
 	return &TradeProcessor{
-		tradesQ:    tradesQ,
-		ledger:     ledger,
-		accountSet: map[string]int64{},
+		tradesQ:            tradesQ,
+		ledger:             ledger,
+		accountSet:         map[string]int64{},
+		upsertAggregations: upsertAggregations,
 	}
 }
 
@@ -81,6 +90,12 @@ func (p *TradeProcessor) Commit() error {
 		if err = batch.Exec(); err != nil {
 			return errors.Wrap(err, "Error flushing operation batch")
 		}
+
+		if p.upsertAggregations {
+			if err = p.tradesQ.UpsertTradeAggregationBuckets(uint32(p.ledger.Header.LedgerSeq)); err != nil {
+				return errors.Wrap(err, "Error upserting trade aggregations")
+			}
+		}
 	}
 
 	return nil
@@ -147,6 +147,7 @@ func (s *TradeProcessorTestSuiteLedger) SetupTest() {
 				LedgerSeq: 100,
 			},
 		},
+		true,
 	)
 }
 
@@ -490,6 +491,11 @@ func (s *TradeProcessorTestSuiteLedger) mockReadTradeTransactions(
 	return inserts
 }
 
+func (s *TradeProcessorTestSuiteLedger) mockUpsertTradeAggregations(err error) {
+	s.mockQ.On("UpsertTradeAggregationBuckets", uint32(s.processor.ledger.Header.LedgerSeq)).
+		Return(err).Once()
+}
+
 func (s *TradeProcessorTestSuiteLedger) TestIngestTradesSucceeds() {
 	inserts := s.mockReadTradeTransactions(s.processor.ledger)
 
@@ -517,6 +523,31 @@ func (s *TradeProcessorTestSuiteLedger) TestIngestTradesSucceeds() {
 		}).Return(nil).Once()
 	}
 
+	s.mockBatchInsertBuilder.On("Exec").Return(nil).Once()
+	s.mockUpsertTradeAggregations(nil)
+
+	for _, tx := range s.txs {
+		err := s.processor.ProcessTransaction(tx)
+		s.Assert().NoError(err)
+	}
+
+	err := s.processor.Commit()
+	s.Assert().NoError(err)
+}
+
+func (s *TradeProcessorTestSuiteLedger) TestIngestTradesWithoutAggregations() {
+	s.processor.upsertAggregations = false
+	inserts := s.mockReadTradeTransactions(s.processor.ledger)
+
+	s.mockQ.On("CreateAccounts", mock.AnythingOfType("[]string"), maxBatchSize).
+		Return(s.unmuxedAccountToID, nil).Once()
+	s.mockQ.On("CreateAssets", mock.AnythingOfType("[]xdr.Asset"), maxBatchSize).
+		Return(s.assetToID, nil).Once()
+	for _, insert := range inserts {
+		s.mockBatchInsertBuilder.On("Add", []history.InsertTrade{
+			insert,
+		}).Return(nil).Once()
+	}
 	s.mockBatchInsertBuilder.On("Exec").Return(nil).Once()
 
 	for _, tx := range s.txs {
@@ -646,6 +677,27 @@ func (s *TradeProcessorTestSuiteLedger) TestBatchExecError() {
 	s.Assert().EqualError(err, "Error flushing operation batch: exec error")
 }
 
+func (s *TradeProcessorTestSuiteLedger) TestUpsertTradeAggregationsError() {
+	insert := s.mockReadTradeTransactions(s.processor.ledger)
+
+	s.mockQ.On("CreateAccounts", mock.AnythingOfType("[]string"), maxBatchSize).
+		Return(s.unmuxedAccountToID, nil).Once()
+	s.mockQ.On("CreateAssets", mock.AnythingOfType("[]xdr.Asset"), maxBatchSize).
+		Return(s.assetToID, nil).Once()
+	s.mockBatchInsertBuilder.On("Add", mock.AnythingOfType("[]history.InsertTrade")).
+		Return(nil).Times(len(insert))
+	s.mockBatchInsertBuilder.On("Exec").Return(nil).Once()
+	s.mockUpsertTradeAggregations(fmt.Errorf("upsert error"))
+
+	for _, tx := range s.txs {
+		err := s.processor.ProcessTransaction(tx)
+		s.Assert().NoError(err)
+	}
+
+	err := s.processor.Commit()
+	s.Assert().EqualError(err, "Error upserting trade aggregations: upsert error")
+}
+
 func (s *TradeProcessorTestSuiteLedger) TestIgnoreCheckIfSmallLedger() {
 	insert := s.mockReadTradeTransactions(s.processor.ledger)
 
@@ -670,6 +722,7 @@ func (s *TradeProcessorTestSuiteLedger) TestIgnoreCheckIfSmallLedger() {
 	s.mockBatchInsertBuilder.On("Add", mock.AnythingOfType("[]history.InsertTrade")).
 		Return(nil).Times(len(insert))
 	s.mockBatchInsertBuilder.On("Exec").Return(nil).Once()
+	s.mockUpsertTradeAggregations(nil)
 
 	for _, tx := range s.txs {
 		err := s.processor.ProcessTransaction(tx)
@@ -66,6 +66,8 @@ func initIngester(app *App) {
 		// Use the first archive for now. We don't have a mechanism to
 		// use multiple archives at the same time currently.
 		HistoryArchiveURL:           app.config.HistoryArchiveURLs[0],
+		HistoryArchiveCachePath:     app.config.HistoryArchiveCachePath,
+		HistoryArchiveCacheMaxSize:  int64(app.config.HistoryArchiveCacheMaxSize) << 20,
 		CheckpointFrequency:         app.config.CheckpointFrequency,
 		StellarCoreURL:              app.config.StellarCoreURL,
 		StellarCoreCursor:           app.config.CursorName,
@@ -75,6 +77,7 @@ func initIngester(app *App) {
 		CaptiveCoreHTTPPort:         app.config.CaptiveCoreHTTPPort,
 		CaptiveCorePeerPort:         app.config.CaptiveCorePeerPort,
 		CaptiveCoreLogPath:          app.config.CaptiveCoreLogPath,
+		CaptiveCoreMaxRestarts:      app.config.CaptiveCoreMaxRestarts,
 		RemoteCaptiveCoreURL:        app.config.RemoteCaptiveCoreURL,
 		EnableCaptiveCore:           app.config.EnableCaptiveCoreIngestion,
 		DisableStateVerification:    app.config.IngestDisableStateVerification,
@@ -280,6 +283,9 @@ func initIngestMetrics(app *App) {
 	app.prometheusRegistry.MustRegister(app.ingester.Metrics().LedgerStatsCounter)
 	app.prometheusRegistry.MustRegister(app.ingester.Metrics().ProcessorsRunDuration)
 	app.prometheusRegistry.MustRegister(app.ingester.Metrics().CaptiveStellarCoreSynced)
+	if collector := app.ingester.Metrics().CaptiveStellarCoreStatus; collector != nil {
+		app.prometheusRegistry.MustRegister(collector)
+	}
 }
 
 func initTxSubMetrics(app *App) {
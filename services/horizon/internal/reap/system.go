@@ -65,6 +65,15 @@ func (r *System) runOnce() {
 func (r *System) clearBefore(seq int32) error {
 	log.WithField("new_elder", seq).Info("reaper: clearing")
 
+	partitioning, err := r.HistoryQ.GetHistoryPartitioning()
+	if err != nil {
+		return err
+	}
+
+	if partitioning.Enabled() {
+		return r.clearPartitionedBefore(seq)
+	}
+
 	start, end, err := toid.LedgerRangeInclusive(1, seq-1)
 	if err != nil {
 		return err
@@ -75,5 +84,43 @@ func (r *System) clearBefore(seq int32) error {
 		return err
 	}
 
+	err = r.HistoryQ.DeleteTradeAggregationBucketsBefore(uint32(seq))
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// clearPartitionedBefore reaps history when history tables are partitioned.
+// Partitioned tables are reaped by dropping whole partitions so their history
+// can only be removed up to the start of the partition containing seq. Tables
+// which are not partitioned, including trade aggregation buckets, are cleared
+// up to the same ledger, so all tables retain the same history.
+func (r *System) clearPartitionedBefore(seq int32) error {
+	elder, err := r.HistoryQ.DropHistoryPartitionsBefore(uint32(seq))
+	if err != nil {
+		return err
+	}
+
+	// no partitions were dropped, the retained history did not change
+	if elder <= 1 {
+		return nil
+	}
+
+	log.WithField("new_elder", elder).Info("reaper: dropped history partitions")
+
+	// trade aggregation buckets use the close times of the ledgers which are
+	// cleared below
+	err = r.HistoryQ.DeleteTradeAggregationBucketsBefore(elder)
+	if err != nil {
+		return err
+	}
+
+	start, end, err := toid.LedgerRangeInclusive(1, int32(elder-1))
+	if err != nil {
+		return err
+	}
+
+	return r.HistoryQ.DeleteUnpartitionedHistoryRange(start, end)
+}
@@ -3,6 +3,7 @@ package reap
 import (
 	"testing"
 
+	"github.com/stellar/go/services/horizon/internal/db2/history"
 	"github.com/stellar/go/services/horizon/internal/ledger"
 	"github.com/stellar/go/services/horizon/internal/test"
 )
@@ -49,3 +50,28 @@ func TestDeleteUnretainedHistory(t *testing.T) {
 		tt.Assert.Equal(1, cur)
 	}
 }
+
+func TestDeleteUnretainedPartitionedHistory(t *testing.T) {
+	tt := test.Start(t)
+	defer tt.Finish()
+	ledgerState := &ledger.State{}
+	ledgerState.SetStatus(tt.Scenario("kahuna"))
+
+	db := tt.HorizonSession()
+	q := &history.Q{db}
+
+	var prev, cur int
+	tt.Require.NoError(db.GetRaw(&prev, `SELECT COUNT(*) FROM history_ledgers`))
+
+	status := tt.LoadLedgerStatus()
+	tt.Require.NoError(q.PartitionHistoryTables(1000, uint32(status.HistoryLatest)))
+	ledgerState.SetStatus(status)
+
+	// all ledgers are in the legacy partition which can't be dropped, the
+	// unpartitioned tables must retain them too
+	sys := New(10, db, ledgerState)
+	if tt.Assert.NoError(sys.DeleteUnretainedHistory()) {
+		tt.Require.NoError(db.GetRaw(&cur, `SELECT COUNT(*) FROM history_ledgers`))
+		tt.Assert.Equal(prev, cur)
+	}
+}
@@ -0,0 +1,62 @@
+package resourceadapter
+
+import (
+	"context"
+
+	"github.com/guregu/null"
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/price"
+	protocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/services/horizon/internal/db2/history"
+	"github.com/stellar/go/xdr"
+)
+
+// PopulateMarketStats fills out the details of market stats using a row from
+// the exp_market_stats table.
+func PopulateMarketStats(
+	ctx context.Context,
+	dest *protocol.MarketStats,
+	row history.MarketStats,
+) error {
+	var err error
+	dest.Base.Type = row.BaseAssetType
+	dest.Base.Code = row.BaseAssetCode
+	dest.Base.Issuer = row.BaseAssetIssuer
+	dest.Counter.Type = row.CounterAssetType
+	dest.Counter.Code = row.CounterAssetCode
+	dest.Counter.Issuer = row.CounterAssetIssuer
+	dest.PT = row.PagingToken()
+	dest.TradeCount = row.TradeCount
+	dest.BaseVolume, err = amount.IntStringToAmount(row.BaseVolume)
+	if err != nil {
+		return err
+	}
+	dest.CounterVolume, err = amount.IntStringToAmount(row.CounterVolume)
+	if err != nil {
+		return err
+	}
+	if row.VolumeWeightedPrice.Valid {
+		dest.Average = price.StringFromFloat64(row.VolumeWeightedPrice.Float64)
+	}
+	dest.Open, dest.OpenR = marketStatsPrice(row.OpenN, row.OpenD)
+	dest.High, dest.HighR = marketStatsPrice(row.HighN, row.HighD)
+	dest.Low, dest.LowR = marketStatsPrice(row.LowN, row.LowD)
+	dest.Close, dest.CloseR = marketStatsPrice(row.CloseN, row.CloseD)
+	dest.Bid, dest.BidR = marketStatsPrice(row.BidN, row.BidD)
+	dest.Ask, dest.AskR = marketStatsPrice(row.AskN, row.AskD)
+	if dest.BidR != nil && dest.AskR != nil {
+		spread := float64(dest.AskR.N)/float64(dest.AskR.D) - float64(dest.BidR.N)/float64(dest.BidR.D)
+		dest.Spread = price.StringFromFloat64(spread)
+	}
+	dest.LastModifiedLedger = row.LastModifiedLedger
+	return nil
+}
+
+func marketStatsPrice(n, d null.Int) (string, *xdr.Price) {
+	if !n.Valid || !d.Valid || d.Int64 == 0 {
+		return "", nil
+	}
+
+	p := xdr.Price{N: xdr.Int32(n.Int64), D: xdr.Int32(d.Int64)}
+	return p.String(), &p
+}
@@ -0,0 +1,76 @@
+package resourceadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/guregu/null"
+	protocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/services/horizon/internal/db2/history"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPopulateMarketStats(t *testing.T) {
+	row := history.MarketStats{
+		BaseAssetID:         1,
+		BaseAssetType:       "native",
+		CounterAssetID:      2,
+		CounterAssetType:    "credit_alphanum4",
+		CounterAssetCode:    "USD",
+		CounterAssetIssuer:  "GBZ35ZJRIKJGYH5PBKLKOZ5L6EXCNTO7BKIL7DAVVDFQ2ODJEEHHJXIM",
+		TradeCount:          3,
+		BaseVolume:          "300000000",
+		CounterVolume:       "60000000",
+		OpenN:               null.IntFrom(1),
+		OpenD:               null.IntFrom(4),
+		HighN:               null.IntFrom(1),
+		HighD:               null.IntFrom(4),
+		LowN:                null.IntFrom(1),
+		LowD:                null.IntFrom(5),
+		CloseN:              null.IntFrom(1),
+		CloseD:              null.IntFrom(5),
+		BidN:                null.IntFrom(1),
+		BidD:                null.IntFrom(5),
+		AskN:                null.IntFrom(1),
+		AskD:                null.IntFrom(4),
+		LastModifiedLedger:  123,
+		VolumeWeightedPrice: null.FloatFrom(0.2),
+	}
+
+	var res protocol.MarketStats
+	assert.NoError(t, PopulateMarketStats(context.Background(), &res, row))
+
+	assert.Equal(t, "native", res.Base.Type)
+	assert.Equal(t, "USD", res.Counter.Code)
+	assert.Equal(t, "1_2", res.PT)
+	assert.Equal(t, int64(3), res.TradeCount)
+	assert.Equal(t, "30.0000000", res.BaseVolume)
+	assert.Equal(t, "6.0000000", res.CounterVolume)
+	assert.Equal(t, "0.2000000", res.Average)
+	assert.Equal(t, "0.2500000", res.Open)
+	assert.Equal(t, &xdr.Price{N: 1, D: 4}, res.OpenR)
+	assert.Equal(t, "0.2000000", res.Close)
+	assert.Equal(t, "0.2000000", res.Bid)
+	assert.Equal(t, "0.2500000", res.Ask)
+	assert.Equal(t, "0.0500000", res.Spread)
+	assert.Equal(t, uint32(123), res.LastModifiedLedger)
+
+	// a pair without trades and bids only has an ask
+	row = history.MarketStats{
+		BaseAssetID:    1,
+		CounterAssetID: 2,
+		BaseVolume:     "0",
+		CounterVolume:  "0",
+		AskN:           null.IntFrom(1),
+		AskD:           null.IntFrom(4),
+	}
+	res = protocol.MarketStats{}
+	assert.NoError(t, PopulateMarketStats(context.Background(), &res, row))
+	assert.Equal(t, "", res.Average)
+	assert.Equal(t, "", res.Open)
+	assert.Nil(t, res.OpenR)
+	assert.Equal(t, "", res.Bid)
+	assert.Equal(t, "0.2500000", res.Ask)
+	assert.Equal(t, "", res.Spread)
+}
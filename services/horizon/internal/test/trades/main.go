@@ -72,7 +72,18 @@ func IngestTestTrade(
 		BuyerAccountID:     accounts[buyer.Address()],
 		SellerAccountID:    accounts[seller.Address()],
 	})
-	return batch.Exec()
+	if err = batch.Exec(); err != nil {
+		return err
+	}
+
+	if err = q.Begin(); err != nil {
+		return err
+	}
+	defer q.Rollback()
+	if err = q.RebuildTradeAggregationTimes(timestamp, timestamp); err != nil {
+		return err
+	}
+	return q.Commit()
 }
 
 //PopulateTestTrades generates and ingests trades between two assets according to given parameters
@@ -6,12 +6,20 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
 
 	"github.com/stellar/go/historyarchive"
 	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lookup" {
+		lookup(os.Args[2:])
+		return
+	}
+
 	ledgerPtr := flag.Uint64("ledger", 0, "`ledger to analyze` (tip: has to be of the form `ledger = 64*n - 1`, where n is > 0)")
 	flag.Parse()
 	var seqNum uint32 = uint32(*ledgerPtr)
@@ -70,3 +78,60 @@ func archive() (*historyarchive.Archive, error) {
 		},
 	)
 }
+
+// lookup prints ledger entries of the given keys at a checkpoint. Keys are
+// account IDs or base64-encoded xdr.LedgerKeys.
+func lookup(args []string) {
+	flags := flag.NewFlagSet("lookup", flag.ExitOnError)
+	ledgerPtr := flags.Uint64("ledger", 0, "`checkpoint ledger` to look up the keys at")
+	indexDirPtr := flags.String("index-dir", "", "`directory` in which bucket indexes are stored, indexes are rebuilt on every run if unset")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s lookup -ledger LEDGER [-index-dir DIR] KEY...\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "KEY is an account ID or a base64-encoded LedgerKey.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	var seqNum uint32 = uint32(*ledgerPtr)
+
+	if seqNum == 0 || flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	keys := make([]xdr.LedgerKey, flags.NArg())
+	for i, arg := range flags.Args() {
+		if strkey.IsValidEd25519PublicKey(arg) {
+			err := keys[i].SetAccount(xdr.MustAddress(arg))
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if err := xdr.SafeUnmarshalBase64(arg, &keys[i]); err != nil {
+			log.Fatalf("invalid key %s: %v", arg, err)
+		}
+	}
+
+	archive, e := archive()
+	if e != nil {
+		panic(e)
+	}
+
+	l, e := ingest.NewLedgerEntryLookup(archive, *indexDirPtr)
+	if e != nil {
+		log.Fatal(e)
+	}
+	entries, e := l.GetLedgerEntries(context.Background(), seqNum, keys)
+	if e != nil {
+		log.Fatal(e)
+	}
+	for i, entry := range entries {
+		if entry == nil {
+			fmt.Printf("%s not found\n", flags.Arg(i))
+			continue
+		}
+		s, e := xdr.MarshalBase64(entry)
+		if e != nil {
+			log.Fatal(e)
+		}
+		fmt.Printf("%s %s\n", flags.Arg(i), s)
+	}
+}
@@ -5,15 +5,27 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/ingest/ledgerbackend"
 	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
 )
 
 const checkpointFrequency = uint32(64)
@@ -47,6 +59,18 @@ type Options struct {
 	Last        int
 	Recent      bool
 	Profile     bool
+	CacheSizeMB int64
+	// TrustedLedger is a SEQUENCE:HASH pair used by the verify command
+	TrustedLedger string
+	// Ledger backend options used by the publish command
+	MetaArchiveURL     string
+	BinaryPath         string
+	ConfigAppendPath   string
+	HistoryArchiveURLs string
+	// ManifestPath is the manifest of files copied by the mirror command
+	ManifestPath string
+	// Output is the output format of the diff and stats commands
+	Output      string
 	CommandOpts historyarchive.CommandOptions
 	ConnectOpts historyarchive.ConnectOptions
 }
@@ -122,11 +146,270 @@ func scan(a string, opts *Options) {
 	}
 }
 
+func verify(a string, opts *Options) {
+	if opts.TrustedLedger == "" {
+		log.Fatal("--trusted-ledger is required")
+	}
+	trusted, err := historyarchive.ParseTrustedLedger(opts.TrustedLedger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	arch := historyarchive.MustConnect(a, opts.ConnectOpts)
+	opts.SetRange(arch, nil)
+	log.Printf("verifying ledger chain of %v against trusted ledger %d\n", a, trusted.Sequence)
+	verified, err := historyarchive.VerifyLedgerChain(arch, trusted, opts.CommandOpts.Range)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Verified ledgers %d-%d are on the chain of trusted ledger %d", verified.Low, verified.High, trusted.Sequence)
+}
+
+func publish(dst string, opts *Options) {
+	dstArch := historyarchive.MustConnect(dst, opts.ConnectOpts)
+	writer, err := historyarchive.NewCheckpointWriter(dstArch, historyarchive.CheckpointWriterOptions{
+		NetworkPassphrase: opts.ConnectOpts.NetworkPassphrase,
+		Server:            "stellar-archivist",
+		StartLedger:       uint32(opts.Low),
+		CommandOptions:    opts.CommandOpts,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	start := writer.NextLedger()
+	if start > opts.High {
+		log.Printf("ledgers up to %d are already published", opts.High)
+		return
+	}
+	ledgerRange := ledgerbackend.UnboundedRange(start)
+	if opts.High != uint32(0xffffffff) {
+		// Only complete checkpoints are published so --high is rounded down
+		// to the last checkpoint ledger not after it.
+		manager := dstArch.GetCheckpointManager()
+		high := opts.High
+		if !manager.IsCheckpoint(high) {
+			high = manager.GetCheckpointRange(high).Low - 1
+		}
+		if high < start {
+			log.Printf("no complete checkpoint between ledgers %d and %d to publish", start, opts.High)
+			return
+		}
+		ledgerRange = ledgerbackend.BoundedRange(start, high)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	var backend ledgerbackend.LedgerBackend
+	if opts.MetaArchiveURL != "" {
+		backend, err = ledgerbackend.NewMetaArchiveBackend(opts.MetaArchiveURL, historyarchive.ConnectOptions{
+			Context: ctx,
+		})
+	} else {
+		backend, err = ledgerbackend.NewCaptive(ledgerbackend.CaptiveCoreConfig{
+			BinaryPath:          opts.BinaryPath,
+			ConfigAppendPath:    opts.ConfigAppendPath,
+			NetworkPassphrase:   opts.ConnectOpts.NetworkPassphrase,
+			HistoryArchiveURLs:  strings.Split(opts.HistoryArchiveURLs, ","),
+			CheckpointFrequency: checkpointFrequency,
+			Context:             ctx,
+		})
+	}
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "error creating ledger backend"))
+	}
+	defer backend.Close()
+
+	stream, err := ingest.NewLedgerStream(ingest.LedgerStreamConfig{
+		Backend:           backend,
+		NetworkPassphrase: opts.ConnectOpts.NetworkPassphrase,
+		Range:             ledgerRange,
+		BufferSize:        100,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("publishing ledgers from %d to %v\n", start, dst)
+	err = stream.StreamLedgers(ctx, func(ledger xdr.LedgerCloseMeta) error {
+		if err := writer.AddLedger(ledger); err != nil {
+			return err
+		}
+		if dstArch.GetCheckpointManager().IsCheckpoint(ledger.LedgerSequence()) {
+			log.Printf("published checkpoint %d", ledger.LedgerSequence())
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "error publishing ledgers"))
+	}
+}
+
+// diffEntry is the JSON output of the diff command. Keys and entries are
+// base64-encoded XDR.
+type diffEntry struct {
+	Type string `json:"type"`
+	Key  string `json:"key"`
+	Pre  string `json:"pre,omitempty"`
+	Post string `json:"post,omitempty"`
+}
+
+func newDiffEntry(entry ingest.BucketListDiffEntry) (diffEntry, error) {
+	var result diffEntry
+	switch entry.Type {
+	case xdr.LedgerEntryChangeTypeLedgerEntryCreated:
+		result.Type = "created"
+	case xdr.LedgerEntryChangeTypeLedgerEntryUpdated:
+		result.Type = "updated"
+	case xdr.LedgerEntryChangeTypeLedgerEntryRemoved:
+		result.Type = "removed"
+	}
+
+	var err error
+	if result.Key, err = xdr.MarshalBase64(entry.Key); err != nil {
+		return result, errors.Wrap(err, "error encoding ledger key")
+	}
+	if entry.Pre != nil {
+		if result.Pre, err = xdr.MarshalBase64(entry.Pre); err != nil {
+			return result, errors.Wrap(err, "error encoding ledger entry")
+		}
+	}
+	if entry.Post != nil {
+		if result.Post, err = xdr.MarshalBase64(entry.Post); err != nil {
+			return result, errors.Wrap(err, "error encoding ledger entry")
+		}
+	}
+	return result, nil
+}
+
+func diff(a string, from, to uint32, opts *Options) {
+	if opts.Output != "json" && opts.Output != "xdr" {
+		log.Fatal("--output must be json or xdr")
+	}
+	arch := historyarchive.MustConnect(a, opts.ConnectOpts)
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	encoder := json.NewEncoder(out)
+	err := ingest.DiffCheckpoints(context.Background(), arch, from, to, func(entry ingest.BucketListDiffEntry) error {
+		if opts.Output == "xdr" {
+			for _, change := range entry.LedgerEntryChanges() {
+				if err := xdr.MarshalFramed(out, change); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		result, err := newDiffEntry(entry)
+		if err != nil {
+			return err
+		}
+		return encoder.Encode(result)
+	})
+	if err != nil {
+		out.Flush()
+		log.Fatal(err)
+	}
+}
+
+func stats(a string, opts *Options) {
+	if opts.Output != "json" && opts.Output != "csv" {
+		log.Fatal("--output must be json or csv")
+	}
+	arch := historyarchive.MustConnect(a, opts.ConnectOpts)
+	opts.SetRange(arch, nil)
+	stats, err := historyarchive.CollectCheckpointStats(arch, &opts.CommandOpts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	if opts.Output == "csv" {
+		err = writeStatsCSV(out, stats)
+	} else {
+		encoder := json.NewEncoder(out)
+		for _, s := range stats {
+			if err = encoder.Encode(s); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		out.Flush()
+		log.Fatal(err)
+	}
+}
+
+// writeStatsCSV writes a row per checkpoint with a column for every
+// operation type found in the stats.
+func writeStatsCSV(out io.Writer, stats []historyarchive.CheckpointStats) error {
+	var operationTypes []string
+	seen := map[string]bool{}
+	for _, s := range stats {
+		for operationType := range s.OperationTypes {
+			if !seen[operationType] {
+				seen[operationType] = true
+				operationTypes = append(operationTypes, operationType)
+			}
+		}
+	}
+	sort.Strings(operationTypes)
+
+	w := csv.NewWriter(out)
+	header := []string{
+		"checkpoint", "ledgers", "transactions", "failed_transactions", "operations", "fee_charged",
+		"first_close_time", "last_close_time", "average_close_time", "buckets", "buckets_size",
+	}
+	if err := w.Write(append(header, operationTypes...)); err != nil {
+		return err
+	}
+	for _, s := range stats {
+		row := []string{
+			strconv.FormatUint(uint64(s.Checkpoint), 10),
+			strconv.Itoa(s.Ledgers),
+			strconv.Itoa(s.Transactions),
+			strconv.Itoa(s.FailedTransactions),
+			strconv.Itoa(s.Operations),
+			strconv.FormatInt(s.FeeCharged, 10),
+			strconv.FormatInt(s.FirstCloseTime, 10),
+			strconv.FormatInt(s.LastCloseTime, 10),
+			strconv.FormatFloat(s.AverageCloseTime, 'f', -1, 64),
+			strconv.Itoa(s.Buckets),
+			strconv.FormatInt(s.BucketsSize, 10),
+		}
+		for _, operationType := range operationTypes {
+			row = append(row, strconv.Itoa(s.OperationTypes[operationType]))
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
 func mirror(src string, dst string, opts *Options) {
 	srcArch := historyarchive.MustConnect(src, opts.ConnectOpts)
 	dstArch := historyarchive.MustConnect(dst, opts.ConnectOpts)
 	opts.SetRange(srcArch, dstArch)
 	log.Printf("mirroring %v -> %v\n", src, dst)
+	if opts.ManifestPath != "" {
+		manifest, err := historyarchive.OpenMirrorManifest(opts.ManifestPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer manifest.Close()
+		log.Printf("using manifest %s with %d copied files\n", opts.ManifestPath, manifest.Len())
+		opts.CommandOpts.Manifest = manifest
+	}
 	e := historyarchive.Mirror(srcArch, dstArch, &opts.CommandOpts)
 	if e != nil {
 		log.Fatal(e)
@@ -144,6 +427,22 @@ func repair(src string, dst string, opts *Options) {
 	}
 }
 
+func prune(a string, opts *Options) {
+	if opts.Low == 0 && opts.Last == -1 {
+		log.Fatal("prune requires --low or --last to set the retained ledgers")
+	}
+	if !opts.CommandOpts.NotPublished {
+		log.Fatal("prune requires --not-published: buckets of a checkpoint being published would be removed")
+	}
+	arch := historyarchive.MustConnect(a, opts.ConnectOpts)
+	opts.SetRange(arch, nil)
+	log.Printf("pruning %v before ledger %d\n", a, opts.CommandOpts.Range.Low)
+	e := historyarchive.Prune(arch, opts.CommandOpts.Range.Low, &opts.CommandOpts)
+	if e != nil {
+		log.Fatal(e)
+	}
+}
+
 func main() {
 
 	var opts Options
@@ -209,6 +508,41 @@ func main() {
 		"S3 endpoint to use",
 	)
 
+	rootCmd.PersistentFlags().StringVar(
+		&opts.ConnectOpts.GCSEndpoint,
+		"gcsendpoint",
+		"",
+		"Google Cloud Storage endpoint to use",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&opts.ConnectOpts.AzureEndpoint,
+		"azureendpoint",
+		"",
+		"Azure Blob Storage endpoint to use",
+	)
+
+	rootCmd.PersistentFlags().BoolVar(
+		&opts.ConnectOpts.UnsignedRequests,
+		"unsigned",
+		false,
+		"send unauthenticated requests to S3, GCS and Azure",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&opts.ConnectOpts.CachePath,
+		"cachepath",
+		"",
+		"local directory in which files read from archives are cached",
+	)
+
+	rootCmd.PersistentFlags().Int64Var(
+		&opts.CacheSizeMB,
+		"cachesize",
+		10240,
+		"maximum size of the cache in MB",
+	)
+
 	rootCmd.PersistentFlags().BoolVarP(
 		&opts.CommandOpts.DryRun,
 		"dryrun",
@@ -239,6 +573,69 @@ func main() {
 		"decode and re-encode all buckets",
 	)
 
+	rootCmd.PersistentFlags().StringVar(
+		&opts.TrustedLedger,
+		"trusted-ledger",
+		"",
+		"trusted ledger as SEQUENCE:HASH to verify the ledger chain against",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&opts.ConnectOpts.NetworkPassphrase,
+		"network-passphrase",
+		"",
+		"network passphrase of archives, written to HAS files by publish",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&opts.MetaArchiveURL,
+		"meta-archive-url",
+		"",
+		"meta archive to read ledgers published by publish from, captive core is used if unset",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&opts.BinaryPath,
+		"stellar-core-binary-path",
+		"",
+		"path to stellar-core binary used by publish to run captive core",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&opts.ConfigAppendPath,
+		"captive-core-config-append-path",
+		"",
+		"path to captive core config file used by publish",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&opts.HistoryArchiveURLs,
+		"history-archive-urls",
+		"",
+		"comma-separated list of history archives used by captive core in publish",
+	)
+
+	rootCmd.PersistentFlags().BoolVar(
+		&opts.CommandOpts.NotPublished,
+		"not-published",
+		false,
+		"confirm that no stellar-core publishes to the archive being pruned",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&opts.ManifestPath,
+		"manifest",
+		"",
+		"local file recording files copied by mirror, copied files are skipped in later runs",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&opts.Output,
+		"output",
+		"json",
+		"output format of diff: json or xdr (framed LedgerEntryChanges), and of stats: json or csv",
+	)
+
 	rootCmd.PersistentFlags().BoolVar(
 		&opts.Profile,
 		"profile",
@@ -246,6 +643,10 @@ func main() {
 		"collect and serve profile locally",
 	)
 
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		opts.ConnectOpts.CacheMaxSize = opts.CacheSizeMB << 20
+	}
+
 	rootCmd.AddCommand(&cobra.Command{
 		Use: "status",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -269,6 +670,49 @@ func main() {
 		},
 	})
 
+	rootCmd.AddCommand(&cobra.Command{
+		Use: "verify",
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.MaybeProfile()
+			verify(firstArg(args), &opts)
+		},
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use: "publish",
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.MaybeProfile()
+			publish(firstArg(args), &opts)
+		},
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use: "diff",
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.MaybeProfile()
+			if len(args) != 3 {
+				log.Fatal("require exactly 3 arguments: archive, from and to checkpoint ledgers")
+			}
+			from, err := strconv.ParseUint(args[1], 10, 32)
+			if err != nil {
+				log.Fatal(errors.Wrap(err, "invalid from ledger"))
+			}
+			to, err := strconv.ParseUint(args[2], 10, 32)
+			if err != nil {
+				log.Fatal(errors.Wrap(err, "invalid to ledger"))
+			}
+			diff(args[0], uint32(from), uint32(to), &opts)
+		},
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use: "stats",
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.MaybeProfile()
+			stats(firstArg(args), &opts)
+		},
+	})
+
 	rootCmd.AddCommand(&cobra.Command{
 		Use: "mirror",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -287,6 +731,14 @@ func main() {
 		},
 	})
 
+	rootCmd.AddCommand(&cobra.Command{
+		Use: "prune",
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.MaybeProfile()
+			prune(firstArg(args), &opts)
+		},
+	})
+
 	rootCmd.AddCommand(&cobra.Command{
 		Use: "dumpxdr",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -5,9 +5,13 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
 
 	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -46,3 +50,72 @@ func TestRecentOption(t *testing.T) {
 	assert.Equal(t, uint32(0x3f), opts.CommandOpts.Range.Low)
 	assert.Equal(t, uint32(0xbf), opts.CommandOpts.Range.High)
 }
+
+func TestWriteStatsCSV(t *testing.T) {
+	var out bytes.Buffer
+	err := writeStatsCSV(&out, []historyarchive.CheckpointStats{
+		{
+			Checkpoint:       63,
+			Ledgers:          63,
+			Transactions:     3,
+			Operations:       4,
+			OperationTypes:   map[string]int{"OperationTypePayment": 4},
+			FeeCharged:       300,
+			FirstCloseTime:   1000,
+			LastCloseTime:    1310,
+			AverageCloseTime: 5,
+		},
+		{
+			Checkpoint:         127,
+			Ledgers:            64,
+			Transactions:       2,
+			FailedTransactions: 1,
+			Operations:         2,
+			OperationTypes:     map[string]int{"OperationTypeBumpSequence": 1, "OperationTypePayment": 1},
+			FeeCharged:         200,
+			FirstCloseTime:     1315,
+			LastCloseTime:      1635,
+			AverageCloseTime:   5.079365079365079,
+			Buckets:            2,
+			BucketsSize:        2048,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "checkpoint,ledgers,transactions,failed_transactions,operations,fee_charged,"+
+		"first_close_time,last_close_time,average_close_time,buckets,buckets_size,"+
+		"OperationTypeBumpSequence,OperationTypePayment\n"+
+		"63,63,3,0,4,300,1000,1310,5,0,0,0,4\n"+
+		"127,64,2,1,2,200,1315,1635,5.079365079365079,2,2048,1,1\n", out.String())
+}
+
+func TestNewDiffEntry(t *testing.T) {
+	account := xdr.MustAddress("GC3C4AKRBQLHOJ45U4XG35ESVWRDECWO5XLDGYADO6DPR3L7KIDVUMML")
+	var key xdr.LedgerKey
+	assert.NoError(t, key.SetAccount(account))
+	post := &xdr.LedgerEntry{
+		Data: xdr.LedgerEntryData{
+			Type:    xdr.LedgerEntryTypeAccount,
+			Account: &xdr.AccountEntry{AccountId: account, Balance: 10},
+		},
+	}
+
+	entry, err := newDiffEntry(ingest.BucketListDiffEntry{
+		Type: xdr.LedgerEntryChangeTypeLedgerEntryCreated,
+		Key:  key,
+		Post: post,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "created", entry.Type)
+	assert.Empty(t, entry.Pre)
+
+	var decodedKey xdr.LedgerKey
+	assert.NoError(t, xdr.SafeUnmarshalBase64(entry.Key, &decodedKey))
+	assert.Equal(t, account.Address(), decodedKey.Account.AccountId.Address())
+	var decodedPost xdr.LedgerEntry
+	assert.NoError(t, xdr.SafeUnmarshalBase64(entry.Post, &decodedPost))
+	assert.Equal(t, xdr.Int64(10), decodedPost.Data.Account.Balance)
+
+	b, err := json.Marshal(entry)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"type":"created","key":"`+entry.Key+`","post":"`+entry.Post+`"}`, string(b))
+}